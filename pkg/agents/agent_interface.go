@@ -3,12 +3,14 @@ package agents
 import (
 	"context"
 
+	"github.com/yubing744/trading-gpt/pkg/llms/usage"
 	"github.com/yubing744/trading-gpt/pkg/types"
 )
 
 type GenResult struct {
 	Texts []string
 	Model string
+	Usage *usage.TokenUsage
 }
 
 type IAgent interface {
@@ -0,0 +1,169 @@
+package trading
+
+import (
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// MessageOverhead is the number of tokens a chat message costs besides its text
+const MessageOverhead = 4
+
+// ImageTokens is the approximate cost of an attached chart image, vision
+// models bill images by size and a 1024x640 image is about 1k tokens
+const ImageTokens = 1000
+
+// shrinkOrder lists the sections from the lowest priority, they are shrunk in
+// this order when the prompt is over budget. Messages without a section are
+// never shrunk.
+var shrinkOrder = []string{
+	types.SectionHistory,
+	types.SectionNews,
+	types.SectionCommands,
+	types.SectionEpisodes,
+	types.SectionKnowledge,
+	types.SectionIndicators,
+	types.SectionKlines,
+	types.SectionMemory,
+}
+
+// ContextBudget fits prompt messages into the input token budget
+type ContextBudget struct {
+	tokenizer tokenizer.Tokenizer
+	maxInput  int
+	limits    map[string]int
+}
+
+func NewContextBudget(tok tokenizer.Tokenizer, maxInput int, cfg *config.ContextBudgetConfig) *ContextBudget {
+	return &ContextBudget{
+		tokenizer: tok,
+		maxInput:  maxInput,
+		limits: map[string]int{
+			types.SectionKlines:     cfg.Klines,
+			types.SectionIndicators: cfg.Indicators,
+			types.SectionNews:       cfg.News,
+			types.SectionMemory:     cfg.Memory,
+			types.SectionHistory:    cfg.History,
+			types.SectionEpisodes:   cfg.Episodes,
+			types.SectionKnowledge:  cfg.Knowledge,
+			types.SectionCommands:   cfg.Commands,
+		},
+	}
+}
+
+// Fit returns a copy of msgs with every section within its cap and the total,
+// including the reserved tokens, within the input budget if possible. It also
+// returns the resulting input tokens.
+func (b *ContextBudget) Fit(msgs []*types.Message, reserved int) ([]*types.Message, int) {
+	fitted := make([]*types.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		copied := *msg
+		fitted = append(fitted, &copied)
+	}
+
+	for _, section := range shrinkOrder {
+		limit := b.limits[section]
+		if limit > 0 && b.sectionTokens(fitted, section) > limit {
+			b.shrinkSection(fitted, section, limit)
+		}
+	}
+
+	for _, section := range shrinkOrder {
+		total := reserved + b.sectionTokens(fitted, "")
+		if b.maxInput <= 0 || total <= b.maxInput {
+			break
+		}
+
+		sectionTokens := b.sectionTokens(fitted, section)
+		if sectionTokens == 0 {
+			continue
+		}
+
+		target := sectionTokens - (total - b.maxInput)
+		if target < 0 {
+			target = 0
+		}
+
+		log.WithField("section", section).
+			WithField("tokens", sectionTokens).
+			WithField("target", target).
+			Info("shrink prompt section to fit context budget")
+
+		b.shrinkSection(fitted, section, target)
+	}
+
+	results := make([]*types.Message, 0, len(fitted))
+	for _, msg := range fitted {
+		if msg.Text != "" {
+			results = append(results, msg)
+		}
+	}
+
+	return results, reserved + b.sectionTokens(results, "")
+}
+
+// Count returns the tokens of a single message
+func (b *ContextBudget) Count(text string) int {
+	return b.tokenizer.Count(text) + MessageOverhead
+}
+
+// sectionTokens counts the tokens of a section, an empty section counts all messages
+func (b *ContextBudget) sectionTokens(msgs []*types.Message, section string) int {
+	total := 0
+	for _, msg := range msgs {
+		if msg.Text != "" && (section == "" || msg.Section == section) {
+			total += b.Count(msg.Text)
+		}
+	}
+
+	return total
+}
+
+// shrinkSection reduces a section to at most target tokens. History, news and
+// episodes drop their messages in order, so the oldest history and news and
+// the least similar episodes go first. The other sections trim every message
+// proportionally: klines and indicators keep their tail, so each series keeps
+// its latest values, while memory, knowledge and commands keep their head,
+// knowledge listing the most specific scope first.
+func (b *ContextBudget) shrinkSection(msgs []*types.Message, section string, target int) {
+	members := make([]*types.Message, 0)
+	for _, msg := range msgs {
+		if msg.Section == section && msg.Text != "" {
+			members = append(members, msg)
+		}
+	}
+
+	switch section {
+	case types.SectionHistory, types.SectionNews, types.SectionEpisodes:
+		total := b.sectionTokens(members, "")
+		for _, msg := range members {
+			if total <= target {
+				return
+			}
+
+			cost := b.Count(msg.Text)
+			if total-cost >= target {
+				msg.Text = ""
+				total -= cost
+				continue
+			}
+
+			msg.Text = tokenizer.KeepTail(b.tokenizer, msg.Text, target-(total-cost)-MessageOverhead)
+			return
+		}
+	default:
+		total := b.sectionTokens(members, "")
+		if total == 0 {
+			return
+		}
+
+		for _, msg := range members {
+			share := b.Count(msg.Text) * target / total
+			if section == types.SectionMemory || section == types.SectionKnowledge || section == types.SectionCommands {
+				msg.Text = tokenizer.KeepHead(b.tokenizer, msg.Text, share-MessageOverhead)
+			} else {
+				msg.Text = tokenizer.KeepTail(b.tokenizer, msg.Text, share-MessageOverhead)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package trading
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func newTestMessages() []*types.Message {
+	return []*types.Message{
+		{Text: "news 1: " + strings.Repeat("a", 100), Section: types.SectionNews},
+		{Text: "news 2: " + strings.Repeat("b", 100), Section: types.SectionNews},
+		{Text: "KLine data changed:\n" + strings.Repeat("1.00 2.00 3.00\n", 20), Section: types.SectionKlines},
+		{Text: "RSI data changed: [" + strings.Repeat("50.1 ", 40) + "]", Section: types.SectionIndicators},
+		{Text: "The current position is long"},
+		{Text: "Analyze data, generate trading cmd"},
+	}
+}
+
+func TestContextBudgetWithinBudget(t *testing.T) {
+	tok := tokenizer.NewApproxTokenizer("test", 1, 1, 1)
+	budget := NewContextBudget(tok, 100000, &config.ContextBudgetConfig{})
+
+	msgs := newTestMessages()
+	fitted, _ := budget.Fit(msgs, 10)
+
+	assert.Equal(t, len(msgs), len(fitted))
+	for i := range msgs {
+		assert.Equal(t, msgs[i].Text, fitted[i].Text)
+	}
+}
+
+func TestContextBudgetSectionLimit(t *testing.T) {
+	tok := tokenizer.NewApproxTokenizer("test", 1, 1, 1)
+	budget := NewContextBudget(tok, 0, &config.ContextBudgetConfig{
+		Klines: 100,
+	})
+
+	msgs := newTestMessages()
+	fitted, _ := budget.Fit(msgs, 0)
+
+	for _, msg := range fitted {
+		if msg.Section == types.SectionKlines {
+			assert.LessOrEqual(t, budget.Count(msg.Text), 100)
+			assert.True(t, strings.HasPrefix(msg.Text, "KLine data changed:"))
+		}
+	}
+
+	// Input messages are not modified
+	assert.Equal(t, newTestMessages()[2].Text, msgs[2].Text)
+}
+
+func TestContextBudgetShrinksLowestPriorityFirst(t *testing.T) {
+	tok := tokenizer.NewApproxTokenizer("test", 1, 1, 1)
+	msgs := newTestMessages()
+
+	full := 0
+	for _, msg := range msgs {
+		full += tok.Count(msg.Text) + MessageOverhead
+	}
+
+	// Over budget by exactly the oldest news
+	oldest := tok.Count(msgs[0].Text) + MessageOverhead
+	budget := NewContextBudget(tok, full-oldest, &config.ContextBudgetConfig{})
+	fitted, tokens := budget.Fit(msgs, 0)
+
+	assert.LessOrEqual(t, tokens, full-oldest)
+	assert.Equal(t, types.SectionNews, fitted[0].Section)
+	assert.True(t, strings.HasPrefix(fitted[0].Text, "news 2"))
+	assert.Equal(t, msgs[2].Text, fitted[1].Text)
+	assert.Equal(t, msgs[3].Text, fitted[2].Text)
+
+	// A tight budget shrinks klines and indicators but keeps unsectioned messages
+	budget = NewContextBudget(tok, 150, &config.ContextBudgetConfig{})
+	fitted, tokens = budget.Fit(msgs, 0)
+
+	assert.LessOrEqual(t, tokens, 150)
+	assert.Equal(t, "Analyze data, generate trading cmd", fitted[len(fitted)-1].Text)
+	assert.Equal(t, "The current position is long", fitted[len(fitted)-2].Text)
+}
@@ -11,6 +11,10 @@ import (
 
 	"github.com/yubing744/trading-gpt/pkg/agents"
 	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/promptcache"
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/llms/usage"
 	"github.com/yubing744/trading-gpt/pkg/types"
 )
 
@@ -26,12 +30,20 @@ type TradingAgent struct {
 	model            string
 	temperature      float32
 	maxContextLength int
+	maxOutputTokens  int
+	contextBudget    config.ContextBudgetConfig
+	tokenizer        tokenizer.Tokenizer
 	backgroup        string
 	chats            []string
 	actions          map[string]*types.ActionDesc
 }
 
 func NewTradingAgent(cfg *config.TradingAgentConfig, llm llms.Model) *TradingAgent {
+	maxOutputTokens := cfg.MaxOutputTokens
+	if maxOutputTokens <= 0 {
+		maxOutputTokens = cfg.MaxContextLength / 4
+	}
+
 	return &TradingAgent{
 		llm:              llm,
 		name:             cfg.Name,
@@ -41,7 +53,24 @@ func NewTradingAgent(cfg *config.TradingAgentConfig, llm llms.Model) *TradingAge
 		chats:            make([]string, 0),
 		actions:          make(map[string]*types.ActionDesc, 0),
 		maxContextLength: cfg.MaxContextLength,
+		maxOutputTokens:  maxOutputTokens,
+		contextBudget:    cfg.ContextBudget,
+		tokenizer:        tokenizer.ForProvider(cfg.LLM, cfg.Model),
+	}
+}
+
+// SetTokenizer sets the tokenizer used to measure prompts, it should match the LLM provider
+func (a *TradingAgent) SetTokenizer(tok tokenizer.Tokenizer) {
+	a.tokenizer = tok
+}
+
+// maxInputTokens is the token budget left for the prompt, 0 means unlimited
+func (a *TradingAgent) maxInputTokens() int {
+	if a.maxContextLength <= 0 {
+		return 0
 	}
+
+	return a.maxContextLength - a.maxOutputTokens
 }
 
 func (agent *TradingAgent) toPrompt(msgs []*types.Message) string {
@@ -57,14 +86,16 @@ func (agent *TradingAgent) toPrompt(msgs []*types.Message) string {
 	return builder.String()
 }
 
-func (agent *TradingAgent) splitChatsByLength(sessionChats []string, maxLength int) []string {
-	length := 0
+// splitChatsByLength returns the latest chats that fit in maxTokens
+func (agent *TradingAgent) splitChatsByLength(sessionChats []string, maxTokens int) []string {
+	tokens := 0
 
 	for i := len(sessionChats) - 1; i >= 0; i-- {
-		if length+len(sessionChats[i])+1 > maxLength {
+		cost := agent.tokenizer.Count(sessionChats[i]) + 1
+		if tokens+cost > maxTokens {
 			return sessionChats[i+1:]
 		} else {
-			length = length + len(sessionChats[i]) + 1
+			tokens = tokens + cost
 		}
 	}
 
@@ -91,28 +122,28 @@ func (agent *TradingAgent) GenPrompt(sessionChats []string, msgs []*types.Messag
 		builder.WriteString("\n")
 	}
 
-	eventPrompt := agent.toPrompt(msgs)
+	maxInput := agent.maxInputTokens()
+	budget := NewContextBudget(agent.tokenizer, maxInput, &agent.contextBudget)
+	fitted, _ := budget.Fit(msgs, agent.tokenizer.Count(builder.String()))
+	eventPrompt := agent.toPrompt(fitted)
 
-	if builder.Len()+len(eventPrompt) > agent.maxContextLength {
-		return "", errors.Errorf("Current msgs too long, current: %d, left: %d", len(eventPrompt), agent.maxContextLength-builder.Len())
+	used := agent.tokenizer.Count(builder.String()) + agent.tokenizer.Count(eventPrompt)
+	if maxInput > 0 && used > maxInput {
+		return "", errors.Errorf("Current msgs too long, current: %d tokens, max: %d tokens", used, maxInput)
 	}
 
-	subChats := agent.splitChatsByLength(sessionChats, agent.maxContextLength-builder.Len()-len(eventPrompt))
+	if maxInput > 0 {
+		subChats := agent.splitChatsByLength(sessionChats, maxInput-used)
 
-	for _, chat := range subChats {
-		builder.WriteString(chat)
-		builder.WriteString("\n")
+		for _, chat := range subChats {
+			builder.WriteString(chat)
+			builder.WriteString("\n")
+		}
 	}
 
 	builder.WriteString(eventPrompt)
 
-	prompt := builder.String()
-
-	if len(prompt) > agent.maxContextLength {
-		return "", errors.Errorf("Gen prompt too long, current: %d, max: %d", len(prompt), agent.maxContextLength)
-	}
-
-	return prompt, nil
+	return builder.String(), nil
 }
 
 func (a *TradingAgent) GetName() string {
@@ -148,18 +179,25 @@ func (a *TradingAgent) Stop() {
 }
 
 func (a *TradingAgent) GenActions(ctx context.Context, session types.ISession, msgs []*types.Message) (*agents.GenResult, error) {
-	gptMsgs, err := a.GenLLMMessages(session.GetChats(), msgs)
+	gptMsgs, stablePrefix, err := a.genLLMMessages(session.GetChats(), msgs)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx = promptcache.WithStablePrefix(ctx, stablePrefix)
+	if task.FromContext(ctx) == "" {
+		ctx = task.WithTask(ctx, task.Decision)
+	}
+
 	log.
 		WithField("chatgpt msgs", gptMsgs).
 		Infof("gen chatgpt messages")
 
 	callOpts := make([]llms.CallOption, 0)
 	callOpts = append(callOpts, llms.WithTemperature(float64(a.temperature)))
-	callOpts = append(callOpts, llms.WithMaxTokens(a.maxContextLength))
+	if a.maxOutputTokens > 0 {
+		callOpts = append(callOpts, llms.WithMaxTokens(a.maxOutputTokens))
+	}
 
 	// Request JSON mode to reduce malformed JSON responses
 	callOpts = append(callOpts, llms.WithJSONMode())
@@ -191,6 +229,11 @@ func (a *TradingAgent) GenActions(ctx context.Context, session types.ISession, m
 				result.Model = model.(string)
 			}
 		}
+
+		result.Usage = usage.NewTokenUsage(extInfo)
+		if result.Usage != nil {
+			log.WithField("usage", result.Usage).Info("token usage")
+		}
 	}
 
 	if len(result.Texts) > 0 {
@@ -205,6 +248,13 @@ func (a *TradingAgent) GenActions(ctx context.Context, session types.ISession, m
 }
 
 func (agent *TradingAgent) GenLLMMessages(sessionChats []string, msgs []*types.Message) ([]llms.MessageContent, error) {
+	llmMsgs, _, err := agent.genLLMMessages(sessionChats, msgs)
+	return llmMsgs, err
+}
+
+// genLLMMessages also returns the number of leading messages that are the
+// same every cycle: the system prompt and the instructions
+func (agent *TradingAgent) genLLMMessages(sessionChats []string, msgs []*types.Message) ([]llms.MessageContent, int, error) {
 	llmMsgs := make([]llms.MessageContent, 0)
 
 	// Backgougroup — append JSON instruction to satisfy providers
@@ -222,16 +272,91 @@ func (agent *TradingAgent) GenLLMMessages(sessionChats []string, msgs []*types.M
 		},
 	})
 
-	for _, msg := range msgs {
+	budget := NewContextBudget(agent.tokenizer, agent.maxInputTokens(), &agent.contextBudget)
+
+	// Recent conversation is only sent when it has a budget
+	inputMsgs := make([]*types.Message, 0, len(sessionChats)+len(msgs))
+	if agent.contextBudget.History > 0 {
+		for _, chat := range sessionChats {
+			inputMsgs = append(inputMsgs, &types.Message{
+				Text:    chat,
+				Section: types.SectionHistory,
+			})
+		}
+	}
+	inputMsgs = append(inputMsgs, msgs...)
+
+	// Images are never shrunk, their cost is reserved up front
+	reserved := budget.Count(systemPrompt)
+	for _, msg := range inputMsgs {
+		if msg.Image != nil {
+			reserved += ImageTokens
+		}
+	}
+
+	fitted, tokens := budget.Fit(inputMsgs, reserved)
+	if maxInput := agent.maxInputTokens(); maxInput > 0 && tokens > maxInput {
+		log.WithField("tokens", tokens).
+			WithField("max", maxInput).
+			Warn("prompt still over context budget after shrinking sections")
+	}
+
+	log.WithField("tokens", tokens).
+		WithField("tokenizer", agent.tokenizer.Name()).
+		Info("prompt tokens")
+
+	// Stable instructions go first, right after the system prompt
+	history := make([]string, 0)
+	for _, msg := range fitted {
+		switch msg.Section {
+		case types.SectionHistory:
+			history = append(history, msg.Text)
+		case types.SectionInstructions:
+			llmMsgs = append(llmMsgs, llms.MessageContent{
+				Role: llms.ChatMessageTypeHuman,
+				Parts: []llms.ContentPart{
+					llms.TextContent{
+						Text: msg.Text,
+					},
+				},
+			})
+		}
+	}
+
+	stablePrefix := len(llmMsgs)
+
+	if len(history) > 0 {
 		llmMsgs = append(llmMsgs, llms.MessageContent{
 			Role: llms.ChatMessageTypeHuman,
 			Parts: []llms.ContentPart{
 				llms.TextContent{
-					Text: msg.Text,
+					Text: "Recent conversation:\n" + strings.Join(history, "\n"),
 				},
 			},
 		})
 	}
 
-	return llmMsgs, nil
+	for _, msg := range fitted {
+		if msg.Section == types.SectionHistory || msg.Section == types.SectionInstructions {
+			continue
+		}
+
+		parts := make([]llms.ContentPart, 0, 2)
+		if msg.Image != nil {
+			parts = append(parts, llms.BinaryContent{
+				MIMEType: msg.Image.MIMEType,
+				Data:     msg.Image.Data,
+			})
+		}
+		parts = append(parts, llms.TextContent{
+			Text: msg.Text,
+		})
+
+		llmMsgs = append(llmMsgs, llms.MessageContent{
+			Role:  llms.ChatMessageTypeHuman,
+			Parts: parts,
+		})
+	}
+
+	return llmMsgs, stablePrefix, nil
 }
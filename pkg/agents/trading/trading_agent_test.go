@@ -0,0 +1,51 @@
+package trading
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func TestGenLLMMessagesPutsInstructionsFirst(t *testing.T) {
+	agent := NewTradingAgent(&config.TradingAgentConfig{
+		Name:             "AI",
+		MaxContextLength: 100000,
+		Backgroup:        "You are a trading assistant.",
+	}, nil)
+
+	msgs, stablePrefix, err := agent.genLLMMessages(nil, []*types.Message{
+		{Text: "KLine data changed: ...", Section: types.SectionKlines},
+		{Text: "Commands: ...", Section: types.SectionInstructions},
+		{Text: "Analyze the data provided above"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stablePrefix)
+	assert.Len(t, msgs, 4)
+	assert.Equal(t, llms.ChatMessageTypeSystem, msgs[0].Role)
+	assert.Equal(t, "Commands: ...", msgs[1].Parts[0].(llms.TextContent).Text)
+	assert.Equal(t, "KLine data changed: ...", msgs[2].Parts[0].(llms.TextContent).Text)
+	assert.Equal(t, "Analyze the data provided above", msgs[3].Parts[0].(llms.TextContent).Text)
+}
+
+func TestGenLLMMessagesAttachesImages(t *testing.T) {
+	agent := NewTradingAgent(&config.TradingAgentConfig{
+		Name:             "AI",
+		MaxContextLength: 100000,
+		Backgroup:        "You are a trading assistant.",
+	}, nil)
+
+	msgs, _, err := agent.genLLMMessages(nil, []*types.Message{
+		{Text: "KLine data changed: ...", Section: types.SectionKlines},
+		{Text: "Candlestick chart", Image: &types.Image{MIMEType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 3)
+	assert.Len(t, msgs[2].Parts, 2)
+	assert.Equal(t, llms.BinaryContent{MIMEType: "image/png", Data: []byte{0x89, 'P', 'N', 'G'}}, msgs[2].Parts[0])
+	assert.Equal(t, "Candlestick chart", msgs[2].Parts[1].(llms.TextContent).Text)
+}
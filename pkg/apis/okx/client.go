@@ -0,0 +1,233 @@
+package okx
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client implements the IOKXClient interface with the signed REST API
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	Secret     string
+	Passphrase string
+	HTTPClient *http.Client
+
+	now func() time.Time
+}
+
+// NewClient creates a new OKX API client with options
+func NewClient(baseURL, apiKey, secret, passphrase string, opts ...ClientOption) *Client {
+	c := &Client{
+		BaseURL:    baseURL,
+		APIKey:     apiKey,
+		Secret:     secret,
+		Passphrase: passphrase,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second, // default timeout
+		},
+		now: time.Now,
+	}
+
+	// Apply options
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// PlaceAlgoOrder places an algo order, such as an OCO order
+func (c *Client) PlaceAlgoOrder(ctx context.Context, req *AlgoOrderRequest) (*AlgoOrder, error) {
+	var orders []AlgoOrder
+	err := c.do(ctx, http.MethodPost, "/api/v5/trade/order-algo", nil, req, &orders)
+	if itemErr := algoOrderError(orders); itemErr != nil {
+		return nil, itemErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("place algo order: empty response")
+	}
+
+	return &orders[0], nil
+}
+
+// CancelAlgoOrders cancels algo orders
+func (c *Client) CancelAlgoOrders(ctx context.Context, reqs []CancelAlgoRequest) error {
+	var results []AlgoOrder
+	err := c.do(ctx, http.MethodPost, "/api/v5/trade/cancel-algos", nil, reqs, &results)
+	if itemErr := algoOrderError(results); itemErr != nil {
+		return itemErr
+	}
+
+	return err
+}
+
+// SetLeverage sets the leverage of an instrument
+func (c *Client) SetLeverage(ctx context.Context, req *SetLeverageRequest) error {
+	return c.do(ctx, http.MethodPost, "/api/v5/account/set-leverage", nil, req, nil)
+}
+
+// SetPositionMode sets the position mode of the account, net_mode or long_short_mode
+func (c *Client) SetPositionMode(ctx context.Context, mode string) error {
+	req := map[string]string{"posMode": mode}
+	return c.do(ctx, http.MethodPost, "/api/v5/account/set-position-mode", nil, req, nil)
+}
+
+// PlaceOrders places a batch of orders, the results are in the order of the requests
+func (c *Client) PlaceOrders(ctx context.Context, reqs []OrderRequest) ([]OrderResult, error) {
+	var results []OrderResult
+	err := c.do(ctx, http.MethodPost, "/api/v5/trade/batch-orders", nil, reqs, &results)
+
+	// Orders of a partially failed batch are placed, the results tell which
+	for _, result := range results {
+		if result.SCode != "" && result.SCode != "0" {
+			return results, &APIError{Code: result.SCode, Message: result.SMsg}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// QueryBills returns the account bills, newest first
+func (c *Client) QueryBills(ctx context.Context, req *BillsRequest) ([]Bill, error) {
+	query := url.Values{}
+	if req.InstType != "" {
+		query.Set("instType", req.InstType)
+	}
+	if req.InstID != "" {
+		query.Set("instId", req.InstID)
+	}
+	if req.Type != "" {
+		query.Set("type", req.Type)
+	}
+	if !req.Begin.IsZero() {
+		query.Set("begin", strconv.FormatInt(req.Begin.UnixMilli(), 10))
+	}
+	if req.After != "" {
+		query.Set("after", req.After)
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+
+	var bills []Bill
+	if err := c.do(ctx, http.MethodGet, "/api/v5/account/bills", query, nil, &bills); err != nil {
+		return nil, err
+	}
+
+	return bills, nil
+}
+
+// QueryPositions returns the open positions of the instrument type and instrument
+func (c *Client) QueryPositions(ctx context.Context, instType, instID string) ([]Position, error) {
+	query := url.Values{}
+	if instType != "" {
+		query.Set("instType", instType)
+	}
+	if instID != "" {
+		query.Set("instId", instID)
+	}
+
+	var positions []Position
+	if err := c.do(ctx, http.MethodGet, "/api/v5/account/positions", query, nil, &positions); err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+// do sends a signed request and decodes the data of the response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	requestPath := path
+	if len(query) > 0 {
+		requestPath += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.BaseURL+requestPath, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := c.now().UTC().Format("2006-01-02T15:04:05.000Z")
+	httpReq.Header.Set("OK-ACCESS-KEY", c.APIKey)
+	httpReq.Header.Set("OK-ACCESS-SIGN", c.sign(timestamp+method+requestPath+string(payload)))
+	httpReq.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+	httpReq.Header.Set("OK-ACCESS-PASSPHRASE", c.Passphrase)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	result := response{Data: out}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &HTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		}
+
+		return fmt.Errorf("failed to decode response: %w, body: %s", err, string(respBody))
+	}
+
+	// The data is decoded on errors too, failed items carry their own sCode
+	if result.Code != "0" {
+		return &APIError{Code: result.Code, Message: result.Message}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return nil
+}
+
+// algoOrderError returns the error of the first failed algo order of a response
+func algoOrderError(orders []AlgoOrder) error {
+	for _, order := range orders {
+		if order.SCode != "" && order.SCode != "0" {
+			return &APIError{Code: order.SCode, Message: order.SMsg}
+		}
+	}
+
+	return nil
+}
+
+// sign returns the base64 HMAC-SHA256 of the prehash string with the secret
+func (c *Client) sign(prehash string) string {
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(prehash))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,258 @@
+package okx
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "test-key", "test-secret", "test-passphrase")
+	client.now = func() time.Time {
+		return time.Date(2026, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	}
+
+	return client
+}
+
+func expectedSign(prehash string) string {
+	mac := hmac.New(sha256.New, []byte("test-secret"))
+	mac.Write([]byte(prehash))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestPlaceAlgoOrder_Success(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v5/trade/order-algo" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		timestamp := "2026-01-02T03:04:05.006Z"
+		if r.Header.Get("OK-ACCESS-TIMESTAMP") != timestamp {
+			t.Errorf("Expected timestamp %s, got %s", timestamp, r.Header.Get("OK-ACCESS-TIMESTAMP"))
+		}
+		if r.Header.Get("OK-ACCESS-KEY") != "test-key" || r.Header.Get("OK-ACCESS-PASSPHRASE") != "test-passphrase" {
+			t.Errorf("Unexpected credentials headers %v", r.Header)
+		}
+
+		sign := expectedSign(timestamp + "POST/api/v5/trade/order-algo" + string(body))
+		if r.Header.Get("OK-ACCESS-SIGN") != sign {
+			t.Errorf("Expected sign %s, got %s", sign, r.Header.Get("OK-ACCESS-SIGN"))
+		}
+
+		var req AlgoOrderRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.OrderType != "oco" || req.Size != "1.5" || req.TpTriggerPx != "110" || req.SlOrdPx != "-1" {
+			t.Errorf("Unexpected request %+v", req)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"123","sCode":"0","sMsg":""}]}`))
+	})
+
+	order, err := client.PlaceAlgoOrder(context.Background(), &AlgoOrderRequest{
+		InstID:      "BTC-USDT",
+		TradeMode:   TradeModeCash,
+		Side:        "sell",
+		OrderType:   "oco",
+		Size:        "1.5",
+		TpTriggerPx: "110",
+		TpOrdPx:     "-1",
+		SlTriggerPx: "90",
+		SlOrdPx:     "-1",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if order.AlgoID != "123" {
+		t.Errorf("Expected algo id 123, got %s", order.AlgoID)
+	}
+}
+
+func TestPlaceAlgoOrder_ItemError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"1","msg":"Operation failed.","data":[{"algoId":"","sCode":"51008","sMsg":"Insufficient balance"}]}`))
+	})
+
+	_, err := client.PlaceAlgoOrder(context.Background(), &AlgoOrderRequest{InstID: "BTC-USDT"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+
+	if apiErr.Code != "51008" || apiErr.Message != "Insufficient balance" {
+		t.Errorf("Expected the item error, got %+v", apiErr)
+	}
+}
+
+func TestCancelAlgoOrders(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/trade/cancel-algos" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		var reqs []CancelAlgoRequest
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if len(reqs) != 1 || reqs[0].AlgoID != "123" || reqs[0].InstID != "BTC-USDT" {
+			t.Errorf("Unexpected request %+v", reqs)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"algoId":"123","sCode":"0","sMsg":""}]}`))
+	})
+
+	err := client.CancelAlgoOrders(context.Background(), []CancelAlgoRequest{{AlgoID: "123", InstID: "BTC-USDT"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestDo_HTTPError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`Unauthorized`))
+	})
+
+	err := client.CancelAlgoOrders(context.Background(), nil)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected HTTPError 401, got %v", err)
+	}
+}
+
+func TestSetLeverage(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/account/set-leverage" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		var req SetLeverageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.InstID != "BTC-USDT-SWAP" || req.Leverage != "5" || req.MarginMode != "cross" || req.PosSide != "long" {
+			t.Errorf("Unexpected request %+v", req)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","lever":"5","mgnMode":"cross","posSide":"long"}]}`))
+	})
+
+	err := client.SetLeverage(context.Background(), &SetLeverageRequest{InstID: "BTC-USDT-SWAP", Leverage: "5", MarginMode: "cross", PosSide: "long"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestSetPositionMode_Error(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"59000","msg":"Setting failed. Cancel any open orders, close positions, and stop trading bots first.","data":[]}`))
+	})
+
+	err := client.SetPositionMode(context.Background(), PositionModeLongShort)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "59000" {
+		t.Fatalf("Expected APIError 59000, got %v", err)
+	}
+}
+
+func TestPlaceOrders_PartialFailure(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v5/trade/batch-orders" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		w.Write([]byte(`{"code":"2","msg":"","data":[{"ordId":"1001","sCode":"0","sMsg":""},{"ordId":"","sCode":"51008","sMsg":"Insufficient margin"}]}`))
+	})
+
+	results, err := client.PlaceOrders(context.Background(), []OrderRequest{
+		{InstID: "BTC-USDT-SWAP", TradeMode: TradeModeCross, Side: "buy", PosSide: "long", OrderType: "market", Size: "1"},
+		{InstID: "BTC-USDT-SWAP", TradeMode: TradeModeCross, Side: "buy", PosSide: "long", OrderType: "market", Size: "100"},
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "51008" {
+		t.Fatalf("Expected the item error, got %v", err)
+	}
+
+	if len(results) != 2 || results[0].OrdID != "1001" {
+		t.Errorf("Expected the placed order in the results, got %+v", results)
+	}
+}
+
+func TestQueryBills(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v5/account/bills" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		query := r.URL.Query()
+		if query.Get("instType") != "SWAP" || query.Get("instId") != "BTC-USDT-SWAP" || query.Get("type") != BillTypeFundingFee ||
+			query.Get("begin") != "1767312000000" || query.Get("after") != "900" || query.Get("limit") != "100" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+
+		sign := expectedSign("2026-01-02T03:04:05.006ZGET/api/v5/account/bills?" + r.URL.RawQuery)
+		if r.Header.Get("OK-ACCESS-SIGN") != sign {
+			t.Errorf("Expected sign %s, got %s", sign, r.Header.Get("OK-ACCESS-SIGN"))
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"billId":"899","instId":"BTC-USDT-SWAP","ccy":"USDT","balChg":"-0.12","type":"8","subType":"174","ts":"1767312300000"}]}`))
+	})
+
+	bills, err := client.QueryBills(context.Background(), &BillsRequest{
+		InstType: "SWAP",
+		InstID:   "BTC-USDT-SWAP",
+		Type:     BillTypeFundingFee,
+		Begin:    time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		After:    "900",
+		Limit:    100,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(bills) != 1 || bills[0].BalChg != "-0.12" || bills[0].BillID != "899" {
+		t.Errorf("Unexpected bills %+v", bills)
+	}
+}
+
+func TestQueryPositions(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v5/account/positions" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		if r.URL.Query().Get("instType") != "SWAP" || r.URL.Query().Get("instId") != "BTC-USDT-SWAP" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+
+		w.Write([]byte(`{"code":"0","msg":"","data":[{"instId":"BTC-USDT-SWAP","posSide":"long","pos":"2","avgPx":"100.5","mgnMode":"cross"},{"instId":"BTC-USDT-SWAP","posSide":"short","pos":"1","avgPx":"102","mgnMode":"cross"}]}`))
+	})
+
+	positions, err := client.QueryPositions(context.Background(), "SWAP", "BTC-USDT-SWAP")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(positions) != 2 || positions[0].PosSide != "long" || positions[1].Pos != "1" || positions[1].AvgPx != "102" {
+		t.Errorf("Unexpected positions %+v", positions)
+	}
+}
@@ -0,0 +1,166 @@
+package okx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultBaseURL is the REST endpoint of OKX
+const DefaultBaseURL = "https://www.okx.com"
+
+// Trade modes of an order
+const (
+	TradeModeCash     = "cash"
+	TradeModeCross    = "cross"
+	TradeModeIsolated = "isolated"
+)
+
+// Position modes of the account
+const (
+	PositionModeNet       = "net_mode"
+	PositionModeLongShort = "long_short_mode"
+)
+
+// HTTPError represents an HTTP error response
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http error: status=%d, body=%s", e.StatusCode, e.Body)
+}
+
+// APIError represents an error code returned by the OKX API, for the request
+// or for one item of it
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"msg"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("okx error: code=%s, message=%s", e.Code, e.Message)
+}
+
+// response is the envelope of the OKX API responses
+type response struct {
+	Code    string      `json:"code"`
+	Message string      `json:"msg"`
+	Data    interface{} `json:"data"`
+}
+
+// AlgoOrderRequest represents the payload placing an algo order
+type AlgoOrderRequest struct {
+	InstID      string `json:"instId"`                // Instrument, e.g. BTC-USDT
+	TradeMode   string `json:"tdMode"`                // cash, cross or isolated
+	Side        string `json:"side"`                  // buy or sell
+	OrderType   string `json:"ordType"`               // conditional or oco
+	Size        string `json:"sz"`                    // Quantity in base
+	TpTriggerPx string `json:"tpTriggerPx,omitempty"` // Take-profit trigger price
+	TpOrdPx     string `json:"tpOrdPx,omitempty"`     // Take-profit order price, -1 for a market order
+	SlTriggerPx string `json:"slTriggerPx,omitempty"` // Stop-loss trigger price
+	SlOrdPx     string `json:"slOrdPx,omitempty"`     // Stop-loss order price, -1 for a market order
+}
+
+// AlgoOrder represents the result of a placed algo order
+type AlgoOrder struct {
+	AlgoID  string `json:"algoId"`
+	SCode   string `json:"sCode"`
+	SMsg    string `json:"sMsg"`
+	ClOrdID string `json:"clOrdId"`
+}
+
+// CancelAlgoRequest represents an algo order to cancel
+type CancelAlgoRequest struct {
+	AlgoID string `json:"algoId"`
+	InstID string `json:"instId"`
+}
+
+// SetLeverageRequest represents the payload setting the leverage of an instrument
+type SetLeverageRequest struct {
+	InstID     string `json:"instId"`            // Instrument, e.g. BTC-USDT-SWAP
+	Leverage   string `json:"lever"`             // Leverage
+	MarginMode string `json:"mgnMode"`           // cross or isolated
+	PosSide    string `json:"posSide,omitempty"` // long or short in long_short_mode, empty otherwise
+}
+
+// OrderRequest represents the payload placing an order
+type OrderRequest struct {
+	InstID     string `json:"instId"`               // Instrument, e.g. BTC-USDT-SWAP
+	TradeMode  string `json:"tdMode"`               // cash, cross or isolated
+	ClOrdID    string `json:"clOrdId,omitempty"`    // Client order id
+	Side       string `json:"side"`                 // buy or sell
+	PosSide    string `json:"posSide,omitempty"`    // long or short in long_short_mode, empty otherwise
+	OrderType  string `json:"ordType"`              // market, limit or post_only
+	Size       string `json:"sz"`                   // Quantity
+	Price      string `json:"px,omitempty"`         // Price of limit orders
+	ReduceOnly bool   `json:"reduceOnly,omitempty"` // Whether the order only reduces the position
+}
+
+// OrderResult represents the result of a placed order
+type OrderResult struct {
+	OrdID   string `json:"ordId"`
+	ClOrdID string `json:"clOrdId"`
+	SCode   string `json:"sCode"`
+	SMsg    string `json:"sMsg"`
+}
+
+// Bill types of the account bills
+const (
+	BillTypeFundingFee = "8"
+)
+
+// BillsRequest represents the query of the account bills of the last 7 days
+type BillsRequest struct {
+	InstType string    // Instrument type, e.g. SWAP
+	InstID   string    // Instrument, e.g. BTC-USDT-SWAP
+	Type     string    // Bill type, e.g. 8 for the funding fees
+	Begin    time.Time // Bills after the time, zero for all
+	After    string    // Bills older than the bill id, for pagination
+	Limit    int       // Number of bills, at most 100
+}
+
+// Bill represents a change of the account balance
+type Bill struct {
+	BillID  string `json:"billId"`
+	InstID  string `json:"instId"`
+	Ccy     string `json:"ccy"`
+	BalChg  string `json:"balChg"` // Balance change, negative when paid
+	Type    string `json:"type"`
+	SubType string `json:"subType"`
+	Ts      string `json:"ts"` // Unix time in milliseconds
+}
+
+// Position represents an open position of the account
+type Position struct {
+	InstID  string `json:"instId"`
+	PosSide string `json:"posSide"` // long or short in long_short_mode, net otherwise
+	Pos     string `json:"pos"`     // Quantity in contracts, signed for a net position
+	AvgPx   string `json:"avgPx"`   // Average open price
+	MgnMode string `json:"mgnMode"` // cross or isolated
+}
+
+// IOKXClient defines the OKX API calls missing from the bbgo exchange
+type IOKXClient interface {
+	// PlaceAlgoOrder places an algo order, such as an OCO order
+	PlaceAlgoOrder(ctx context.Context, req *AlgoOrderRequest) (*AlgoOrder, error)
+
+	// CancelAlgoOrders cancels algo orders
+	CancelAlgoOrders(ctx context.Context, reqs []CancelAlgoRequest) error
+
+	// SetLeverage sets the leverage of an instrument
+	SetLeverage(ctx context.Context, req *SetLeverageRequest) error
+
+	// SetPositionMode sets the position mode of the account, net_mode or long_short_mode
+	SetPositionMode(ctx context.Context, mode string) error
+
+	// PlaceOrders places a batch of orders, the results are in the order of the requests
+	PlaceOrders(ctx context.Context, reqs []OrderRequest) ([]OrderResult, error)
+
+	// QueryBills returns the account bills, newest first
+	QueryBills(ctx context.Context, req *BillsRequest) ([]Bill, error)
+
+	// QueryPositions returns the open positions of the instrument type and instrument
+	QueryPositions(ctx context.Context, instType, instID string) ([]Position, error)
+}
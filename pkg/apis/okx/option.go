@@ -0,0 +1,23 @@
+package okx
+
+import (
+	"net/http"
+	"time"
+)
+
+// ClientOption is a function that configures the Client
+type ClientOption func(*Client)
+
+// WithTimeout sets the HTTP client timeout
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient.Timeout = timeout
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
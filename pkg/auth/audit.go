@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single authorization decision
+type AuditEntry struct {
+	Time         time.Time         `json:"time"`
+	UserID       string            `json:"user_id"`
+	Name         string            `json:"name,omitempty"`
+	Role         string            `json:"role"`
+	SessionID    string            `json:"session_id"`
+	Action       string            `json:"action"`
+	Args         map[string]string `json:"args,omitempty"`
+	RequiredRole string            `json:"required_role"`
+	Allowed      bool              `json:"allowed"`
+}
+
+// AuditLog appends audit entries to a JSONL file
+type AuditLog struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewAuditLog creates an audit log writing to path
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{
+		path: path,
+	}
+}
+
+// Record appends entry to the log file
+func (a *AuditLog) Record(entry *AuditEntry) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+var log = logrus.WithField("auth", "authorizer")
+
+const DefaultAuditLogPath = "data/audit.jsonl"
+
+// ErrForbidden is returned when a principal lacks the role required for an action
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer resolves chat users to roles and checks them against the role
+// required by actions and commands. Every decision is written to the audit log.
+type Authorizer struct {
+	users       map[string]*Principal
+	defaultRole string
+	audit       *AuditLog
+}
+
+func NewAuthorizer(cfg *config.AuthConfig) (*Authorizer, error) {
+	if cfg.DefaultRole != "" && !types.IsValidRole(cfg.DefaultRole) {
+		return nil, errors.Errorf("invalid default_role: %s", cfg.DefaultRole)
+	}
+
+	users := make(map[string]*Principal, len(cfg.Users))
+	for _, user := range cfg.Users {
+		if user.ID == "" {
+			return nil, errors.New("auth user id required")
+		}
+
+		if !types.IsValidRole(user.Role) {
+			return nil, errors.Errorf("invalid role %s for user %s", user.Role, user.ID)
+		}
+
+		users[user.ID] = &Principal{
+			UserID: user.ID,
+			Name:   user.Name,
+			Role:   user.Role,
+		}
+	}
+
+	auditLogPath := cfg.AuditLogPath
+	if auditLogPath == "" {
+		auditLogPath = DefaultAuditLogPath
+	}
+
+	return &Authorizer{
+		users:       users,
+		defaultRole: cfg.DefaultRole,
+		audit:       NewAuditLog(auditLogPath),
+	}, nil
+}
+
+// Resolve returns the principal of a chat user, unknown users get the default role
+func (a *Authorizer) Resolve(userID string) *Principal {
+	if p, ok := a.users[userID]; ok {
+		return p
+	}
+
+	return &Principal{
+		UserID: userID,
+		Role:   a.defaultRole,
+	}
+}
+
+// Users returns the configured user mappings
+func (a *Authorizer) Users() []*Principal {
+	users := make([]*Principal, 0, len(a.users))
+	for _, p := range a.users {
+		users = append(users, p)
+	}
+
+	return users
+}
+
+// Authorize checks whether p may execute action, which requires the given role,
+// and records the attempt in the audit log
+func (a *Authorizer) Authorize(p *Principal, sessionID string, action string, required string, args map[string]string) error {
+	allowed := types.RoleSatisfies(p.Role, required)
+
+	err := a.audit.Record(&AuditEntry{
+		Time:         time.Now(),
+		UserID:       p.UserID,
+		Name:         p.Name,
+		Role:         p.Role,
+		SessionID:    sessionID,
+		Action:       action,
+		Args:         args,
+		RequiredRole: required,
+		Allowed:      allowed,
+	})
+	if err != nil {
+		log.WithError(err).Error("record audit entry error")
+	}
+
+	if !allowed {
+		log.WithField("user", p.UserID).
+			WithField("role", p.Role).
+			WithField("action", action).
+			WithField("required", required).
+			Warn("action refused")
+
+		return errors.Wrapf(ErrForbidden, "%s requires role %s, %s has role %s", action, required, p.DisplayName(), roleText(p.Role))
+	}
+
+	return nil
+}
+
+func roleText(role string) string {
+	if role == "" {
+		return "none"
+	}
+
+	return role
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func newTestAuthorizer(t *testing.T, defaultRole string) (*Authorizer, string) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	authorizer, err := NewAuthorizer(&config.AuthConfig{
+		DefaultRole:  defaultRole,
+		AuditLogPath: auditPath,
+		Users: []config.AuthUserConfig{
+			{ID: "ou_admin", Name: "alice", Role: types.RoleAdmin},
+			{ID: "ou_operator", Name: "bob", Role: types.RoleOperator},
+		},
+	})
+	assert.NoError(t, err)
+
+	return authorizer, auditPath
+}
+
+func readAudit(t *testing.T, path string) []*AuditEntry {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	entries := make([]*AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, &entry)
+	}
+
+	return entries
+}
+
+func TestNewAuthorizerRejectsInvalidRole(t *testing.T) {
+	_, err := NewAuthorizer(&config.AuthConfig{
+		Users: []config.AuthUserConfig{
+			{ID: "ou_1", Role: "admim"},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	authorizer, _ := newTestAuthorizer(t, "")
+
+	assert.Equal(t, types.RoleAdmin, authorizer.Resolve("ou_admin").Role)
+	assert.Equal(t, "bob", authorizer.Resolve("ou_operator").Name)
+	assert.Equal(t, "", authorizer.Resolve("ou_unknown").Role)
+
+	authorizer, _ = newTestAuthorizer(t, types.RoleViewer)
+	assert.Equal(t, types.RoleViewer, authorizer.Resolve("ou_unknown").Role)
+}
+
+func TestAuthorizeAudits(t *testing.T) {
+	authorizer, auditPath := newTestAuthorizer(t, types.RoleViewer)
+
+	operator := authorizer.Resolve("ou_operator")
+	viewer := authorizer.Resolve("ou_unknown")
+
+	assert.NoError(t, authorizer.Authorize(operator, "chat-1", "exchange.close_position", types.RoleOperator, nil))
+
+	err := authorizer.Authorize(viewer, "chat-1", "exchange.open_long_position", types.RoleOperator, map[string]string{"quote_ratio": "0.5"})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	entries := readAudit(t, auditPath)
+	assert.Len(t, entries, 2)
+	assert.True(t, entries[0].Allowed)
+	assert.Equal(t, "ou_operator", entries[0].UserID)
+	assert.False(t, entries[1].Allowed)
+	assert.Equal(t, "exchange.open_long_position", entries[1].Action)
+	assert.Equal(t, "0.5", entries[1].Args["quote_ratio"])
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	assert.True(t, types.RoleSatisfies(types.RoleAdmin, types.RoleOperator))
+	assert.True(t, types.RoleSatisfies(types.RoleOperator, types.RoleViewer))
+	assert.False(t, types.RoleSatisfies(types.RoleViewer, types.RoleOperator))
+	assert.False(t, types.RoleSatisfies("", types.RoleViewer))
+	assert.True(t, types.RoleSatisfies("", ""))
+}
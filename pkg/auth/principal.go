@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+)
+
+const (
+	// SystemUserID identifies actions driven by the strategy itself rather than a chat user
+	SystemUserID = "system"
+)
+
+type principalKey struct{}
+
+// Principal is the identity an action or command is executed on behalf of
+type Principal struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name,omitempty"`
+	Role   string `json:"role"`
+}
+
+// DisplayName returns the configured name or the user ID
+func (p *Principal) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	return p.UserID
+}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,448 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	DefaultWidth  = 1024
+	DefaultHeight = 640
+
+	marginLeft   = 10
+	marginRight  = 80
+	marginTop    = 24
+	marginBottom = 10
+	panelGap     = 8
+	gridLines    = 5
+)
+
+var (
+	ColorBackground = color.RGBA{0x13, 0x17, 0x22, 0xff}
+	ColorGrid       = color.RGBA{0x2a, 0x2e, 0x39, 0xff}
+	ColorText       = color.RGBA{0xd1, 0xd4, 0xdc, 0xff}
+	ColorUp         = color.RGBA{0x26, 0xa6, 0x9a, 0xff}
+	ColorDown       = color.RGBA{0xef, 0x53, 0x50, 0xff}
+	ColorEntry      = color.RGBA{0x42, 0xa5, 0xf5, 0xff}
+	ColorStopLoss   = color.RGBA{0xff, 0x52, 0x52, 0xff}
+	ColorTakeProfit = color.RGBA{0x66, 0xbb, 0x6a, 0xff}
+	ColorSupport    = color.RGBA{0x8d, 0x6e, 0x63, 0xff}
+	ColorResistance = color.RGBA{0xff, 0xa7, 0x26, 0xff}
+)
+
+// Palette is used for series without a color, in order
+var Palette = []color.RGBA{
+	{0xff, 0xeb, 0x3b, 0xff},
+	{0xab, 0x47, 0xbc, 0xff},
+	{0x29, 0xb6, 0xf6, 0xff},
+	{0xff, 0x70, 0x43, 0xff},
+	{0x9c, 0xcc, 0x65, 0xff},
+	{0xec, 0x40, 0x7a, 0xff},
+}
+
+// Candle is one OHLCV bar
+type Candle struct {
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+// Series is a line over the candles, its last value lines up with the last candle
+type Series struct {
+	Name   string
+	Values []float64
+	Color  color.RGBA
+}
+
+// Level is a horizontal price line, levels beyond the price range are drawn at its edge
+type Level struct {
+	Name   string
+	Price  float64
+	Color  color.RGBA
+	Dashed bool
+}
+
+// Chart is a candlestick chart with indicator overlays, an optional
+// subpanel and horizontal price levels
+type Chart struct {
+	Title    string
+	Candles  []Candle
+	Overlays []*Series // Drawn on the price scale, e.g. BOLL bands and MAs
+	Subpanel []*Series // Drawn below the candles on their own scale, e.g. VR
+	Levels   []*Level  // S/R levels and the position entry, SL and TP
+	Width    int
+	Height   int
+}
+
+func NewChart(title string, candles []Candle) *Chart {
+	return &Chart{
+		Title:   title,
+		Candles: candles,
+		Width:   DefaultWidth,
+		Height:  DefaultHeight,
+	}
+}
+
+// AddOverlay adds a line on the price scale, a zero color picks one from the palette
+func (c *Chart) AddOverlay(name string, values []float64, col color.RGBA) {
+	c.Overlays = append(c.Overlays, &Series{Name: name, Values: values, Color: c.pick(col)})
+}
+
+// AddSubpanel adds a line to the subpanel
+func (c *Chart) AddSubpanel(name string, values []float64, col color.RGBA) {
+	c.Subpanel = append(c.Subpanel, &Series{Name: name, Values: values, Color: c.pick(col)})
+}
+
+// AddLevel adds a horizontal price line
+func (c *Chart) AddLevel(name string, price float64, col color.RGBA, dashed bool) {
+	c.Levels = append(c.Levels, &Level{Name: name, Price: price, Color: col, Dashed: dashed})
+}
+
+func (c *Chart) pick(col color.RGBA) color.RGBA {
+	if col.A != 0 {
+		return col
+	}
+
+	return Palette[(len(c.Overlays)+len(c.Subpanel))%len(Palette)]
+}
+
+// PNG renders the chart as a PNG image
+func (c *Chart) PNG() ([]byte, error) {
+	img, err := c.Render()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Render draws the chart
+func (c *Chart) Render() (*image.RGBA, error) {
+	if len(c.Candles) == 0 {
+		return nil, fmt.Errorf("no candles to render")
+	}
+
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(ColorBackground), image.Point{}, draw.Src)
+
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+	pricePanel := plot
+	var subPanel image.Rectangle
+	if len(c.Subpanel) > 0 {
+		split := plot.Min.Y + plot.Dy()*3/4
+		pricePanel.Max.Y = split - panelGap/2
+		subPanel = image.Rect(plot.Min.X, split+panelGap/2, plot.Max.X, plot.Max.Y)
+	}
+
+	low, high := c.priceRange()
+	priceScale := newScale(low, high, pricePanel)
+
+	c.drawGrid(img, pricePanel, priceScale)
+	c.drawCandles(img, pricePanel, priceScale)
+
+	for _, series := range c.Overlays {
+		c.drawSeries(img, pricePanel, priceScale, series)
+	}
+
+	c.drawLevels(img, pricePanel, priceScale)
+
+	if len(c.Subpanel) > 0 {
+		c.drawSubpanel(img, subPanel)
+	}
+
+	c.drawLegend(img)
+
+	return img, nil
+}
+
+// priceRange covers the candles and overlays, levels are clamped to it
+func (c *Chart) priceRange() (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, candle := range c.Candles {
+		low = math.Min(low, candle.Low)
+		high = math.Max(high, candle.High)
+	}
+
+	for _, series := range c.Overlays {
+		for _, v := range c.visible(series.Values) {
+			if valid(v) {
+				low = math.Min(low, v)
+				high = math.Max(high, v)
+			}
+		}
+	}
+
+	padding := (high - low) * 0.05
+	if padding == 0 {
+		padding = math.Max(math.Abs(high)*0.01, 1e-9)
+	}
+
+	return low - padding, high + padding
+}
+
+// visible returns the values that line up with the candles
+func (c *Chart) visible(values []float64) []float64 {
+	if len(values) > len(c.Candles) {
+		return values[len(values)-len(c.Candles):]
+	}
+
+	return values
+}
+
+func (c *Chart) slotX(panel image.Rectangle, i int) (int, int) {
+	slot := float64(panel.Dx()) / float64(len(c.Candles))
+	center := panel.Min.X + int(slot*float64(i)+slot/2)
+	body := int(slot * 0.6)
+	if body < 1 {
+		body = 1
+	}
+
+	return center, body
+}
+
+func (c *Chart) drawGrid(img *image.RGBA, panel image.Rectangle, s *scale) {
+	for i := 0; i <= gridLines; i++ {
+		price := s.low + (s.high-s.low)*float64(i)/gridLines
+		y := s.y(price)
+		hline(img, panel.Min.X, panel.Max.X, y, ColorGrid, false)
+		text(img, panel.Max.X+4, y+4, formatPrice(price), ColorText)
+	}
+
+	last := c.Candles[len(c.Candles)-1]
+	col := ColorUp
+	if last.Close < last.Open {
+		col = ColorDown
+	}
+	y := s.y(last.Close)
+	fillRect(img, image.Rect(panel.Max.X+1, y-7, img.Bounds().Max.X, y+7), col)
+	text(img, panel.Max.X+4, y+4, formatPrice(last.Close), ColorBackground)
+}
+
+func (c *Chart) drawCandles(img *image.RGBA, panel image.Rectangle, s *scale) {
+	for i, candle := range c.Candles {
+		x, body := c.slotX(panel, i)
+
+		col := ColorUp
+		if candle.Close < candle.Open {
+			col = ColorDown
+		}
+
+		vline(img, x, s.y(candle.High), s.y(candle.Low), col)
+
+		top, bottom := s.y(math.Max(candle.Open, candle.Close)), s.y(math.Min(candle.Open, candle.Close))
+		if bottom == top {
+			bottom++
+		}
+		fillRect(img, image.Rect(x-body/2, top, x-body/2+body, bottom), col)
+	}
+}
+
+func (c *Chart) drawSeries(img *image.RGBA, panel image.Rectangle, s *scale, series *Series) {
+	values := c.visible(series.Values)
+	offset := len(c.Candles) - len(values)
+
+	prevX, prevY, hasPrev := 0, 0, false
+	for i, v := range values {
+		if !valid(v) {
+			hasPrev = false
+			continue
+		}
+
+		x, _ := c.slotX(panel, offset+i)
+		y := s.y(v)
+		if hasPrev {
+			line(img, prevX, prevY, x, y, series.Color)
+		}
+
+		prevX, prevY, hasPrev = x, y, true
+	}
+}
+
+func (c *Chart) drawLevels(img *image.RGBA, panel image.Rectangle, s *scale) {
+	for _, level := range c.Levels {
+		if !valid(level.Price) {
+			continue
+		}
+
+		y := s.y(level.Price)
+		if y < panel.Min.Y {
+			y = panel.Min.Y
+		}
+		if y > panel.Max.Y {
+			y = panel.Max.Y
+		}
+
+		hline(img, panel.Min.X, panel.Max.X, y, level.Color, level.Dashed)
+		label := fmt.Sprintf("%s %s", level.Name, formatPrice(level.Price))
+		text(img, panel.Max.X-len(label)*7-4, y-3, label, level.Color)
+	}
+}
+
+func (c *Chart) drawSubpanel(img *image.RGBA, panel image.Rectangle) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, series := range c.Subpanel {
+		for _, v := range c.visible(series.Values) {
+			if valid(v) {
+				low = math.Min(low, v)
+				high = math.Max(high, v)
+			}
+		}
+	}
+
+	if math.IsInf(low, 1) {
+		return
+	}
+
+	if high == low {
+		high = low + 1
+	}
+
+	s := newScale(low, high, panel)
+	hline(img, panel.Min.X, panel.Max.X, panel.Min.Y, ColorGrid, false)
+	hline(img, panel.Min.X, panel.Max.X, panel.Max.Y, ColorGrid, false)
+	text(img, panel.Max.X+4, panel.Min.Y+10, formatPrice(high), ColorText)
+	text(img, panel.Max.X+4, panel.Max.Y, formatPrice(low), ColorText)
+
+	x := panel.Min.X + 4
+	for _, series := range c.Subpanel {
+		c.drawSeries(img, panel, s, series)
+		text(img, x, panel.Min.Y+12, series.Name, series.Color)
+		x += (len(series.Name) + 1) * 7
+	}
+}
+
+func (c *Chart) drawLegend(img *image.RGBA) {
+	x := marginLeft
+	text(img, x, 16, c.Title, ColorText)
+	x += (len(c.Title) + 2) * 7
+
+	for _, series := range c.Overlays {
+		text(img, x, 16, series.Name, series.Color)
+		x += (len(series.Name) + 1) * 7
+	}
+}
+
+type scale struct {
+	low   float64
+	high  float64
+	panel image.Rectangle
+}
+
+func newScale(low float64, high float64, panel image.Rectangle) *scale {
+	return &scale{low: low, high: high, panel: panel}
+}
+
+func (s *scale) y(v float64) int {
+	return s.panel.Min.Y + int((s.high-v)/(s.high-s.low)*float64(s.panel.Dy()))
+}
+
+func valid(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func formatPrice(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1000:
+		return fmt.Sprintf("%.1f", v)
+	case abs >= 1:
+		return fmt.Sprintf("%.3f", v)
+	default:
+		return fmt.Sprintf("%.5f", v)
+	}
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, col color.RGBA) {
+	draw.Draw(img, r.Intersect(img.Bounds()), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func hline(img *image.RGBA, x0 int, x1 int, y int, col color.RGBA, dashed bool) {
+	for x := x0; x <= x1; x++ {
+		if dashed && (x/6)%2 == 1 {
+			continue
+		}
+		img.SetRGBA(x, y, col)
+	}
+}
+
+func vline(img *image.RGBA, x int, y0 int, y1 int, col color.RGBA) {
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+
+	for y := y0; y <= y1; y++ {
+		img.SetRGBA(x, y, col)
+	}
+}
+
+// line draws a line with Bresenham's algorithm
+func line(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, col color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func text(img *image.RGBA, x int, y int, s string, col color.RGBA) {
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(col),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(s)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,98 @@
+package chart
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCandles() []Candle {
+	candles := make([]Candle, 0)
+	price := 1.0
+	for i := 0; i < 40; i++ {
+		open := price
+		price = 1.0 + 0.2*math.Sin(float64(i)/4)
+		candles = append(candles, Candle{
+			Open:   open,
+			Close:  price,
+			High:   math.Max(open, price) + 0.01,
+			Low:    math.Min(open, price) - 0.01,
+			Volume: 100 + float64(i),
+		})
+	}
+
+	return candles
+}
+
+func TestChartPNG(t *testing.T) {
+	candles := testCandles()
+
+	chart := NewChart("SUIUSDT 5m", candles)
+	chart.Width, chart.Height = 600, 400
+
+	ma := make([]float64, 0)
+	for i := range candles[:30] {
+		ma = append(ma, candles[i].Close)
+	}
+	ma[0] = math.NaN()
+
+	chart.AddOverlay("MA5", ma, Palette[0])
+	chart.AddOverlay("BOLL", make([]float64, 60), Palette[1])
+	chart.AddSubpanel("VR", []float64{1, 2, 3}, Palette[2])
+	chart.AddLevel("SL", 0.5, ColorStopLoss, true)
+	chart.AddLevel("TP", 1.1, ColorTakeProfit, true)
+
+	data, err := chart.PNG()
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 600, img.Bounds().Dx())
+	assert.Equal(t, 400, img.Bounds().Dy())
+
+	rgba, err := chart.Render()
+	assert.NoError(t, err)
+
+	found := map[string]bool{}
+	for x := 0; x < 600; x++ {
+		for y := 0; y < 400; y++ {
+			switch rgba.RGBAAt(x, y) {
+			case ColorUp:
+				found["up"] = true
+			case ColorDown:
+				found["down"] = true
+			case ColorStopLoss:
+				found["sl"] = true
+			}
+		}
+	}
+	assert.Equal(t, map[string]bool{"up": true, "down": true, "sl": true}, found)
+}
+
+func TestChartNoCandles(t *testing.T) {
+	_, err := NewChart("empty", nil).PNG()
+	assert.Error(t, err)
+}
+
+func TestSupportResistance(t *testing.T) {
+	candles := []Candle{
+		{High: 1.10, Low: 1.00, Close: 1.05},
+		{High: 1.20, Low: 1.05, Close: 1.15},
+		{High: 1.30, Low: 1.10, Close: 1.25}, // swing high
+		{High: 1.20, Low: 0.95, Close: 1.00},
+		{High: 1.05, Low: 0.90, Close: 0.95}, // swing low
+		{High: 1.10, Low: 0.95, Close: 1.05},
+		{High: 1.15, Low: 1.00, Close: 1.10},
+	}
+
+	supports, resistances := SupportResistance(candles, 2, 3)
+	assert.Equal(t, []float64{0.90}, supports)
+	assert.Equal(t, []float64{1.30}, resistances)
+
+	supports, resistances = SupportResistance(nil, 2, 3)
+	assert.Empty(t, supports)
+	assert.Empty(t, resistances)
+}
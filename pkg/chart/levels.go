@@ -0,0 +1,73 @@
+package chart
+
+import (
+	"math"
+	"sort"
+)
+
+// SupportResistance finds swing highs and lows, a bar whose high (low) is the
+// highest (lowest) within span bars on each side. It returns up to limit of the
+// nearest supports below and resistances above the last close, levels closer
+// than 0.2% are merged.
+func SupportResistance(candles []Candle, span int, limit int) ([]float64, []float64) {
+	if len(candles) == 0 || span <= 0 {
+		return nil, nil
+	}
+
+	lows, highs := make([]float64, 0), make([]float64, 0)
+	for i := span; i < len(candles)-span; i++ {
+		isHigh, isLow := true, true
+		for j := i - span; j <= i+span; j++ {
+			if j == i {
+				continue
+			}
+			if candles[j].High > candles[i].High {
+				isHigh = false
+			}
+			if candles[j].Low < candles[i].Low {
+				isLow = false
+			}
+		}
+
+		if isHigh {
+			highs = append(highs, candles[i].High)
+		}
+		if isLow {
+			lows = append(lows, candles[i].Low)
+		}
+	}
+
+	lastClose := candles[len(candles)-1].Close
+
+	supports := make([]float64, 0)
+	resistances := make([]float64, 0)
+	for _, level := range append(lows, highs...) {
+		if level < lastClose {
+			supports = append(supports, level)
+		} else if level > lastClose {
+			resistances = append(resistances, level)
+		}
+	}
+
+	// Nearest first
+	sort.Sort(sort.Reverse(sort.Float64Slice(supports)))
+	sort.Float64s(resistances)
+
+	return nearest(supports, limit), nearest(resistances, limit)
+}
+
+func nearest(levels []float64, limit int) []float64 {
+	merged := make([]float64, 0, limit)
+	for _, level := range levels {
+		if len(merged) > 0 && math.Abs(level-merged[len(merged)-1]) <= math.Abs(level)*0.002 {
+			continue
+		}
+
+		merged = append(merged, level)
+		if len(merged) == limit {
+			break
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// BroadcastSession is the session of the trading cycles. The state of the
+// cycles is kept once, and the replies go to every subscribed session.
+type BroadcastSession struct {
+	id          string
+	chats       []string
+	roles       []string
+	attributes  *sync.Map
+	subscribers []types.ISession
+	lock        sync.RWMutex
+}
+
+func NewBroadcastSession(id string) *BroadcastSession {
+	return &BroadcastSession{
+		id:          id,
+		chats:       make([]string, 0),
+		attributes:  new(sync.Map),
+		subscribers: make([]types.ISession, 0),
+	}
+}
+
+// Subscribe adds a session receiving the replies, it returns false if the
+// session was already subscribed
+func (s *BroadcastSession) Subscribe(session types.ISession) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, subscriber := range s.subscribers {
+		if subscriber.GetID() == session.GetID() {
+			return false
+		}
+	}
+
+	s.subscribers = append(s.subscribers, session)
+	return true
+}
+
+// Subscribers returns the sessions receiving the replies
+func (s *BroadcastSession) Subscribers() []types.ISession {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]types.ISession{}, s.subscribers...)
+}
+
+func (s *BroadcastSession) GetID() string {
+	return s.id
+}
+
+func (s *BroadcastSession) GetChats() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.chats
+}
+
+func (s *BroadcastSession) AddChat(chat string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.chats = append(s.chats, chat)
+}
+
+func (s *BroadcastSession) GetAttributeNames() []string {
+	names := make([]string, 0)
+
+	s.attributes.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+
+	return names
+}
+
+func (s *BroadcastSession) GetAttribute(name string) (interface{}, bool) {
+	return s.attributes.Load(name)
+}
+
+func (s *BroadcastSession) SetAttribute(name string, value interface{}) {
+	s.attributes.Store(name, value)
+}
+
+func (s *BroadcastSession) RemoveAttribute(name string) {
+	s.attributes.Delete(name)
+}
+
+// Reply sends the message to every subscribed session
+func (s *BroadcastSession) Reply(ctx context.Context, msg *types.Message) error {
+	errs := make([]error, 0)
+
+	for _, session := range s.Subscribers() {
+		err := session.Reply(ctx, msg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("Reply with many error, errors: %v", errs)
+	}
+
+	return nil
+}
+
+func (s *BroadcastSession) SetRoles(roles []string) {
+	s.roles = roles
+}
+
+func (s *BroadcastSession) GetRoles() []string {
+	return s.roles
+}
+
+// HasRole reports whether the session holds role or a more privileged one
+func (s *BroadcastSession) HasRole(role string) bool {
+	return types.RoleSatisfies(types.HighestRole(s.roles), role)
+}
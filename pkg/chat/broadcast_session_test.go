@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+type recordChannel struct {
+	id      string
+	replies []string
+}
+
+func (c *recordChannel) GetID() string {
+	return c.id
+}
+
+func (c *recordChannel) Reply(ctx context.Context, msg *types.Message) error {
+	c.replies = append(c.replies, msg.Text)
+	return nil
+}
+
+func TestBroadcastSession(t *testing.T) {
+	cycle := NewBroadcastSession("cycle")
+	first := &recordChannel{id: "first"}
+	second := &recordChannel{id: "second"}
+
+	assert.True(t, cycle.Subscribe(NewChatSession(first)))
+	assert.True(t, cycle.Subscribe(NewChatSession(second)))
+	assert.False(t, cycle.Subscribe(NewChatSession(first)))
+	assert.Len(t, cycle.Subscribers(), 2)
+
+	// One reply of the cycle reaches each subscriber once
+	assert.NoError(t, cycle.Reply(context.Background(), &types.Message{Text: "cycle done"}))
+	assert.Equal(t, []string{"cycle done"}, first.replies)
+	assert.Equal(t, []string{"cycle done"}, second.replies)
+
+	// The state of the cycle is its own
+	cycle.SetAttribute("kline", 1)
+	value, ok := cycle.GetAttribute("kline")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	cycle.SetRoles([]string{types.RoleAdmin})
+	assert.True(t, cycle.HasRole(types.RoleOperator))
+}
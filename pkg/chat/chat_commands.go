@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// CommandHandler executes a slash command and returns the reply text
+type CommandHandler func(ctx context.Context, session types.ISession, args []string) (string, error)
+
+// Command is a slash command a chat user can run directly, bypassing the agent
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Role        string // Minimum role required to run the command, empty means anyone
+	Handler     CommandHandler
+}
+
+type CommandRegistry struct {
+	commands map[string]*Command
+	lock     sync.RWMutex
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{
+		commands: make(map[string]*Command, 0),
+	}
+}
+
+func (r *CommandRegistry) Register(cmd *Command) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.commands[cmd.Name] = cmd
+}
+
+func (r *CommandRegistry) Get(name string) (*Command, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// Commands returns all registered commands ordered by name
+func (r *CommandRegistry) Commands() []*Command {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	cmds := make([]*Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		cmds = append(cmds, cmd)
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	return cmds
+}
+
+// ParseCommand splits a chat text like "/close 50%" into its name and args,
+// leading mentions such as "@_user_1" in group chats are skipped.
+// It returns false if the text is not a slash command.
+func ParseCommand(text string) (string, []string, bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") || len(fields[0]) == 1 {
+		return "", nil, false
+	}
+
+	return strings.ToLower(fields[0][1:]), fields[1:], true
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	name, args, ok := ParseCommand(" /Close  50% ")
+	assert.True(t, ok)
+	assert.Equal(t, "close", name)
+	assert.Equal(t, []string{"50%"}, args)
+
+	name, args, ok = ParseCommand("/whoami")
+	assert.True(t, ok)
+	assert.Equal(t, "whoami", name)
+	assert.Empty(t, args)
+
+	name, _, ok = ParseCommand("@_user_1 /position")
+	assert.True(t, ok)
+	assert.Equal(t, "position", name)
+
+	_, _, ok = ParseCommand("how is the market?")
+	assert.False(t, ok)
+
+	_, _, ok = ParseCommand("/")
+	assert.False(t, ok)
+}
+
+func TestCommandRegistry(t *testing.T) {
+	registry := NewCommandRegistry()
+	registry.Register(&Command{Name: "whoami"})
+	registry.Register(&Command{Name: "close"})
+
+	_, ok := registry.Get("close")
+	assert.True(t, ok)
+
+	_, ok = registry.Get("open")
+	assert.False(t, ok)
+
+	cmds := registry.Commands()
+	assert.Equal(t, "close", cmds[0].Name)
+	assert.Equal(t, "whoami", cmds[1].Name)
+}
@@ -72,12 +72,11 @@ func (s *ChatSession) SetRoles(roles []string) {
 	s.roles = roles
 }
 
-func (s *ChatSession) HasRole(role string) bool {
-	for _, r := range s.roles {
-		if r == role {
-			return true
-		}
-	}
+func (s *ChatSession) GetRoles() []string {
+	return s.roles
+}
 
-	return false
+// HasRole reports whether the session holds role or a more privileged one
+func (s *ChatSession) HasRole(role string) bool {
+	return types.RoleSatisfies(types.HighestRole(s.roles), role)
 }
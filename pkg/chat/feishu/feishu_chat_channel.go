@@ -1,6 +1,7 @@
 package feishu
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -37,6 +38,11 @@ func (ch *FeishuChatChannel) GetID() string {
 }
 
 func (ch *FeishuChatChannel) toMessage(event *larkim.P2MessageReceiveV1) (*types.Message, error) {
+	userID := ""
+	if event.Event.Sender != nil && event.Event.Sender.SenderId != nil && event.Event.Sender.SenderId.OpenId != nil {
+		userID = *event.Event.Sender.SenderId.OpenId
+	}
+
 	switch *event.Event.Message.MessageType {
 	case "text":
 		var data struct {
@@ -47,13 +53,15 @@ func (ch *FeishuChatChannel) toMessage(event *larkim.P2MessageReceiveV1) (*types
 		}
 
 		return &types.Message{
-			ID:   event.EventReq.RequestId(),
-			Text: data.Text,
+			ID:     event.EventReq.RequestId(),
+			Text:   data.Text,
+			UserID: userID,
 		}, nil
 	default:
 		return &types.Message{
-			ID:   event.EventReq.RequestId(),
-			Text: *event.Event.Message.Content,
+			ID:     event.EventReq.RequestId(),
+			Text:   *event.Event.Message.Content,
+			UserID: userID,
 		}, nil
 	}
 }
@@ -74,7 +82,19 @@ func (ch *FeishuChatChannel) OnMessage(cb types.MessageCallback) {
 	ch.callbacks = append(ch.callbacks, cb)
 }
 
+// Reply sends the image of the message, if any, followed by its text
 func (ch *FeishuChatChannel) Reply(ctx context.Context, msg *types.Message) error {
+	if msg.Image != nil {
+		err := ch.replyImage(ctx, msg.Image)
+		if err != nil {
+			return err
+		}
+
+		if msg.Text == "" {
+			return nil
+		}
+	}
+
 	content := map[string]string{
 		"text": msg.Text,
 	}
@@ -100,3 +120,44 @@ func (ch *FeishuChatChannel) Reply(ctx context.Context, msg *types.Message) erro
 
 	return nil
 }
+
+// replyImage uploads the image and sends it as an image message
+func (ch *FeishuChatChannel) replyImage(ctx context.Context, image *types.Image) error {
+	uploadResp, err := ch.client.Im.Image.Create(ctx, larkim.NewCreateImageReqBuilder().
+		Body(larkim.NewCreateImageReqBodyBuilder().
+			ImageType(larkim.ImageTypeMessage).
+			Image(bytes.NewReader(image.Data)).
+			Build()).
+		Build(), larkcore.WithTenantKey(ch.tenantKey))
+	if err != nil {
+		return errors.Wrap(err, "upload_image_error")
+	}
+
+	if !uploadResp.Success() || uploadResp.Data == nil || uploadResp.Data.ImageKey == nil {
+		return errors.Errorf("upload_image_error, code: %d, msg: %s", uploadResp.Code, uploadResp.Msg)
+	}
+
+	content := map[string]string{
+		"image_key": *uploadResp.Data.ImageKey,
+	}
+	contentBody, _ := json.Marshal(content)
+
+	resp, err := ch.client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType(ch.receiveIdType).
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeImage).
+			ReceiveId(ch.receiveId).
+			Content(string(contentBody)).
+			Build()).
+		Build(), larkcore.WithTenantKey(ch.tenantKey))
+	if err != nil {
+		return errors.Wrap(err, "reply_image_error")
+	}
+
+	log.
+		WithField("image", image.Name).
+		WithField("resp", resp).
+		Info("reply image ok")
+
+	return nil
+}
@@ -1,11 +1,28 @@
 package config
 
 type TradingAgentConfig struct {
-	Enabled          bool    `json:"enabled"`
-	Name             string  `json:"name"`
-	Model            string  `json:"model"`
-	Temperature      float32 `json:"temperature"`
-	MaxContextLength int     `json:"max_context_length"`
-	LLM              string  `json:"llm"`
-	Backgroup        string  `json:"backgroup"`
+	Enabled          bool                `json:"enabled"`
+	Name             string              `json:"name"`
+	Model            string              `json:"model"`
+	Temperature      float32             `json:"temperature"`
+	MaxContextLength int                 `json:"max_context_length"` // Context window of the model in tokens
+	MaxOutputTokens  int                 `json:"max_output_tokens"`  // Tokens reserved for the response (default: 1/4 of max_context_length)
+	ContextBudget    ContextBudgetConfig `json:"context_budget"`
+	LLM              string              `json:"llm"`
+	Backgroup        string              `json:"backgroup"`
+}
+
+// ContextBudgetConfig caps the input tokens of each prompt section, 0 means no
+// cap except for history which is only sent when it has a budget. When the
+// prompt is still over budget, sections are shrunk from the lowest priority:
+// history, news, commands, episodes, knowledge, indicators, klines.
+type ContextBudgetConfig struct {
+	Klines     int `json:"klines"`
+	Indicators int `json:"indicators"`
+	News       int `json:"news"`
+	Memory     int `json:"memory"`
+	History    int `json:"history"`
+	Episodes   int `json:"episodes"`
+	Knowledge  int `json:"knowledge"`
+	Commands   int `json:"commands"`
 }
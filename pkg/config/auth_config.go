@@ -0,0 +1,15 @@
+package config
+
+// AuthConfig maps chat users to roles
+type AuthConfig struct {
+	DefaultRole  string           `json:"default_role"`   // Role of chat users not listed in users (default: none)
+	AuditLogPath string           `json:"audit_log_path"` // Path of the JSONL audit log (default: data/audit.jsonl)
+	Users        []AuthUserConfig `json:"users"`
+}
+
+// AuthUserConfig binds a chat user ID to a role
+type AuthUserConfig struct {
+	ID   string `json:"id"`   // Chat user ID, e.g. feishu open_id
+	Name string `json:"name"` // Display name used in replies and audit log
+	Role string `json:"role"` // viewer, operator or admin
+}
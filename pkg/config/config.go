@@ -15,6 +15,7 @@ type Config struct {
 	Notify NotifyConfig `json:"notify"`
 	LLM    LLMConfig    `json:"llm"`
 	Chat   ChatConfig   `json:"chat"`
+	Auth   AuthConfig   `json:"auth"`
 	Agent  AgentConfig  `json:"agent"`
 	Env    EnvConfig    `json:"env"`
 
@@ -26,6 +27,57 @@ type Config struct {
 
 	// Commands configuration for next-cycle command persistence
 	Commands CommandsConfig `json:"commands"`
+
+	// Chart configuration for the candlestick image sent to vision models
+	Chart ChartConfig `json:"chart"`
+
+	// Episodes configuration for retrieving similar past market situations
+	Episodes EpisodesConfig `json:"episodes"`
+
+	// Reflection configuration for post-mortems of closed positions
+	Reflection ReflectionConfig `json:"reflection"`
+
+	// Knowledge configuration for lessons shared between instances
+	Knowledge KnowledgeConfig `json:"knowledge"`
+}
+
+// KnowledgeConfig defines the knowledge base shared by the instances of a host
+type KnowledgeConfig struct {
+	Enabled       bool   `json:"enabled"`        // Whether to read and contribute shared lessons
+	KnowledgePath string `json:"knowledge_path"` // Store shared by the instances (default: memory-bank/shared/knowledge.json)
+	AssetClass    string `json:"asset_class"`    // Asset class of the symbol, such as majors or memecoins, empty disables the asset scope
+	Instance      string `json:"instance"`       // Name of this instance in the provenance of its lessons (default: strategy instance ID)
+	MaxPerScope   int    `json:"max_per_scope"`  // Lessons kept per scope, the least recently updated are dropped first (default: 50)
+	ShareRules    *bool  `json:"share_rules"`    // Share the rules adopted by trade reflections in the symbol scope (default: true)
+}
+
+// ReflectionConfig defines the post-trade reflection run when a position closes
+type ReflectionConfig struct {
+	Enabled     bool   `json:"enabled"`      // Whether to journal trades and review them with the reflection llm route
+	JournalPath string `json:"journal_path"` // Trade journal, one closed trade per line (default: memory-bank/trade-journal.jsonl)
+	WriteMemory *bool  `json:"write_memory"` // Write the adopted rule and the mistakes into memory (default: true)
+}
+
+// EpisodesConfig defines the episodic memory of past decision cycles
+type EpisodesConfig struct {
+	Enabled        bool           `json:"enabled"`         // Whether to record episodes and inject similar ones
+	EpisodePath    string         `json:"episode_path"`    // Path to episode file (default: memory-bank/episodes.json)
+	TopK           int            `json:"top_k"`           // Similar episodes injected into the prompt (default: 3)
+	MaxEpisodes    int            `json:"max_episodes"`    // Episodes kept, the oldest are dropped first (default: 2000)
+	OutcomeHorizon types.Duration `json:"outcome_horizon"` // Forward return horizon of cycles without a trade (default: 1h)
+	MinSimilarity  float64        `json:"min_similarity"`  // Similarity threshold in [-1, 1] of injected episodes (default: 0.5)
+	Ollama         *OllamaConfig  `json:"ollama"`          // Embedding model, the market feature vector is used when empty or unreachable
+}
+
+// ChartConfig defines the candlestick chart rendered every decision cycle
+type ChartConfig struct {
+	Enabled    bool     `json:"enabled"`     // Whether to render the chart
+	Width      int      `json:"width"`       // Image width in pixels (default: 1024)
+	Height     int      `json:"height"`      // Image height in pixels (default: 640)
+	Indicators []string `json:"indicators"`  // Indicator names to draw, empty means all of BOLL, SMA, EWMA, VWMA and VR
+	PivotSpan  int      `json:"pivot_span"`  // Bars on each side of a swing high or low used for S/R levels (default: 3)
+	MaxLevels  int      `json:"max_levels"`  // Support and resistance levels drawn on each side, 0 disables them (default: 2)
+	NotifyChat *bool    `json:"notify_chat"` // Post the chart to chat channels supporting images (default: true)
 }
 
 // MemoryConfig defines configuration for the file-based memory system
@@ -33,10 +85,32 @@ type MemoryConfig struct {
 	Enabled    bool   `json:"enabled"`     // Whether to enable memory function
 	MemoryPath string `json:"memory_path"` // Path to memory file
 	MaxWords   int    `json:"max_words"`   // Maximum word limit for memory
+
+	Compaction  *bool  `json:"compaction"`   // Consolidate memory over the limit with the memory_compaction llm route (default: true)
+	ArchivePath string `json:"archive_path"` // Directory of pre-compaction memories (default: memory-bank/archive)
+	MaxArchives int    `json:"max_archives"` // Archived memories kept, the oldest are removed first (default: 20)
+
+	HistoryPath        string  `json:"history_path"`         // Append-only version history (default: memory path with .history.jsonl)
+	DeleteGuardPercent float64 `json:"delete_guard_percent"` // Writes deleting more of the memory wait for /memory_confirm, 0 disables the guard
+
+	Structured bool                   `json:"structured"` // Split the memory into typed sections the model updates one by one
+	Sections   []*MemorySectionConfig `json:"sections"`   // Sections of the structured memory (default: trading_rules, market_regime, setup_stats, hypotheses, mistakes)
+}
+
+// MemorySectionConfig defines a section of the structured memory
+type MemorySectionConfig struct {
+	Name        string `json:"name"`        // Key used in the memory output
+	Title       string `json:"title"`       // Markdown heading
+	Mode        string `json:"mode"`        // Update mode: replace, append or merge
+	MaxWords    int    `json:"max_words"`   // Word budget of the section
+	Description string `json:"description"` // What belongs in the section
 }
 
 // CommandsConfig defines configuration for the command persistence system
 type CommandsConfig struct {
-	Enabled     bool   `json:"enabled"`      // Whether to enable command system
-	CommandPath string `json:"command_path"` // Path to command persistence file
+	Enabled          bool           `json:"enabled"`            // Whether to enable command system
+	CommandPath      string         `json:"command_path"`       // Path to command persistence file
+	TriggerCheck     types.Duration `json:"trigger_check"`      // How often price and time triggers are checked (default: 5s)
+	TriggerExpiry    types.Duration `json:"trigger_expiry"`     // Expiry of triggered commands without expires_in (default: 24h)
+	MaxTriggerExpiry types.Duration `json:"max_trigger_expiry"` // Longest expiry a triggered command can ask for (default: 168h)
 }
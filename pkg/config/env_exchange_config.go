@@ -100,9 +100,53 @@ type EnvExchangeConfig struct {
 	Indicators          map[string]*IndicatorConfig `json:"indicators"`
 	HandlePositionClose bool                        `json:"handle_position_close"`
 	CleanPosition       CleanPositionConfig         `json:"clean_position"`
+	TrailingStop        TrailingStopConfig          `json:"trailing_stop"`
+	Sizing              PositionSizingConfig        `json:"sizing"`
+	Execution           ExecutionConfig             `json:"execution"`
+	Reconcile           ReconcileConfig             `json:"reconcile"`
+	Futures             FuturesConfig               `json:"futures"`
+	Spot                SpotConfig                  `json:"spot"`
 }
 
 type CleanPositionConfig struct {
 	Enabled  bool           `json:"enabled"`
 	Interval types.Interval `json:"interval"`
 }
+
+type TrailingStopConfig struct {
+	OnTrades         bool           `json:"on_trades"`          // Also move the stop on market trades, not only closed klines
+	MinAmendInterval types.Duration `json:"min_amend_interval"` // Minimum time between exchange stop amendments, default 10s
+}
+
+type PositionSizingConfig struct {
+	Mode            string  `json:"mode"`              // quote_ratio (default) or risk
+	RiskPercent     float64 `json:"risk_percent"`      // Equity percent lost at the stop-loss in risk mode
+	MaxRiskPercent  float64 `json:"max_risk_percent"`  // Cap of the risk per trade, default 5
+	FeeRate         float64 `json:"fee_rate"`          // Taker fee rate counted on entry and exit, default 0.001
+	ATRStopMultiple float64 `json:"atr_stop_multiple"` // Stop-loss distance in ATR(14) when none is given, 0 disables
+}
+
+type SpotConfig struct {
+	Enabled    bool   `json:"enabled"`     // Spot-only account: long positions, no leverage and no margin borrowing
+	ExitOrders string `json:"exit_orders"` // local (default) monitors the stop-loss and take-profit, oco places them as OCO orders
+}
+
+type FuturesConfig struct {
+	Enabled    bool   `json:"enabled"`     // Trade a futures session: base quantities, reduce-only closes, no margin borrowing
+	MarginMode string `json:"margin_mode"` // cross (default) or isolated, used when setting the leverage
+	HedgeMode  bool   `json:"hedge_mode"`  // Long and short legs coexist, each with its own position
+}
+
+type ReconcileConfig struct {
+	Enabled  bool           `json:"enabled"`  // Reconcile the position and orders with the exchange at startup and on a schedule
+	Interval types.Duration `json:"interval"` // Time between reconciliations, default 5m
+}
+
+type ExecutionConfig struct {
+	Algo           string         `json:"algo"`            // Default algorithm: market (default), twap, iceberg or chase
+	Duration       types.Duration `json:"duration"`        // TWAP duration, iceberg and chase timeout, default 5m
+	Slices         int            `json:"slices"`          // TWAP slices, default 5
+	IcebergVisible float64        `json:"iceberg_visible"` // Visible ratio of the iceberg size, default 0.2
+	ChaseInterval  types.Duration `json:"chase_interval"`  // Time a chase order rests before it is reposted, default 5s
+	FallbackMarket bool           `json:"fallback_market"` // Complete an unfilled iceberg or chase with a market order
+}
@@ -22,4 +22,5 @@ type TwitterAPIEntityConfig struct {
 	APIKey      string                  `json:"api_key"`
 	Timeout     types.Interval          `json:"timeout"`
 	SearchItems []*TwitterAPISearchItem `json:"search_items"` // A list of scheduled search tasks
+	Summarize   bool                    `json:"summarize"`    // Summarize tweets with the news_summarization llm route before reporting
 }
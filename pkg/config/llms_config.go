@@ -1,36 +1,99 @@
 package config
 
+import (
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// LLMProviderConfig is the schema every provider config implements
+type LLMProviderConfig interface {
+	ModelName() string
+}
+
 type OpenAIConfig struct {
-	Token        string `json:"token"`
+	Token        string `json:"token"` // Overridable by LLM_<NAME>_TOKEN
 	Model        string `json:"model"`
 	BaseURL      string `json:"base_url"`
 	NoSystemRole *bool  `json:"no_system_role"`
 }
 
+func (cfg *OpenAIConfig) ModelName() string {
+	return cfg.Model
+}
+
 type OllamaConfig struct {
 	Model     string `json:"model"`
 	ServerURL string `json:"server_url"`
 	Format    string `json:"format"`
 }
 
+func (cfg *OllamaConfig) ModelName() string {
+	return cfg.Model
+}
+
 type AnthropicConfig struct {
-	Token            string `json:"token"`
+	Token            string `json:"token"` // Overridable by LLM_<NAME>_TOKEN
 	Model            string `json:"model"`
 	BaseURL          string `json:"base_url"`
 	ExtendedThinking bool   `json:"extended_thinking"`
 	ThinkingBudget   int64  `json:"thinking_budget"`
+	PromptCaching    *bool  `json:"prompt_caching"` // Cache the stable prompt prefix (default: true)
+}
+
+func (cfg *AnthropicConfig) ModelName() string {
+	return cfg.Model
 }
 
 type GoogleAIConfig struct {
-	APIKey string `json:"api_key"`
+	APIKey string `json:"api_key"` // Overridable by LLM_<NAME>_APIKEY
 	Model  string `json:"model"`
 }
 
+func (cfg *GoogleAIConfig) ModelName() string {
+	return cfg.Model
+}
+
 type LLMConfig struct {
-	Primary   string           `json:"primary,omitempty"`
-	Secondly  string           `json:"secondly,omitempty"`
-	OpenAI    *OpenAIConfig    `json:"openai,omitempty"`
-	Ollama    *OllamaConfig    `json:"ollama,omitempty"`
-	Anthropic *AnthropicConfig `json:"anthropic,omitempty"`
-	GoogleAI  *GoogleAIConfig  `json:"googleai,omitempty"`
+	Primary        string                   `json:"primary,omitempty"`
+	Secondly       string                   `json:"secondly,omitempty"`
+	Chain          []string                 `json:"chain,omitempty"`  // Ordered fallback chain of instance names, overrides primary and secondly
+	Routes         map[string][]string      `json:"routes,omitempty"` // Fallback chain per task type, unrouted tasks use the chain
+	OpenAI         *OpenAIConfig            `json:"openai,omitempty"`
+	Ollama         *OllamaConfig            `json:"ollama,omitempty"`
+	Anthropic      *AnthropicConfig         `json:"anthropic,omitempty"`
+	GoogleAI       *GoogleAIConfig          `json:"googleai,omitempty"`
+	Providers      []*LLMInstanceConfig     `json:"providers,omitempty"` // Named provider instances, several may share a type
+	CircuitBreaker *LLMCircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	Vision         map[string]bool          `json:"vision,omitempty"` // Whether an instance accepts images, overrides the provider default
+	Usage          *LLMUsageConfig          `json:"usage,omitempty"`
+}
+
+// LLMInstanceConfig is a named instance of a registered provider type
+type LLMInstanceConfig struct {
+	Name   string                 `json:"name"`   // Instance name used in the chain, e.g. deepseek
+	Type   string                 `json:"type"`   // Provider type: openai, anthropic, googleai or ollama
+	Config map[string]interface{} `json:"config"` // Decoded into the config schema of the provider type
+}
+
+// LLMCircuitBreakerConfig configures when a failing provider is skipped
+type LLMCircuitBreakerConfig struct {
+	FailureThreshold int            `json:"failure_threshold"` // Consecutive failures that open the breaker (default: 3)
+	OpenTimeout      types.Duration `json:"open_timeout"`      // How long a provider is skipped before it is probed again (default: 5m)
+	CallTimeout      types.Duration `json:"call_timeout"`      // Timeout per provider call, counted as a failure (default: 3m)
+}
+
+// LLMUsageConfig configures cost accounting and the daily spend cap
+type LLMUsageConfig struct {
+	Prices        map[string]*LLMPriceConfig `json:"prices"`          // Keyed by model name, or provider name as fallback
+	DailyCap      float64                    `json:"daily_cap"`       // USD per UTC day, checked before each call so the last calls can overshoot it, 0 means no cap
+	OverCapAction string                     `json:"over_cap_action"` // downgrade (default) to the fallback llms of the chain, or skip cycles
+	StatePath     string                     `json:"state_path"`      // Usage persistence file (default: data/llm_usage.json)
+	RetentionDays int                        `json:"retention_days"`  // Days of usage history kept (default: 90)
+}
+
+// LLMPriceConfig is the price in USD per million tokens
+type LLMPriceConfig struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
 }
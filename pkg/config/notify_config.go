@@ -3,4 +3,7 @@ package config
 type NotifyConfig struct {
 	Feishu     *NotifyFeishuConfig     `json:"feishu"`
 	FeishuHook *NotifyFeishuHookConfig `json:"feishu_hook"`
+	Slack      *NotifySlackConfig      `json:"slack"`
+	Discord    *NotifyDiscordConfig    `json:"discord"`
+	Webhook    *NotifyWebhookConfig    `json:"webhook"`
 }
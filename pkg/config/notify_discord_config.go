@@ -0,0 +1,7 @@
+package config
+
+type NotifyDiscordConfig struct {
+	Enabled  bool   `json:"enabled"`
+	URL      string `json:"url"`      // Discord channel webhook url
+	Username string `json:"username"` // Optional override of the webhook's default username
+}
@@ -0,0 +1,6 @@
+package config
+
+type NotifySlackConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"` // Slack incoming webhook url
+}
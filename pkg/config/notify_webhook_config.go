@@ -0,0 +1,20 @@
+package config
+
+import (
+	"github.com/c9s/bbgo/pkg/types"
+)
+
+// NotifyWebhookConfig configures the generic JSON webhook that receives
+// machine-readable trade events (decisions, orders and closed positions).
+type NotifyWebhookConfig struct {
+	Enabled       bool           `json:"enabled"`
+	URL           string         `json:"url"`
+	Secret        string         `json:"secret"`         // HMAC-SHA256 signing secret, overridable by NOTIFY_WEBHOOK_SECRET
+	Events        []string       `json:"events"`         // Event types to publish, empty means all
+	Timeout       types.Duration `json:"timeout"`        // HTTP timeout per request (default: 10s)
+	MaxRetries    int            `json:"max_retries"`    // Retries before an event is queued on disk (default: 3)
+	RetryBackoff  types.Duration `json:"retry_backoff"`  // Initial backoff, doubled on each retry (default: 1s)
+	QueuePath     string         `json:"queue_path"`     // Directory of the local disk queue (default: data/webhook-queue)
+	MaxQueueSize  int            `json:"max_queue_size"` // Maximum queued events, oldest are dropped (default: 1000)
+	FlushInterval types.Duration `json:"flush_interval"` // How often the disk queue is redelivered (default: 30s)
+}
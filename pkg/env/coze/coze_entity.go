@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +21,8 @@ type CozeEntity struct {
 	cozeClient coze.ICozeClient
 	config     *config.CozeEntityConfig
 	timers     map[string]*time.Ticker
+
+	eventChannel atomic.Value // Store chan types.IEvent for thread-safe access
 }
 
 // NewCozeEntity creates a new instance of CozeEntity with the given ID, Coze client, and configuration.
@@ -87,6 +90,15 @@ func (e *CozeEntity) Actions() []*types.ActionDesc {
 	return actions
 }
 
+// getEventChannel safely retrieves the event channel
+func (e *CozeEntity) getEventChannel() (chan types.IEvent, error) {
+	ch := e.eventChannel.Load()
+	if ch == nil {
+		return nil, fmt.Errorf("event channel not initialized, command can only be executed during Run()")
+	}
+	return ch.(chan types.IEvent), nil
+}
+
 // HandleCommand handles a command directed at the entity.
 func (e *CozeEntity) HandleCommand(ctx context.Context, cmd string, args map[string]string) error {
 	// Check if command matches a workflow
@@ -108,6 +120,11 @@ func (e *CozeEntity) HandleCommand(ctx context.Context, cmd string, args map[str
 
 // executeWorkflowCommand executes a Coze workflow command
 func (e *CozeEntity) executeWorkflowCommand(ctx context.Context, workflow *config.WorkflowIndicatorItem, args map[string]string) error {
+	ch, err := e.getEventChannel()
+	if err != nil {
+		return err
+	}
+
 	// Use workflow ID from args if provided, otherwise use configured ID
 	workflowID := workflow.WorkflowID
 	if providedID, ok := args["workflow_id"]; ok && providedID != "" {
@@ -142,12 +159,19 @@ func (e *CozeEntity) executeWorkflowCommand(ctx context.Context, workflow *confi
 		return fmt.Errorf("workflow execution failed: %s (code: %d)", resp.Msg, resp.Code)
 	}
 
+	types.EmitEvent(ctx, ch, NewCozeEvent(workflow.Name, workflow.Description, resp.Data))
+
 	log.WithField("workflowID", workflowID).WithField("response", resp.Data).Info("Workflow command executed successfully")
 	return nil
 }
 
 // executeBotCommand executes a Coze bot command
 func (e *CozeEntity) executeBotCommand(ctx context.Context, bot *config.IndicatorItem, args map[string]string) error {
+	ch, err := e.getEventChannel()
+	if err != nil {
+		return err
+	}
+
 	// Use message from args if provided, otherwise use configured message
 	message := bot.Message
 	if providedMsg, ok := args["message"]; ok && providedMsg != "" {
@@ -174,12 +198,23 @@ func (e *CozeEntity) executeBotCommand(ctx context.Context, bot *config.Indicato
 		return fmt.Errorf("bot execution failed: %s (code: %d)", response.Msg, response.Code)
 	}
 
+	sb := strings.Builder{}
+	for _, msg := range response.Messages {
+		if msg.Role == "assistant" && msg.Type == "answer" {
+			sb.WriteString(msg.Content)
+		}
+	}
+	types.EmitEvent(ctx, ch, NewCozeEvent(bot.Name, bot.Description, sb.String()))
+
 	log.WithField("botID", bot.BotID).Info("Bot command executed successfully")
 	return nil
 }
 
 // Run starts the entity's main loop and sets up scheduled tasks based on the entity's configuration.
 func (e *CozeEntity) Run(ctx context.Context, ch chan types.IEvent) {
+	// Store event channel for command execution using atomic operation
+	e.eventChannel.Store(ch)
+
 	log.Info("coze_run")
 
 	for _, item := range e.config.IndicatorItems {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -36,15 +37,25 @@ func (env *Environment) GetEntity(entityID string) IEntity {
 	return env.entites[entityID]
 }
 
+// Actions returns the actions of all entities ordered by entity ID, so prompts
+// listing them stay identical between cycles
 func (env *Environment) Actions() []*types.ActionDesc {
 	actions := make([]*types.ActionDesc, 0)
 
-	for _, ent := range env.entites {
+	entityIDs := make([]string, 0, len(env.entites))
+	for id := range env.entites {
+		entityIDs = append(entityIDs, id)
+	}
+	sort.Strings(entityIDs)
+
+	for _, id := range entityIDs {
+		ent := env.entites[id]
 		for _, action := range ent.Actions() {
 			actions = append(actions, &types.ActionDesc{
 				Name:        fmt.Sprintf("%s.%s", ent.GetID(), action.Name),
 				Description: action.Description,
 				Args:        action.Args,
+				Role:        action.Role,
 			})
 		}
 	}
@@ -52,6 +63,17 @@ func (env *Environment) Actions() []*types.ActionDesc {
 	return actions
 }
 
+// GetAction returns the descriptor of a full command name like "exchange.close_position"
+func (env *Environment) GetAction(fullCmd string) *types.ActionDesc {
+	for _, action := range env.Actions() {
+		if action.Name == fullCmd {
+			return action
+		}
+	}
+
+	return nil
+}
+
 func (env *Environment) SendCommand(ctx context.Context, fullCmd string, args map[string]string) error {
 	dotIndex := strings.Index(fullCmd, ".")
 	if dotIndex == -1 || strings.Contains(fullCmd[dotIndex+1:], ".") {
@@ -0,0 +1,700 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+	"github.com/yubing744/trading-gpt/pkg/utils"
+)
+
+// Entry plan arguments of the add_to_position action
+const (
+	ArgPlanSide        = "side"
+	ArgPlanLegs        = "legs"
+	ArgPlanLegOffset   = "leg_offset"
+	ArgPlanLegInterval = "leg_interval"
+	ArgPlanMaxExposure = "max_exposure"
+
+	MaxPlanLegs = 10
+
+	EventEntryPlanStopsFailed = "entry_plan_stops_failed"
+)
+
+// EntryLeg is a part of an entry plan. A price leg is a resting limit order
+// placed with the plan, a time leg a market order placed once At passed.
+type EntryLeg struct {
+	Price          fixedpoint.Value // Zero for a time leg
+	At             time.Time        // Zero for a price leg
+	Triggered      bool             // The order of the leg was placed
+	TriggeredAt    time.Time
+	FilledQuantity fixedpoint.Value // Base filled by the order of the leg
+	FilledPrice    fixedpoint.Value // Average price of the fills, zero before the first fill
+	Skipped        string           // Why the leg was not placed
+
+	placing   bool             // The order of the leg is being sent
+	stopsBase fixedpoint.Value // Filled base the stops of the plan were applied for
+	execution *Execution
+}
+
+// EntryPlan builds or adds to a position in legs, each sized by an equal
+// part of the quote ratio or risk of the plan. The stop-loss and take-profit
+// of the plan apply to the whole position after every leg.
+type EntryPlan struct {
+	Side        types.SideType
+	Legs        []*EntryLeg
+	QuoteRatio  *fixedpoint.Value // Total ratio of the available quote, split over the legs
+	RiskPercent *fixedpoint.Value // Total equity percent at risk, split over the legs
+	MaxExposure fixedpoint.Value  // Position funds ratio the legs are clamped to, zero for no limit
+	StopLoss    *fixedpoint.Value
+	TakeProfit  *fixedpoint.Value
+	CreatedAt   time.Time
+}
+
+// entryPlanState holds the entry plan of the entity
+type entryPlanState struct {
+	mu   sync.Mutex
+	plan *EntryPlan
+}
+
+// parseEntryPlan builds the plan of an add_to_position action, legs fill
+// at offsets from price, every interval from now, or at once
+func parseEntryPlan(side types.SideType, price fixedpoint.Value, now time.Time, args map[string]string) (*EntryPlan, error) {
+	plan := &EntryPlan{Side: side, CreatedAt: now}
+
+	legs := 1
+	if raw := strings.TrimSpace(args[ArgPlanLegs]); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > MaxPlanLegs {
+			return nil, errors.Errorf("invalid %s %q, use 1 to %d", ArgPlanLegs, raw, MaxPlanLegs)
+		}
+		legs = n
+	}
+
+	offsetArg := strings.TrimSpace(args[ArgPlanLegOffset])
+	intervalArg := strings.TrimSpace(args[ArgPlanLegInterval])
+	if offsetArg != "" && intervalArg != "" {
+		return nil, errors.Errorf("use either %s or %s", ArgPlanLegOffset, ArgPlanLegInterval)
+	}
+
+	switch {
+	case offsetArg != "":
+		// A positive offset adds on pullbacks, a negative one as price moves in favor
+		isPercent := strings.HasSuffix(offsetArg, "%")
+		offset, err := fixedpoint.NewFromString(strings.TrimSuffix(offsetArg, "%"))
+		if err != nil || offset.IsZero() {
+			return nil, errors.Errorf("invalid %s %q", ArgPlanLegOffset, offsetArg)
+		}
+		if isPercent {
+			offset = price.Mul(offset).Div(fixedpoint.NewFromInt(100))
+		}
+		if side == types.SideTypeSell {
+			offset = offset.Neg()
+		}
+
+		for i := 1; i <= legs; i++ {
+			legPrice := price.Sub(offset.Mul(fixedpoint.NewFromInt(int64(i))))
+			if legPrice.Sign() <= 0 {
+				return nil, errors.Errorf("%s %q puts leg %d below zero", ArgPlanLegOffset, offsetArg, i)
+			}
+			plan.Legs = append(plan.Legs, &EntryLeg{Price: legPrice})
+		}
+	case intervalArg != "":
+		interval, err := time.ParseDuration(intervalArg)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid %s %q", ArgPlanLegInterval, intervalArg)
+		}
+
+		for i := 0; i < legs; i++ {
+			plan.Legs = append(plan.Legs, &EntryLeg{At: now.Add(interval * time.Duration(i))})
+		}
+	default:
+		if legs > 1 {
+			return nil, errors.Errorf("%s needs %s or %s", ArgPlanLegs, ArgPlanLegOffset, ArgPlanLegInterval)
+		}
+		plan.Legs = append(plan.Legs, &EntryLeg{At: now})
+	}
+
+	if raw := strings.TrimSpace(args[ArgPlanMaxExposure]); raw != "" {
+		val, err := fixedpoint.NewFromString(strings.TrimSuffix(raw, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", ArgPlanMaxExposure)
+		}
+		if strings.HasSuffix(raw, "%") || val.Compare(fixedpoint.One) > 0 {
+			val = val.Div(fixedpoint.NewFromInt(100))
+		}
+		if val.Sign() <= 0 || val.Compare(fixedpoint.One) > 0 {
+			return nil, errors.Errorf("%s must be in (0, 1]", ArgPlanMaxExposure)
+		}
+		plan.MaxExposure = val
+	}
+
+	return plan, nil
+}
+
+// DueLegs returns the legs whose order is due: the price legs at once, as
+// resting limit orders, and the time legs once At passed
+func (p *EntryPlan) DueLegs(now time.Time) []*EntryLeg {
+	due := make([]*EntryLeg, 0)
+	for _, leg := range p.Legs {
+		if leg.Triggered || leg.placing || leg.Skipped != "" {
+			continue
+		}
+
+		if leg.At.IsZero() || !now.Before(leg.At) {
+			due = append(due, leg)
+		}
+	}
+
+	return due
+}
+
+// Done reports whether every leg was skipped, placed at market, or filled
+// by its limit order up to less than minQuantity
+func (p *EntryPlan) Done(minQuantity fixedpoint.Value) bool {
+	for _, leg := range p.Legs {
+		if leg.Skipped != "" || (leg.Triggered && !leg.At.IsZero()) {
+			continue
+		}
+
+		if !leg.Triggered || leg.unfilled().Compare(minQuantity) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unfilled returns the base of the order of a placed leg not filled yet
+func (leg *EntryLeg) unfilled() fixedpoint.Value {
+	if leg.execution == nil {
+		return fixedpoint.Zero
+	}
+
+	report := leg.execution.Report()
+	return fixedpoint.Max(report.TargetBase.Sub(report.FilledBase), fixedpoint.Zero)
+}
+
+// pendingExposure returns the value of the unfilled limit orders of the legs
+func (p *EntryPlan) pendingExposure() fixedpoint.Value {
+	pending := fixedpoint.Zero
+	for _, leg := range p.Legs {
+		if leg.Triggered && leg.At.IsZero() {
+			pending = pending.Add(leg.unfilled().Mul(leg.Price))
+		}
+	}
+
+	return pending
+}
+
+// newFills reports whether a leg filled more since the stops of the plan
+// were last applied, and marks its fills as applied
+func (p *EntryPlan) newFills() bool {
+	filled := false
+	for _, leg := range p.Legs {
+		if leg.FilledQuantity.Compare(leg.stopsBase) > 0 {
+			leg.stopsBase = leg.FilledQuantity
+			filled = true
+		}
+	}
+
+	return filled
+}
+
+// legOpts returns the sizing options of a leg
+func (p *EntryPlan) legOpts() []interface{} {
+	n := fixedpoint.NewFromInt(int64(len(p.Legs)))
+	opts := make([]interface{}, 0, 1)
+
+	if p.RiskPercent != nil && p.StopLoss != nil {
+		opts = append(opts, &RiskSizingOpt{
+			RiskPercent: p.RiskPercent.Div(n),
+			StopLoss:    *p.StopLoss,
+		})
+	} else if p.QuoteRatio != nil {
+		opts = append(opts, &QuoteRatioOpt{
+			Value: p.QuoteRatio.Div(n),
+		})
+	}
+
+	return opts
+}
+
+// String describes the plan and its legs for the prompt
+func (p *EntryPlan) String() string {
+	side := "long"
+	if p.Side == types.SideTypeSell {
+		side = "short"
+	}
+
+	parts := make([]string, 0, len(p.Legs))
+	for i, leg := range p.Legs {
+		target := leg.Price.String()
+		if !leg.At.IsZero() {
+			target = leg.At.UTC().Format(time.RFC3339)
+		}
+
+		state := "pending"
+		if leg.Triggered && leg.FilledQuantity.Sign() > 0 {
+			state = fmt.Sprintf("filled %s at %s", leg.FilledQuantity.String(), leg.FilledPrice.String())
+		} else if leg.Triggered {
+			state = "order placed"
+		} else if leg.Skipped != "" {
+			state = "skipped: " + leg.Skipped
+		}
+
+		parts = append(parts, fmt.Sprintf("leg%d %s (%s)", i+1, target, state))
+	}
+
+	text := fmt.Sprintf("%s entry in %d legs: %s", side, len(p.Legs), strings.Join(parts, ", "))
+	if p.MaxExposure.Sign() > 0 {
+		text += fmt.Sprintf(", max exposure %.2f%%", p.MaxExposure.Float64()*100)
+	}
+	if p.StopLoss != nil {
+		text += fmt.Sprintf(", position stop-loss %s", p.StopLoss.String())
+	}
+	if p.TakeProfit != nil {
+		text += fmt.Sprintf(", position take-profit %s", p.TakeProfit.String())
+	}
+
+	return text
+}
+
+// syncFills reads the fills of the triggered legs from their execution reports
+func (p *EntryPlan) syncFills() {
+	for _, leg := range p.Legs {
+		if leg.execution == nil {
+			continue
+		}
+
+		report := leg.execution.Report()
+		leg.FilledQuantity = report.FilledBase
+		leg.FilledPrice = report.AveragePrice()
+	}
+}
+
+// clone copies the plan for the prompt
+func (p *EntryPlan) clone() *EntryPlan {
+	c := *p
+	c.Legs = make([]*EntryLeg, 0, len(p.Legs))
+	for _, leg := range p.Legs {
+		l := *leg
+		c.Legs = append(c.Legs, &l)
+	}
+
+	return &c
+}
+
+// addToPosition starts an entry plan adding to the open position, or
+// opening one on the given side, and places the legs already due
+func (ent *ExchangeEntity) addToPosition(ctx context.Context, closePrice fixedpoint.Value, args map[string]string) error {
+	side := types.SideTypeBuy
+	if !ent.position.IsDust(closePrice) {
+		if ent.position.IsShort() {
+			side = types.SideTypeSell
+		}
+
+		if arg := strings.ToLower(strings.TrimSpace(args[ArgPlanSide])); arg != "" && arg != ent.sideName(side) {
+			return errors.Errorf("the %s position can not be added to on the %s side", ent.sideName(side), arg)
+		}
+	} else {
+		switch strings.ToLower(strings.TrimSpace(args[ArgPlanSide])) {
+		case "long":
+		case "short":
+			side = types.SideTypeSell
+		case "":
+			// Spot positions are long only
+			if !ent.spot() {
+				return errors.Errorf("%s long|short is required without an open position", ArgPlanSide)
+			}
+		default:
+			return errors.Errorf("%s long|short is required without an open position", ArgPlanSide)
+		}
+	}
+
+	plan, err := parseEntryPlan(side, closePrice, time.Now(), args)
+	if err != nil {
+		return err
+	}
+
+	if raw := strings.TrimSpace(args["quote_ratio"]); raw != "" {
+		ratio, err := fixedpoint.NewFromString(strings.TrimSuffix(raw, "%"))
+		if err != nil {
+			return errors.Wrap(err, "invalid quote_ratio")
+		}
+		if strings.HasSuffix(raw, "%") {
+			ratio = ratio.Div(fixedpoint.NewFromInt(100))
+		}
+		if ratio.Sign() <= 0 || ratio.Compare(fixedpoint.One) > 0 {
+			return errors.New("quote_ratio must be in (0, 1]")
+		}
+		plan.QuoteRatio = &ratio
+	}
+
+	if stopLoss := args["stop_loss_trigger_price"]; stopLoss != "" {
+		stop, err := utils.ParseStopLoss(ent.vm, side, closePrice, stopLoss)
+		if err != nil {
+			return errors.Wrapf(err, "the stop loss invalid: %s", stopLoss)
+		}
+		plan.StopLoss = stop
+	}
+
+	if takeProfit := args["take_profit_trigger_price"]; takeProfit != "" {
+		tp, err := utils.ParseTakeProfit(ent.vm, side, closePrice, takeProfit)
+		if err != nil {
+			return errors.Wrapf(err, "the take profit invalid: %s", takeProfit)
+		}
+		plan.TakeProfit = tp
+	}
+
+	riskPercent, err := ent.parseRiskPercent(args)
+	if err != nil {
+		return err
+	}
+	if riskPercent != nil && plan.QuoteRatio == nil {
+		if plan.StopLoss == nil {
+			return errors.Errorf("%s sizing requires stop_loss_trigger_price", ArgRiskPercent)
+		}
+		plan.RiskPercent = riskPercent
+	}
+
+	if plan.QuoteRatio == nil && plan.RiskPercent == nil {
+		return errors.Errorf("add_to_position requires quote_ratio or %s", ArgRiskPercent)
+	}
+
+	ent.entryPlan.mu.Lock()
+	replaced := ent.entryPlan.plan
+	if replaced != nil {
+		log.WithField("plan", replaced.String()).Info("entry_plan_replaced")
+	}
+	ent.entryPlan.plan = plan
+	ent.entryPlan.mu.Unlock()
+
+	if replaced != nil {
+		ent.cancelLegOrders(ctx, replaced)
+	}
+
+	ent.runEntryPlan(ctx, closePrice)
+	return nil
+}
+
+// cancelEntryPlan drops the pending legs of the entry plan and cancels
+// the resting orders of its legs
+func (ent *ExchangeEntity) cancelEntryPlan(ctx context.Context) error {
+	ent.entryPlan.mu.Lock()
+	plan := ent.entryPlan.plan
+	if plan == nil {
+		ent.entryPlan.mu.Unlock()
+		return errors.New("no entry plan")
+	}
+
+	ent.entryPlan.plan = nil
+	ent.publishEntryPlan()
+	ent.entryPlan.mu.Unlock()
+
+	ent.cancelLegOrders(ctx, plan)
+	return nil
+}
+
+// updateEntryPlan places the legs of the entry plan due at a new price
+func (ent *ExchangeEntity) updateEntryPlan(ctx context.Context, price fixedpoint.Value) {
+	ent.runEntryPlan(ctx, price)
+}
+
+// clearEntryPlan drops the entry plan once its position closed, the resting
+// orders of its legs are cancelled in the background
+func (ent *ExchangeEntity) clearEntryPlan(ctx context.Context) {
+	ent.entryPlan.mu.Lock()
+	plan := ent.entryPlan.plan
+	ent.entryPlan.plan = nil
+	ent.publishEntryPlan()
+	ent.entryPlan.mu.Unlock()
+
+	if plan != nil {
+		go ent.cancelLegOrders(ctx, plan)
+	}
+}
+
+// runEntryPlan places the orders of the due legs and applies the stops of
+// the plan to the position after new fills. The orders are sent outside of
+// the plan lock, the legs being sent are marked so no other caller sends them.
+func (ent *ExchangeEntity) runEntryPlan(ctx context.Context, price fixedpoint.Value) {
+	ent.entryPlan.mu.Lock()
+	plan := ent.entryPlan.plan
+	if plan == nil {
+		ent.entryPlan.mu.Unlock()
+		return
+	}
+
+	plan.syncFills()
+	filled := plan.newFills()
+	due := plan.DueLegs(time.Now())
+	for _, leg := range due {
+		leg.placing = true
+	}
+	ent.entryPlan.mu.Unlock()
+
+	for _, leg := range due {
+		// A market leg fills at once, its stops are applied without waiting for the fills
+		if ent.placeEntryLeg(ctx, plan, leg, price) && !leg.At.IsZero() {
+			filled = true
+		}
+	}
+
+	if filled {
+		ent.setPositionStops(ctx, plan.Side, price, plan.StopLoss, plan.TakeProfit)
+	}
+
+	ent.entryPlan.mu.Lock()
+	defer ent.entryPlan.mu.Unlock()
+
+	if ent.entryPlan.plan != plan {
+		return
+	}
+
+	if plan.Done(ent.position.Market.MinQuantity) {
+		log.WithField("plan", plan.String()).Info("entry_plan_done")
+		ent.entryPlan.plan = nil
+	}
+	ent.publishEntryPlan()
+}
+
+// placeEntryLeg sends the order of a leg, a limit order at the leg price or
+// a market order for a time leg. With a max exposure, the quantity is clamped
+// to the exposure left by the position and the unfilled legs. It returns
+// whether the order was placed.
+func (ent *ExchangeEntity) placeEntryLeg(ctx context.Context, plan *EntryPlan, leg *EntryLeg, price fixedpoint.Value) bool {
+	entry := price
+	opts := plan.legOpts()
+	if leg.At.IsZero() {
+		entry = leg.Price
+		opts = append(opts, &OrderTypeOpt{Type: types.OrderTypeLimit}, &LimitPriceOpt{Value: leg.Price})
+	}
+
+	var err error
+	if plan.MaxExposure.Sign() > 0 {
+		var room fixedpoint.Value
+		room, err = ent.exposureRoom(ctx, plan, price, entry)
+		if err == nil && room.Compare(ent.position.Market.MinQuantity) < 0 {
+			err = errors.New("max exposure reached")
+		} else if err == nil {
+			opts = append(opts, &MaxQuantityOpt{Value: room})
+		}
+	}
+
+	report := &ExecutionReportOpt{}
+	if err == nil {
+		err = ent.OpenPosition(ctx, plan.Side, price, append(opts, report)...)
+	}
+
+	ent.entryPlan.mu.Lock()
+	leg.placing = false
+	if err != nil {
+		leg.Skipped = err.Error()
+	} else {
+		// The fills of the order arrive with the trades, see syncFills
+		leg.Triggered = true
+		leg.TriggeredAt = time.Now()
+		leg.execution = report.Execution
+	}
+	current := ent.entryPlan.plan == plan
+	ent.entryPlan.mu.Unlock()
+
+	if err != nil {
+		log.WithError(err).WithField("price", entry).Error("entry_plan_leg_fail")
+		return false
+	}
+
+	log.WithField("price", entry).Info("entry_plan_leg_placed")
+
+	// The plan was replaced or cleared while the order was sent
+	if !current {
+		ent.cancelLegOrders(ctx, &EntryPlan{Legs: []*EntryLeg{leg}})
+	}
+
+	return true
+}
+
+// exposureRoom returns the base the plan may still add at the entry price
+// before the position and the unfilled limit orders of the legs reach the
+// max exposure of the plan
+func (ent *ExchangeEntity) exposureRoom(ctx context.Context, plan *EntryPlan, price, entry fixedpoint.Value) (fixedpoint.Value, error) {
+	netValue, err := bbgo.NewAccountValueCalculator(ent.session, ent.position.QuoteCurrency).NetValue(ctx)
+	if err != nil {
+		return fixedpoint.Zero, errors.Wrap(err, "can not calculate the account net value for max exposure")
+	}
+
+	ent.entryPlan.mu.Lock()
+	pending := plan.pendingExposure()
+	ent.entryPlan.mu.Unlock()
+
+	exposure := ent.position.GetBase().Abs().Mul(price).Add(pending)
+	room := plan.MaxExposure.Mul(netValue).Sub(exposure)
+	if room.Sign() <= 0 || entry.Sign() <= 0 {
+		return fixedpoint.Zero, nil
+	}
+
+	return room.Div(entry), nil
+}
+
+// cancelLegOrders cancels the orders of the legs of a plan still resting on the exchange
+func (ent *ExchangeEntity) cancelLegOrders(ctx context.Context, plan *EntryPlan) {
+	ent.entryPlan.mu.Lock()
+	orders := make([]types.Order, 0)
+	for _, leg := range plan.Legs {
+		if leg.execution == nil {
+			continue
+		}
+
+		for _, orderID := range leg.execution.orderIDs() {
+			if order, ok := ent.orderExecutor.ActiveMakerOrders().Get(orderID); ok {
+				orders = append(orders, order)
+			}
+		}
+	}
+	ent.entryPlan.mu.Unlock()
+
+	if len(orders) == 0 {
+		return
+	}
+
+	if err := ent.orderExecutor.CancelOrders(ctx, orders...); err != nil {
+		log.WithError(err).WithField("order_count", len(orders)).Warn("entry_plan_cancel_orders_fail")
+		return
+	}
+
+	log.WithField("order_count", len(orders)).Info("entry_plan_orders_cancelled")
+}
+
+// owns reports whether the order is the one of a leg of the plan
+func (s *entryPlanState) owns(orderID uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.plan == nil {
+		return false
+	}
+
+	for _, leg := range s.plan.Legs {
+		if leg.execution == nil {
+			continue
+		}
+
+		for _, id := range leg.execution.orderIDs() {
+			if id == orderID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// publishEntryPlan copies the entry plan to the position for the prompt
+func (ent *ExchangeEntity) publishEntryPlan() {
+	if ent.position == nil {
+		return
+	}
+
+	ent.position.EntryPlan = nil
+	if ent.entryPlan.plan != nil {
+		ent.entryPlan.plan.syncFills()
+		ent.position.EntryPlan = ent.entryPlan.plan.clone()
+	}
+}
+
+// setPositionStops applies the stop-loss and take-profit of a plan to the
+// whole position, on the exchange when it supports position updates and
+// through the local exits otherwise. A take-profit ladder of the position is
+// kept over the take-profit of the plan.
+func (ent *ExchangeEntity) setPositionStops(ctx context.Context, side types.SideType, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) {
+	ent.exitMu.Lock()
+	hasLadder := ent.takeProfitLadder != nil
+	ent.unlockExits()
+
+	if hasLadder && takeProfit != nil {
+		log.WithField("take_profit", *takeProfit).Info("entry_plan_take_profit_kept_ladder")
+		takeProfit = nil
+	}
+
+	if stopLoss == nil && takeProfit == nil {
+		return
+	}
+
+	if ent.canAmendStop() {
+		opts := make([]interface{}, 0, 2)
+		if stopLoss != nil {
+			opts = append(opts, &StopLossPrice{Value: *stopLoss})
+		}
+		if takeProfit != nil {
+			opts = append(opts, &TakeProfitPrice{Value: *takeProfit})
+		}
+
+		err := ent.UpdatePositionV2(ctx, side, price, opts...)
+		if err == nil {
+			ent.exitMu.Lock()
+			if stopLoss != nil && ent.trailingStop != nil {
+				ent.trailingStop.Stop = *stopLoss
+				ent.publishExits()
+			}
+			ent.unlockExits()
+			return
+		}
+
+		// The local exits take over, the agent is told the exchange ones were not set
+		log.WithError(err).Error("entry_plan_stops_update_fail")
+		ent.emitEntryPlanError(ctx, errors.Wrap(err, "the stops of the entry plan could not be set on the exchange, they are enforced locally"))
+	}
+
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	if stopLoss != nil {
+		if ent.trailingStop == nil {
+			ent.trailingStop = &TrailingStop{}
+		}
+		ent.trailingStop.Stop = *stopLoss
+	}
+
+	if takeProfit != nil && ent.takeProfitLadder == nil {
+		ent.takeProfitLadder = &TakeProfitLadder{Levels: []*TakeProfitLevel{
+			{Price: *takeProfit, Percent: fixedpoint.NewFromInt(100)},
+		}}
+	}
+
+	ent.publishExits()
+}
+
+// emitEntryPlanError reports a failure of the entry plan to the agent. The
+// event is sent in the background, the kline and trade callbacks run the plan.
+func (ent *ExchangeEntity) emitEntryPlanError(ctx context.Context, err error) {
+	ch, chErr := ent.getEventChannel()
+	if chErr != nil {
+		return
+	}
+
+	evt := ttypes.NewEvent(EventEntryPlanStopsFailed, err.Error())
+	if _, ok := ttypes.CommandOutputFromContext(ctx); ok {
+		ttypes.EmitEvent(ctx, ch, evt)
+		return
+	}
+
+	go ent.emitEvent(ch, evt)
+}
+
+func (ent *ExchangeEntity) sideName(side types.SideType) string {
+	if side == types.SideTypeSell {
+		return "short"
+	}
+
+	return "long"
+}
@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntryPlan(t *testing.T) {
+	now := time.Date(2025, 1, 23, 10, 0, 0, 0, time.UTC)
+
+	plan, err := parseEntryPlan(types.SideTypeBuy, num(2), now, map[string]string{})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Legs, 1)
+	assert.Equal(t, now, plan.Legs[0].At)
+
+	plan, err = parseEntryPlan(types.SideTypeBuy, num(2), now, map[string]string{
+		ArgPlanLegs:        "3",
+		ArgPlanLegOffset:   "1%",
+		ArgPlanMaxExposure: "60%",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.98", "1.96", "1.94"}, legPrices(plan))
+	assert.Equal(t, num(0.6), plan.MaxExposure)
+
+	// Shorts add on rallies, a negative offset pyramids
+	plan, err = parseEntryPlan(types.SideTypeSell, num(2), now, map[string]string{
+		ArgPlanLegs:      "2",
+		ArgPlanLegOffset: "-0.1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.9", "1.8"}, legPrices(plan))
+
+	plan, err = parseEntryPlan(types.SideTypeBuy, num(2), now, map[string]string{
+		ArgPlanLegs:        "3",
+		ArgPlanLegInterval: "15m",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(30*time.Minute), plan.Legs[2].At)
+
+	invalid := []map[string]string{
+		{ArgPlanLegs: "0"},
+		{ArgPlanLegs: "11", ArgPlanLegOffset: "1%"},
+		{ArgPlanLegs: "2"},
+		{ArgPlanLegs: "2", ArgPlanLegOffset: "1%", ArgPlanLegInterval: "1h"},
+		{ArgPlanLegOffset: "0"},
+		{ArgPlanLegInterval: "-1h"},
+		{ArgPlanLegs: "3", ArgPlanLegOffset: "1"},
+		{ArgPlanMaxExposure: "0"},
+	}
+	for _, args := range invalid {
+		_, err := parseEntryPlan(types.SideTypeBuy, num(2), now, args)
+		assert.Error(t, err, "args %v", args)
+	}
+}
+
+func TestEntryPlan_DueLegs(t *testing.T) {
+	now := time.Date(2025, 1, 23, 10, 0, 0, 0, time.UTC)
+
+	plan, err := parseEntryPlan(types.SideTypeBuy, num(2), now, map[string]string{
+		ArgPlanLegs:      "2",
+		ArgPlanLegOffset: "0.1",
+	})
+	assert.NoError(t, err)
+
+	// The price legs are placed at once as resting limit orders
+	due := plan.DueLegs(now)
+	assert.Len(t, due, 2)
+	due[0].placing = true
+	assert.Len(t, plan.DueLegs(now), 1)
+
+	due[0].placing = false
+	due[0].Triggered = true
+	due[0].execution = newExecution(ExecutionMarket, "open", types.SideTypeBuy, num(1.9), num(10))
+	due[0].execution.addOrders(types.OrderSlice{{OrderID: 1}})
+	plan.Legs[1].Skipped = "max exposure reached"
+	assert.Empty(t, plan.DueLegs(now))
+	assert.Equal(t, num(19), plan.pendingExposure())
+	assert.False(t, plan.Done(num(0.1)))
+	assert.Contains(t, plan.String(), "leg2 1.8 (skipped: max exposure reached)")
+
+	// The plan is done once the limit order of the leg filled
+	due[0].execution.recordTrade(types.Trade{OrderID: 1, Price: num(1.9), Quantity: num(9.95)})
+	plan.syncFills()
+	assert.True(t, plan.newFills())
+	assert.False(t, plan.newFills())
+	assert.True(t, plan.Done(num(0.1)))
+
+	timed, err := parseEntryPlan(types.SideTypeSell, num(2), now, map[string]string{
+		ArgPlanLegs:        "2",
+		ArgPlanLegInterval: "1h",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, timed.DueLegs(now), 1)
+	assert.Len(t, timed.DueLegs(now.Add(time.Hour)), 2)
+
+	// A time leg is a market order, done once placed
+	timed.Legs[0].Triggered = true
+	timed.Legs[1].Triggered = true
+	assert.True(t, timed.Done(num(0.1)))
+}
+
+func TestEntryPlan_SyncFills(t *testing.T) {
+	now := time.Date(2025, 1, 23, 10, 0, 0, 0, time.UTC)
+
+	plan, err := parseEntryPlan(types.SideTypeBuy, num(2), now, map[string]string{})
+	assert.NoError(t, err)
+
+	exec := newExecution(ExecutionMarket, "open", types.SideTypeBuy, num(2), num(10))
+	exec.addOrders(types.OrderSlice{{OrderID: 1}})
+
+	leg := plan.Legs[0]
+	leg.Triggered = true
+	leg.execution = exec
+	plan.syncFills()
+	assert.Contains(t, plan.String(), "leg1 2025-01-23T10:00:00Z (order placed)")
+
+	// The leg reports the fills of its order, not the trigger price
+	exec.recordTrade(types.Trade{OrderID: 1, Price: num(2.02), Quantity: num(4)})
+	exec.recordTrade(types.Trade{OrderID: 1, Price: num(2.04), Quantity: num(6)})
+	plan.syncFills()
+	assert.Equal(t, num(10), leg.FilledQuantity)
+	assert.Equal(t, num(2.032), leg.FilledPrice)
+	assert.Contains(t, plan.String(), "(filled 10 at 2.032)")
+}
+
+func TestSetPositionStops_KeepsLadder(t *testing.T) {
+	ent := &ExchangeEntity{position: NewPositionX(types.NewPositionFromMarket(ledgerMarket))}
+	ladder := &TakeProfitLadder{Levels: []*TakeProfitLevel{
+		{Price: num(2.1), Percent: num(50)},
+		{Price: num(2.2), Percent: num(50)},
+	}}
+	ent.setTakeProfitLadder(ladder)
+
+	stop, takeProfit := num(1.8), num(2.3)
+	ent.setPositionStops(context.Background(), types.SideTypeBuy, num(2), &stop, &takeProfit)
+
+	assert.Same(t, ladder, ent.takeProfitLadder)
+	assert.Len(t, ent.takeProfitLadder.Levels, 2)
+	assert.Equal(t, num(1.8), ent.trailingStop.Stop)
+
+	// Without a ladder the take-profit of the plan closes the whole position
+	ent.setTakeProfitLadder(nil)
+	ent.setPositionStops(context.Background(), types.SideTypeBuy, num(2), nil, &takeProfit)
+	assert.Equal(t, num(2.3), ent.takeProfitLadder.Levels[0].Price)
+	assert.Equal(t, num(100), ent.takeProfitLadder.Levels[0].Percent)
+}
+
+func legPrices(plan *EntryPlan) []string {
+	prices := make([]string, 0, len(plan.Legs))
+	for _, leg := range plan.Legs {
+		prices = append(prices, leg.Price.String())
+	}
+
+	return prices
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -58,6 +59,29 @@ type ExchangeEntity struct {
 	eventChannel              atomic.Value // Store chan ttypes.IEvent for thread-safe access
 	dynamicIndicatorCount     atomic.Int32 // Track dynamic indicator requests per cycle
 	dynamicIndicatorCycleTime time.Time    // Track current cycle start time
+
+	exitMu           sync.Mutex        // Guards the trailing stop and take-profit ladder state
+	trailingStop     *TrailingStop     // Trailing stop of the open position, nil if none
+	takeProfitLadder *TakeProfitLadder // Take-profit tiers of the open position, nil if none
+	pendingAmend     bool              // Whether the exchange stop lags the trailing stop
+	lastAmend        time.Time         // Last exchange stop amendment
+	amending         bool              // Whether an amendment of the exchange stop is being placed
+	amendFailing     bool              // Whether the last amendment failed, the stop is then enforced locally
+	exitClosing      bool              // Whether the close of an exit is being placed
+	exitsCleared     atomic.Uint64     // Position generation + 1 of a clear asked while exitMu was held, 0 if none
+	positionGen      atomic.Uint64     // Generation of the position, bumped when one is opened from flat
+
+	entryPlan  entryPlanState   // Pending legs of add_to_position
+	executions executionTracker // Running and recent order executions
+	ledger     positionLedger   // Account fills of the position for the close reason and realized profit
+	runCtx     context.Context  // Context of Run for background executions
+
+	positionSide PositionSide    // Leg of the entity in hedge mode, empty for a net position
+	parent       *ExchangeEntity // Long leg entity of the short leg in hedge mode
+	shortLeg     *ExchangeEntity // Short leg in hedge mode, the entity trades the long leg
+
+	spotExits spotExitState // OCO order of the spot position
+	services  interface{}   // Exchange services missing from the session exchange, nil if none
 }
 
 func NewExchangeEntity(
@@ -69,6 +93,11 @@ func NewExchangeEntity(
 	orderExecutor *bbgo.GeneralOrderExecutor,
 	position *types.Position,
 ) *ExchangeEntity {
+	// Spot positions are not leveraged
+	if cfg != nil && cfg.Spot.Enabled {
+		leverage = fixedpoint.One
+	}
+
 	return &ExchangeEntity{
 		symbol:        symbol,
 		interval:      interval,
@@ -81,15 +110,32 @@ func NewExchangeEntity(
 	}
 }
 
+// SetExchangeServices sets an adapter implementing the exchange services the
+// session exchange lacks, such as OCOOrderService
+func (ent *ExchangeEntity) SetExchangeServices(services interface{}) {
+	ent.root().services = services
+}
+
+// exchangeService returns the exchange services adapter, or the session
+// exchange without one, for the service type assertions
+func (ent *ExchangeEntity) exchangeService() interface{} {
+	if services := ent.root().services; services != nil {
+		return services
+	}
+
+	return ent.session.Exchange
+}
+
 func (ent *ExchangeEntity) GetID() string {
 	return "exchange"
 }
 
 func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
-	return []*ttypes.ActionDesc{
+	actions := []*ttypes.ActionDesc{
 		{
 			Name:        "open_long_position",
 			Description: "Open long position (supports market and limit orders; unfilled limit orders auto-cancel at next cycle)",
+			Role:        ttypes.RoleOperator,
 			Args: []ttypes.ArgmentDesc{
 				{
 					Name:        "order_type",
@@ -105,12 +151,36 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 				},
 				{
 					Name:        "post_only",
-					Description: "Post only: true|false (default: false, maker only)",
+					Description: "Post only: true|false (default: false), places the limit order as maker only",
 				},
 				{
 					Name:        "quote_ratio",
 					Description: "Optional ratio (0-1] of available quote balance to use before leverage",
 				},
+				{
+					Name:        "risk_percent",
+					Description: "Optional percent of account equity to lose at the stop-loss, sizes the position from the stop distance instead of quote_ratio",
+				},
+				{
+					Name:        "execution",
+					Description: "Execution algorithm: market|twap|iceberg|chase (default: market; chase reposts a post-only order at the best bid/ask)",
+				},
+				{
+					Name:        "execution_duration",
+					Description: "TWAP duration, iceberg and chase timeout, e.g. 5m",
+				},
+				{
+					Name:        "execution_slices",
+					Description: "Number of TWAP slices (default: 5)",
+				},
+				{
+					Name:        "iceberg_visible",
+					Description: "Visible part of the iceberg size, ratio (0-1] (default: 0.2)",
+				},
+				{
+					Name:        "fallback_market",
+					Description: "true|false, complete an unfilled iceberg or chase with a market order at timeout",
+				},
 				{
 					Name:        "stop_loss_trigger_price",
 					Description: "Stop-loss trigger price",
@@ -119,6 +189,26 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 					Name:        "take_profit_trigger_price",
 					Description: "Take-profit trigger price",
 				},
+				{
+					Name:        "take_profit_levels",
+					Description: "Optional take-profit ladder of price:percent tiers closing parts of the position, e.g. '1.82:30%,1.90:40%,2.00:30%'",
+				},
+				{
+					Name:        "stop_after_tp1",
+					Description: "Optional stop-loss after the first tier fills: break_even or a price",
+				},
+				{
+					Name:        "trailing_stop_mode",
+					Description: "Optional trailing stop mode: distance|percent|atr, the stop follows the best price and only tightens",
+				},
+				{
+					Name:        "trailing_stop_distance",
+					Description: "Trailing distance: price offset for distance, percent of price for percent, ATR(14) multiple for atr",
+				},
+				{
+					Name:        "break_even_trigger_percent",
+					Description: "Optional: move the stop-loss to the entry price once price moves this percent in favor (e.g., 1.5)",
+				},
 			},
 			Samples: []ttypes.Sample{
 				{
@@ -137,6 +227,7 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 		{
 			Name:        "open_short_position",
 			Description: "Open short position (supports market and limit orders; unfilled limit orders auto-cancel at next cycle)",
+			Role:        ttypes.RoleOperator,
 			Args: []ttypes.ArgmentDesc{
 				{
 					Name:        "order_type",
@@ -152,12 +243,36 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 				},
 				{
 					Name:        "post_only",
-					Description: "Post only: true|false (default: false, maker only)",
+					Description: "Post only: true|false (default: false), places the limit order as maker only",
 				},
 				{
 					Name:        "quote_ratio",
 					Description: "Optional ratio (0-1] of available quote balance to use before leverage",
 				},
+				{
+					Name:        "risk_percent",
+					Description: "Optional percent of account equity to lose at the stop-loss, sizes the position from the stop distance instead of quote_ratio",
+				},
+				{
+					Name:        "execution",
+					Description: "Execution algorithm: market|twap|iceberg|chase (default: market; chase reposts a post-only order at the best bid/ask)",
+				},
+				{
+					Name:        "execution_duration",
+					Description: "TWAP duration, iceberg and chase timeout, e.g. 5m",
+				},
+				{
+					Name:        "execution_slices",
+					Description: "Number of TWAP slices (default: 5)",
+				},
+				{
+					Name:        "iceberg_visible",
+					Description: "Visible part of the iceberg size, ratio (0-1] (default: 0.2)",
+				},
+				{
+					Name:        "fallback_market",
+					Description: "true|false, complete an unfilled iceberg or chase with a market order at timeout",
+				},
 				{
 					Name:        "stop_loss_trigger_price",
 					Description: "Stop-loss trigger price",
@@ -166,6 +281,26 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 					Name:        "take_profit_trigger_price",
 					Description: "Take-profit trigger price",
 				},
+				{
+					Name:        "take_profit_levels",
+					Description: "Optional take-profit ladder of price:percent tiers closing parts of the position, e.g. '1.82:30%,1.90:40%,2.00:30%'",
+				},
+				{
+					Name:        "stop_after_tp1",
+					Description: "Optional stop-loss after the first tier fills: break_even or a price",
+				},
+				{
+					Name:        "trailing_stop_mode",
+					Description: "Optional trailing stop mode: distance|percent|atr, the stop follows the best price and only tightens",
+				},
+				{
+					Name:        "trailing_stop_distance",
+					Description: "Trailing distance: price offset for distance, percent of price for percent, ATR(14) multiple for atr",
+				},
+				{
+					Name:        "break_even_trigger_percent",
+					Description: "Optional: move the stop-loss to the entry price once price moves this percent in favor (e.g., 1.5)",
+				},
 			},
 			Samples: []ttypes.Sample{
 				{
@@ -183,7 +318,8 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 		},
 		{
 			Name:        "update_position",
-			Description: "Update position stop-loss/take-profit",
+			Description: "Update position stop-loss/take-profit and trailing stop",
+			Role:        ttypes.RoleOperator,
 			Args: []ttypes.ArgmentDesc{
 				{
 					Name:        "stop_loss_trigger_price",
@@ -193,6 +329,18 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 					Name:        "take_profit_trigger_price",
 					Description: "Take-profit trigger price",
 				},
+				{
+					Name:        "trailing_stop_mode",
+					Description: "Optional trailing stop mode: distance|percent|atr, the stop follows the best price and only tightens",
+				},
+				{
+					Name:        "trailing_stop_distance",
+					Description: "Trailing distance: price offset for distance, percent of price for percent, ATR(14) multiple for atr",
+				},
+				{
+					Name:        "break_even_trigger_percent",
+					Description: "Optional: move the stop-loss to the entry price once price moves this percent in favor (e.g., 1.5)",
+				},
 			},
 			Samples: []ttypes.Sample{
 				{
@@ -207,9 +355,69 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 				},
 			},
 		},
+		{
+			Name:        "add_to_position",
+			Description: "Add to the open position, or build one, now or in legs at price offsets or time intervals (legs fill at market when due)",
+			Role:        ttypes.RoleOperator,
+			Args: []ttypes.ArgmentDesc{
+				{
+					Name:        "side",
+					Description: "long|short, required without an open position",
+				},
+				{
+					Name:        "quote_ratio",
+					Description: "Total ratio (0-1] of the available quote balance, split evenly over the legs",
+				},
+				{
+					Name:        "risk_percent",
+					Description: "Total percent of account equity to lose at the stop-loss, split evenly over the legs (requires stop_loss_trigger_price)",
+				},
+				{
+					Name:        "legs",
+					Description: "Number of legs, 1-10 (default: 1)",
+				},
+				{
+					Name:        "leg_offset",
+					Description: "Price step between legs, as price or percent like 0.5%; positive adds on pullbacks, negative as price moves in favor",
+				},
+				{
+					Name:        "leg_interval",
+					Description: "Time between legs like 15m, the first leg fills now",
+				},
+				{
+					Name:        "max_exposure",
+					Description: "Optional position exposure ratio of equity (0-1] above which legs are skipped",
+				},
+				{
+					Name:        "stop_loss_trigger_price",
+					Description: "Stop-loss of the whole position, applied after every leg",
+				},
+				{
+					Name:        "take_profit_trigger_price",
+					Description: "Take-profit of the whole position, applied after every leg",
+				},
+			},
+			Samples: []ttypes.Sample{
+				{
+					Input: []string{
+						"The current position is long, average cost: 1.75",
+						"Price pulls back to support with the trend intact, scale in",
+					},
+					Output: []string{
+						"Execute cmd: /add_to_position quote_ratio=0.3 legs=3 leg_offset=0.5% max_exposure=0.6 stop_loss_trigger_price=1.68",
+					},
+				},
+			},
+		},
+		{
+			Name:        "cancel_entry_plan",
+			Description: "Cancel the pending legs of the entry plan",
+			Role:        ttypes.RoleOperator,
+		},
 		{
 			Name:        "close_position",
 			Description: "close position",
+			Role:        ttypes.RoleOperator,
 			Args: []ttypes.ArgmentDesc{
 				{
 					Name:        "percentage",
@@ -223,6 +431,26 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 					Name:        "profit_amount",
 					Description: "Optional profit amount in quote currency to realize",
 				},
+				{
+					Name:        "execution",
+					Description: "Execution algorithm: market|twap|iceberg|chase (default: market; chase reposts a post-only order at the best bid/ask)",
+				},
+				{
+					Name:        "execution_duration",
+					Description: "TWAP duration, iceberg and chase timeout, e.g. 5m",
+				},
+				{
+					Name:        "execution_slices",
+					Description: "Number of TWAP slices (default: 5)",
+				},
+				{
+					Name:        "iceberg_visible",
+					Description: "Visible part of the iceberg size, ratio (0-1] (default: 0.2)",
+				},
+				{
+					Name:        "fallback_market",
+					Description: "true|false, complete an unfilled iceberg or chase with a market order at timeout",
+				},
 			},
 			Samples: []ttypes.Sample{
 				{
@@ -317,6 +545,8 @@ func (ent *ExchangeEntity) Actions() []*ttypes.ActionDesc {
 			},
 		},
 	}
+
+	return ent.spotActions(ent.futuresActions(actions))
 }
 
 func (ent *ExchangeEntity) cmdToSide(cmd string) types.SideType {
@@ -358,6 +588,19 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 		return ent.executeGetIndicator(ctx, args)
 	}
 
+	if err := ent.checkSpotCommand(cmd, args); err != nil {
+		return err
+	}
+
+	// Commands of the short leg are handled by its entity in hedge mode
+	leg, err := ent.commandLeg(cmd, args)
+	if err != nil {
+		return err
+	}
+	if leg != ent {
+		return leg.HandleCommand(ctx, cmd, args)
+	}
+
 	if ent.KLineWindow == nil {
 		log.Warn("skip for current kline nil")
 		return errors.New("current kline nil")
@@ -365,6 +608,13 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 
 	closePrice := ent.KLineWindow.GetClose()
 
+	switch cmd {
+	case "add_to_position":
+		return ent.addToPosition(ctx, closePrice, args)
+	case "cancel_entry_plan":
+		return ent.cancelEntryPlan(ctx)
+	}
+
 	// close position if need
 	if cmd == "close_position" {
 		// TP/SL if there's non-dust position and meets the criteria
@@ -447,7 +697,12 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 					WithField("modeArgs", args).
 					Info("executing close_position command")
 
-				err := ent.ClosePosition(ctx, closePercentage, closePrice)
+				execution, err := ent.parseExecution(args)
+				if err != nil {
+					return err
+				}
+
+				err = ent.ClosePosition(context.WithValue(ctx, "execution", execution), closePercentage, closePrice)
 				if err != nil {
 					return errors.Wrap(err, "close position error")
 				}
@@ -508,14 +763,32 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 				}
 			} else {
 				if (cmd == "open_long_position" || cmd == "open_short_position") && quoteRatio == nil {
-					return errors.Errorf("existing %s position has the same direction with the signal", ent.symbol)
+					return errors.Errorf("existing %s position has the same direction with the signal, use add_to_position to add to it", ent.symbol)
 				}
 			}
 		}
 
+		trailing, err := ParseTrailingStop(args)
+		if err != nil {
+			return errors.Wrap(err, "the trailing stop invalid")
+		}
+
+		var ladder *TakeProfitLadder
+		if cmd == "open_long_position" || cmd == "open_short_position" {
+			ladder, err = ParseTakeProfitLadder(ent.vm, ent.KLineWindow, side, closePrice, args)
+			if err != nil {
+				return errors.Wrap(err, "the take profit levels invalid")
+			}
+
+			if ladder != nil && args["take_profit_trigger_price"] != "" {
+				return errors.New("use either take_profit_trigger_price or take_profit_levels")
+			}
+		}
+
 		opts := make([]interface{}, 0)
 
 		// config stop losss
+		var initialStop *fixedpoint.Value
 		if stopLoss, ok := args["stop_loss_trigger_price"]; ok && stopLoss != "" {
 			stopLoss, err := utils.ParseStopLoss(ent.vm, side, closePrice, stopLoss)
 			if err != nil {
@@ -523,6 +796,7 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 			}
 
 			if stopLoss != nil {
+				initialStop = stopLoss
 				opts = append(opts, &StopLossPrice{
 					Value: *stopLoss,
 				})
@@ -578,6 +852,58 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 			})
 		}
 
+		if cmd == "open_long_position" || cmd == "open_short_position" {
+			riskPercent, err := ent.parseRiskPercent(args)
+			if err != nil {
+				return err
+			}
+
+			if riskPercent != nil && args[ArgRiskPercent] != "" && quoteRatio != nil {
+				return errors.Errorf("use either quote_ratio or %s", ArgRiskPercent)
+			}
+
+			if riskPercent != nil && quoteRatio == nil {
+				entry := closePrice
+				for _, opt := range opts {
+					if lp, ok := opt.(*LimitPriceOpt); ok {
+						entry = lp.Value
+					}
+				}
+
+				if initialStop == nil {
+					initialStop = ent.volatilityStop(side, entry)
+					if initialStop == nil {
+						return errors.Errorf("%s sizing requires stop_loss_trigger_price", ArgRiskPercent)
+					}
+
+					opts = append(opts, &StopLossPrice{
+						Value: *initialStop,
+					})
+				}
+
+				if (side == types.SideTypeBuy && initialStop.Compare(entry) >= 0) ||
+					(side == types.SideTypeSell && initialStop.Compare(entry) <= 0) {
+					return errors.Errorf("stop loss %s is on the wrong side of the entry %s", initialStop.String(), entry.String())
+				}
+
+				opts = append(opts, &RiskSizingOpt{
+					RiskPercent: *riskPercent,
+					StopLoss:    *initialStop,
+				})
+			}
+		}
+
+		if cmd == "open_long_position" || cmd == "open_short_position" {
+			execution, err := ent.parseExecution(args)
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, &ExecutionOpt{
+				Params: execution,
+			})
+		}
+
 		if quoteRatio != nil {
 			opts = append(opts, &QuoteRatioOpt{
 				Value: *quoteRatio,
@@ -599,16 +925,51 @@ func (ent *ExchangeEntity) HandleCommand(ctx context.Context, cmd string, args m
 		log.Infof("open %s position for signal %v, options: %v", ent.symbol, side, opts)
 
 		if cmd == "open_long_position" || cmd == "open_short_position" {
-			err := ent.OpenPosition(ctx, side, closePrice, opts...)
+			leverage, err := ent.parseLeverage(args)
 			if err != nil {
-				return errors.Wrap(err, "open position error")
+				return err
 			}
-		} else if cmd == "update_position" {
-			side := ent.getPositionSide(ent.position)
-			err := ent.UpdatePositionV2(ctx, side, closePrice, opts...)
+
+			if leverage != nil {
+				err = ent.applyLeverage(ctx, *leverage)
+				if err != nil {
+					return errors.Wrap(err, "apply leverage error")
+				}
+			}
+
+			err = ent.OpenPosition(ctx, side, closePrice, opts...)
 			if err != nil {
 				return errors.Wrap(err, "open position error")
 			}
+
+			if trailing != nil {
+				ent.setTrailingStop(trailing, initialStop)
+			}
+
+			if ladder != nil {
+				ent.setTakeProfitLadder(ladder)
+			}
+		} else if cmd == "update_position" {
+			if trailing != nil && ent.position.IsDust(closePrice) {
+				return errors.New("no existing open position for the trailing stop")
+			}
+
+			// A trailing stop alone is kept locally, it must not reopen the position
+			if len(opts) > 0 {
+				side := ent.getPositionSide(ent.position)
+				err := ent.UpdatePositionV2(ctx, side, closePrice, opts...)
+				if err != nil {
+					return errors.Wrap(err, "open position error")
+				}
+			}
+
+			if trailing != nil {
+				if initialStop == nil {
+					initialStop = ent.currentStop()
+				}
+
+				ent.setTrailingStop(trailing, initialStop)
+			}
 		}
 
 		return nil
@@ -757,7 +1118,7 @@ func (ent *ExchangeEntity) executeGetIndicator(ctx context.Context, args map[str
 				Info("Found matching pre-configured indicator, reusing instead of creating new one")
 
 			// Emit existing indicator data
-			ch <- ttypes.NewEvent("indicator_changed", indicator)
+			ttypes.EmitEvent(ctx, ch, ttypes.NewEvent("indicator_changed", indicator))
 			return nil
 		}
 	}
@@ -820,7 +1181,7 @@ func (ent *ExchangeEntity) executeGetIndicator(ctx context.Context, args map[str
 		Info("Dynamic indicator created and calculated")
 
 	// Emit the calculated indicator data
-	ch <- ttypes.NewEvent("indicator_changed", dynamicIndicator)
+	ttypes.EmitEvent(ctx, ch, ttypes.NewEvent("indicator_changed", dynamicIndicator))
 
 	log.Info("Dynamic indicator data sent successfully")
 	return nil
@@ -829,6 +1190,7 @@ func (ent *ExchangeEntity) executeGetIndicator(ctx context.Context, args map[str
 func (ent *ExchangeEntity) Run(ctx context.Context, ch chan ttypes.IEvent) {
 	// Store event channel for command execution using atomic operation
 	ent.eventChannel.Store(ch)
+	ent.runCtx = ctx
 
 	// Initialize dynamic indicator tracking
 	ent.dynamicIndicatorCycleTime = time.Now()
@@ -867,34 +1229,10 @@ func (ent *ExchangeEntity) Run(ctx context.Context, ch chan ttypes.IEvent) {
 			}
 		}
 
-		// Update position accumulated profit metrics
-		if ent.position != nil {
-			log.WithField("position", ent.position).Info("update_position")
-
-			accumulatedProfit := kline.GetClose().Sub(ent.position.AverageCost).Div(ent.position.AverageCost).Mul(fixedpoint.NewFromFloat(100.0)).Mul(ent.leverage)
-			if ent.position.IsShort() {
-				accumulatedProfit = accumulatedProfit.Mul(fixedpoint.NewFromInt(-1))
-			}
-
-			baseQty := ent.position.GetBase().Abs()
-			profitValue := fixedpoint.Zero
-
-			if !baseQty.IsZero() {
-				if ent.position.IsLong() {
-					profitValue = kline.GetClose().Sub(ent.position.AverageCost).Mul(baseQty)
-				} else if ent.position.IsShort() {
-					profitValue = ent.position.AverageCost.Sub(kline.GetClose()).Mul(baseQty)
-				}
-
-				profitValue = profitValue.Mul(ent.leverage)
-			}
-
-			ent.position.UpdateProfit(accumulatedProfit, profitValue)
-			ent.position.Dust = ent.position.IsDust(kline.GetClose())
+		for _, leg := range ent.legs() {
+			leg.updatePosition(ctx, kline)
 		}
 
-		ent.updatePositionFundRatios(ctx, kline.GetClose())
-
 		log.WithField("kline", kline).Info("kline closed")
 
 		// Auto cleanup unfilled limit orders before new decision cycle
@@ -906,65 +1244,159 @@ func (ent *ExchangeEntity) Run(ctx context.Context, ch chan ttypes.IEvent) {
 			ent.emitEvent(ch, ttypes.NewEvent("indicator_changed", indicator))
 		}
 
-		ent.emitEvent(ch, ttypes.NewEvent("position_changed", ent.position))
+		ent.emitEvent(ch, ttypes.NewEvent("position_changed", ent.positionSnapshot()))
 
 		ent.emitEvent(ch, ttypes.NewEvent("update_finish", nil))
 	}))
 
+	ent.setupFutures(ctx)
+	ent.setupSpot()
+
+	ent.bindPosition(ctx, ch)
+	if ent.shortLeg != nil {
+		ent.shortLeg.runLeg(ctx, ch)
+	}
+
+	if ent.cfg.TrailingStop.OnTrades {
+		log.Info("trailing stop on market trades enabled")
+
+		session.MarketDataStream.OnMarketTrade(func(trade types.Trade) {
+			if trade.Symbol != ent.symbol {
+				return
+			}
+
+			for _, leg := range ent.legs() {
+				leg.updateExits(ctx, trade.Price, trade.Price, trade.Price)
+				leg.updateEntryPlan(ctx, trade.Price)
+			}
+		})
+	}
+
+	cleanPostionCfg := ent.cfg.CleanPosition
+	if cleanPostionCfg.Enabled && ent.hedged() {
+		log.Warn("clean position is not supported in hedge mode, disabled")
+	} else if cleanPostionCfg.Enabled {
+		log.WithField("config", cleanPostionCfg).Info("clean position enabled")
+
+		session.MarketDataStream.OnKLineClosed(types.KLineWith(ent.symbol, cleanPostionCfg.Interval, func(kline types.KLine) {
+			log.WithField("kline", kline).Info("clean position triggered")
+			ent.handleCleanPosition(ctx, kline)
+		}))
+	}
+
+	// The account fills do not tell the legs apart, each leg is reconciled with its exchange position
+	if _, ok := ent.exchangeService().(HedgePositionService); ent.cfg.Reconcile.Enabled && ent.hedged() && !ok {
+		log.Warn("reconcile is not supported in hedge mode on this exchange, disabled")
+	} else if ent.cfg.Reconcile.Enabled {
+		log.WithField("config", ent.cfg.Reconcile).Info("reconcile enabled")
+		for _, leg := range ent.legs() {
+			go leg.runReconciler(ctx, ch)
+		}
+	}
+}
+
+// updatePosition updates the profit metrics, exits and entry plan of the position at a closed kline
+func (ent *ExchangeEntity) updatePosition(ctx context.Context, kline types.KLine) {
+	// Update position accumulated profit metrics
+	if ent.position != nil {
+		log.WithField("position", ent.position).Info("update_position")
+
+		accumulatedProfit := kline.GetClose().Sub(ent.position.AverageCost).Div(ent.position.AverageCost).Mul(fixedpoint.NewFromFloat(100.0)).Mul(ent.leverage)
+		if ent.position.IsShort() {
+			accumulatedProfit = accumulatedProfit.Mul(fixedpoint.NewFromInt(-1))
+		}
+
+		baseQty := ent.position.GetBase().Abs()
+		profitValue := fixedpoint.Zero
+
+		if !baseQty.IsZero() {
+			if ent.position.IsLong() {
+				profitValue = kline.GetClose().Sub(ent.position.AverageCost).Mul(baseQty)
+			} else if ent.position.IsShort() {
+				profitValue = ent.position.AverageCost.Sub(kline.GetClose()).Mul(baseQty)
+			}
+
+			profitValue = profitValue.Mul(ent.leverage)
+		}
+
+		ent.position.UpdateProfit(accumulatedProfit, profitValue)
+		ent.position.Dust = ent.position.IsDust(kline.GetClose())
+	}
+
+	ent.updateExits(ctx, kline.High, kline.Low, kline.Close)
+	ent.updateEntryPlan(ctx, kline.Close)
+
+	ent.updatePositionFundRatios(ctx, kline.GetClose())
+}
+
+// positionSnapshot returns the position for the prompt, with the short leg in hedge mode
+func (ent *ExchangeEntity) positionSnapshot() *PositionX {
+	ent.position.Executions = ent.executions.reports()
+	ent.position.Realized = ent.ledger.realized()
+	ent.position.Leg = string(ent.positionSide)
+
+	ent.position.ShortLeg = nil
+	if ent.shortLeg != nil {
+		ent.position.ShortLeg = ent.shortLeg.positionSnapshot()
+	}
+
+	return ent.position
+}
+
+// bindPosition follows the fills and updates of the position of the entity
+func (ent *ExchangeEntity) bindPosition(ctx context.Context, ch chan ttypes.IEvent) {
+	if !ent.position.IsClosed() {
+		ent.ledger.seed(ent.position.GetBase(), ent.position.AverageCost, ent.position.OpenedAt)
+	}
+
+	// Follow every fill of the symbol, also those of the exchange TP/SL triggers and liquidations
+	if !ent.hedged() {
+		ent.session.UserDataStream.OnTradeUpdate(func(trade types.Trade) {
+			if trade.Symbol == ent.symbol {
+				ent.adoptSpotOCOFill(trade)
+				ent.handleTrade(ctx, ch, trade)
+			}
+		})
+	}
+
+	// Track the fills of the executions
+	ent.orderExecutor.TradeCollector().OnTrade(func(trade types.Trade, _ fixedpoint.Value, _ fixedpoint.Value) {
+		ent.executions.recordTrade(trade)
+
+		// The account fills do not tell the legs of a hedge mode position apart
+		if ent.hedged() {
+			ent.handleTrade(ctx, ch, trade)
+		}
+	})
+
 	// Handle position update
 	ent.orderExecutor.TradeCollector().OnPositionUpdate(func(position *types.Position) {
 		log.WithField("position", position).Info("ExchangeEntity_OnPositionUpdate")
 
+		// The OCO orders follow the base of the position
+		if ent.spotOCO() {
+			go ent.placeSpotOCO(ctx)
+		}
+
 		if position.IsClosed() {
 			log.WithField("position", position).Info("ExchangeEntity_PositionClose")
 
-			// Get the latest close price from KLineWindow
+			ent.clearExits()
+			ent.clearEntryPlan(ctx)
+
+			// The TP/SL attachments are gone with the position
+			position.SlTriggerPx, position.TpTriggerPx = nil, nil
+
+			// The position_closed event is emitted by the ledger from the closing fill
 			var exitPrice float64
 			if ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
-				lastIdx := ent.KLineWindow.Len() - 1
-				exitPrice = (*ent.KLineWindow)[lastIdx].Close.Float64()
+				exitPrice = ent.KLineWindow.GetClose().Float64()
 			} else {
 				exitPrice = position.AverageCost.Float64() // Fallback if no kline data
 			}
 
-			// Determine position data for closed position event
-			positionData := PositionClosedEventData{
-				StrategyID:           position.StrategyInstanceID,
-				Symbol:               ent.symbol,
-				EntryPrice:           position.AverageCost.Float64(),
-				ExitPrice:            exitPrice,
-				Quantity:             position.Base.Float64(),
-				ProfitAndLoss:        ent.position.AccumulatedProfitValue.Float64(),
-				ProfitAndLossPercent: ent.position.AccumulatedProfit.Float64(),
-				CloseReason:          CloseReasonManual, // Default to Manual (will be overridden by the context in ClosePosition if available)
-				Timestamp:            time.Now(),
-			}
-
-			// Get recent market data as context if available
-			if ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
-				lastIdx := ent.KLineWindow.Len() - 1
-				kline := (*ent.KLineWindow)[lastIdx]
-				positionData.RelatedMarketData = map[string]interface{}{
-					"lastKline": map[string]interface{}{
-						"open":      kline.Open.Float64(),
-						"high":      kline.High.Float64(),
-						"low":       kline.Low.Float64(),
-						"close":     kline.Close.Float64(),
-						"volume":    kline.Volume.Float64(),
-						"startTime": kline.StartTime.Time(),
-						"endTime":   kline.EndTime.Time(),
-					},
-				}
-			}
-
 			ent.updatePositionFundRatios(ctx, fixedpoint.NewFromFloat(exitPrice))
 
-			// Emit the position closed event
-			go func() {
-				log.WithField("positionData", positionData).Info("Emitting position_closed event")
-				ent.emitEvent(ch, NewPositionClosedEvent(positionData))
-			}()
-
 			if ent.cfg.HandlePositionClose {
 				go func() {
 					time.Sleep(time.Second * 5)
@@ -985,22 +1417,12 @@ func (ent *ExchangeEntity) Run(ctx context.Context, ch chan ttypes.IEvent) {
 						ent.emitEvent(ch, ttypes.NewEvent("indicator_changed", indicator))
 					}
 
-					ent.emitEvent(ch, ttypes.NewEvent("position_changed", ent.position))
+					ent.emitEvent(ch, ttypes.NewEvent("position_changed", ent.root().positionSnapshot()))
 					ent.emitEvent(ch, ttypes.NewEvent("update_finish", nil))
 				}()
 			}
 		}
 	})
-
-	cleanPostionCfg := ent.cfg.CleanPosition
-	if cleanPostionCfg.Enabled {
-		log.WithField("config", cleanPostionCfg).Info("clean position enabled")
-
-		session.MarketDataStream.OnKLineClosed(types.KLineWith(ent.symbol, cleanPostionCfg.Interval, func(kline types.KLine) {
-			log.WithField("kline", kline).Info("clean position triggered")
-			ent.handleCleanPosition(ctx, kline)
-		}))
-	}
 }
 
 func (ent *ExchangeEntity) handleCleanPosition(ctx context.Context, kline types.KLine) {
@@ -1068,6 +1490,7 @@ func (ent *ExchangeEntity) handleCleanPosition(ctx context.Context, kline types.
 
 				// Create context with take profit close reason
 				tpCtx := context.WithValue(ctx, "closeReason", CloseReasonTakeProfit)
+				tpCtx = context.WithValue(tpCtx, "closeSource", CloseSourceCleanPosition)
 
 				err := ent.ClosePosition(tpCtx, fixedpoint.One, currentPrice)
 				if err != nil {
@@ -1097,6 +1520,7 @@ func (ent *ExchangeEntity) handleCleanPosition(ctx context.Context, kline types.
 
 				// Create context with stop loss close reason
 				slCtx := context.WithValue(ctx, "closeReason", CloseReasonStopLoss)
+				slCtx = context.WithValue(slCtx, "closeSource", CloseSourceCleanPosition)
 
 				err := ent.ClosePosition(slCtx, fixedpoint.One, currentPrice)
 				if err != nil {
@@ -1236,6 +1660,11 @@ func (ent *ExchangeEntity) cleanupLimitOrders(ctx context.Context) {
 	limitOrders := make([]types.Order, 0)
 	for _, order := range orders {
 		if order.Type == types.OrderTypeLimit || order.Type == types.OrderTypeLimitMaker {
+			// Orders worked by a running execution are managed by it
+			if ent.ownsOrder(order.OrderID) {
+				continue
+			}
+
 			limitOrders = append(limitOrders, order)
 		}
 	}
@@ -1255,6 +1684,17 @@ func (ent *ExchangeEntity) cleanupLimitOrders(ctx context.Context) {
 	}
 }
 
+// ownsOrder reports whether a running execution or the entry plan of a leg works the order
+func (ent *ExchangeEntity) ownsOrder(orderID uint64) bool {
+	for _, leg := range ent.legs() {
+		if leg.executions.owns(orderID) || leg.entryPlan.owns(orderID) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type StopLossPrice struct {
 	Value fixedpoint.Value
 }
@@ -1275,6 +1715,11 @@ type LimitPriceOpt struct {
 	Value fixedpoint.Value
 }
 
+// MaxQuantityOpt caps the base of the order
+type MaxQuantityOpt struct {
+	Value fixedpoint.Value
+}
+
 type TimeInForceOpt struct {
 	Value types.TimeInForce
 }
@@ -1285,6 +1730,11 @@ type PostOnlyOpt struct {
 
 func (s *ExchangeEntity) OpenPosition(ctx context.Context, side types.SideType, closePrice fixedpoint.Value, args ...interface{}) error {
 	var quoteRatio *fixedpoint.Value
+	var riskSizing *RiskSizingOpt
+	var execution *ExecutionParams
+	var executionReport *ExecutionReportOpt
+	var maxQuantity *fixedpoint.Value
+	entryPrice := closePrice
 	filteredArgs := make([]interface{}, 0, len(args))
 
 	for _, arg := range args {
@@ -1292,12 +1742,45 @@ func (s *ExchangeEntity) OpenPosition(ctx context.Context, side types.SideType,
 		case *QuoteRatioOpt:
 			r := val.Value
 			quoteRatio = &r
+		case *RiskSizingOpt:
+			riskSizing = val
+		case *ExecutionOpt:
+			execution = val.Params
+		case *ExecutionReportOpt:
+			executionReport = val
+		case *MaxQuantityOpt:
+			maxQuantity = &val.Value
+		case *LimitPriceOpt:
+			entryPrice = val.Value
+			filteredArgs = append(filteredArgs, arg)
 		default:
 			filteredArgs = append(filteredArgs, arg)
 		}
 	}
 
-	quantity := s.calculateQuantity(ctx, closePrice, side, quoteRatio)
+	var quantity fixedpoint.Value
+	if riskSizing != nil {
+		var err error
+		quantity, err = s.calculateRiskQuantity(ctx, entryPrice, side, riskSizing)
+		if err != nil {
+			return err
+		}
+	} else {
+		quantity = s.calculateQuantity(ctx, closePrice, side, quoteRatio)
+	}
+
+	if maxQuantity != nil {
+		limit := *maxQuantity
+		if side == types.SideTypeBuy && s.buysInQuote() {
+			limit = limit.Mul(entryPrice) // Buy quantities are in quote
+		}
+		quantity = fixedpoint.Min(quantity, limit)
+	}
+
+	// The exits cleared by the close of the previous position are not the ones of this position
+	if s.position.IsClosed() || s.position.IsDust(closePrice) {
+		s.positionGen.Add(1)
+	}
 
 	for {
 		if quantity.Compare(s.position.Market.MinQuantity) < 0 {
@@ -1305,6 +1788,7 @@ func (s *ExchangeEntity) OpenPosition(ctx context.Context, side types.SideType,
 		}
 
 		orderForm := s.generateOrderForm(side, quantity, types.SideEffectTypeMarginBuy)
+		postOnly := false
 
 		for _, arg := range filteredArgs {
 			switch val := arg.(type) {
@@ -1319,15 +1803,36 @@ func (s *ExchangeEntity) OpenPosition(ctx context.Context, side types.SideType,
 			case *TimeInForceOpt:
 				orderForm.TimeInForce = val.Value
 			case *PostOnlyOpt:
-				// Note: PostOnly is not directly supported in bbgo's SubmitOrder
-				// Some exchanges may support it through TimeInForce=POST_ONLY
-				// For now, we accept the parameter but don't apply it
-				log.WithField("post_only", val.Enabled).Debug("post_only parameter received but not applied (not supported by bbgo SubmitOrder)")
+				// Post only limit orders are placed as limit maker orders
+				if val.Enabled {
+					postOnly = true
+				}
+			}
+		}
+
+		if postOnly {
+			if orderForm.Type != types.OrderTypeLimit {
+				return errors.New("post_only requires order_type=limit, or execution=chase")
 			}
+			orderForm.Type = types.OrderTypeLimitMaker
+		}
+
+		// TP/SL attached to the order are triggered on the exchange
+		var stopLoss, takeProfit *fixedpoint.Value
+		if orderForm.StopPrice.Sign() > 0 {
+			stopLoss = &orderForm.StopPrice
+		}
+		if orderForm.TakePrice.Sign() > 0 {
+			takeProfit = &orderForm.TakePrice
+		}
+
+		// Spot orders take no attachments, the exits are monitored or placed as OCO orders
+		if s.spot() {
+			orderForm.StopPrice, orderForm.TakePrice = fixedpoint.Zero, fixedpoint.Zero
 		}
 
 		log.Infof("submit open position order %v", orderForm)
-		_, err := s.orderExecutor.SubmitOrders(ctx, orderForm)
+		exec, err := s.execute(ctx, orderForm, entryPrice, execution, "open")
 		if err != nil {
 			if strings.Contains(err.Error(), "Insufficient USDT") {
 				log.WithField("quantity", quantity.Float64()).Error("Insufficient USDT, try reduce order quantity")
@@ -1339,6 +1844,27 @@ func (s *ExchangeEntity) OpenPosition(ctx context.Context, side types.SideType,
 			return err
 		}
 
+		if executionReport != nil {
+			executionReport.Execution = exec
+		}
+
+		if s.spot() {
+			s.setSpotExits(ctx, stopLoss, takeProfit)
+			break
+		}
+
+		s.ledger.setTriggers(stopLoss, takeProfit)
+		if stopLoss != nil || takeProfit != nil {
+			s.position.Lock()
+			if stopLoss != nil {
+				s.position.SlTriggerPx = stopLoss
+			}
+			if takeProfit != nil {
+				s.position.TpTriggerPx = takeProfit
+			}
+			s.position.Unlock()
+		}
+
 		break
 	}
 
@@ -1350,8 +1876,6 @@ func (s *ExchangeEntity) ClosePosition(ctx context.Context, percentage fixedpoin
 		return fmt.Errorf("no opened %s position", s.position.Symbol)
 	}
 
-	// Capture position info before closing for reflection event
-	posBeforeClose := *s.position
 	isFullClose := percentage.Compare(fixedpoint.One) == 0
 
 	// make it negative
@@ -1364,81 +1888,41 @@ func (s *ExchangeEntity) ClosePosition(ctx context.Context, percentage fixedpoin
 		if quantity.Compare(s.position.Market.MinQuantity) < 0 {
 			return fmt.Errorf("%s order quantity %v is too small, less than %v", s.symbol, quantity, s.position.Market.MinQuantity)
 		}
-	} else {
+	} else if s.buysInQuote() {
 		quantity = quantity.Mul(closePrice)
 	}
 
+	if s.spot() {
+		// The OCO orders lock the base the close sells
+		s.cancelSpotOCO(ctx)
+
+		if side == types.SideTypeSell {
+			quantity = s.closableBase(ctx, quantity)
+		}
+	}
+
 	orderForm := s.generateOrderForm(side, quantity, types.SideEffectTypeAutoRepay)
+	if s.futures() && !s.spot() {
+		orderForm.ReduceOnly = true // Never opens the other side
+	}
 	if isFullClose {
 		orderForm.ClosePosition = true // Full close position
 	}
 
 	bbgo.Notify("submitting %s %s order to close position by %v, orderForm:%v", s.symbol, side.String(), percentage, orderForm)
 
-	_, err := s.orderExecutor.SubmitOrders(ctx, orderForm)
+	// The fills of the close may arrive before its orders are registered
+	s.ledger.expectClose(closeAttributionFromContext(ctx), time.Now())
+
+	execution, _ := ctx.Value("execution").(*ExecutionParams)
+	_, err := s.execute(ctx, orderForm, closePrice, execution, "close")
 	if err != nil {
 		log.WithError(err).Errorf("can not place %s position close order", s.symbol)
 		bbgo.Notify("can not place %s position close order", s.symbol)
 		return err
 	}
 
-	// Only emit position closed event for full closures
-	if isFullClose {
-		// Get the strategy ID from context
-		strategyID := "unknown"
-		if val, exists := ctx.Value("strategyID").(string); exists {
-			strategyID = val
-		}
-
-		// Determine close reason based on available context
-		closeReason := CloseReasonManual // Default to Manual
-		if val, exists := ctx.Value("closeReason").(string); exists {
-			closeReason = val
-		}
-		if val, exists := ctx.Value("closeReason").(string); exists {
-			closeReason = val
-		}
-
-		// Create the position closed event data
-		positionData := PositionClosedEventData{
-			StrategyID:           strategyID,
-			Symbol:               s.symbol,
-			EntryPrice:           posBeforeClose.AverageCost.Float64(),
-			ExitPrice:            closePrice.Float64(),
-			Quantity:             posBeforeClose.GetBase().Float64(),
-			ProfitAndLoss:        posBeforeClose.AccumulatedProfitValue.Float64(),
-			ProfitAndLossPercent: posBeforeClose.AccumulatedProfit.Float64(),
-			CloseReason:          closeReason,
-			Timestamp:            time.Now(),
-		}
-
-		// Get recent market data as context if available
-		if s.KLineWindow != nil && s.KLineWindow.Len() > 0 {
-			lastIdx := s.KLineWindow.Len() - 1
-			kline := (*s.KLineWindow)[lastIdx]
-			positionData.RelatedMarketData = map[string]interface{}{
-				"lastKline": map[string]interface{}{
-					"open":      kline.Open.Float64(),
-					"high":      kline.High.Float64(),
-					"low":       kline.Low.Float64(),
-					"close":     kline.Close.Float64(),
-					"volume":    kline.Volume.Float64(),
-					"startTime": kline.StartTime.Time(),
-					"endTime":   kline.EndTime.Time(),
-				},
-			}
-		}
-
-		// Emit the position closed event if we can access a channel
-		log.WithField("positionData", positionData).Info("Position fully closed, emitting PositionClosedEvent")
-
-		// Extract event channel from context if available
-		if eventCh, exists := ctx.Value("eventChannel").(chan ttypes.IEvent); exists {
-			eventCh <- NewPositionClosedEvent(positionData)
-		}
-	}
-
-	return err
+	return nil
 }
 
 func (s *ExchangeEntity) UpdatePosition(ctx context.Context, side types.SideType, closePrice fixedpoint.Value, args ...interface{}) error {
@@ -1481,6 +1965,22 @@ POSITION_CLOSED:
 }
 
 func (s *ExchangeEntity) UpdatePositionV2(ctx context.Context, side types.SideType, closePrice fixedpoint.Value, args ...interface{}) error {
+	// The spot exits are kept locally, or replaced as OCO orders
+	if s.spot() {
+		var stopLoss, takeProfit *fixedpoint.Value
+		for _, arg := range args {
+			switch val := arg.(type) {
+			case *StopLossPrice:
+				stopLoss = &val.Value
+			case *TakeProfitPrice:
+				takeProfit = &val.Value
+			}
+		}
+
+		s.setSpotExits(ctx, stopLoss, takeProfit)
+		return nil
+	}
+
 	exchange := s.session.Exchange
 	service, implemented := exchange.(types.ExchangePositionUpdateService)
 	if implemented {
@@ -1503,6 +2003,8 @@ func (s *ExchangeEntity) UpdatePositionV2(ctx context.Context, side types.SideTy
 			return errors.Wrap(err, "UpdatePositionV2_UpdatePosition_error")
 		}
 
+		s.ledger.setTriggers(tmpPos.SlTriggerPx, tmpPos.TpTriggerPx)
+
 		log.Info("UpdatePositionV2_ok")
 		return nil
 	} else {
@@ -1521,6 +2023,11 @@ func (s *ExchangeEntity) generateOrderForm(side types.SideType, quantity fixedpo
 		MarginSideEffect: marginOrderSideEffect,
 	}
 
+	// Futures and spot orders do not borrow or repay
+	if s.futures() || s.spot() {
+		orderForm.MarginSideEffect = ""
+	}
+
 	return orderForm
 }
 
@@ -1542,7 +2049,7 @@ func (s *ExchangeEntity) calculateQuantity(ctx context.Context, currentPrice fix
 		quoteQty = quoteQty.Mul(ratio)
 	}
 
-	if side == types.SideTypeSell {
+	if side == types.SideTypeSell || !s.buysInQuote() {
 		return quoteQty.Div(currentPrice).
 			Mul(fixedpoint.NewFromFloat(0.99))
 	} else {
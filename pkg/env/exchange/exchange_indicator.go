@@ -194,3 +194,33 @@ func basicIndicatorToValues(basicIndicator IBasicIndicator) []float64 {
 
 	return vals
 }
+
+// Interval returns the kline interval the indicator is computed on
+func (ei *ExchangeIndicator) Interval() types.Interval {
+	return ei.Config.GetInterval("interval", "5m")
+}
+
+// Values returns the values of a single line indicator, oldest first
+func (ei *ExchangeIndicator) Values() ([]float64, bool) {
+	basicIndicator, ok := ei.Data.(IBasicIndicator)
+	if !ok {
+		return nil, false
+	}
+
+	vals := basicIndicatorToValues(basicIndicator)
+	for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+
+	return vals, true
+}
+
+// Bands returns the upper, middle and lower Bollinger bands, oldest first
+func (ei *ExchangeIndicator) Bands() ([]float64, []float64, []float64, bool) {
+	boll, ok := ei.Data.(*indicator.BOLL)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	return boll.UpBand, boll.SMA.Values, boll.DownBand, true
+}
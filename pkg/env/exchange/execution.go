@@ -0,0 +1,790 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Execution algorithms of the open and close actions
+const (
+	ExecutionMarket  = "market"  // One order as placed by the action, the default
+	ExecutionTWAP    = "twap"    // Market slices spread over the duration
+	ExecutionIceberg = "iceberg" // Limit orders showing a slice of the size at a time
+	ExecutionChase   = "chase"   // Post-only order reposted at the best bid/ask
+)
+
+// Execution arguments of the open and close actions
+const (
+	ArgExecution         = "execution"
+	ArgExecutionDuration = "execution_duration"
+	ArgExecutionSlices   = "execution_slices"
+	ArgIcebergVisible    = "iceberg_visible"
+	ArgFallbackMarket    = "fallback_market"
+)
+
+// Execution statuses
+const (
+	ExecutionRunning = "running"
+	ExecutionDone    = "done"
+	ExecutionTimeout = "timeout"
+	ExecutionFailed  = "failed"
+)
+
+const (
+	DefaultExecutionDuration = 5 * time.Minute
+	DefaultExecutionSlices   = 5
+	DefaultIcebergVisible    = 0.2
+	DefaultChaseInterval     = 5 * time.Second
+	MaxRecentExecutions      = 5
+)
+
+// ExecutionParams selects how an order is worked
+type ExecutionParams struct {
+	Algo           string
+	Duration       time.Duration    // TWAP duration, iceberg and chase timeout
+	Slices         int              // TWAP slices
+	Visible        fixedpoint.Value // Iceberg slice as a ratio of the size
+	FallbackMarket bool             // Complete an iceberg or chase with a market order on timeout
+	ChaseInterval  time.Duration    // Time a chase order rests before it is reposted
+}
+
+// ExecutionOpt carries the execution algorithm of an open action
+type ExecutionOpt struct {
+	Params *ExecutionParams
+}
+
+// ExecutionReportOpt receives the execution of an open action, the caller
+// follows its fills with Report
+type ExecutionReportOpt struct {
+	Execution *Execution
+}
+
+// parseExecution reads the execution arguments over the configured defaults
+func (ent *ExchangeEntity) parseExecution(args map[string]string) (*ExecutionParams, error) {
+	cfg := ent.cfg.Execution
+	params := &ExecutionParams{
+		Algo:           ExecutionMarket,
+		Duration:       DefaultExecutionDuration,
+		Slices:         DefaultExecutionSlices,
+		Visible:        fixedpoint.NewFromFloat(DefaultIcebergVisible),
+		FallbackMarket: cfg.FallbackMarket,
+		ChaseInterval:  DefaultChaseInterval,
+	}
+
+	if cfg.Algo != "" {
+		params.Algo = cfg.Algo
+	}
+	if cfg.Duration > 0 {
+		params.Duration = cfg.Duration.Duration()
+	}
+	if cfg.Slices > 0 {
+		params.Slices = cfg.Slices
+	}
+	if cfg.IcebergVisible > 0 {
+		params.Visible = fixedpoint.NewFromFloat(cfg.IcebergVisible)
+	}
+	if cfg.ChaseInterval > 0 {
+		params.ChaseInterval = cfg.ChaseInterval.Duration()
+	}
+
+	if raw := strings.ToLower(strings.TrimSpace(args[ArgExecution])); raw != "" {
+		params.Algo = raw
+	}
+	switch params.Algo {
+	case ExecutionMarket, ExecutionTWAP, ExecutionIceberg, ExecutionChase:
+	default:
+		return nil, errors.Errorf("invalid %s %q, use market, twap, iceberg or chase", ArgExecution, params.Algo)
+	}
+
+	if raw := strings.TrimSpace(args[ArgExecutionDuration]); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid %s %q", ArgExecutionDuration, raw)
+		}
+		params.Duration = d
+	}
+
+	if raw := strings.TrimSpace(args[ArgExecutionSlices]); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("invalid %s %q", ArgExecutionSlices, raw)
+		}
+		params.Slices = n
+	}
+
+	if raw := strings.TrimSpace(args[ArgIcebergVisible]); raw != "" {
+		val, err := fixedpoint.NewFromString(strings.TrimSuffix(raw, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", ArgIcebergVisible)
+		}
+		if strings.HasSuffix(raw, "%") {
+			val = val.Div(fixedpoint.NewFromInt(100))
+		}
+		if val.Sign() <= 0 || val.Compare(fixedpoint.One) > 0 {
+			return nil, errors.Errorf("%s must be in (0, 1]", ArgIcebergVisible)
+		}
+		params.Visible = val
+	}
+
+	if raw := strings.TrimSpace(args[ArgFallbackMarket]); raw != "" {
+		params.FallbackMarket = strings.EqualFold(raw, "true")
+	}
+
+	return params, nil
+}
+
+// Execution tracks the fills of an order worked by an execution algorithm
+// against the price the decision was made at
+type Execution struct {
+	mu sync.Mutex
+
+	Algo          string
+	Purpose       string // open or close
+	Side          types.SideType
+	DecisionPrice fixedpoint.Value
+	TargetBase    fixedpoint.Value
+	FilledBase    fixedpoint.Value
+	FilledQuote   fixedpoint.Value
+	Status        string
+	Error         string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+
+	orders   map[uint64]fixedpoint.Value // Filled base per order
+	executed map[uint64]fixedpoint.Value // Executed base per order queried from the exchange, ahead of lagging fills
+	attr     closeAttribution            // Reason and source of a close
+}
+
+// ExecutionReport is a snapshot of an execution
+type ExecutionReport struct {
+	Algo          string
+	Purpose       string
+	Side          types.SideType
+	DecisionPrice fixedpoint.Value
+	TargetBase    fixedpoint.Value
+	FilledBase    fixedpoint.Value
+	FilledQuote   fixedpoint.Value
+	Status        string
+	Error         string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+}
+
+func newExecution(algo, purpose string, side types.SideType, decisionPrice, targetBase fixedpoint.Value) *Execution {
+	return &Execution{
+		Algo:          algo,
+		Purpose:       purpose,
+		Side:          side,
+		DecisionPrice: decisionPrice,
+		TargetBase:    targetBase,
+		Status:        ExecutionRunning,
+		StartedAt:     time.Now(),
+		orders:        make(map[uint64]fixedpoint.Value),
+		executed:      make(map[uint64]fixedpoint.Value),
+	}
+}
+
+func (e *Execution) addOrders(orders types.OrderSlice) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, order := range orders {
+		if _, ok := e.orders[order.OrderID]; !ok {
+			e.orders[order.OrderID] = fixedpoint.Zero
+		}
+	}
+}
+
+// recordTrade adds a fill of one of the execution orders
+func (e *Execution) recordTrade(trade types.Trade) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	filled, ok := e.orders[trade.OrderID]
+	if !ok {
+		return false
+	}
+
+	quote := trade.QuoteQuantity
+	if quote.IsZero() {
+		quote = trade.Price.Mul(trade.Quantity)
+	}
+
+	e.orders[trade.OrderID] = filled.Add(trade.Quantity)
+	e.FilledBase = e.FilledBase.Add(trade.Quantity)
+	e.FilledQuote = e.FilledQuote.Add(quote)
+	return true
+}
+
+// orderIDs returns the orders placed by the execution
+func (e *Execution) orderIDs() []uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ids := make([]uint64, 0, len(e.orders))
+	for orderID := range e.orders {
+		ids = append(ids, orderID)
+	}
+
+	return ids
+}
+
+func (e *Execution) orderFilled(orderID uint64) fixedpoint.Value {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.orders[orderID]
+}
+
+// setOrderExecuted records the executed base of an order reported by the exchange
+func (e *Execution) setOrderExecuted(orderID uint64, executed fixedpoint.Value) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.executed[orderID] = executed
+}
+
+// remaining returns the base left to place, the executed base reported by
+// the exchange counts for the orders whose fills have not arrived yet
+func (e *Execution) remaining() fixedpoint.Value {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	filled := fixedpoint.Zero
+	for orderID, base := range e.orders {
+		filled = filled.Add(fixedpoint.Max(base, e.executed[orderID]))
+	}
+
+	return e.TargetBase.Sub(filled)
+}
+
+func (e *Execution) running() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.Status == ExecutionRunning
+}
+
+func (e *Execution) finish(status string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.Status = status
+	e.FinishedAt = time.Now()
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Report returns a snapshot of the execution
+func (e *Execution) Report() ExecutionReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return ExecutionReport{
+		Algo:          e.Algo,
+		Purpose:       e.Purpose,
+		Side:          e.Side,
+		DecisionPrice: e.DecisionPrice,
+		TargetBase:    e.TargetBase,
+		FilledBase:    e.FilledBase,
+		FilledQuote:   e.FilledQuote,
+		Status:        e.Status,
+		Error:         e.Error,
+		StartedAt:     e.StartedAt,
+		FinishedAt:    e.FinishedAt,
+	}
+}
+
+// AveragePrice returns the average fill price, zero before the first fill
+func (r ExecutionReport) AveragePrice() fixedpoint.Value {
+	if r.FilledBase.IsZero() {
+		return fixedpoint.Zero
+	}
+
+	return r.FilledQuote.Div(r.FilledBase)
+}
+
+// SlippageBps returns the cost of the fills against the decision price in
+// basis points, negative when the fills were better
+func (r ExecutionReport) SlippageBps() fixedpoint.Value {
+	avg := r.AveragePrice()
+	if avg.IsZero() || r.DecisionPrice.IsZero() {
+		return fixedpoint.Zero
+	}
+
+	diff := avg.Sub(r.DecisionPrice)
+	if r.Side == types.SideTypeSell {
+		diff = diff.Neg()
+	}
+
+	return diff.Div(r.DecisionPrice).Mul(fixedpoint.NewFromInt(10000))
+}
+
+// String describes the execution for the prompt and notifications
+func (r ExecutionReport) String() string {
+	text := fmt.Sprintf("%s %s %s: filled %s of %s", r.Algo, r.Purpose, strings.ToLower(string(r.Side)),
+		r.FilledBase.String(), r.TargetBase.String())
+
+	if !r.FilledBase.IsZero() {
+		text += fmt.Sprintf(" at avg %s vs decision %s, slippage %.1f bps",
+			r.AveragePrice().String(), r.DecisionPrice.String(), r.SlippageBps().Float64())
+	}
+
+	text += fmt.Sprintf(" (%s", r.Status)
+	if r.Error != "" {
+		text += ": " + r.Error
+	}
+
+	return text + ")"
+}
+
+// executionTracker keeps the running executions and the recent finished ones
+type executionTracker struct {
+	mu         sync.Mutex
+	executions []*Execution
+}
+
+func (t *executionTracker) add(exec *Execution) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.executions = append(t.executions, exec)
+
+	// Drop the oldest finished executions over the limit
+	for len(t.executions) > MaxRecentExecutions {
+		dropped := false
+		for i, e := range t.executions {
+			if !e.running() {
+				t.executions = append(t.executions[:i], t.executions[i+1:]...)
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			break
+		}
+	}
+}
+
+// recordTrade routes a trade to the execution of its order
+func (t *executionTracker) recordTrade(trade types.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, exec := range t.executions {
+		if exec.recordTrade(trade) {
+			return
+		}
+	}
+}
+
+// running reports whether an execution is working its orders
+func (t *executionTracker) running() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, exec := range t.executions {
+		if exec.running() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// owns reports whether a running execution works the order
+func (t *executionTracker) owns(orderID uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, exec := range t.executions {
+		if !exec.running() {
+			continue
+		}
+
+		exec.mu.Lock()
+		_, ok := exec.orders[orderID]
+		exec.mu.Unlock()
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closeAttribution returns the reason and source of the close execution working the order
+func (t *executionTracker) closeAttribution(orderID uint64) (closeAttribution, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, exec := range t.executions {
+		exec.mu.Lock()
+		_, ok := exec.orders[orderID]
+		attr := exec.attr
+		exec.mu.Unlock()
+
+		if ok && exec.Purpose == "close" {
+			return attr, true
+		}
+	}
+
+	return closeAttribution{}, false
+}
+
+// reports returns the snapshots of the tracked executions, oldest first
+func (t *executionTracker) reports() []ExecutionReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reports := make([]ExecutionReport, 0, len(t.executions))
+	for _, exec := range t.executions {
+		reports = append(reports, exec.Report())
+	}
+
+	return reports
+}
+
+// execute places an order form with the execution algorithm. A market
+// execution submits it at once, the other algorithms work it in the
+// background and return after it started.
+func (s *ExchangeEntity) execute(ctx context.Context, form types.SubmitOrder, decisionPrice fixedpoint.Value, params *ExecutionParams, purpose string) (*Execution, error) {
+	algo := ExecutionMarket
+	if params != nil {
+		algo = params.Algo
+	}
+
+	targetBase := form.Quantity
+	if form.Side == types.SideTypeBuy && s.buysInQuote() && decisionPrice.Sign() > 0 {
+		// Buy quantities of the entity are in quote, like calculateQuantity,
+		// the algorithms work in base and place market buys in quote
+		targetBase = form.Quantity.Div(decisionPrice)
+	}
+
+	exec := newExecution(algo, purpose, form.Side, decisionPrice, targetBase)
+	if purpose == "close" {
+		exec.attr = closeAttributionFromContext(ctx)
+	}
+	s.executions.add(exec)
+
+	if algo == ExecutionMarket {
+		orders, err := s.submitOrders(ctx, form)
+		exec.addOrders(orders)
+		if err != nil {
+			exec.finish(ExecutionFailed, err)
+			return exec, err
+		}
+
+		exec.finish(ExecutionDone, nil)
+		return exec, nil
+	}
+
+	runCtx := s.runCtx
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+
+	log.WithField("algo", algo).
+		WithField("form", form).
+		Info("execution_started")
+
+	go s.runExecution(runCtx, exec, form, params)
+	return exec, nil
+}
+
+// runExecution works the order of an algorithm until filled or timed out
+func (s *ExchangeEntity) runExecution(ctx context.Context, exec *Execution, form types.SubmitOrder, params *ExecutionParams) {
+	var err error
+	status := ExecutionDone
+
+	switch params.Algo {
+	case ExecutionTWAP:
+		err = s.runTWAP(ctx, exec, form, params)
+	case ExecutionIceberg, ExecutionChase:
+		var filled bool
+		filled, err = s.runLimitSlices(ctx, exec, form, params)
+		if err == nil && !filled {
+			status = ExecutionTimeout
+			if params.FallbackMarket {
+				err = s.submitSlice(ctx, exec, form, types.OrderTypeMarket, fixedpoint.Zero, exec.remaining(), form.ClosePosition)
+				if err == nil {
+					status = ExecutionDone
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		status = ExecutionFailed
+	}
+	exec.finish(status, err)
+
+	report := exec.Report()
+	log.WithField("report", report.String()).Info("execution_finished")
+	bbgo.Notify("%s execution: %s", s.symbol, report.String())
+}
+
+// runTWAP submits equal market slices spread over the duration
+func (s *ExchangeEntity) runTWAP(ctx context.Context, exec *Execution, form types.SubmitOrder, params *ExecutionParams) error {
+	slices := params.Slices
+	minQty := s.position.Market.MinQuantity
+	if minQty.Sign() > 0 {
+		if maxSlices := int(exec.TargetBase.Div(minQty).Float64()); maxSlices < slices {
+			slices = maxSlices
+		}
+	}
+	if slices < 1 {
+		slices = 1
+	}
+
+	slice := exec.TargetBase.Div(fixedpoint.NewFromInt(int64(slices)))
+	interval := params.Duration / time.Duration(slices)
+	submitted := fixedpoint.Zero
+
+	for i := 0; i < slices; i++ {
+		qty := slice
+		last := i == slices-1
+		if last {
+			qty = exec.TargetBase.Sub(submitted)
+		}
+
+		if err := s.submitSlice(ctx, exec, form, types.OrderTypeMarket, fixedpoint.Zero, qty, last && form.ClosePosition); err != nil {
+			return errors.Wrapf(err, "twap slice %d/%d", i+1, slices)
+		}
+		submitted = submitted.Add(qty)
+
+		if last {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	return nil
+}
+
+// runLimitSlices works an iceberg or chase until filled or the duration
+// passed. An iceberg rests slices at the limit price or the best price at
+// start, a chase reposts a post-only order at the best price.
+func (s *ExchangeEntity) runLimitSlices(ctx context.Context, exec *Execution, form types.SubmitOrder, params *ExecutionParams) (bool, error) {
+	deadline := time.Now().Add(params.Duration)
+	minQty := s.position.Market.MinQuantity
+
+	price := form.Price
+	if params.Algo == ExecutionIceberg && price.IsZero() {
+		best, err := s.bestPrice(ctx, form.Side)
+		if err != nil {
+			return false, err
+		}
+		price = best
+	}
+
+	visible := exec.TargetBase
+	if params.Algo == ExecutionIceberg {
+		visible = exec.TargetBase.Mul(params.Visible)
+		if visible.Compare(minQty) < 0 {
+			visible = minQty
+		}
+	}
+
+	for {
+		remaining := exec.remaining()
+		if remaining.Compare(minQty) < 0 || remaining.Sign() <= 0 {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+
+		qty := fixedpoint.Min(visible, remaining)
+		orderType := types.OrderTypeLimit
+		wait := time.Until(deadline)
+
+		if params.Algo == ExecutionChase {
+			best, err := s.bestPrice(ctx, form.Side)
+			if err != nil {
+				return false, err
+			}
+			price = best
+			orderType = types.OrderTypeLimitMaker
+			if params.ChaseInterval < wait {
+				wait = params.ChaseInterval
+			}
+		}
+
+		order, err := s.submitLimitSlice(ctx, exec, form, orderType, price, qty)
+		if err != nil {
+			if params.Algo == ExecutionChase {
+				// A post-only order crossing the book is rejected, retry at the new best price
+				log.WithError(err).Warn("execution_chase_submit_fail")
+				if !sleepCtx(ctx, params.ChaseInterval) {
+					return false, ctx.Err()
+				}
+				continue
+			}
+			return false, err
+		}
+
+		if s.waitFilled(ctx, exec, order.OrderID, qty, wait) {
+			continue
+		}
+
+		if err := s.orderExecutor.CancelOrders(ctx, order); err != nil {
+			log.WithError(err).Warn("execution_cancel_fail")
+		}
+
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		// The fills of the cancelled order may lag, the remainder is placed from its state on the exchange
+		if err := s.syncOrderExecuted(ctx, exec, order); err != nil {
+			return false, err
+		}
+	}
+}
+
+// syncOrderExecuted queries the executed base of an order of the execution
+func (s *ExchangeEntity) syncOrderExecuted(ctx context.Context, exec *Execution, order types.Order) error {
+	service, ok := s.session.Exchange.(types.ExchangeOrderQueryService)
+	if !ok {
+		return errors.New("the exchange can not query orders, the fills of the cancelled order are unknown")
+	}
+
+	state, err := service.QueryOrder(ctx, types.OrderQuery{
+		Symbol:  s.symbol,
+		OrderID: strconv.FormatUint(order.OrderID, 10),
+	})
+	if err != nil {
+		return errors.Wrap(err, "query the cancelled order")
+	}
+
+	exec.setOrderExecuted(order.OrderID, state.ExecutedQuantity)
+	return nil
+}
+
+// submitSlice places a part of the execution in base quantity
+func (s *ExchangeEntity) submitSlice(ctx context.Context, exec *Execution, form types.SubmitOrder, orderType types.OrderType, price, qty fixedpoint.Value, closePosition bool) error {
+	if qty.Sign() <= 0 {
+		return nil
+	}
+
+	slice := form
+	slice.Type = orderType
+	slice.Price = price
+	slice.ClosePosition = closePosition
+	slice.StopPrice = fixedpoint.Zero
+	slice.TakePrice = fixedpoint.Zero
+	slice.Quantity = qty
+
+	if slice.Side == types.SideTypeBuy && orderType == types.OrderTypeMarket && s.buysInQuote() {
+		ref := exec.DecisionPrice
+		if best, err := s.bestPrice(ctx, types.SideTypeSell); err == nil {
+			ref = best
+		}
+		slice.Quantity = qty.Mul(ref)
+	}
+
+	// An attached stop and take profit cover the size of their order, every slice of an open takes them
+	if exec.Purpose == "open" {
+		slice.StopPrice = form.StopPrice
+		slice.TakePrice = form.TakePrice
+	}
+
+	orders, err := s.submitOrders(ctx, slice)
+	exec.addOrders(orders)
+	return err
+}
+
+// submitLimitSlice places a limit part of the execution and returns its order
+func (s *ExchangeEntity) submitLimitSlice(ctx context.Context, exec *Execution, form types.SubmitOrder, orderType types.OrderType, price, qty fixedpoint.Value) (types.Order, error) {
+	slice := form
+	slice.Type = orderType
+	slice.Price = price
+	slice.ClosePosition = false
+	slice.StopPrice = fixedpoint.Zero
+	slice.TakePrice = fixedpoint.Zero
+	slice.Quantity = qty
+
+	if exec.Purpose == "open" {
+		slice.StopPrice = form.StopPrice
+		slice.TakePrice = form.TakePrice
+	}
+
+	orders, err := s.submitOrders(ctx, slice)
+	exec.addOrders(orders)
+	if err != nil {
+		return types.Order{}, err
+	}
+	if len(orders) == 0 {
+		return types.Order{}, errors.New("no order created")
+	}
+
+	return orders[0], nil
+}
+
+// waitFilled waits until the order filled qty, for at most timeout
+func (s *ExchangeEntity) waitFilled(ctx context.Context, exec *Execution, orderID uint64, qty fixedpoint.Value, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if exec.orderFilled(orderID).Compare(qty) >= 0 {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// bestPrice returns the best bid for a buy and the best ask for a sell
+func (s *ExchangeEntity) bestPrice(ctx context.Context, side types.SideType) (fixedpoint.Value, error) {
+	ticker, err := s.session.Exchange.QueryTicker(ctx, s.symbol)
+	if err != nil {
+		return fixedpoint.Zero, errors.Wrap(err, "query ticker")
+	}
+
+	price := ticker.Buy
+	if side == types.SideTypeSell {
+		price = ticker.Sell
+	}
+	if price.IsZero() {
+		price = ticker.Last
+	}
+	if price.IsZero() {
+		return fixedpoint.Zero, errors.New("no best price available")
+	}
+
+	return price, nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,109 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+func TestParseExecution(t *testing.T) {
+	ent := &ExchangeEntity{cfg: &config.EnvExchangeConfig{}}
+
+	params, err := ent.parseExecution(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, ExecutionMarket, params.Algo)
+	assert.Equal(t, DefaultExecutionDuration, params.Duration)
+
+	ent.cfg.Execution = config.ExecutionConfig{Algo: ExecutionChase, FallbackMarket: true}
+	params, err = ent.parseExecution(map[string]string{
+		ArgExecution:         "TWAP",
+		ArgExecutionDuration: "10m",
+		ArgExecutionSlices:   "4",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ExecutionTWAP, params.Algo)
+	assert.Equal(t, 10*time.Minute, params.Duration)
+	assert.Equal(t, 4, params.Slices)
+	assert.True(t, params.FallbackMarket)
+
+	params, err = ent.parseExecution(map[string]string{ArgIcebergVisible: "25%", ArgFallbackMarket: "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, ExecutionChase, params.Algo)
+	assert.Equal(t, num(0.25), params.Visible)
+	assert.False(t, params.FallbackMarket)
+
+	invalid := []map[string]string{
+		{ArgExecution: "vwap"},
+		{ArgExecutionDuration: "0s"},
+		{ArgExecutionSlices: "0"},
+		{ArgIcebergVisible: "1.5"},
+	}
+	for _, args := range invalid {
+		_, err := ent.parseExecution(args)
+		assert.Error(t, err, "args %v", args)
+	}
+}
+
+func TestExecution_Slippage(t *testing.T) {
+	var tracker executionTracker
+
+	buy := newExecution(ExecutionTWAP, "open", types.SideTypeBuy, num(2), num(10))
+	buy.addOrders(types.OrderSlice{{OrderID: 1}, {OrderID: 2}})
+	tracker.add(buy)
+
+	tracker.recordTrade(types.Trade{OrderID: 1, Price: num(2), Quantity: num(5)})
+	tracker.recordTrade(types.Trade{OrderID: 2, Price: num(2.02), Quantity: num(5)})
+	tracker.recordTrade(types.Trade{OrderID: 3, Price: num(9), Quantity: num(5)})
+
+	assert.True(t, tracker.owns(2))
+	assert.False(t, tracker.owns(3))
+
+	report := buy.Report()
+	assert.InDelta(t, 2.01, report.AveragePrice().Float64(), 1e-6)
+	assert.InDelta(t, 50, report.SlippageBps().Float64(), 1e-3)
+
+	buy.finish(ExecutionDone, nil)
+	assert.False(t, tracker.owns(2))
+	assert.Contains(t, buy.Report().String(), "twap open buy: filled 10 of 10 at avg 2.01 vs decision 2, slippage 50.0 bps (done)")
+
+	// A sell filled above the decision price has negative slippage
+	sell := newExecution(ExecutionMarket, "close", types.SideTypeSell, num(2), num(1))
+	sell.addOrders(types.OrderSlice{{OrderID: 4}})
+	sell.recordTrade(types.Trade{OrderID: 4, Price: num(2.01), Quantity: num(1)})
+	assert.InDelta(t, -50, sell.Report().SlippageBps().Float64(), 1e-3)
+}
+
+func TestExecution_RemainingAfterCancel(t *testing.T) {
+	exec := newExecution(ExecutionIceberg, "open", types.SideTypeBuy, num(2), num(10))
+	exec.addOrders(types.OrderSlice{{OrderID: 1}})
+	exec.recordTrade(types.Trade{OrderID: 1, Price: num(2), Quantity: num(1)})
+
+	// The cancelled order executed 3, its last fills have not arrived yet
+	exec.setOrderExecuted(1, num(3))
+	assert.Equal(t, num(7), exec.remaining())
+
+	exec.recordTrade(types.Trade{OrderID: 1, Price: num(2), Quantity: num(2)})
+	assert.Equal(t, num(7), exec.remaining())
+	assert.Equal(t, num(3), exec.Report().FilledBase)
+}
+
+func TestExecutionTracker_Prune(t *testing.T) {
+	var tracker executionTracker
+
+	running := newExecution(ExecutionChase, "open", types.SideTypeBuy, num(2), num(1))
+	tracker.add(running)
+
+	for i := 0; i < MaxRecentExecutions+2; i++ {
+		exec := newExecution(ExecutionMarket, "open", types.SideTypeBuy, num(2), num(1))
+		exec.finish(ExecutionDone, nil)
+		tracker.add(exec)
+	}
+
+	reports := tracker.reports()
+	assert.Len(t, reports, MaxRecentExecutions)
+	assert.Equal(t, ExecutionChase, reports[0].Algo)
+}
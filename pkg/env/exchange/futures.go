@@ -0,0 +1,308 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Margin modes of a futures position
+const (
+	MarginModeCross    = "cross"
+	MarginModeIsolated = "isolated"
+)
+
+// PositionSide is the leg of a hedge mode position
+type PositionSide string
+
+const (
+	PositionSideLong  PositionSide = "long"
+	PositionSideShort PositionSide = "short"
+)
+
+const (
+	ArgLeg      = "leg"
+	ArgLeverage = "leverage"
+
+	// MaxLeverage bounds the leverage argument
+	MaxLeverage = 125
+)
+
+// FuturesLeverageService is implemented by futures exchanges setting the leverage of a position
+type FuturesLeverageService interface {
+	// SetLeverage sets the leverage of the symbol in the margin mode, side is
+	// long or short in hedge mode and empty for a net position
+	SetLeverage(ctx context.Context, symbol string, leverage int, marginMode string, side string) error
+}
+
+// HedgeModeService is implemented by futures exchanges supporting hedge mode,
+// where the orders name the leg they open or close
+type HedgeModeService interface {
+	SetHedgeMode(ctx context.Context, enabled bool) error
+
+	// SubmitHedgeOrders places orders of the long or short side in the margin mode
+	SubmitHedgeOrders(ctx context.Context, marginMode string, side string, orders ...types.SubmitOrder) (types.OrderSlice, error)
+}
+
+// LegPosition is the position of a hedge mode leg on the exchange
+type LegPosition struct {
+	Base        fixedpoint.Value // Unsigned base of the leg
+	AverageCost fixedpoint.Value
+}
+
+// HedgePositionService is implemented by futures exchanges reporting the
+// positions of the legs in hedge mode
+type HedgePositionService interface {
+	// QueryLegPositions returns the open legs of the symbol by side, long or short
+	QueryLegPositions(ctx context.Context, symbol string) (map[string]LegPosition, error)
+}
+
+// SetShortLeg makes the entity trade the long leg of a hedge mode position.
+// The short leg has its own position and order executor.
+func (ent *ExchangeEntity) SetShortLeg(orderExecutor *bbgo.GeneralOrderExecutor, position *types.Position) {
+	leg := NewExchangeEntity(ent.symbol, ent.interval, ent.leverage, ent.cfg, ent.session, orderExecutor, position)
+	leg.parent = ent
+	leg.positionSide = PositionSideShort
+
+	ent.positionSide = PositionSideLong
+	ent.shortLeg = leg
+}
+
+// futures reports whether the entity trades a futures session
+func (ent *ExchangeEntity) futures() bool {
+	return ent.cfg.Futures.Enabled
+}
+
+// hedged reports whether the entity trades a leg of a hedge mode position
+func (ent *ExchangeEntity) hedged() bool {
+	return ent.positionSide != ""
+}
+
+// root returns the long leg entity in hedge mode, the entity itself otherwise
+func (ent *ExchangeEntity) root() *ExchangeEntity {
+	if ent.parent != nil {
+		return ent.parent
+	}
+
+	return ent
+}
+
+func (ent *ExchangeEntity) marginMode() string {
+	if strings.EqualFold(ent.cfg.Futures.MarginMode, MarginModeIsolated) {
+		return MarginModeIsolated
+	}
+
+	return MarginModeCross
+}
+
+// buysInQuote reports whether market buy quantities are in quote, as for
+// margin sessions. Futures orders are in base on both sides.
+func (ent *ExchangeEntity) buysInQuote() bool {
+	return !ent.futures()
+}
+
+// setupFutures checks the futures session and sets the hedge mode and the leverage of the legs
+func (ent *ExchangeEntity) setupFutures(ctx context.Context) {
+	if !ent.futures() {
+		return
+	}
+
+	session := ent.session
+	if !session.Futures && !session.IsolatedFutures {
+		log.Warn("futures mode on a session without futures or isolatedFutures, orders may go to the spot or margin account")
+	}
+
+	if session.IsolatedFutures != (ent.marginMode() == MarginModeIsolated) {
+		log.WithField("marginMode", ent.marginMode()).
+			WithField("isolatedFutures", session.IsolatedFutures).
+			Warn("futures margin_mode differs from the session isolatedFutures setting")
+	}
+
+	if ent.hedged() {
+		service, ok := ent.exchangeService().(HedgeModeService)
+		if !ok {
+			log.Error("exchange does not support hedge mode, hedge orders will fail")
+		} else if err := service.SetHedgeMode(ctx, true); err != nil {
+			log.WithError(err).Error("set hedge mode fail")
+		}
+	}
+
+	for _, leg := range ent.legs() {
+		if err := leg.applyLeverage(ctx, leg.leverage); err != nil {
+			log.WithError(err).
+				WithField("side", leg.positionSide).
+				Warn("set futures leverage fail, the exchange setting applies")
+		}
+	}
+}
+
+// applyLeverage sets the leverage of the position on the exchange and uses it for the sizing
+func (ent *ExchangeEntity) applyLeverage(ctx context.Context, leverage fixedpoint.Value) error {
+	if leverage.Compare(fixedpoint.One) < 0 || leverage.Compare(fixedpoint.NewFromInt(MaxLeverage)) > 0 {
+		return fmt.Errorf("leverage must be between 1 and %d", MaxLeverage)
+	}
+
+	service, ok := ent.exchangeService().(FuturesLeverageService)
+	if !ok {
+		return errors.New("exchange does not support setting the leverage")
+	}
+
+	err := service.SetLeverage(ctx, ent.symbol, int(leverage.Int()), ent.marginMode(), string(ent.positionSide))
+	if err != nil {
+		return errors.Wrap(err, "set leverage error")
+	}
+
+	log.WithField("leverage", leverage).
+		WithField("marginMode", ent.marginMode()).
+		WithField("side", ent.positionSide).
+		Info("futures leverage set")
+
+	ent.leverage = leverage
+	return nil
+}
+
+// parseLeverage reads the leverage argument of an open, nil if not given
+func (ent *ExchangeEntity) parseLeverage(args map[string]string) (*fixedpoint.Value, error) {
+	raw := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(args[ArgLeverage]), "x"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	if !ent.futures() {
+		return nil, errors.New("leverage is only supported in futures mode")
+	}
+
+	val, err := fixedpoint.NewFromString(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid leverage")
+	}
+
+	return &val, nil
+}
+
+// submitOrders places orders with the order executor, or on the leg of the
+// entity in hedge mode. Hedge orders are registered to the executor so that
+// its trade collector follows their fills.
+func (ent *ExchangeEntity) submitOrders(ctx context.Context, forms ...types.SubmitOrder) (types.OrderSlice, error) {
+	if !ent.hedged() {
+		return ent.orderExecutor.SubmitOrders(ctx, forms...)
+	}
+
+	service, ok := ent.exchangeService().(HedgeModeService)
+	if !ok {
+		return nil, errors.New("exchange does not support hedge mode orders")
+	}
+
+	orders, err := service.SubmitHedgeOrders(ctx, ent.marginMode(), string(ent.positionSide), forms...)
+	if len(orders) > 0 {
+		ent.orderExecutor.OrderStore().Add(orders...)
+		ent.orderExecutor.ActiveMakerOrders().Add(orders...)
+		ent.orderExecutor.TradeCollector().Process()
+	}
+
+	return orders, err
+}
+
+// commandLeg returns the leg entity a command trades in hedge mode: the open
+// actions name their leg, the others take the leg argument or the only open leg
+func (ent *ExchangeEntity) commandLeg(cmd string, args map[string]string) (*ExchangeEntity, error) {
+	if ent.shortLeg == nil {
+		return ent, nil
+	}
+
+	switch cmd {
+	case "open_long_position":
+		return ent, nil
+	case "open_short_position":
+		return ent.shortLeg, nil
+	case "close_position", "update_position", "add_to_position", "cancel_entry_plan":
+	default:
+		return ent, nil
+	}
+
+	switch PositionSide(strings.ToLower(strings.TrimSpace(args[ArgLeg]))) {
+	case PositionSideLong:
+		return ent, nil
+	case PositionSideShort:
+		return ent.shortLeg, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("invalid leg %s, must be long or short", args[ArgLeg])
+	}
+
+	// Without a position, add_to_position builds the leg of its side
+	if cmd == "add_to_position" {
+		switch strings.ToLower(strings.TrimSpace(args["side"])) {
+		case "long":
+			return ent, nil
+		case "short":
+			return ent.shortLeg, nil
+		}
+	}
+
+	longOpen := !ent.position.IsClosed()
+	shortOpen := !ent.shortLeg.position.IsClosed()
+	if longOpen && shortOpen {
+		return nil, fmt.Errorf("leg is required for %s in hedge mode, both legs are open", cmd)
+	}
+	if shortOpen {
+		return ent.shortLeg, nil
+	}
+
+	return ent, nil
+}
+
+// runLeg starts the short leg of a hedge mode position, it shares the klines
+// and indicators of the long leg
+func (ent *ExchangeEntity) runLeg(ctx context.Context, ch chan ttypes.IEvent) {
+	ent.eventChannel.Store(ch)
+	ent.runCtx = ctx
+	ent.Status = types.StrategyStatusRunning
+	ent.KLineWindow = ent.parent.KLineWindow
+	ent.Indicators = ent.parent.Indicators
+
+	ent.bindPosition(ctx, ch)
+}
+
+// futuresActions adds the leverage argument to the open actions in futures
+// mode, and the leg argument to the actions of an open position in hedge mode
+func (ent *ExchangeEntity) futuresActions(actions []*ttypes.ActionDesc) []*ttypes.ActionDesc {
+	if !ent.futures() {
+		return actions
+	}
+
+	for _, action := range actions {
+		switch action.Name {
+		case "open_long_position", "open_short_position":
+			action.Args = append(action.Args, ttypes.ArgmentDesc{
+				Name:        ArgLeverage,
+				Description: fmt.Sprintf("Optional leverage of the position, 1-%d, set on the exchange before the order", MaxLeverage),
+			})
+		case "close_position", "update_position", "add_to_position", "cancel_entry_plan":
+			if ent.shortLeg != nil {
+				action.Args = append(action.Args, ttypes.ArgmentDesc{
+					Name:        ArgLeg,
+					Description: "long|short, the leg of the hedge mode position, required when both legs are open",
+				})
+			}
+		}
+	}
+
+	return actions
+}
+
+// legs returns the entities of the legs, the entity alone for a net position
+func (ent *ExchangeEntity) legs() []*ExchangeEntity {
+	if ent.shortLeg == nil {
+		return []*ExchangeEntity{ent}
+	}
+
+	return []*ExchangeEntity{ent, ent.shortLeg}
+}
@@ -0,0 +1,164 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yubing744/trading-gpt/pkg/apis/okx"
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+func hedgeEntity() *ExchangeEntity {
+	cfg := &config.EnvExchangeConfig{}
+	cfg.Futures.Enabled = true
+	cfg.Futures.HedgeMode = true
+
+	long := &ExchangeEntity{cfg: cfg, position: NewPositionX(types.NewPositionFromMarket(ledgerMarket))}
+	short := &ExchangeEntity{cfg: cfg, position: NewPositionX(types.NewPositionFromMarket(ledgerMarket))}
+	short.parent = long
+	short.positionSide = PositionSideShort
+	long.positionSide = PositionSideLong
+	long.shortLeg = short
+
+	return long
+}
+
+func TestCommandLeg(t *testing.T) {
+	ent := hedgeEntity()
+
+	leg, err := ent.commandLeg("open_short_position", map[string]string{})
+	assert.NoError(t, err)
+	assert.Same(t, ent.shortLeg, leg)
+
+	leg, err = ent.commandLeg("open_long_position", map[string]string{})
+	assert.NoError(t, err)
+	assert.Same(t, ent, leg)
+
+	leg, err = ent.commandLeg("close_position", map[string]string{ArgLeg: "Short"})
+	assert.NoError(t, err)
+	assert.Same(t, ent.shortLeg, leg)
+
+	_, err = ent.commandLeg("close_position", map[string]string{ArgLeg: "both"})
+	assert.Error(t, err)
+
+	leg, err = ent.commandLeg("add_to_position", map[string]string{"side": "short"})
+	assert.NoError(t, err)
+	assert.Same(t, ent.shortLeg, leg)
+
+	// The only open leg is used without the leg argument
+	ent.shortLeg.position.Base = num(-1)
+	ent.shortLeg.position.AverageCost = num(100)
+	leg, err = ent.commandLeg("update_position", map[string]string{})
+	assert.NoError(t, err)
+	assert.Same(t, ent.shortLeg, leg)
+
+	// Both legs open require it
+	ent.position.Base = num(1)
+	ent.position.AverageCost = num(100)
+	_, err = ent.commandLeg("close_position", map[string]string{})
+	assert.Error(t, err)
+
+	leg, err = ent.commandLeg("get_indicator", map[string]string{})
+	assert.NoError(t, err)
+	assert.Same(t, ent, leg)
+}
+
+func TestParseLeverage(t *testing.T) {
+	ent := hedgeEntity()
+
+	leverage, err := ent.parseLeverage(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, leverage)
+
+	leverage, err = ent.parseLeverage(map[string]string{ArgLeverage: "10x"})
+	if assert.NoError(t, err) && assert.NotNil(t, leverage) {
+		assert.Equal(t, num(10), *leverage)
+	}
+
+	_, err = ent.parseLeverage(map[string]string{ArgLeverage: "ten"})
+	assert.Error(t, err)
+
+	ent.cfg = &config.EnvExchangeConfig{}
+	_, err = ent.parseLeverage(map[string]string{ArgLeverage: "10"})
+	assert.Error(t, err)
+}
+
+func TestFuturesOrderUnits(t *testing.T) {
+	ent := hedgeEntity()
+	assert.False(t, ent.buysInQuote())
+	assert.True(t, ent.hedged())
+	assert.Same(t, ent, ent.shortLeg.root())
+	assert.Len(t, ent.legs(), 2)
+
+	form := ent.generateOrderForm(types.SideTypeBuy, num(1), types.SideEffectTypeMarginBuy)
+	assert.Empty(t, form.MarginSideEffect)
+
+	ent.cfg = &config.EnvExchangeConfig{}
+	assert.True(t, ent.buysInQuote())
+	assert.Equal(t, MarginModeCross, ent.marginMode())
+}
+
+func TestOKXAdapterHedge(t *testing.T) {
+	market := ledgerMarket
+	market.TickSize, market.StepSize = num(0.1), num(0.01)
+	client := &fakeOKXClient{}
+	adapter := NewOKXAdapter(client, market)
+
+	// Plain strings, any futures exchange can implement the services
+	var _ FuturesLeverageService = adapter
+	var _ HedgeModeService = adapter
+
+	assert.NoError(t, adapter.SetLeverage(context.Background(), "BTCUSDT", 5, MarginModeIsolated, string(PositionSideShort)))
+	assert.Equal(t, &okx.SetLeverageRequest{InstID: "BTC-USDT-SWAP", Leverage: "5", MarginMode: "isolated", PosSide: "short"}, client.leverage)
+
+	assert.NoError(t, adapter.SetHedgeMode(context.Background(), true))
+	assert.Equal(t, okx.PositionModeLongShort, client.posMode)
+
+	client.results = []okx.OrderResult{{OrdID: "1001", SCode: "0"}, {SCode: "51008", SMsg: "Insufficient margin"}}
+	client.err = &okx.APIError{Code: "51008", Message: "Insufficient margin"}
+	orders, err := adapter.SubmitHedgeOrders(context.Background(), MarginModeCross, string(PositionSideShort),
+		types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeSell, Type: types.OrderTypeMarket, Quantity: num(0.5)},
+		types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Type: types.OrderTypeLimit, Quantity: num(0.5), Price: num(95), ReduceOnly: true},
+	)
+	assert.Error(t, err)
+
+	if assert.Len(t, client.orders, 2) {
+		assert.Equal(t, okx.OrderRequest{InstID: "BTC-USDT-SWAP", TradeMode: "cross", Side: "sell", PosSide: "short", OrderType: "market", Size: "0.50"}, client.orders[0])
+		assert.Equal(t, "limit", client.orders[1].OrderType)
+		assert.Equal(t, "95.0", client.orders[1].Price)
+		assert.False(t, client.orders[1].ReduceOnly)
+	}
+
+	// The placed order of the partially failed batch is returned
+	if assert.Len(t, orders, 1) {
+		assert.Equal(t, uint64(1001), orders[0].OrderID)
+		assert.Equal(t, types.SideTypeSell, orders[0].Side)
+		assert.True(t, orders[0].IsFutures)
+	}
+
+	_, err = adapter.SubmitHedgeOrders(context.Background(), MarginModeCross, string(PositionSideLong),
+		types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeBuy, Type: types.OrderTypeStopMarket, Quantity: num(1)})
+	assert.Error(t, err)
+}
+
+func TestOKXAdapterLegPositions(t *testing.T) {
+	client := &fakeOKXClient{positions: []okx.Position{
+		{InstID: "BTC-USDT-SWAP", PosSide: "long", Pos: "2", AvgPx: "100"},
+		{InstID: "BTC-USDT-SWAP", PosSide: "short", Pos: "0", AvgPx: ""},
+		{InstID: "ETH-USDT-SWAP", PosSide: "short", Pos: "5", AvgPx: "10"},
+	}}
+	adapter := NewOKXAdapter(client, ledgerMarket)
+
+	var _ HedgePositionService = adapter
+
+	legs, err := adapter.QueryLegPositions(context.Background(), "BTCUSDT")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]LegPosition{"long": {Base: num(2), AverageCost: num(100)}}, legs)
+
+	client.positions = []okx.Position{{InstID: "BTC-USDT-SWAP", PosSide: "short", Pos: "x"}}
+	_, err = adapter.QueryLegPositions(context.Background(), "BTCUSDT")
+	assert.Error(t, err)
+}
@@ -0,0 +1,280 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	"github.com/yubing744/trading-gpt/pkg/apis/okx"
+)
+
+// OKXAdapter implements the exchange services the bbgo okex exchange lacks
+// with the OKX REST API, for the market of the entity
+type OKXAdapter struct {
+	client okx.IOKXClient
+	market types.Market
+}
+
+// NewOKXAdapter creates the OKX services adapter of the market
+func NewOKXAdapter(client okx.IOKXClient, market types.Market) *OKXAdapter {
+	return &OKXAdapter{
+		client: client,
+		market: market,
+	}
+}
+
+// spotInstID returns the OKX spot instrument of the market, e.g. BTC-USDT
+func (a *OKXAdapter) spotInstID(symbol string) (string, error) {
+	if symbol != a.market.Symbol {
+		return "", fmt.Errorf("symbol %s is not the market %s of the adapter", symbol, a.market.Symbol)
+	}
+
+	return a.market.BaseCurrency + "-" + a.market.QuoteCurrency, nil
+}
+
+// swapInstID returns the OKX perpetual swap instrument of the market, e.g. BTC-USDT-SWAP
+func (a *OKXAdapter) swapInstID(symbol string) (string, error) {
+	instID, err := a.spotInstID(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	return instID + "-SWAP", nil
+}
+
+// SubmitOCOOrder places an OCO sell order of the quantity, both legs trigger market orders
+func (a *OKXAdapter) SubmitOCOOrder(ctx context.Context, symbol string, quantity, takeProfit, stopLoss fixedpoint.Value) (string, error) {
+	instID, err := a.spotInstID(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	order, err := a.client.PlaceAlgoOrder(ctx, &okx.AlgoOrderRequest{
+		InstID:      instID,
+		TradeMode:   okx.TradeModeCash,
+		Side:        "sell",
+		OrderType:   "oco",
+		Size:        a.market.FormatQuantity(quantity),
+		TpTriggerPx: a.market.FormatPrice(takeProfit),
+		TpOrdPx:     "-1",
+		SlTriggerPx: a.market.FormatPrice(stopLoss),
+		SlOrdPx:     "-1",
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "place OKX OCO order fail")
+	}
+
+	return order.AlgoID, nil
+}
+
+// CancelOCOOrder cancels the OCO order of the id
+func (a *OKXAdapter) CancelOCOOrder(ctx context.Context, symbol string, id string) error {
+	instID, err := a.spotInstID(symbol)
+	if err != nil {
+		return err
+	}
+
+	err = a.client.CancelAlgoOrders(ctx, []okx.CancelAlgoRequest{{AlgoID: id, InstID: instID}})
+	if err != nil {
+		return errors.Wrap(err, "cancel OKX OCO order fail")
+	}
+
+	return nil
+}
+
+// SetLeverage sets the leverage of the swap in the margin mode, of the side in hedge mode
+func (a *OKXAdapter) SetLeverage(ctx context.Context, symbol string, leverage int, marginMode string, side string) error {
+	instID, err := a.swapInstID(symbol)
+	if err != nil {
+		return err
+	}
+
+	err = a.client.SetLeverage(ctx, &okx.SetLeverageRequest{
+		InstID:     instID,
+		Leverage:   strconv.Itoa(leverage),
+		MarginMode: marginMode,
+		PosSide:    side,
+	})
+	if err != nil {
+		return errors.Wrap(err, "set OKX leverage fail")
+	}
+
+	return nil
+}
+
+// SetHedgeMode switches the account to the long/short position mode, or back to the net mode
+func (a *OKXAdapter) SetHedgeMode(ctx context.Context, enabled bool) error {
+	mode := okx.PositionModeNet
+	if enabled {
+		mode = okx.PositionModeLongShort
+	}
+
+	if err := a.client.SetPositionMode(ctx, mode); err != nil {
+		return errors.Wrap(err, "set OKX position mode fail")
+	}
+
+	return nil
+}
+
+// SubmitHedgeOrders places swap orders of the position side. The side decides
+// what an order opens or closes, so they are never reduce-only.
+func (a *OKXAdapter) SubmitHedgeOrders(ctx context.Context, marginMode string, side string, forms ...types.SubmitOrder) (types.OrderSlice, error) {
+	reqs := make([]okx.OrderRequest, 0, len(forms))
+	for _, form := range forms {
+		instID, err := a.swapInstID(form.Symbol)
+		if err != nil {
+			return nil, err
+		}
+
+		req := okx.OrderRequest{
+			InstID:    instID,
+			TradeMode: marginMode,
+			ClOrdID:   form.ClientOrderID,
+			Side:      strings.ToLower(string(form.Side)),
+			PosSide:   side,
+			Size:      a.market.FormatQuantity(form.Quantity),
+		}
+
+		switch form.Type {
+		case types.OrderTypeMarket:
+			req.OrderType = "market"
+		case types.OrderTypeLimit:
+			req.OrderType = "limit"
+			req.Price = a.market.FormatPrice(form.Price)
+		case types.OrderTypeLimitMaker:
+			req.OrderType = "post_only"
+			req.Price = a.market.FormatPrice(form.Price)
+		default:
+			return nil, fmt.Errorf("order type %s is not supported for hedge orders", form.Type)
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	results, err := a.client.PlaceOrders(ctx, reqs)
+
+	// The placed orders of a partially failed batch are returned with the error
+	orders := make(types.OrderSlice, 0, len(results))
+	for i, result := range results {
+		if i >= len(forms) || result.OrdID == "" || (result.SCode != "" && result.SCode != "0") {
+			continue
+		}
+
+		orderID, parseErr := strconv.ParseUint(result.OrdID, 10, 64)
+		if parseErr != nil {
+			log.WithError(parseErr).WithField("ordId", result.OrdID).Warn("invalid OKX order id")
+			continue
+		}
+
+		orders = append(orders, types.Order{
+			SubmitOrder:  forms[i],
+			Exchange:     types.ExchangeOKEx,
+			OrderID:      orderID,
+			Status:       types.OrderStatusNew,
+			IsWorking:    true,
+			CreationTime: types.Time(time.Now()),
+			IsFutures:    true,
+			IsIsolated:   marginMode == MarginModeIsolated,
+		})
+	}
+
+	if err != nil {
+		return orders, errors.Wrap(err, "place OKX hedge orders fail")
+	}
+
+	return orders, nil
+}
+
+// QueryLegPositions returns the positions of the legs of the swap in hedge
+// mode by side, in the unit of the hedge orders
+func (a *OKXAdapter) QueryLegPositions(ctx context.Context, symbol string) (map[string]LegPosition, error) {
+	instID, err := a.swapInstID(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := a.client.QueryPositions(ctx, "SWAP", instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query OKX positions fail")
+	}
+
+	legs := make(map[string]LegPosition, 2)
+	for _, position := range positions {
+		side := strings.ToLower(position.PosSide)
+		if position.InstID != instID || (side != string(PositionSideLong) && side != string(PositionSideShort)) {
+			continue
+		}
+
+		base, err := fixedpoint.NewFromString(position.Pos)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid position size of the %s leg", side)
+		}
+
+		averageCost := fixedpoint.Zero
+		if position.AvgPx != "" {
+			if averageCost, err = fixedpoint.NewFromString(position.AvgPx); err != nil {
+				return nil, errors.Wrapf(err, "invalid average price of the %s leg", side)
+			}
+		}
+
+		if base.IsZero() {
+			continue
+		}
+
+		legs[side] = LegPosition{Base: base.Abs(), AverageCost: averageCost}
+	}
+
+	return legs, nil
+}
+
+// fundingBillPages bounds the pages of bills a funding query reads
+const fundingBillPages = 10
+
+// QueryFundingFees returns the funding paid on the swap since the time in
+// quote, negative when received. The OKX bills cover the last 7 days.
+func (a *OKXAdapter) QueryFundingFees(ctx context.Context, symbol string, since time.Time) (fixedpoint.Value, error) {
+	instID, err := a.swapInstID(symbol)
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+
+	received := fixedpoint.Zero
+	after := ""
+	for page := 0; page < fundingBillPages; page++ {
+		bills, err := a.client.QueryBills(ctx, &okx.BillsRequest{
+			InstType: "SWAP",
+			InstID:   instID,
+			Type:     okx.BillTypeFundingFee,
+			Begin:    since,
+			After:    after,
+			Limit:    100,
+		})
+		if err != nil {
+			return fixedpoint.Zero, errors.Wrap(err, "query OKX funding bills fail")
+		}
+
+		for _, bill := range bills {
+			change, err := fixedpoint.NewFromString(bill.BalChg)
+			if err != nil {
+				return fixedpoint.Zero, errors.Wrapf(err, "invalid balance change of bill %s", bill.BillID)
+			}
+
+			received = received.Add(change)
+		}
+
+		if len(bills) < 100 {
+			return received.Neg(), nil
+		}
+
+		after = bills[len(bills)-1].BillID
+	}
+
+	log.WithField("since", since).Warn("too many funding bills, the funding fees are partial")
+	return received.Neg(), nil
+}
@@ -18,20 +18,25 @@ const (
 	CloseReasonTakeProfit  = "TakeProfit"
 	CloseReasonStopLoss    = "StopLoss"
 	CloseReasonLiquidation = "Liquidation"
+	CloseReasonAgent       = "Agent"
+	CloseReasonEmergency   = "Emergency"
 )
 
 // PositionClosedEventData contains all the information about a closed position
 type PositionClosedEventData struct {
-	StrategyID           string      // ID of the strategy that managed this position
-	Symbol               string      // Trading pair symbol
-	EntryPrice           float64     // Price at which the position was opened
-	ExitPrice            float64     // Price at which the position was closed
-	Quantity             float64     // Position size
-	ProfitAndLoss        float64     // Profit or loss amount (quote currency)
-	ProfitAndLossPercent float64     // Profit or loss percentage
-	CloseReason          string      // Reason for closing: "TakeProfit", "StopLoss", "Manual", "Liquidation", etc.
-	Timestamp            time.Time   // Time when the position was closed
-	RelatedMarketData    interface{} // Optional market data snapshot around close time
+	StrategyID           string      `json:"strategy_id"`                   // ID of the strategy that managed this position
+	Symbol               string      `json:"symbol"`                        // Trading pair symbol
+	EntryPrice           float64     `json:"entry_price"`                   // Price at which the position was opened
+	ExitPrice            float64     `json:"exit_price"`                    // Price at which the position was closed
+	Quantity             float64     `json:"quantity"`                      // Position size
+	ProfitAndLoss        float64     `json:"profit_and_loss"`               // Realized profit or loss after fees and funding (quote currency)
+	ProfitAndLossPercent float64     `json:"profit_and_loss_percent"`       // Realized profit or loss percentage of the margin
+	Fees                 float64     `json:"fees"`                          // Trading fees of the position (quote currency)
+	Funding              float64     `json:"funding,omitempty"`             // Funding paid while open, negative when received (quote currency)
+	CloseReason          string      `json:"close_reason"`                  // Reason for closing: "TakeProfit", "StopLoss", "Liquidation", "Agent", "Emergency" or "Manual"
+	CloseSource          string      `json:"close_source,omitempty"`        // Origin of the closing fill: "exchange", "agent", "clean_position", "trailing_stop", "take_profit_ladder", "emergency" or "external"
+	Timestamp            time.Time   `json:"timestamp"`                     // Time when the position was closed
+	RelatedMarketData    interface{} `json:"related_market_data,omitempty"` // Optional market data snapshot around close time
 }
 
 // NewPositionClosedEvent creates a new position closed event
@@ -53,7 +58,9 @@ func (data PositionClosedEventData) ToPrompts() []string {
 		"Exit Price: %.2f\n"+
 		"Quantity: %.6f\n"+
 		"%s: %.2f (%.2f%%)\n"+
+		"Fees: %.2f, Funding: %.2f\n"+
 		"Close Reason: %s\n"+
+		"Close Source: %s\n"+
 		"Close Time: %s",
 		data.Symbol,
 		data.StrategyID,
@@ -64,7 +71,10 @@ func (data PositionClosedEventData) ToPrompts() []string {
 		pnlStr,
 		data.ProfitAndLoss,
 		data.ProfitAndLossPercent,
+		data.Fees,
+		data.Funding,
 		data.CloseReason,
+		data.CloseSource,
 		data.Timestamp.Format(time.RFC3339),
 	)
 
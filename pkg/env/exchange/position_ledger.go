@@ -0,0 +1,592 @@
+package exchange
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Close sources, where the fill that closed a position came from
+const (
+	CloseSourceExchange         = "exchange"           // TP/SL trigger order or liquidation on the exchange
+	CloseSourceAgent            = "agent"              // close_position or a reversal of the model
+	CloseSourceCleanPosition    = "clean_position"     // Clean-position job
+	CloseSourceTrailingStop     = "trailing_stop"      // Local trailing stop
+	CloseSourceTakeProfitLadder = "take_profit_ladder" // Local take-profit ladder
+	CloseSourceEmergency        = "emergency"          // Emergency close of the strategy
+	CloseSourceChat             = "chat"               // /close chat command of an operator
+	CloseSourceLocalExit        = "local_exit"         // Locally monitored stop-loss or take-profit of the spot mode
+	CloseSourceExternal         = "external"           // Order placed outside of the strategy
+	CloseSourceReconcile        = "reconcile"          // Position found flat on the exchange by the reconciler
+)
+
+const (
+	// PendingCloseWindow is how long a close placed by the entity claims the
+	// reducing fills of orders it has not registered yet
+	PendingCloseWindow = 30 * time.Second
+
+	// MaxSeenTrades bounds the trade keys kept to drop duplicated fills, the
+	// least recently seen key is dropped first
+	MaxSeenTrades = 1000
+)
+
+var (
+	// TriggerPriceTolerance is the relative distance of a fill from a TP/SL
+	// trigger price that is still attributed to the trigger order. A stop-loss
+	// fill may slip past its trigger by more.
+	TriggerPriceTolerance = fixedpoint.NewFromFloat(0.005)
+
+	// LiquidationMarginRatio is the share of the margin a fill of an unknown
+	// order must lose to be attributed to a liquidation
+	LiquidationMarginRatio = fixedpoint.NewFromFloat(0.8)
+)
+
+// FundingFeeService is implemented by exchanges that report the funding fees of a position
+type FundingFeeService interface {
+	// QueryFundingFees returns the funding paid since the time in quote, negative when received
+	QueryFundingFees(ctx context.Context, symbol string, since time.Time) (fixedpoint.Value, error)
+}
+
+// closeAttribution is the reason and source of a reducing fill
+type closeAttribution struct {
+	Reason string
+	Source string
+}
+
+// RealizedPosition is the result of the exits of a position computed from its fills
+type RealizedPosition struct {
+	Side        types.SideType
+	EntryPrice  fixedpoint.Value // Average price of the increasing fills
+	ExitPrice   fixedpoint.Value // Average price of the reducing fills
+	Quantity    fixedpoint.Value // Base closed by the reducing fills
+	GrossProfit fixedpoint.Value // Profit of the exits before fees and funding, in quote
+	Fees        fixedpoint.Value // Fees of the exits and the share of the entry fees of the closed quantity, in quote
+	Funding     fixedpoint.Value // Funding paid while the position was open, in quote
+	CloseReason string
+	CloseSource string
+	OpenedAt    time.Time
+	ClosedAt    time.Time
+}
+
+// NetProfit returns the realized profit after fees and funding
+func (r RealizedPosition) NetProfit() fixedpoint.Value {
+	return r.GrossProfit.Sub(r.Fees).Sub(r.Funding)
+}
+
+// ProfitPercent returns the net profit as a percentage of the margin of the closed quantity
+func (r RealizedPosition) ProfitPercent(leverage fixedpoint.Value) fixedpoint.Value {
+	if leverage.Sign() <= 0 {
+		leverage = fixedpoint.One
+	}
+
+	margin := r.EntryPrice.Mul(r.Quantity).Div(leverage)
+	if margin.Sign() <= 0 {
+		return fixedpoint.Zero
+	}
+
+	return r.NetProfit().Div(margin).Mul(fixedpoint.NewFromInt(100))
+}
+
+func (r RealizedPosition) String() string {
+	side := "long"
+	if r.Side == types.SideTypeSell {
+		side = "short"
+	}
+
+	text := fmt.Sprintf("closed %s of the %s at %s (entry %s), gross %s, fees %s",
+		r.Quantity.String(), side, r.ExitPrice.String(), r.EntryPrice.String(),
+		r.GrossProfit.String(), r.Fees.String())
+	if !r.Funding.IsZero() {
+		text += fmt.Sprintf(", funding %s", r.Funding.String())
+	}
+
+	return text + fmt.Sprintf(", net %s", r.NetProfit().String())
+}
+
+// positionLedger follows the position from the account fills, including the
+// fills of orders placed outside of the entity like exchange TP/SL triggers
+type positionLedger struct {
+	mu sync.Mutex
+
+	base       fixedpoint.Value // Signed base, positive when long
+	openSide   types.SideType   // Side of the fills that opened the position
+	entryBase  fixedpoint.Value
+	entryQuote fixedpoint.Value
+	exitBase   fixedpoint.Value
+	exitQuote  fixedpoint.Value
+	entryFees  fixedpoint.Value
+	exitFees   fixedpoint.Value
+	openedAt   time.Time
+	lastClose  closeAttribution
+
+	stopLoss   *fixedpoint.Value // Exchange stop-loss trigger price
+	takeProfit *fixedpoint.Value // Exchange take-profit trigger price
+
+	pending        *closeAttribution // Close placed by the entity
+	pendingExpires time.Time
+
+	seen        tradeKeyLRU // Kept for the lifetime of the ledger, across positions
+	lastTradeAt time.Time   // Arrival of the last fill
+}
+
+// seed starts the ledger from a position restored without its fills
+func (l *positionLedger) seed(base, averageCost fixedpoint.Value, openedAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.base.IsZero() || base.IsZero() {
+		return
+	}
+
+	l.start(base, averageCost, openedAt)
+}
+
+// resync restarts the ledger from a position corrected by the reconciler, its
+// fills and exits are dropped
+func (l *positionLedger) resync(base, averageCost fixedpoint.Value, openedAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stopLoss, takeProfit := l.stopLoss, l.takeProfit
+	l.reset()
+	if !base.IsZero() {
+		l.start(base, averageCost, openedAt)
+		l.stopLoss, l.takeProfit = stopLoss, takeProfit
+	}
+}
+
+func (l *positionLedger) start(base, averageCost fixedpoint.Value, openedAt time.Time) {
+	l.reset()
+	l.base = base
+	l.openSide = types.SideTypeBuy
+	if base.Sign() < 0 {
+		l.openSide = types.SideTypeSell
+	}
+	l.entryBase = base.Abs()
+	l.entryQuote = base.Abs().Mul(averageCost)
+	l.openedAt = openedAt
+}
+
+// setTriggers records the TP/SL trigger prices placed on the exchange, nil keeps the current one
+func (l *positionLedger) setTriggers(stopLoss, takeProfit *fixedpoint.Value) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if stopLoss != nil {
+		v := *stopLoss
+		l.stopLoss = &v
+	}
+
+	if takeProfit != nil {
+		v := *takeProfit
+		l.takeProfit = &v
+	}
+}
+
+// replaceTriggers sets the TP/SL trigger prices reported by the exchange, nil when there is none
+func (l *positionLedger) replaceTriggers(stopLoss, takeProfit *fixedpoint.Value) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopLoss, l.takeProfit = nil, nil
+	if stopLoss != nil {
+		v := *stopLoss
+		l.stopLoss = &v
+	}
+
+	if takeProfit != nil {
+		v := *takeProfit
+		l.takeProfit = &v
+	}
+}
+
+// lastFill returns the time of the last fill recorded
+func (l *positionLedger) lastFill() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lastTradeAt
+}
+
+// expectClose attributes the next reducing fills of unregistered orders to a close of the entity
+func (l *positionLedger) expectClose(attr closeAttribution, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending = &attr
+	l.pendingExpires = now.Add(PendingCloseWindow)
+}
+
+// realized returns the result of the partial exits of the open position, nil if none
+func (l *positionLedger) realized() *RealizedPosition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.base.IsZero() || l.exitBase.IsZero() {
+		return nil
+	}
+
+	r := l.result(time.Time{})
+	return &r
+}
+
+// record adds a fill. It returns the realized position when the fill closes
+// it, attribute names the reason of a reducing fill not claimed by a close
+// of the entity.
+func (l *positionLedger) record(
+	trade types.Trade,
+	market types.Market,
+	owner func(orderID uint64) (closeAttribution, bool),
+	attribute func(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) closeAttribution,
+) *RealizedPosition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen.add(trade.Key(), MaxSeenTrades) {
+		return nil
+	}
+	l.lastTradeAt = time.Now()
+
+	if trade.Quantity.Sign() <= 0 {
+		return nil
+	}
+
+	fee := tradeFeeInQuote(trade, market)
+	signed := trade.Quantity
+	if trade.Side == types.SideTypeSell {
+		signed = signed.Neg()
+	}
+
+	// Opening or adding to the position
+	if l.base.IsZero() || l.base.Sign() == signed.Sign() {
+		l.increase(trade, trade.Quantity, fee)
+		return nil
+	}
+
+	closing := fixedpoint.Min(trade.Quantity, l.base.Abs())
+	remainder := trade.Quantity.Sub(closing)
+	closingFee := fee.Mul(closing).Div(trade.Quantity)
+
+	attr, ok := owner(trade.OrderID)
+	if !ok && l.pending != nil && trade.Time.Time().Before(l.pendingExpires) {
+		attr, ok = *l.pending, true
+	}
+	if !ok {
+		attr = attribute(l.side(), l.entryPrice(), trade.Price, l.stopLoss, l.takeProfit)
+	}
+
+	l.exitBase = l.exitBase.Add(closing)
+	l.exitQuote = l.exitQuote.Add(closing.Mul(trade.Price))
+	l.exitFees = l.exitFees.Add(closingFee)
+	l.lastClose = attr
+	if l.base.Sign() > 0 {
+		l.base = l.base.Sub(closing)
+	} else {
+		l.base = l.base.Add(closing)
+	}
+
+	if !l.base.IsZero() && l.base.Abs().Compare(market.MinQuantity) >= 0 {
+		return nil
+	}
+
+	r := l.result(trade.Time.Time())
+	l.reset()
+
+	// A fill larger than the position reverses it
+	if remainder.Sign() > 0 {
+		l.increase(trade, remainder, fee.Sub(closingFee))
+	}
+
+	return &r
+}
+
+// settle closes the rest of the position at price, for a position found flat
+// on the exchange whose closing fills were missed. The reason comes from
+// attribute, the source is the reconciler. It returns nil without a position.
+func (l *positionLedger) settle(
+	price fixedpoint.Value,
+	closedAt time.Time,
+	attribute func(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) closeAttribution,
+) *RealizedPosition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.base.IsZero() {
+		return nil
+	}
+
+	// Without a price the exit is taken at the entry
+	if price.Sign() <= 0 {
+		price = l.entryPrice()
+	}
+
+	attr := attribute(l.side(), l.entryPrice(), price, l.stopLoss, l.takeProfit)
+	attr.Source = CloseSourceReconcile
+
+	closing := l.base.Abs()
+	l.exitBase = l.exitBase.Add(closing)
+	l.exitQuote = l.exitQuote.Add(closing.Mul(price))
+	l.lastClose = attr
+
+	r := l.result(closedAt)
+	l.reset()
+	return &r
+}
+
+func (l *positionLedger) increase(trade types.Trade, quantity, fee fixedpoint.Value) {
+	if l.base.IsZero() {
+		l.openedAt = trade.Time.Time()
+		l.openSide = trade.Side
+	}
+
+	if trade.Side == types.SideTypeBuy {
+		l.base = l.base.Add(quantity)
+	} else {
+		l.base = l.base.Sub(quantity)
+	}
+
+	l.entryBase = l.entryBase.Add(quantity)
+	l.entryQuote = l.entryQuote.Add(quantity.Mul(trade.Price))
+	l.entryFees = l.entryFees.Add(fee)
+}
+
+func (l *positionLedger) side() types.SideType {
+	return l.openSide
+}
+
+func (l *positionLedger) entryPrice() fixedpoint.Value {
+	if l.entryBase.IsZero() {
+		return fixedpoint.Zero
+	}
+
+	return l.entryQuote.Div(l.entryBase)
+}
+
+func (l *positionLedger) result(closedAt time.Time) RealizedPosition {
+	r := RealizedPosition{
+		Side:        l.side(),
+		EntryPrice:  l.entryPrice(),
+		Quantity:    l.exitBase,
+		Fees:        l.exitFees,
+		CloseReason: l.lastClose.Reason,
+		CloseSource: l.lastClose.Source,
+		OpenedAt:    l.openedAt,
+		ClosedAt:    closedAt,
+	}
+
+	if !l.exitBase.IsZero() {
+		r.ExitPrice = l.exitQuote.Div(l.exitBase)
+	}
+
+	// A partial exit bears the entry fees of the quantity it closed
+	if l.entryBase.Sign() > 0 {
+		closed := fixedpoint.Min(l.exitBase.Div(l.entryBase), fixedpoint.One)
+		r.Fees = r.Fees.Add(l.entryFees.Mul(closed))
+	}
+
+	r.GrossProfit = r.ExitPrice.Sub(r.EntryPrice).Mul(r.Quantity)
+	if r.Side == types.SideTypeSell {
+		r.GrossProfit = r.GrossProfit.Neg()
+	}
+
+	return r
+}
+
+func (l *positionLedger) reset() {
+	l.base = fixedpoint.Zero
+	l.openSide = ""
+	l.entryBase = fixedpoint.Zero
+	l.entryQuote = fixedpoint.Zero
+	l.exitBase = fixedpoint.Zero
+	l.exitQuote = fixedpoint.Zero
+	l.entryFees = fixedpoint.Zero
+	l.exitFees = fixedpoint.Zero
+	l.openedAt = time.Time{}
+	l.lastClose = closeAttribution{}
+	l.stopLoss = nil
+	l.takeProfit = nil
+	l.pending = nil
+}
+
+// tradeKeyLRU is a bounded set of trade keys
+type tradeKeyLRU struct {
+	keys  map[types.TradeKey]*list.Element
+	order *list.List // Most recently seen first
+}
+
+// add records a key and reports whether it was already seen, the least
+// recently seen keys over max are dropped
+func (c *tradeKeyLRU) add(key types.TradeKey, max int) bool {
+	if c.keys == nil {
+		c.keys = make(map[types.TradeKey]*list.Element)
+		c.order = list.New()
+	}
+
+	if elem, ok := c.keys[key]; ok {
+		c.order.MoveToFront(elem)
+		return true
+	}
+
+	c.keys[key] = c.order.PushFront(key)
+	for c.order.Len() > max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.keys, oldest.Value.(types.TradeKey))
+	}
+
+	return false
+}
+
+// tradeFeeInQuote converts the fee of a fill to the quote currency, fees paid
+// in a third currency are not counted
+func tradeFeeInQuote(trade types.Trade, market types.Market) fixedpoint.Value {
+	switch trade.FeeCurrency {
+	case market.QuoteCurrency:
+		return trade.Fee
+	case market.BaseCurrency:
+		return trade.Fee.Mul(trade.Price)
+	}
+
+	if !trade.Fee.IsZero() {
+		log.WithField("trade", trade).Warn("fee currency not convertible to quote, fee not counted")
+	}
+
+	return fixedpoint.Zero
+}
+
+// attributeFill names the reason of a reducing fill of an order the entity did
+// not place: a fill near the take-profit or at or beyond the stop-loss is the
+// exchange TP/SL order, a fill losing most of the margin a liquidation,
+// anything else a manual close.
+func attributeFill(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value, leverage fixedpoint.Value) closeAttribution {
+	// adverse is how far the price moved against the position, relative to the entry
+	adverse := fixedpoint.Zero
+	if entryPrice.Sign() > 0 {
+		adverse = entryPrice.Sub(price).Div(entryPrice)
+		if side == types.SideTypeSell {
+			adverse = adverse.Neg()
+		}
+	}
+
+	// A take-profit fills at its trigger price, a fill far beyond it is not the trigger order
+	if takeProfit != nil && takeProfit.Sign() > 0 {
+		distance := price.Sub(*takeProfit).Div(*takeProfit).Abs()
+		if distance.Compare(TriggerPriceTolerance) <= 0 {
+			return closeAttribution{Reason: CloseReasonTakeProfit, Source: CloseSourceExchange}
+		}
+	}
+
+	if stopLoss != nil && stopLoss.Sign() > 0 {
+		distance := stopLoss.Sub(price).Div(*stopLoss)
+		if side == types.SideTypeSell {
+			distance = distance.Neg()
+		}
+
+		if distance.Compare(TriggerPriceTolerance.Neg()) >= 0 {
+			return closeAttribution{Reason: CloseReasonStopLoss, Source: CloseSourceExchange}
+		}
+	}
+
+	if leverage.Sign() <= 0 {
+		leverage = fixedpoint.One
+	}
+
+	if adverse.Mul(leverage).Compare(LiquidationMarginRatio) >= 0 {
+		return closeAttribution{Reason: CloseReasonLiquidation, Source: CloseSourceExchange}
+	}
+
+	return closeAttribution{Reason: CloseReasonManual, Source: CloseSourceExternal}
+}
+
+// closeAttributionFromContext reads the close reason and source put in the
+// context by the caller of ClosePosition, closes without them are the model's
+func closeAttributionFromContext(ctx context.Context) closeAttribution {
+	attr := closeAttribution{Reason: CloseReasonAgent, Source: CloseSourceAgent}
+
+	if val, ok := ctx.Value("closeReason").(string); ok && val != "" {
+		attr.Reason = val
+	}
+
+	if val, ok := ctx.Value("closeSource").(string); ok && val != "" {
+		attr.Source = val
+	}
+
+	return attr
+}
+
+// handleTrade adds an account fill to the ledger and emits the position_closed
+// event when it closes the position
+func (ent *ExchangeEntity) handleTrade(ctx context.Context, ch chan ttypes.IEvent, trade types.Trade) {
+	realized := ent.ledger.record(trade, ent.position.Market, ent.executions.closeAttribution,
+		func(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) closeAttribution {
+			return attributeFill(side, entryPrice, price, stopLoss, takeProfit, ent.leverage)
+		})
+	if realized == nil {
+		return
+	}
+
+	go ent.emitPositionClosed(ctx, ch, *realized)
+}
+
+// emitPositionClosed completes the realized position with its funding and emits the position_closed event
+func (ent *ExchangeEntity) emitPositionClosed(ctx context.Context, ch chan ttypes.IEvent, realized RealizedPosition) {
+	// Only futures positions pay funding
+	if service, ok := ent.exchangeService().(FundingFeeService); ok && ent.futures() && !realized.OpenedAt.IsZero() {
+		queryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		funding, err := service.QueryFundingFees(queryCtx, ent.symbol, realized.OpenedAt)
+		cancel()
+
+		if err != nil {
+			log.WithError(err).Warn("query funding fees fail, realized profit without funding")
+		} else {
+			realized.Funding = funding
+		}
+	}
+
+	closedAt := realized.ClosedAt
+	if closedAt.IsZero() {
+		closedAt = time.Now()
+	}
+
+	positionData := PositionClosedEventData{
+		StrategyID:           ent.position.StrategyInstanceID,
+		Symbol:               ent.symbol,
+		EntryPrice:           realized.EntryPrice.Float64(),
+		ExitPrice:            realized.ExitPrice.Float64(),
+		Quantity:             realized.Quantity.Float64(),
+		ProfitAndLoss:        realized.NetProfit().Float64(),
+		ProfitAndLossPercent: realized.ProfitPercent(ent.leverage).Float64(),
+		Fees:                 realized.Fees.Float64(),
+		Funding:              realized.Funding.Float64(),
+		CloseReason:          realized.CloseReason,
+		CloseSource:          realized.CloseSource,
+		Timestamp:            closedAt,
+	}
+
+	// Get recent market data as context if available
+	if ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
+		lastIdx := ent.KLineWindow.Len() - 1
+		kline := (*ent.KLineWindow)[lastIdx]
+		positionData.RelatedMarketData = map[string]interface{}{
+			"lastKline": map[string]interface{}{
+				"open":      kline.Open.Float64(),
+				"high":      kline.High.Float64(),
+				"low":       kline.Low.Float64(),
+				"close":     kline.Close.Float64(),
+				"volume":    kline.Volume.Float64(),
+				"startTime": kline.StartTime.Time(),
+				"endTime":   kline.EndTime.Time(),
+			},
+		}
+	}
+
+	log.WithField("positionData", positionData).Info("Emitting position_closed event")
+	ent.emitEvent(ch, NewPositionClosedEvent(positionData))
+}
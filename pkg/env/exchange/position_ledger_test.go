@@ -0,0 +1,234 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yubing744/trading-gpt/pkg/apis/okx"
+)
+
+var ledgerMarket = types.Market{
+	Symbol:        "BTCUSDT",
+	BaseCurrency:  "BTC",
+	QuoteCurrency: "USDT",
+	MinQuantity:   num(0.001),
+}
+
+func ledgerTrade(id, orderID uint64, side types.SideType, price, quantity, fee float64, feeCurrency string) types.Trade {
+	return types.Trade{
+		ID:          id,
+		OrderID:     orderID,
+		Symbol:      "BTCUSDT",
+		Side:        side,
+		Price:       num(price),
+		Quantity:    num(quantity),
+		Fee:         num(fee),
+		FeeCurrency: feeCurrency,
+		Time:        types.Time(time.Now()),
+	}
+}
+
+func noOwner(uint64) (closeAttribution, bool) {
+	return closeAttribution{}, false
+}
+
+func unknownFill(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) closeAttribution {
+	return attributeFill(side, entryPrice, price, stopLoss, takeProfit, num(10))
+}
+
+func TestPositionLedgerOwnClose(t *testing.T) {
+	var ledger positionLedger
+
+	assert.Nil(t, ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 100, 1, 0.1, "USDT"), ledgerMarket, noOwner, unknownFill))
+	assert.Nil(t, ledger.record(ledgerTrade(2, 2, types.SideTypeBuy, 110, 1, 0.001, "BTC"), ledgerMarket, noOwner, unknownFill))
+
+	// Duplicated fills are dropped
+	assert.Nil(t, ledger.record(ledgerTrade(2, 2, types.SideTypeBuy, 110, 1, 0.001, "BTC"), ledgerMarket, noOwner, unknownFill))
+
+	owner := func(orderID uint64) (closeAttribution, bool) {
+		return closeAttribution{Reason: CloseReasonAgent, Source: CloseSourceAgent}, orderID == 3
+	}
+
+	realized := ledger.record(ledgerTrade(3, 3, types.SideTypeSell, 120, 2, 0.24, "USDT"), ledgerMarket, owner, unknownFill)
+	if assert.NotNil(t, realized) {
+		assert.Equal(t, types.SideTypeBuy, realized.Side)
+		assert.InDelta(t, 105, realized.EntryPrice.Float64(), 1e-9)
+		assert.InDelta(t, 120, realized.ExitPrice.Float64(), 1e-9)
+		assert.InDelta(t, 30, realized.GrossProfit.Float64(), 1e-9)
+		assert.InDelta(t, 0.1+0.11+0.24, realized.Fees.Float64(), 1e-9)
+		assert.InDelta(t, 30-0.45, realized.NetProfit().Float64(), 1e-9)
+		assert.Equal(t, CloseReasonAgent, realized.CloseReason)
+		assert.Equal(t, CloseSourceAgent, realized.CloseSource)
+
+		// Margin of 2 BTC at 105 with 10x leverage is 21
+		assert.InDelta(t, (30-0.45)/21*100, realized.ProfitPercent(num(10)).Float64(), 1e-6)
+	}
+
+	assert.Nil(t, ledger.realized())
+}
+
+func TestPositionLedgerPartialExitsAndReversal(t *testing.T) {
+	var ledger positionLedger
+
+	ledger.seed(num(-2), num(100), time.Now())
+	assert.Nil(t, ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 90, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill))
+
+	partial := ledger.realized()
+	if assert.NotNil(t, partial) {
+		assert.Equal(t, types.SideTypeSell, partial.Side)
+		assert.InDelta(t, 10, partial.GrossProfit.Float64(), 1e-9)
+	}
+
+	// Buying 3 closes the remaining short of 1 and opens a long of 2
+	realized := ledger.record(ledgerTrade(2, 2, types.SideTypeBuy, 80, 3, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	if assert.NotNil(t, realized) {
+		assert.InDelta(t, 30, realized.GrossProfit.Float64(), 1e-9)
+		assert.InDelta(t, 2, realized.Quantity.Float64(), 1e-9)
+	}
+
+	assert.InDelta(t, 2, ledger.base.Float64(), 1e-9)
+	assert.Equal(t, types.SideTypeBuy, ledger.side())
+}
+
+func TestPositionLedgerPartialExitFees(t *testing.T) {
+	var ledger positionLedger
+
+	ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 100, 4, 0.4, "USDT"), ledgerMarket, noOwner, unknownFill)
+	ledger.record(ledgerTrade(2, 2, types.SideTypeSell, 110, 1, 0.11, "USDT"), ledgerMarket, noOwner, unknownFill)
+
+	// The exit of a quarter bears a quarter of the entry fees
+	partial := ledger.realized()
+	if assert.NotNil(t, partial) {
+		assert.InDelta(t, 0.1+0.11, partial.Fees.Float64(), 1e-9)
+	}
+
+	realized := ledger.record(ledgerTrade(3, 3, types.SideTypeSell, 110, 3, 0.33, "USDT"), ledgerMarket, noOwner, unknownFill)
+	if assert.NotNil(t, realized) {
+		assert.InDelta(t, 0.4+0.11+0.33, realized.Fees.Float64(), 1e-9)
+	}
+}
+
+func TestPositionLedgerSeenTrades(t *testing.T) {
+	var ledger positionLedger
+
+	ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	assert.NotNil(t, ledger.record(ledgerTrade(2, 2, types.SideTypeSell, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill))
+
+	// A fill of the closed position replayed after a new one opened is still dropped
+	ledger.record(ledgerTrade(3, 3, types.SideTypeBuy, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	assert.Nil(t, ledger.record(ledgerTrade(2, 2, types.SideTypeSell, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill))
+	assert.InDelta(t, 1, ledger.base.Float64(), 1e-9)
+
+	// The least recently seen keys go first
+	var lru tradeKeyLRU
+	key := func(id uint64) types.TradeKey { return types.TradeKey{ID: id} }
+	assert.False(t, lru.add(key(1), 2))
+	assert.False(t, lru.add(key(2), 2))
+	assert.True(t, lru.add(key(1), 2))
+	assert.False(t, lru.add(key(3), 2))
+	assert.True(t, lru.add(key(1), 2))
+	assert.False(t, lru.add(key(2), 2))
+}
+
+func TestPositionLedgerSettle(t *testing.T) {
+	var ledger positionLedger
+	assert.Nil(t, ledger.settle(num(100), time.Now(), unknownFill))
+
+	stopLoss := num(95)
+	ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 100, 2, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	ledger.setTriggers(&stopLoss, nil)
+
+	// A position found flat is closed at the given price by the reconciler
+	realized := ledger.settle(num(94.8), time.Now(), unknownFill)
+	if assert.NotNil(t, realized) {
+		assert.Equal(t, CloseReasonStopLoss, realized.CloseReason)
+		assert.Equal(t, CloseSourceReconcile, realized.CloseSource)
+		assert.InDelta(t, 2, realized.Quantity.Float64(), 1e-9)
+		assert.InDelta(t, -10.4, realized.GrossProfit.Float64(), 1e-9)
+	}
+
+	assert.True(t, ledger.base.IsZero())
+}
+
+func TestPositionLedgerPendingClose(t *testing.T) {
+	var ledger positionLedger
+
+	ledger.record(ledgerTrade(1, 1, types.SideTypeBuy, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	ledger.expectClose(closeAttribution{Reason: CloseReasonEmergency, Source: CloseSourceEmergency}, time.Now())
+
+	realized := ledger.record(ledgerTrade(2, 2, types.SideTypeSell, 100, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+	if assert.NotNil(t, realized) {
+		assert.Equal(t, CloseReasonEmergency, realized.CloseReason)
+		assert.Equal(t, CloseSourceEmergency, realized.CloseSource)
+	}
+}
+
+func TestAttributeFill(t *testing.T) {
+	stopLoss := num(95)
+	takeProfit := num(110)
+
+	attr := attributeFill(types.SideTypeBuy, num(100), num(109.8), &stopLoss, &takeProfit, num(10))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonTakeProfit, Source: CloseSourceExchange}, attr)
+
+	// A stop-loss fill slipping past the trigger
+	attr = attributeFill(types.SideTypeBuy, num(100), num(94), &stopLoss, &takeProfit, num(10))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonStopLoss, Source: CloseSourceExchange}, attr)
+
+	attr = attributeFill(types.SideTypeBuy, num(100), num(91), nil, nil, num(10))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonLiquidation, Source: CloseSourceExchange}, attr)
+
+	attr = attributeFill(types.SideTypeBuy, num(100), num(102), &stopLoss, &takeProfit, num(10))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonManual, Source: CloseSourceExternal}, attr)
+
+	// A fill far beyond the take-profit is not the trigger order
+	attr = attributeFill(types.SideTypeBuy, num(100), num(115), &stopLoss, &takeProfit, num(10))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonManual, Source: CloseSourceExternal}, attr)
+
+	shortStop := num(105)
+	attr = attributeFill(types.SideTypeSell, num(100), num(105.2), &shortStop, nil, num(3))
+	assert.Equal(t, closeAttribution{Reason: CloseReasonStopLoss, Source: CloseSourceExchange}, attr)
+}
+
+func TestCloseAttributionFromContext(t *testing.T) {
+	assert.Equal(t, closeAttribution{Reason: CloseReasonAgent, Source: CloseSourceAgent}, closeAttributionFromContext(context.Background()))
+
+	ctx := context.WithValue(context.Background(), "closeReason", CloseReasonStopLoss)
+	ctx = context.WithValue(ctx, "closeSource", CloseSourceTrailingStop)
+	assert.Equal(t, closeAttribution{Reason: CloseReasonStopLoss, Source: CloseSourceTrailingStop}, closeAttributionFromContext(ctx))
+}
+
+func TestOKXAdapterFundingFees(t *testing.T) {
+	firstPage := make([]okx.Bill, 0, 100)
+	for i := 0; i < 100; i++ {
+		firstPage = append(firstPage, okx.Bill{BillID: fmt.Sprintf("%d", 1000-i), BalChg: "-0.1"})
+	}
+
+	client := &fakeOKXClient{bills: map[string][]okx.Bill{
+		"":    firstPage,
+		"901": {{BillID: "900", BalChg: "2.5"}},
+	}}
+	adapter := NewOKXAdapter(client, ledgerMarket)
+	var _ FundingFeeService = adapter
+
+	since := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	funding, err := adapter.QueryFundingFees(context.Background(), "BTCUSDT", since)
+	assert.NoError(t, err)
+
+	// 10 paid, 2.5 received
+	assert.InDelta(t, 7.5, funding.Float64(), 1e-9)
+
+	if assert.Len(t, client.billReqs, 2) {
+		assert.Equal(t, okx.BillsRequest{InstType: "SWAP", InstID: "BTC-USDT-SWAP", Type: okx.BillTypeFundingFee, Begin: since, Limit: 100}, client.billReqs[0])
+		assert.Equal(t, "901", client.billReqs[1].After)
+	}
+
+	client.bills = map[string][]okx.Bill{"": {{BillID: "1", BalChg: "abc"}}}
+	_, err = adapter.QueryFundingFees(context.Background(), "BTCUSDT", since)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"context"
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Sizing modes of the open actions
+const (
+	SizingModeQuoteRatio = "quote_ratio" // Ratio of the available quote, the default
+	SizingModeRisk       = "risk"        // Percent of equity lost at the stop-loss
+)
+
+// ArgRiskPercent is the open action argument sizing the position by risk
+const ArgRiskPercent = "risk_percent"
+
+const (
+	DefaultFeeRate        = 0.001 // Taker fee rate counted on entry and exit
+	DefaultMaxRiskPercent = 5.0   // Cap of the risk per trade
+)
+
+// RiskSizingOpt sizes an open order so that hitting the stop-loss loses
+// RiskPercent of the account equity
+type RiskSizingOpt struct {
+	RiskPercent fixedpoint.Value
+	StopLoss    fixedpoint.Value
+}
+
+// parseRiskPercent returns the risk per trade of an open action, from the
+// risk_percent argument or from the config in risk mode, nil if the
+// position is sized by quote ratio
+func (ent *ExchangeEntity) parseRiskPercent(args map[string]string) (*fixedpoint.Value, error) {
+	cfg := ent.cfg.Sizing
+
+	var risk fixedpoint.Value
+	if raw := strings.TrimSpace(args[ArgRiskPercent]); raw != "" {
+		val, err := fixedpoint.NewFromString(strings.TrimSuffix(raw, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", ArgRiskPercent)
+		}
+		risk = val
+	} else if cfg.Mode == SizingModeRisk && cfg.RiskPercent > 0 {
+		risk = fixedpoint.NewFromFloat(cfg.RiskPercent)
+	} else {
+		return nil, nil
+	}
+
+	if risk.Sign() <= 0 {
+		return nil, errors.Errorf("%s must be greater than zero", ArgRiskPercent)
+	}
+
+	maxRisk := fixedpoint.NewFromFloat(DefaultMaxRiskPercent)
+	if cfg.MaxRiskPercent > 0 {
+		maxRisk = fixedpoint.NewFromFloat(cfg.MaxRiskPercent)
+	}
+	if risk.Compare(maxRisk) > 0 {
+		return nil, errors.Errorf("%s %s is above the maximum of %s", ArgRiskPercent, risk.String(), maxRisk.String())
+	}
+
+	return &risk, nil
+}
+
+// volatilityStop returns the stop-loss ATRStopMultiple ATRs away from the
+// entry, nil when volatility targeting is disabled or the ATR unknown
+func (ent *ExchangeEntity) volatilityStop(side types.SideType, entry fixedpoint.Value) *fixedpoint.Value {
+	if ent.cfg.Sizing.ATRStopMultiple <= 0 || ent.KLineWindow == nil {
+		return nil
+	}
+
+	atr := averageTrueRange(*ent.KLineWindow, DefaultATRWindow)
+	if atr.IsZero() {
+		return nil
+	}
+
+	distance := atr.Mul(fixedpoint.NewFromFloat(ent.cfg.Sizing.ATRStopMultiple))
+	stop := entry.Sub(distance)
+	if side == types.SideTypeSell {
+		stop = entry.Add(distance)
+	}
+
+	if ent.position.Market.TickSize.Sign() > 0 {
+		stop = ent.position.Market.TruncatePrice(stop)
+	}
+	return &stop
+}
+
+func (ent *ExchangeEntity) feeRate() fixedpoint.Value {
+	if ent.cfg.Sizing.FeeRate > 0 {
+		return fixedpoint.NewFromFloat(ent.cfg.Sizing.FeeRate)
+	}
+
+	return fixedpoint.NewFromFloat(DefaultFeeRate)
+}
+
+// calculateRiskQuantity returns the order quantity risking the given percent
+// of the account equity, in the units calculateQuantity uses for the side
+func (s *ExchangeEntity) calculateRiskQuantity(ctx context.Context, entry fixedpoint.Value, side types.SideType, opt *RiskSizingOpt) (fixedpoint.Value, error) {
+	quoteCurrency := s.position.Market.QuoteCurrency
+
+	equity, err := bbgo.NewAccountValueCalculator(s.session, quoteCurrency).NetValue(ctx)
+	if err != nil {
+		return fixedpoint.Zero, errors.Wrap(err, "can not calculate account net value")
+	}
+
+	buyingPower, err := bbgo.CalculateQuoteQuantity(ctx, s.session, quoteCurrency, s.leverage)
+	if err != nil {
+		return fixedpoint.Zero, errors.Wrap(err, "can not calculate buying power")
+	}
+
+	base, err := RiskQuantity(equity, opt.RiskPercent, entry, opt.StopLoss, s.feeRate(), buyingPower, s.position.Market)
+	if err != nil {
+		return fixedpoint.Zero, err
+	}
+
+	log.WithField("equity", equity).
+		WithField("riskPercent", opt.RiskPercent).
+		WithField("entry", entry).
+		WithField("stopLoss", opt.StopLoss).
+		WithField("base", base).
+		Info("risk based position sizing")
+
+	// Buy orders are placed in quote, like calculateQuantity
+	if side == types.SideTypeBuy && s.buysInQuote() {
+		return base.Mul(entry), nil
+	}
+
+	return base, nil
+}
+
+// RiskQuantity returns the base quantity whose loss from entry to stop,
+// including the fees of both fills, is riskPercent of equity. It is capped
+// by the buying power and truncated to the market step size.
+func RiskQuantity(equity, riskPercent, entry, stop, feeRate, buyingPower fixedpoint.Value, market types.Market) (fixedpoint.Value, error) {
+	if equity.Sign() <= 0 {
+		return fixedpoint.Zero, errors.New("account equity unavailable for risk sizing")
+	}
+
+	if entry.Sign() <= 0 || stop.Sign() <= 0 {
+		return fixedpoint.Zero, errors.New("entry and stop-loss prices are required for risk sizing")
+	}
+
+	distance := entry.Sub(stop).Abs()
+	if distance.IsZero() {
+		return fixedpoint.Zero, errors.New("stop-loss equals the entry price")
+	}
+
+	riskAmount := equity.Mul(riskPercent).Div(fixedpoint.NewFromInt(100))
+	lossPerUnit := distance.Add(entry.Add(stop).Mul(feeRate))
+	base := riskAmount.Div(lossPerUnit)
+
+	if buyingPower.Sign() > 0 {
+		maxBase := buyingPower.Div(entry).Mul(fixedpoint.NewFromFloat(0.99))
+		if base.Compare(maxBase) > 0 {
+			log.WithField("base", base).
+				WithField("maxBase", maxBase).
+				Warn("risk sized quantity above buying power; capping")
+			base = maxBase
+		}
+	}
+
+	if market.StepSize.Sign() > 0 {
+		base = market.TruncateQuantity(base)
+	}
+	if base.Compare(market.MinQuantity) < 0 {
+		return fixedpoint.Zero, errors.Errorf("risk sized quantity %s is less than the minimum %s, widen the risk or tighten the stop", base.String(), market.MinQuantity.String())
+	}
+
+	if !market.MinNotional.IsZero() && base.Mul(entry).Compare(market.MinNotional) < 0 {
+		return fixedpoint.Zero, errors.Errorf("risk sized notional %s is less than the minimum %s", base.Mul(entry).String(), market.MinNotional.String())
+	}
+
+	return base, nil
+}
@@ -0,0 +1,46 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiskQuantity(t *testing.T) {
+	market := types.Market{
+		StepSize:    num(0.01),
+		MinQuantity: num(0.1),
+		MinNotional: num(5),
+	}
+
+	// 1% of 10000 lost over a 0.1 stop distance, without fees
+	base, err := RiskQuantity(num(10000), num(1), num(2), num(1.9), fixedpoint.Zero, fixedpoint.Zero, market)
+	assert.NoError(t, err)
+	assert.Equal(t, num(1000), base)
+
+	// Fees of both fills shrink the quantity
+	base, err = RiskQuantity(num(10000), num(1), num(2), num(1.9), num(0.001), fixedpoint.Zero, market)
+	assert.NoError(t, err)
+	assert.Equal(t, num(962.46), base)
+
+	// Shorts risk the distance above the entry
+	base, err = RiskQuantity(num(10000), num(1), num(2), num(2.1), fixedpoint.Zero, fixedpoint.Zero, market)
+	assert.NoError(t, err)
+	assert.Equal(t, num(1000), base)
+
+	// Capped by the buying power
+	base, err = RiskQuantity(num(10000), num(1), num(2), num(1.9), fixedpoint.Zero, num(1000), market)
+	assert.NoError(t, err)
+	assert.Equal(t, num(495), base)
+
+	_, err = RiskQuantity(num(10), num(1), num(2), num(1), fixedpoint.Zero, fixedpoint.Zero, market)
+	assert.Error(t, err)
+
+	_, err = RiskQuantity(num(10000), num(1), num(2), num(2), fixedpoint.Zero, fixedpoint.Zero, market)
+	assert.Error(t, err)
+
+	_, err = RiskQuantity(fixedpoint.Zero, num(1), num(2), num(1.9), fixedpoint.Zero, fixedpoint.Zero, market)
+	assert.Error(t, err)
+}
@@ -14,6 +14,13 @@ type PositionX struct {
 	AccumulatedProfitValue fixedpoint.Value
 	RemainingFundsRatio    fixedpoint.Value
 	PositionFundsRatio     fixedpoint.Value
+	TrailingStop           *TrailingStop     // Snapshot of the trailing stop, nil if none
+	TakeProfitLadder       *TakeProfitLadder // Snapshot of the take-profit ladder, nil if none
+	EntryPlan              *EntryPlan        // Snapshot of the pending entry plan, nil if none
+	Executions             []ExecutionReport // Running and recent order executions
+	Realized               *RealizedPosition // Realized result of the partial exits, nil if none
+	Leg                    string            // Leg of the position in hedge mode, empty for a net position
+	ShortLeg               *PositionX        // Snapshot of the short leg in hedge mode, nil otherwise
 }
 
 func NewPositionX(pos *types.Position) *PositionX {
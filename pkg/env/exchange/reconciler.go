@@ -0,0 +1,445 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+const (
+	EventPositionReconciled = "position_reconciled"
+
+	// DefaultReconcileInterval is the time between reconciliations when none is configured
+	DefaultReconcileInterval = 5 * time.Minute
+
+	// ReconcileSettleTime is how long after a fill a scheduled reconciliation
+	// waits, the exchange state may be ahead of the fills being processed
+	ReconcileSettleTime = 30 * time.Second
+)
+
+// Discrepancy kinds
+const (
+	DiscrepancyPosition   = "position"
+	DiscrepancyStopLoss   = "stop_loss"
+	DiscrepancyTakeProfit = "take_profit"
+	DiscrepancyOrder      = "order"
+)
+
+// Discrepancy is a difference between the local state and the exchange
+type Discrepancy struct {
+	Kind     string
+	Local    string // Local value
+	Exchange string // Exchange value
+	Action   string // Correction applied
+
+	order *types.Order // Local order no longer open on the exchange
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s: local %s, exchange %s, %s", d.Kind, d.Local, d.Exchange, d.Action)
+}
+
+// ReconcileReport lists the discrepancies a reconciliation found and corrected
+type ReconcileReport struct {
+	Symbol        string
+	Startup       bool
+	Discrepancies []Discrepancy
+	Time          time.Time
+}
+
+// ToPrompts returns the report for the prompt
+func (r ReconcileReport) ToPrompts() []string {
+	when := "during trading"
+	if r.Startup {
+		when = "while the strategy was stopped"
+	}
+
+	lines := []string{fmt.Sprintf("The %s state on the exchange changed outside of your control %s, the local state was reconciled:", r.Symbol, when)}
+	for _, d := range r.Discrepancies {
+		lines = append(lines, "- "+d.String())
+	}
+
+	return []string{strings.Join(lines, "\n")}
+}
+
+// exchangeState is the state of the symbol on the exchange
+type exchangeState struct {
+	Base        fixedpoint.Value // Signed base, positive when long
+	AverageCost fixedpoint.Value // Zero when unknown
+	HasTriggers bool             // Whether the exchange reports the TP/SL attachments
+	StopLoss    *fixedpoint.Value
+	TakeProfit  *fixedpoint.Value
+	OpenOrders  []types.Order
+}
+
+// localState is the state the entity trades on
+type localState struct {
+	Base         fixedpoint.Value
+	AverageCost  fixedpoint.Value
+	StopLoss     *fixedpoint.Value
+	TakeProfit   *fixedpoint.Value
+	ActiveOrders []types.Order
+}
+
+// diffState compares the local state with the exchange. known reports the
+// orders placed by the entity.
+func diffState(local localState, remote exchangeState, market types.Market, known func(orderID uint64) bool) []Discrepancy {
+	discrepancies := make([]Discrepancy, 0)
+
+	if local.Base.Sub(remote.Base).Abs().Compare(market.MinQuantity) >= 0 {
+		discrepancies = append(discrepancies, Discrepancy{
+			Kind:     DiscrepancyPosition,
+			Local:    describeBase(local.Base, local.AverageCost),
+			Exchange: describeBase(remote.Base, remote.AverageCost),
+			Action:   "local position set to the exchange position",
+		})
+	}
+
+	if remote.HasTriggers {
+		if !samePrice(local.StopLoss, remote.StopLoss, market) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:     DiscrepancyStopLoss,
+				Local:    describePrice(local.StopLoss),
+				Exchange: describePrice(remote.StopLoss),
+				Action:   "local stop-loss set to the exchange trigger",
+			})
+		}
+
+		if !samePrice(local.TakeProfit, remote.TakeProfit, market) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:     DiscrepancyTakeProfit,
+				Local:    describePrice(local.TakeProfit),
+				Exchange: describePrice(remote.TakeProfit),
+				Action:   "local take-profit set to the exchange trigger",
+			})
+		}
+	}
+
+	open := make(map[uint64]struct{}, len(remote.OpenOrders))
+	for _, order := range remote.OpenOrders {
+		open[order.OrderID] = struct{}{}
+
+		if !known(order.OrderID) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:     DiscrepancyOrder,
+				Local:    "none",
+				Exchange: describeOrder(order),
+				Action:   "order placed outside of the strategy, left open",
+			})
+		}
+	}
+
+	for i := range local.ActiveOrders {
+		order := local.ActiveOrders[i]
+		if _, ok := open[order.OrderID]; ok {
+			continue
+		}
+
+		discrepancies = append(discrepancies, Discrepancy{
+			Kind:     DiscrepancyOrder,
+			Local:    describeOrder(order),
+			Exchange: "none",
+			Action:   "order no longer open, removed from the local order book",
+			order:    &order,
+		})
+	}
+
+	return discrepancies
+}
+
+func describeBase(base, averageCost fixedpoint.Value) string {
+	if base.IsZero() {
+		return "flat"
+	}
+
+	side := "long"
+	if base.Sign() < 0 {
+		side = "short"
+	}
+
+	if averageCost.Sign() <= 0 {
+		return fmt.Sprintf("%s %s", side, base.Abs().String())
+	}
+
+	return fmt.Sprintf("%s %s at %s", side, base.Abs().String(), averageCost.String())
+}
+
+func describePrice(price *fixedpoint.Value) string {
+	if price == nil {
+		return "none"
+	}
+
+	return price.String()
+}
+
+func describeOrder(order types.Order) string {
+	return fmt.Sprintf("#%d %s %s %s at %s", order.OrderID, order.Type, order.Side, order.Quantity.String(), order.Price.String())
+}
+
+// samePrice compares trigger prices to the tick size
+func samePrice(a, b *fixedpoint.Value, market types.Market) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return a.Sub(*b).Abs().Compare(market.TickSize) <= 0
+}
+
+// runReconciler reconciles the local state with the exchange at startup and on a schedule
+func (ent *ExchangeEntity) runReconciler(ctx context.Context, ch chan ttypes.IEvent) {
+	interval := ent.cfg.Reconcile.Interval.Duration()
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	ent.reconcileAndReport(ctx, ch, true)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Fills and executions in progress are ahead of the local state
+			if ent.executions.running() || time.Since(ent.ledger.lastFill()) < ReconcileSettleTime {
+				log.Info("reconcile_skip_for_trading_in_progress")
+				continue
+			}
+
+			ent.reconcileAndReport(ctx, ch, false)
+		}
+	}
+}
+
+func (ent *ExchangeEntity) reconcileAndReport(ctx context.Context, ch chan ttypes.IEvent, startup bool) {
+	report, err := ent.reconcile(ctx, ch, startup)
+	if err != nil {
+		log.WithError(err).Warn("reconcile_fail")
+		return
+	}
+
+	if len(report.Discrepancies) == 0 {
+		log.Info("reconcile_ok")
+		return
+	}
+
+	for _, d := range report.Discrepancies {
+		log.WithField("discrepancy", d.String()).Warn("reconcile_discrepancy")
+	}
+
+	bbgo.Notify("%s reconciled with the exchange: %d discrepancies", ent.symbol, len(report.Discrepancies))
+	ent.emitEvent(ch, ttypes.NewEvent(EventPositionReconciled, report))
+}
+
+// reconcile compares the local position, TP/SL and orders with the exchange
+// and sets the local state to the exchange state
+func (ent *ExchangeEntity) reconcile(ctx context.Context, ch chan ttypes.IEvent, startup bool) (*ReconcileReport, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	remote, err := ent.queryExchangeState(queryCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := ent.position.Position
+	pos.Lock()
+	local := localState{
+		Base:        pos.Base,
+		AverageCost: pos.AverageCost,
+		StopLoss:    pos.SlTriggerPx,
+		TakeProfit:  pos.TpTriggerPx,
+	}
+	pos.Unlock()
+
+	// The wallet of a spot account may hold base the bot did not buy, only a
+	// shortfall from the quantity of the bot is adopted
+	if ent.spot() && remote.Base.Compare(local.Base) > 0 {
+		remote.Base = fixedpoint.Max(local.Base, fixedpoint.Zero)
+		remote.AverageCost = local.AverageCost
+	}
+
+	activeOrders := ent.orderExecutor.ActiveMakerOrders()
+	local.ActiveOrders = activeOrders.Orders()
+
+	// The open orders of the symbol include those of the other leg in hedge mode
+	known := func(orderID uint64) bool {
+		if _, ok := activeOrders.Get(orderID); ok {
+			return true
+		}
+
+		for _, leg := range ent.root().legs() {
+			if leg.orderExecutor.OrderStore().Exists(orderID) || leg.executions.owns(orderID) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	report := &ReconcileReport{
+		Symbol:        ent.symbol,
+		Startup:       startup,
+		Discrepancies: diffState(local, *remote, pos.Market, known),
+		Time:          time.Now(),
+	}
+
+	for _, d := range report.Discrepancies {
+		switch d.Kind {
+		case DiscrepancyPosition:
+			ent.adoptPosition(ctx, ch, remote.Base, remote.AverageCost)
+		case DiscrepancyStopLoss, DiscrepancyTakeProfit:
+			pos.Lock()
+			pos.SlTriggerPx, pos.TpTriggerPx = remote.StopLoss, remote.TakeProfit
+			pos.Unlock()
+			ent.ledger.replaceTriggers(remote.StopLoss, remote.TakeProfit)
+		case DiscrepancyOrder:
+			if d.order != nil {
+				activeOrders.Remove(*d.order)
+			}
+		}
+	}
+
+	if len(report.Discrepancies) > 0 && ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
+		ent.updatePositionFundRatios(ctx, ent.KLineWindow.GetClose())
+	}
+
+	return report, nil
+}
+
+// queryExchangeState reads the position and TP/SL from the position service of
+// the exchange, or the base balance without one, and the open orders
+func (ent *ExchangeEntity) queryExchangeState(ctx context.Context) (*exchangeState, error) {
+	state := &exchangeState{}
+
+	// A hedge mode leg is the position of its side
+	if ent.hedged() {
+		service, ok := ent.exchangeService().(HedgePositionService)
+		if !ok {
+			return nil, errors.New("exchange does not report the positions of the hedge mode legs")
+		}
+
+		legs, err := service.QueryLegPositions(ctx, ent.symbol)
+		if err != nil {
+			return nil, errors.Wrap(err, "query leg positions error")
+		}
+
+		if leg, ok := legs[string(ent.positionSide)]; ok {
+			state.Base = leg.Base
+			if ent.positionSide == PositionSideShort {
+				state.Base = state.Base.Neg()
+			}
+			state.AverageCost = leg.AverageCost
+		}
+	} else if service, ok := ent.session.Exchange.(types.ExchangePositionUpdateService); ok && !ent.spot() {
+		info, err := service.QueryPositionInfo(ctx, ent.symbol)
+		if err != nil {
+			return nil, errors.Wrap(err, "query position info error")
+		}
+
+		state.HasTriggers = true
+		if info != nil {
+			state.Base = info.Pos
+			if strings.EqualFold(info.PosSide, "short") && state.Base.Sign() > 0 {
+				state.Base = state.Base.Neg()
+			}
+			state.AverageCost = info.AvgPx
+			state.StopLoss = info.SlTriggerPx
+			state.TakeProfit = info.TpTriggerPx
+		}
+	} else {
+		account, err := ent.session.UpdateAccount(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "update account error")
+		}
+
+		if balance, ok := account.Balance(ent.position.BaseCurrency); ok {
+			if ent.session.Margin && !ent.spot() {
+				state.Base = balance.NetAsset
+			} else {
+				state.Base = balance.Available.Add(balance.Locked)
+			}
+		}
+
+		// Base below the minimum quantity is dust, not a position
+		if state.Base.Abs().Compare(ent.position.Market.MinQuantity) < 0 {
+			state.Base = fixedpoint.Zero
+		}
+	}
+
+	orders, err := ent.session.Exchange.QueryOpenOrders(ctx, ent.symbol)
+	if err != nil {
+		return nil, errors.Wrap(err, "query open orders error")
+	}
+	state.OpenOrders = orders
+
+	return state, nil
+}
+
+// adoptPosition sets the local position to the exchange position. An unknown
+// average cost keeps the local one on the same side, or the last close. A
+// position found flat is closed at the last close with the position_closed
+// event, its closing fills were missed.
+func (ent *ExchangeEntity) adoptPosition(ctx context.Context, ch chan ttypes.IEvent, base, averageCost fixedpoint.Value) {
+	pos := ent.position.Position
+
+	if base.IsZero() {
+		exitPrice := fixedpoint.Zero
+		if ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
+			exitPrice = ent.KLineWindow.GetClose()
+		}
+
+		realized := ent.ledger.settle(exitPrice, time.Now(),
+			func(side types.SideType, entryPrice, price fixedpoint.Value, stopLoss, takeProfit *fixedpoint.Value) closeAttribution {
+				return attributeFill(side, entryPrice, price, stopLoss, takeProfit, ent.leverage)
+			})
+		if realized != nil {
+			go ent.emitPositionClosed(ctx, ch, *realized)
+		}
+	}
+
+	pos.Lock()
+	if base.IsZero() {
+		pos.Reset()
+		pos.ApproximateAverageCost = fixedpoint.Zero
+		pos.SlTriggerPx, pos.TpTriggerPx = nil, nil
+	} else {
+		if averageCost.Sign() <= 0 {
+			if pos.Base.Sign() == base.Sign() && pos.AverageCost.Sign() > 0 {
+				averageCost = pos.AverageCost
+			} else if ent.KLineWindow != nil && ent.KLineWindow.Len() > 0 {
+				averageCost = ent.KLineWindow.GetClose()
+			}
+		}
+
+		if pos.Base.Sign() != base.Sign() {
+			pos.OpenedAt = time.Now()
+			ent.positionGen.Add(1)
+		}
+
+		pos.Base = base
+		pos.AverageCost = averageCost
+		pos.ApproximateAverageCost = averageCost
+		pos.Quote = base.Mul(averageCost).Neg()
+	}
+	pos.ChangedAt = time.Now()
+	openedAt := pos.OpenedAt
+	pos.Unlock()
+
+	ent.ledger.resync(base, averageCost, openedAt)
+
+	if base.IsZero() {
+		ent.clearExits()
+		ent.clearEntryPlan(ctx)
+	}
+}
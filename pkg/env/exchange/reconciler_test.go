@@ -0,0 +1,133 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func reconcileOrder(id uint64) types.Order {
+	return types.Order{
+		SubmitOrder: types.SubmitOrder{
+			Symbol:   "BTCUSDT",
+			Side:     types.SideTypeBuy,
+			Type:     types.OrderTypeLimit,
+			Quantity: num(0.1),
+			Price:    num(100),
+		},
+		OrderID: id,
+	}
+}
+
+func TestDiffStateInSync(t *testing.T) {
+	market := ledgerMarket
+	market.TickSize = num(0.01)
+	stop := num(95)
+
+	local := localState{
+		Base:         num(1),
+		AverageCost:  num(100),
+		StopLoss:     &stop,
+		ActiveOrders: []types.Order{reconcileOrder(1)},
+	}
+	remote := exchangeState{
+		Base:        num(1.0005),
+		AverageCost: num(100),
+		HasTriggers: true,
+		StopLoss:    &stop,
+		OpenOrders:  []types.Order{reconcileOrder(1)},
+	}
+
+	known := func(orderID uint64) bool { return orderID == 1 }
+	assert.Empty(t, diffState(local, remote, market, known))
+}
+
+func TestDiffStateDrift(t *testing.T) {
+	market := ledgerMarket
+	market.TickSize = num(0.01)
+	localStop := num(95)
+	remoteTakeProfit := num(120)
+
+	local := localState{
+		Base:         num(1),
+		AverageCost:  num(100),
+		StopLoss:     &localStop,
+		ActiveOrders: []types.Order{reconcileOrder(1)},
+	}
+
+	// The stop-loss fired while the strategy was stopped, and an order was placed on the exchange UI
+	remote := exchangeState{
+		HasTriggers: true,
+		TakeProfit:  &remoteTakeProfit,
+		OpenOrders:  []types.Order{reconcileOrder(2)},
+	}
+
+	discrepancies := diffState(local, remote, market, func(orderID uint64) bool { return orderID == 1 })
+	if assert.Len(t, discrepancies, 5) {
+		assert.Equal(t, DiscrepancyPosition, discrepancies[0].Kind)
+		assert.Equal(t, "long 1 at 100", discrepancies[0].Local)
+		assert.Equal(t, "flat", discrepancies[0].Exchange)
+
+		assert.Equal(t, DiscrepancyStopLoss, discrepancies[1].Kind)
+		assert.Equal(t, "none", discrepancies[1].Exchange)
+
+		assert.Equal(t, DiscrepancyTakeProfit, discrepancies[2].Kind)
+		assert.Equal(t, "120", discrepancies[2].Exchange)
+
+		// Unknown exchange order is reported, the stale local one removed
+		assert.Equal(t, DiscrepancyOrder, discrepancies[3].Kind)
+		assert.Nil(t, discrepancies[3].order)
+		assert.Equal(t, DiscrepancyOrder, discrepancies[4].Kind)
+		if assert.NotNil(t, discrepancies[4].order) {
+			assert.Equal(t, uint64(1), discrepancies[4].order.OrderID)
+		}
+	}
+
+	// Without a position service the TP/SL are not compared
+	remote.HasTriggers = false
+	assert.Len(t, diffState(local, remote, market, func(orderID uint64) bool { return orderID == 1 }), 3)
+}
+
+func TestReconcileReportPrompts(t *testing.T) {
+	report := ReconcileReport{
+		Symbol:  "BTCUSDT",
+		Startup: true,
+		Discrepancies: []Discrepancy{{
+			Kind:     DiscrepancyPosition,
+			Local:    "long 1 at 100",
+			Exchange: "flat",
+			Action:   "local position set to the exchange position",
+		}},
+		Time: time.Now(),
+	}
+
+	prompts := report.ToPrompts()
+	if assert.Len(t, prompts, 1) {
+		assert.Contains(t, prompts[0], "outside of your control while the strategy was stopped")
+		assert.Contains(t, prompts[0], "- position: local long 1 at 100, exchange flat, local position set to the exchange position")
+	}
+}
+
+func TestPositionLedgerResync(t *testing.T) {
+	var ledger positionLedger
+	stop := num(95)
+
+	ledger.seed(num(2), num(100), time.Now())
+	ledger.setTriggers(&stop, nil)
+	ledger.record(ledgerTrade(1, 1, types.SideTypeSell, 110, 1, 0, "USDT"), ledgerMarket, noOwner, unknownFill)
+
+	ledger.resync(num(-0.5), num(105), time.Now())
+	assert.InDelta(t, -0.5, ledger.base.Float64(), 1e-9)
+	assert.Equal(t, types.SideTypeSell, ledger.side())
+	assert.Nil(t, ledger.realized())
+	if assert.NotNil(t, ledger.stopLoss) {
+		assert.Equal(t, stop, *ledger.stopLoss)
+	}
+
+	ledger.resync(fixedpoint.Zero, fixedpoint.Zero, time.Time{})
+	assert.True(t, ledger.base.IsZero())
+	assert.Nil(t, ledger.stopLoss)
+}
@@ -0,0 +1,332 @@
+package exchange
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Exit orders of the stop-loss and take-profit in spot mode
+const (
+	SpotExitLocal = "local"
+	SpotExitOCO   = "oco"
+)
+
+// OCOOrderService is implemented by spot exchanges placing one-cancels-the-other
+// sell orders, a take-profit and a stop-loss trigger on the same base
+type OCOOrderService interface {
+	// SubmitOCOOrder places the OCO sell order and returns its id
+	SubmitOCOOrder(ctx context.Context, symbol string, quantity, takeProfit, stopLoss fixedpoint.Value) (string, error)
+
+	// CancelOCOOrder cancels the OCO order of the id
+	CancelOCOOrder(ctx context.Context, symbol string, id string) error
+}
+
+// spotExitState holds the OCO order protecting the spot position
+type spotExitState struct {
+	mu        sync.Mutex
+	ocoID     string // Id of the pending OCO order, empty if none
+	triggered bool   // Whether the OCO order triggered, its fills close the position
+}
+
+// spot reports whether the entity trades a spot account: long only, no
+// leverage and no margin borrowing
+func (ent *ExchangeEntity) spot() bool {
+	return ent.cfg != nil && ent.cfg.Spot.Enabled
+}
+
+// spotOCO reports whether the stop-loss and take-profit of the spot position
+// are placed as OCO orders instead of being monitored locally
+func (ent *ExchangeEntity) spotOCO() bool {
+	if !ent.spot() || !strings.EqualFold(ent.cfg.Spot.ExitOrders, SpotExitOCO) {
+		return false
+	}
+
+	_, ok := ent.exchangeService().(OCOOrderService)
+	return ok
+}
+
+// setupSpot checks the session of the spot mode
+func (ent *ExchangeEntity) setupSpot() {
+	if !ent.spot() {
+		return
+	}
+
+	if ent.futures() {
+		log.Warn("spot and futures mode are both enabled, the spot mode applies")
+	}
+
+	if ent.session.Margin || ent.session.IsolatedMargin {
+		log.Warn("spot mode on a margin session, orders do not borrow")
+	}
+
+	if strings.EqualFold(ent.cfg.Spot.ExitOrders, SpotExitOCO) && !ent.spotOCO() {
+		log.Warn("exchange does not support OCO orders, the stop-loss and take-profit are monitored locally")
+	}
+
+	if ent.position.IsShort() {
+		log.WithField("position", ent.position).Warn("short position in spot mode, only closing it is allowed")
+	}
+}
+
+// checkSpotCommand rejects the commands opening a short position in spot mode
+func (ent *ExchangeEntity) checkSpotCommand(cmd string, args map[string]string) error {
+	if !ent.spot() {
+		return nil
+	}
+
+	if cmd == "open_short_position" {
+		return errors.New("short positions are not supported in spot mode")
+	}
+
+	if cmd == "add_to_position" && strings.EqualFold(strings.TrimSpace(args[ArgPlanSide]), "short") {
+		return errors.New("short positions are not supported in spot mode")
+	}
+
+	return nil
+}
+
+// spotActions removes the short action and the side of add_to_position in
+// spot mode, positions are long only
+func (ent *ExchangeEntity) spotActions(actions []*ttypes.ActionDesc) []*ttypes.ActionDesc {
+	if !ent.spot() {
+		return actions
+	}
+
+	filtered := make([]*ttypes.ActionDesc, 0, len(actions))
+	for _, action := range actions {
+		switch action.Name {
+		case "open_short_position":
+			continue
+		case "add_to_position":
+			args := make([]ttypes.ArgmentDesc, 0, len(action.Args))
+			for _, arg := range action.Args {
+				if arg.Name != ArgPlanSide {
+					args = append(args, arg)
+				}
+			}
+			action.Args = args
+		}
+
+		filtered = append(filtered, action)
+	}
+
+	return filtered
+}
+
+// closableBase caps the base quantity of a spot close to the base balance,
+// fees paid in base leave less than the position
+func (ent *ExchangeEntity) closableBase(ctx context.Context, quantity fixedpoint.Value) fixedpoint.Value {
+	balances, err := ent.session.Exchange.QueryAccountBalances(ctx)
+	if err != nil {
+		log.WithError(err).Warn("query base balance for the close fail")
+		return quantity
+	}
+
+	balance, ok := balances[ent.position.Market.BaseCurrency]
+	if !ok || balance.Available.Sign() <= 0 {
+		return quantity
+	}
+
+	if balance.Available.Compare(quantity) < 0 {
+		log.WithField("quantity", quantity).
+			WithField("available", balance.Available).
+			Info("spot close capped to the base balance")
+		return balance.Available
+	}
+
+	return quantity
+}
+
+// checkSpotExits returns the close of the spot position once price crosses its
+// stop-loss or take-profit, when no OCO order protects it. The caller holds exitMu.
+func (ent *ExchangeEntity) checkSpotExits(high, low, price fixedpoint.Value) *exitClose {
+	if !ent.spot() || ent.spotOCOActive() || ent.position == nil || !ent.position.IsLong() {
+		return nil
+	}
+
+	ent.position.Lock()
+	stopLoss, takeProfit := ent.position.SlTriggerPx, ent.position.TpTriggerPx
+	ent.position.Unlock()
+
+	reason := ""
+	switch {
+	case stopLoss != nil && low.Compare(*stopLoss) <= 0:
+		reason = CloseReasonStopLoss
+	case takeProfit != nil && high.Compare(*takeProfit) >= 0:
+		reason = CloseReasonTakeProfit
+	default:
+		return nil
+	}
+
+	log.WithField("stopLoss", stopLoss).
+		WithField("takeProfit", takeProfit).
+		WithField("price", price).
+		WithField("reason", reason).
+		Info("spot_exit_triggered")
+
+	return &exitClose{
+		reason:     reason,
+		source:     CloseSourceLocalExit,
+		percentage: fixedpoint.One,
+		price:      price,
+		placed: func() {
+			// Fire once, the close is in flight
+			ent.position.Lock()
+			ent.position.SlTriggerPx, ent.position.TpTriggerPx = nil, nil
+			ent.position.Unlock()
+
+			ent.trailingStop = nil
+			ent.takeProfitLadder = nil
+		},
+	}
+}
+
+// setSpotExits records the stop-loss and take-profit of the spot position and
+// places them as OCO orders when enabled
+func (ent *ExchangeEntity) setSpotExits(ctx context.Context, stopLoss, takeProfit *fixedpoint.Value) {
+	ent.ledger.setTriggers(stopLoss, takeProfit)
+
+	ent.position.Lock()
+	if stopLoss != nil {
+		ent.position.SlTriggerPx = stopLoss
+	}
+	if takeProfit != nil {
+		ent.position.TpTriggerPx = takeProfit
+	}
+	ent.position.Unlock()
+
+	// New exits protect the position again
+	ent.spotExits.mu.Lock()
+	ent.spotExits.triggered = false
+	ent.spotExits.mu.Unlock()
+
+	ent.placeSpotOCO(ctx)
+}
+
+// placeSpotOCO replaces the OCO order with one covering the current base of
+// the position. Both exits are needed, and the position must be long.
+func (ent *ExchangeEntity) placeSpotOCO(ctx context.Context) {
+	if !ent.spotOCO() {
+		return
+	}
+
+	ent.spotExits.mu.Lock()
+	defer ent.spotExits.mu.Unlock()
+
+	ent.cancelSpotOCOLocked(ctx)
+
+	// The fills of the triggered order close the position
+	if ent.spotExits.triggered {
+		return
+	}
+
+	ent.position.Lock()
+	stopLoss, takeProfit := ent.position.SlTriggerPx, ent.position.TpTriggerPx
+	ent.position.Unlock()
+
+	if !ent.position.IsLong() || ent.position.IsDust(ent.position.AverageCost) {
+		return
+	}
+
+	if stopLoss == nil || takeProfit == nil {
+		log.Info("spot OCO needs both the stop-loss and the take-profit, monitored locally")
+		return
+	}
+
+	quantity := ent.position.Market.TruncateQuantity(ent.closableBase(ctx, ent.position.GetBase()))
+	if quantity.Compare(ent.position.Market.MinQuantity) < 0 {
+		return
+	}
+
+	service := ent.exchangeService().(OCOOrderService)
+	id, err := service.SubmitOCOOrder(ctx, ent.symbol, quantity, *takeProfit, *stopLoss)
+	if err != nil {
+		log.WithError(err).Error("submit spot OCO order fail")
+		return
+	}
+
+	ent.spotExits.ocoID = id
+
+	log.WithField("id", id).
+		WithField("quantity", quantity).
+		WithField("stopLoss", stopLoss).
+		WithField("takeProfit", takeProfit).
+		Info("spot OCO order placed")
+}
+
+// cancelSpotOCO cancels the OCO order, it locks the base a close sells
+func (ent *ExchangeEntity) cancelSpotOCO(ctx context.Context) {
+	ent.spotExits.mu.Lock()
+	defer ent.spotExits.mu.Unlock()
+
+	ent.cancelSpotOCOLocked(ctx)
+}
+
+func (ent *ExchangeEntity) cancelSpotOCOLocked(ctx context.Context) {
+	if ent.spotExits.ocoID == "" {
+		return
+	}
+
+	// A triggered order fails to cancel, that's fine
+	service := ent.exchangeService().(OCOOrderService)
+	if err := service.CancelOCOOrder(ctx, ent.symbol, ent.spotExits.ocoID); err != nil {
+		log.WithError(err).Warn("cancel spot OCO order fail")
+	}
+
+	ent.spotExits.ocoID = ""
+}
+
+// spotOCOActive reports whether an OCO order protects the position
+func (ent *ExchangeEntity) spotOCOActive() bool {
+	ent.spotExits.mu.Lock()
+	defer ent.spotExits.mu.Unlock()
+
+	return ent.spotExits.ocoID != ""
+}
+
+// adoptSpotOCOFill adds a sell fill of an unknown order to the position while
+// the OCO order is pending. The order the OCO order triggered has an id only
+// known once it fills, it is registered so that the trade collector follows it.
+func (ent *ExchangeEntity) adoptSpotOCOFill(trade types.Trade) {
+	if !ent.spot() || trade.Side != types.SideTypeSell {
+		return
+	}
+
+	store := ent.orderExecutor.OrderStore()
+	if store.Exists(trade.OrderID) {
+		return
+	}
+
+	ent.spotExits.mu.Lock()
+	if ent.spotExits.ocoID == "" {
+		ent.spotExits.mu.Unlock()
+		return
+	}
+
+	ent.spotExits.ocoID = ""
+	ent.spotExits.triggered = true
+	ent.spotExits.mu.Unlock()
+
+	log.WithField("orderID", trade.OrderID).
+		WithField("price", trade.Price).
+		Info("spot OCO order triggered")
+
+	store.Add(types.Order{
+		SubmitOrder: types.SubmitOrder{
+			Symbol: trade.Symbol,
+			Side:   trade.Side,
+			Type:   types.OrderTypeMarket,
+		},
+		Exchange: trade.Exchange,
+		OrderID:  trade.OrderID,
+		Status:   types.OrderStatusPartiallyFilled,
+	})
+	ent.orderExecutor.TradeCollector().Process()
+}
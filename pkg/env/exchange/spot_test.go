@@ -0,0 +1,194 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/bbgo"
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yubing744/trading-gpt/pkg/apis/okx"
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+func spotEntity() *ExchangeEntity {
+	cfg := &config.EnvExchangeConfig{}
+	cfg.Spot.Enabled = true
+
+	return NewExchangeEntity("BTCUSDT", types.Interval5m, num(3), cfg, nil, nil, types.NewPositionFromMarket(ledgerMarket))
+}
+
+func TestSpotActions(t *testing.T) {
+	ent := spotEntity()
+	assert.Equal(t, fixedpoint.One, ent.leverage)
+
+	names := map[string]bool{}
+	for _, action := range ent.Actions() {
+		names[action.Name] = true
+
+		if action.Name == "add_to_position" {
+			for _, arg := range action.Args {
+				assert.NotEqual(t, ArgPlanSide, arg.Name)
+			}
+		}
+	}
+
+	assert.True(t, names["open_long_position"])
+	assert.True(t, names["close_position"])
+	assert.False(t, names["open_short_position"])
+}
+
+func TestCheckSpotCommand(t *testing.T) {
+	ent := spotEntity()
+
+	assert.Error(t, ent.checkSpotCommand("open_short_position", map[string]string{}))
+	assert.Error(t, ent.checkSpotCommand("add_to_position", map[string]string{ArgPlanSide: "Short"}))
+	assert.NoError(t, ent.checkSpotCommand("add_to_position", map[string]string{}))
+	assert.NoError(t, ent.checkSpotCommand("open_long_position", map[string]string{}))
+
+	ent.cfg.Spot.Enabled = false
+	assert.NoError(t, ent.checkSpotCommand("open_short_position", map[string]string{}))
+}
+
+func TestSpotOrderForm(t *testing.T) {
+	ent := spotEntity()
+
+	form := ent.generateOrderForm(types.SideTypeBuy, num(100), types.SideEffectTypeMarginBuy)
+	assert.Empty(t, form.MarginSideEffect)
+	assert.True(t, ent.buysInQuote())
+}
+
+func TestCheckSpotExits(t *testing.T) {
+	ent := spotEntity()
+	ent.position.AddTrade(ledgerTrade(1, 1, types.SideTypeBuy, 100, 1, 0, "USDT"))
+
+	stopLoss, takeProfit := num(90), num(120)
+	ent.position.SlTriggerPx, ent.position.TpTriggerPx = &stopLoss, &takeProfit
+
+	assert.Nil(t, ent.checkSpotExits(num(110), num(95), num(100)))
+
+	exit := ent.checkSpotExits(num(100), num(89), num(89))
+	if assert.NotNil(t, exit) {
+		assert.Equal(t, CloseReasonStopLoss, exit.reason)
+		assert.Equal(t, CloseSourceLocalExit, exit.source)
+		assert.Equal(t, fixedpoint.One, exit.percentage)
+
+		// The exits fire once the close is placed
+		assert.NotNil(t, ent.position.SlTriggerPx)
+		exit.placed()
+		assert.Nil(t, ent.position.SlTriggerPx)
+		assert.Nil(t, ent.position.TpTriggerPx)
+	}
+
+	// An OCO order protects the position on the exchange
+	ent.position.SlTriggerPx = &stopLoss
+	ent.spotExits.ocoID = "123"
+	assert.Nil(t, ent.checkSpotExits(num(100), num(80), num(80)))
+}
+
+func TestAdoptSpotOCOFill(t *testing.T) {
+	position := types.NewPositionFromMarket(ledgerMarket)
+	executor := bbgo.NewGeneralOrderExecutor(&bbgo.ExchangeSession{}, "BTCUSDT", "jarvis", "test", position)
+
+	cfg := &config.EnvExchangeConfig{}
+	cfg.Spot.Enabled = true
+	ent := NewExchangeEntity("BTCUSDT", types.Interval5m, num(1), cfg, nil, executor, position)
+
+	executor.OrderStore().Add(types.Order{OrderID: 1, SubmitOrder: types.SubmitOrder{Symbol: "BTCUSDT", Side: types.SideTypeBuy}})
+	executor.TradeCollector().ProcessTrade(ledgerTrade(1, 1, types.SideTypeBuy, 100, 1, 0, "USDT"))
+	assert.Equal(t, num(1), position.GetBase())
+
+	// Without an OCO order, fills of unknown orders are not the position's
+	fill := ledgerTrade(2, 2, types.SideTypeSell, 90, 0.4, 0, "USDT")
+	executor.TradeCollector().ProcessTrade(fill)
+	ent.adoptSpotOCOFill(fill)
+	assert.Equal(t, num(1), position.GetBase())
+
+	// The order the OCO order triggered is adopted with its later fills
+	ent.spotExits.ocoID = "123"
+	fill = ledgerTrade(3, 3, types.SideTypeSell, 90, 0.6, 0, "USDT")
+	executor.TradeCollector().ProcessTrade(fill)
+	ent.adoptSpotOCOFill(fill)
+	assert.Equal(t, num(0.4), position.GetBase())
+	assert.True(t, ent.spotExits.triggered)
+	assert.False(t, ent.spotOCOActive())
+
+	fill = ledgerTrade(4, 3, types.SideTypeSell, 90, 0.4, 0, "USDT")
+	ent.adoptSpotOCOFill(fill)
+	executor.TradeCollector().ProcessTrade(fill)
+	assert.True(t, position.IsClosed())
+}
+
+type fakeOKXClient struct {
+	placed    *okx.AlgoOrderRequest
+	canceled  []okx.CancelAlgoRequest
+	leverage  *okx.SetLeverageRequest
+	posMode   string
+	orders    []okx.OrderRequest
+	results   []okx.OrderResult
+	err       error
+	bills     map[string][]okx.Bill // Pages of bills by the after bill id
+	billReqs  []okx.BillsRequest
+	positions []okx.Position
+}
+
+func (c *fakeOKXClient) PlaceAlgoOrder(ctx context.Context, req *okx.AlgoOrderRequest) (*okx.AlgoOrder, error) {
+	c.placed = req
+	return &okx.AlgoOrder{AlgoID: "42", SCode: "0"}, nil
+}
+
+func (c *fakeOKXClient) CancelAlgoOrders(ctx context.Context, reqs []okx.CancelAlgoRequest) error {
+	c.canceled = reqs
+	return nil
+}
+
+func (c *fakeOKXClient) SetLeverage(ctx context.Context, req *okx.SetLeverageRequest) error {
+	c.leverage = req
+	return nil
+}
+
+func (c *fakeOKXClient) SetPositionMode(ctx context.Context, mode string) error {
+	c.posMode = mode
+	return nil
+}
+
+func (c *fakeOKXClient) QueryBills(ctx context.Context, req *okx.BillsRequest) ([]okx.Bill, error) {
+	c.billReqs = append(c.billReqs, *req)
+	return c.bills[req.After], nil
+}
+
+func (c *fakeOKXClient) QueryPositions(ctx context.Context, instType, instID string) ([]okx.Position, error) {
+	return c.positions, nil
+}
+
+func (c *fakeOKXClient) PlaceOrders(ctx context.Context, reqs []okx.OrderRequest) ([]okx.OrderResult, error) {
+	c.orders = reqs
+	return c.results, c.err
+}
+
+func TestOKXAdapterOCO(t *testing.T) {
+	market := ledgerMarket
+	market.TickSize, market.StepSize = num(0.01), num(0.0001)
+	client := &fakeOKXClient{}
+	adapter := NewOKXAdapter(client, market)
+
+	id, err := adapter.SubmitOCOOrder(context.Background(), "BTCUSDT", num(0.5), num(120), num(90))
+	assert.NoError(t, err)
+	assert.Equal(t, "42", id)
+	assert.Equal(t, "BTC-USDT", client.placed.InstID)
+	assert.Equal(t, "oco", client.placed.OrderType)
+	assert.Equal(t, okx.TradeModeCash, client.placed.TradeMode)
+	assert.Equal(t, "sell", client.placed.Side)
+	assert.Equal(t, "0.5000", client.placed.Size)
+	assert.Equal(t, "120.00", client.placed.TpTriggerPx)
+	assert.Equal(t, "90.00", client.placed.SlTriggerPx)
+	assert.Equal(t, "-1", client.placed.TpOrdPx)
+
+	assert.NoError(t, adapter.CancelOCOOrder(context.Background(), "BTCUSDT", "42"))
+	assert.Equal(t, []okx.CancelAlgoRequest{{AlgoID: "42", InstID: "BTC-USDT"}}, client.canceled)
+
+	_, err = adapter.SubmitOCOOrder(context.Background(), "ETHUSDT", num(1), num(2), num(1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,307 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+
+	"github.com/yubing744/trading-gpt/pkg/utils"
+)
+
+// Take-profit ladder arguments of the open actions
+const (
+	ArgTakeProfitLevels = "take_profit_levels"
+	ArgStopAfterTP1     = "stop_after_tp1"
+
+	StopAfterTP1BreakEven = "break_even"
+)
+
+// TakeProfitLevel is a tier of a take-profit ladder
+type TakeProfitLevel struct {
+	Price       fixedpoint.Value
+	Percent     fixedpoint.Value // Percent of the initial position closed at the tier
+	Filled      bool
+	FilledPrice fixedpoint.Value
+	FilledAt    time.Time
+}
+
+// TakeProfitLadder scales out of the open position in tiers, each closing a
+// percent of the position size when it was first seen open
+type TakeProfitLadder struct {
+	Levels      []*TakeProfitLevel // Ordered from the nearest tier
+	InitialBase fixedpoint.Value   // Position size the percents refer to, zero until filled
+
+	StopAfterTP1 *fixedpoint.Value // Stop moved to after the first tier, nil if none
+	BreakEven    bool              // Whether the stop moves to the entry price after the first tier
+}
+
+// TakeProfitLadderOpt carries the take-profit ladder of an open action
+type TakeProfitLadderOpt struct {
+	Value *TakeProfitLadder
+}
+
+// ParseTakeProfitLadder reads the ladder arguments such as
+// "1.82:30%,1.90:40%,2.00:30%", it returns nil when no ladder is set.
+// Tier prices may be price expressions.
+func ParseTakeProfitLadder(vm *goja.Runtime, klines *types.KLineWindow, side types.SideType, closePrice fixedpoint.Value, args map[string]string) (*TakeProfitLadder, error) {
+	levelsArg := strings.TrimSpace(args[ArgTakeProfitLevels])
+	stopArg := strings.TrimSpace(args[ArgStopAfterTP1])
+
+	if levelsArg == "" {
+		if stopArg != "" {
+			return nil, errors.Errorf("%s requires %s", ArgStopAfterTP1, ArgTakeProfitLevels)
+		}
+		return nil, nil
+	}
+
+	hundred := fixedpoint.NewFromInt(100)
+	ladder := &TakeProfitLadder{}
+	total := fixedpoint.Zero
+
+	for _, tier := range strings.Split(levelsArg, ",") {
+		tier = strings.TrimSpace(tier)
+		sep := strings.LastIndex(tier, ":")
+		if sep <= 0 {
+			return nil, errors.Errorf("invalid take profit level %q, use price:percent", tier)
+		}
+
+		price, err := utils.ParsePrice(vm, klines, closePrice, tier[:sep])
+		if err != nil || price == nil {
+			return nil, errors.Errorf("invalid take profit level price %q", tier[:sep])
+		}
+
+		rawPercent := strings.TrimSpace(tier[sep+1:])
+		percent, err := fixedpoint.NewFromString(strings.TrimSuffix(rawPercent, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid take profit level percent %q", rawPercent)
+		}
+		if !strings.HasSuffix(rawPercent, "%") && percent.Compare(fixedpoint.One) <= 0 {
+			percent = percent.Mul(hundred)
+		}
+		if percent.Sign() <= 0 {
+			return nil, errors.Errorf("take profit level percent %q must be greater than zero", rawPercent)
+		}
+
+		if (side == types.SideTypeBuy && price.Compare(closePrice) <= 0) ||
+			(side == types.SideTypeSell && price.Compare(closePrice) >= 0) {
+			return nil, errors.Errorf("take profit level %s is not in profit from %s", price.String(), closePrice.String())
+		}
+
+		if n := len(ladder.Levels); n > 0 {
+			prev := ladder.Levels[n-1].Price
+			if (side == types.SideTypeBuy && price.Compare(prev) <= 0) || (side == types.SideTypeSell && price.Compare(prev) >= 0) {
+				return nil, errors.Errorf("take profit levels must move away from the price, got %s after %s", price.String(), prev.String())
+			}
+		}
+
+		total = total.Add(percent)
+		ladder.Levels = append(ladder.Levels, &TakeProfitLevel{Price: *price, Percent: percent})
+	}
+
+	if total.Compare(hundred) > 0 {
+		return nil, errors.Errorf("take profit levels close %s%%, more than 100%%", total.String())
+	}
+
+	switch {
+	case stopArg == "":
+	case strings.EqualFold(stopArg, StopAfterTP1BreakEven):
+		ladder.BreakEven = true
+	default:
+		stop, err := utils.ParseStopLoss(vm, side, closePrice, stopArg)
+		if err != nil || stop == nil {
+			return nil, errors.Errorf("invalid %s %q, use break_even or a price", ArgStopAfterTP1, stopArg)
+		}
+		ladder.StopAfterTP1 = stop
+	}
+
+	return ladder, nil
+}
+
+// Hit returns the unfilled tiers the price range reached and the percent of
+// the initial position they close. They are filled once their close is placed.
+func (l *TakeProfitLadder) Hit(isLong bool, high, low fixedpoint.Value) ([]*TakeProfitLevel, fixedpoint.Value) {
+	levels := make([]*TakeProfitLevel, 0)
+	percent := fixedpoint.Zero
+	for _, level := range l.Levels {
+		if level.Filled {
+			continue
+		}
+
+		if (isLong && high.Compare(level.Price) < 0) || (!isLong && low.Compare(level.Price) > 0) {
+			break
+		}
+
+		levels = append(levels, level)
+		percent = percent.Add(level.Percent)
+	}
+
+	return levels, percent
+}
+
+// Fill marks the tiers as filled at the price
+func (l *TakeProfitLadder) Fill(levels []*TakeProfitLevel, price fixedpoint.Value, now time.Time) {
+	for _, level := range levels {
+		level.Filled = true
+		level.FilledPrice = price
+		level.FilledAt = now
+	}
+}
+
+// FilledPercent returns the percent of the initial position the filled tiers closed
+func (l *TakeProfitLadder) FilledPercent() fixedpoint.Value {
+	percent := fixedpoint.Zero
+	for _, level := range l.Levels {
+		if level.Filled {
+			percent = percent.Add(level.Percent)
+		}
+	}
+
+	return percent
+}
+
+// FilledCount returns the number of filled tiers
+func (l *TakeProfitLadder) FilledCount() int {
+	count := 0
+	for _, level := range l.Levels {
+		if level.Filled {
+			count++
+		}
+	}
+
+	return count
+}
+
+// String describes the ladder and its filled tiers for the prompt
+func (l *TakeProfitLadder) String() string {
+	parts := make([]string, 0, len(l.Levels))
+	for i, level := range l.Levels {
+		state := "pending"
+		if level.Filled {
+			state = fmt.Sprintf("filled at %s", level.FilledPrice.String())
+		}
+		parts = append(parts, fmt.Sprintf("TP%d %s for %s%% (%s)", i+1, level.Price.String(), level.Percent.String(), state))
+	}
+
+	text := strings.Join(parts, ", ")
+	if l.BreakEven {
+		text += ", stop to break-even after TP1"
+	} else if l.StopAfterTP1 != nil {
+		text += fmt.Sprintf(", stop to %s after TP1", l.StopAfterTP1.String())
+	}
+
+	return text
+}
+
+// clone copies the ladder for the prompt
+func (l *TakeProfitLadder) clone() *TakeProfitLadder {
+	c := *l
+	c.Levels = make([]*TakeProfitLevel, 0, len(l.Levels))
+	for _, level := range l.Levels {
+		lv := *level
+		c.Levels = append(c.Levels, &lv)
+	}
+
+	return &c
+}
+
+// setTakeProfitLadder replaces the take-profit ladder of the position, nil clears it
+func (ent *ExchangeEntity) setTakeProfitLadder(ladder *TakeProfitLadder) {
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	ent.takeProfitLadder = ladder
+	ent.publishExits()
+}
+
+// checkTakeProfitLadder returns the close of the part of the position the
+// tiers reached by the price range hit, nil if none. The tiers are filled
+// once the close is placed. The caller holds exitMu.
+func (ent *ExchangeEntity) checkTakeProfitLadder(high, low, price fixedpoint.Value) *exitClose {
+	ladder := ent.takeProfitLadder
+	if ladder == nil {
+		return nil
+	}
+
+	if ladder.InitialBase.IsZero() {
+		ladder.InitialBase = ent.position.GetBase().Abs()
+	}
+
+	isLong := ent.position.IsLong()
+	filledBefore := ladder.FilledPercent()
+	filledCount := ladder.FilledCount()
+
+	levels, percent := ladder.Hit(isLong, high, low)
+	if percent.IsZero() {
+		return nil
+	}
+
+	// The percents refer to the initial size, convert to the remaining part
+	hundred := fixedpoint.NewFromInt(100)
+	remaining := hundred.Sub(filledBefore)
+	closePercentage := fixedpoint.One
+	fullClose := filledBefore.Add(percent).Compare(hundred) >= 0
+	if !fullClose {
+		closePercentage = percent.Div(remaining)
+	}
+
+	log.WithField("percent", percent).
+		WithField("closePercentage", closePercentage).
+		WithField("price", price).
+		Info("take_profit_ladder_triggered")
+
+	return &exitClose{
+		reason:     CloseReasonTakeProfit,
+		source:     CloseSourceTakeProfitLadder,
+		percentage: closePercentage,
+		price:      price,
+		placed: func() {
+			ladder.Fill(levels, price, time.Now())
+
+			// The fills of the close may have cleared the exits already
+			if ent.takeProfitLadder != ladder {
+				return
+			}
+
+			if fullClose {
+				ent.takeProfitLadder = nil
+				ent.trailingStop = nil
+				return
+			}
+
+			if filledCount == 0 {
+				ent.moveStopAfterTP1(ladder)
+			}
+		},
+	}
+}
+
+// moveStopAfterTP1 tightens the stop once the first tier filled, through the
+// trailing stop so it is amended on the exchange or enforced locally
+func (ent *ExchangeEntity) moveStopAfterTP1(ladder *TakeProfitLadder) {
+	var stop fixedpoint.Value
+	switch {
+	case ladder.BreakEven:
+		stop = ent.position.AverageCost
+	case ladder.StopAfterTP1 != nil:
+		stop = *ladder.StopAfterTP1
+	default:
+		return
+	}
+
+	if ent.trailingStop == nil {
+		ent.trailingStop = &TrailingStop{}
+	}
+
+	isLong := ent.position.IsLong()
+	if ent.trailingStop.Stop.IsZero() || tighter(isLong, stop, ent.trailingStop.Stop) {
+		log.WithField("stop", stop).Info("take_profit_ladder_stop_moved")
+
+		ent.trailingStop.Stop = stop
+		ent.pendingAmend = true
+	}
+}
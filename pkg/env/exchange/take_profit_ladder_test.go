@@ -0,0 +1,108 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTakeProfitLadder(t *testing.T) {
+	vm := goja.New()
+	klines := &types.KLineWindow{{Close: num(1.75)}}
+
+	ladder, err := ParseTakeProfitLadder(vm, klines, types.SideTypeBuy, num(1.75), map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, ladder)
+
+	ladder, err = ParseTakeProfitLadder(vm, klines, types.SideTypeBuy, num(1.75), map[string]string{
+		ArgTakeProfitLevels: "1.82:30%, 1.90:0.4, 2.00:30%",
+		ArgStopAfterTP1:     "break_even",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ladder.Levels, 3)
+	assert.Equal(t, num(1.9), ladder.Levels[1].Price)
+	assert.Equal(t, num(40), ladder.Levels[1].Percent)
+	assert.True(t, ladder.BreakEven)
+
+	ladder, err = ParseTakeProfitLadder(vm, klines, types.SideTypeSell, num(1.75), map[string]string{
+		ArgTakeProfitLevels: "last_close * 0.98:50%,1.60:50%",
+		ArgStopAfterTP1:     "1.74",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, num(1.715), ladder.Levels[0].Price)
+	assert.Equal(t, num(1.74), *ladder.StopAfterTP1)
+
+	invalid := []map[string]string{
+		{ArgStopAfterTP1: "break_even"},
+		{ArgTakeProfitLevels: "1.82"},
+		{ArgTakeProfitLevels: "1.70:50%"},
+		{ArgTakeProfitLevels: "1.90:50%,1.82:50%"},
+		{ArgTakeProfitLevels: "1.82:60%,1.90:60%"},
+		{ArgTakeProfitLevels: "1.82:0%"},
+	}
+	for _, args := range invalid {
+		_, err := ParseTakeProfitLadder(vm, klines, types.SideTypeBuy, num(1.75), args)
+		assert.Error(t, err, "args %v", args)
+	}
+}
+
+func TestTakeProfitLadder_Hit(t *testing.T) {
+	ladder := &TakeProfitLadder{Levels: []*TakeProfitLevel{
+		{Price: num(1.82), Percent: num(30)},
+		{Price: num(1.90), Percent: num(40)},
+		{Price: num(2.00), Percent: num(30)},
+	}}
+	now := time.Now()
+
+	levels, percent := ladder.Hit(true, num(1.81), num(1.78))
+	assert.Empty(t, levels)
+	assert.True(t, percent.IsZero())
+
+	// Reached tiers stay pending until their close is placed
+	levels, percent = ladder.Hit(true, num(1.83), num(1.79))
+	assert.Equal(t, num(30), percent)
+	assert.Equal(t, 0, ladder.FilledCount())
+
+	ladder.Fill(levels, num(1.82), now)
+	assert.Equal(t, 1, ladder.FilledCount())
+
+	// A filled tier does not fire again, a wide range reaches several tiers
+	levels, percent = ladder.Hit(true, num(2.01), num(1.85))
+	assert.Equal(t, num(70), percent)
+	ladder.Fill(levels, num(1.99), now)
+	assert.Equal(t, num(100), ladder.FilledPercent())
+	assert.Contains(t, ladder.String(), "TP3 2 for 30% (filled at 1.99)")
+
+	short := &TakeProfitLadder{Levels: []*TakeProfitLevel{{Price: num(1.60), Percent: num(50)}}}
+	_, percent = short.Hit(false, num(1.70), num(1.61))
+	assert.True(t, percent.IsZero())
+	_, percent = short.Hit(false, num(1.66), num(1.59))
+	assert.Equal(t, num(50), percent)
+}
+
+func TestTakeProfitLadderFailedClose(t *testing.T) {
+	pos := types.NewPositionFromMarket(ledgerMarket)
+	pos.Base = num(1)
+	pos.AverageCost = num(1.75)
+	ent := &ExchangeEntity{position: NewPositionX(pos)}
+
+	ladder := &TakeProfitLadder{Levels: []*TakeProfitLevel{{Price: num(1.82), Percent: num(50)}}}
+	ent.setTakeProfitLadder(ladder)
+
+	ent.exitMu.Lock()
+	exit := ent.decideExit(context.Background(), num(1.83), num(1.79), num(1.82))
+	ent.unlockExits()
+	if !assert.NotNil(t, exit) {
+		return
+	}
+
+	// The close fails, the tier stays pending for the next price update
+	pos.Base = num(0)
+	ent.placeExitClose(context.Background(), exit)
+	assert.Equal(t, 0, ladder.FilledCount())
+	assert.False(t, ent.exitClosing)
+}
@@ -0,0 +1,525 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Trailing stop modes
+const (
+	TrailingModeDistance = "distance" // Fixed price distance from the best price
+	TrailingModePercent  = "percent"  // Percentage of the best price
+	TrailingModeATR      = "atr"      // Multiple of the ATR of the entity klines
+)
+
+// Trailing stop arguments of the open and update actions
+const (
+	ArgTrailingStopMode     = "trailing_stop_mode"
+	ArgTrailingStopDistance = "trailing_stop_distance"
+	ArgBreakEvenPercent     = "break_even_trigger_percent"
+)
+
+const (
+	DefaultATRWindow        = 14               // ATR window of the atr trailing mode
+	DefaultMinAmendInterval = 10 * time.Second // Minimum time between exchange stop amendments
+)
+
+// TrailingStop moves the stop loss of the open position behind the best price
+// since it was set, and to the entry price once the position is up by the
+// break-even percentage. The stop only ever tightens.
+type TrailingStop struct {
+	Mode             string           // TrailingMode*, empty for break-even only
+	Distance         fixedpoint.Value // Price distance, percentage or ATR multiple
+	BreakEvenPercent fixedpoint.Value // Price move from entry in percent, zero disables
+
+	Extreme   fixedpoint.Value // Highest price of a long, lowest of a short
+	Stop      fixedpoint.Value // Current stop, zero if none yet
+	BrokeEven bool             // Whether the stop was moved to break-even
+}
+
+// TrailingStopOpt carries the trailing stop of an open or update action
+type TrailingStopOpt struct {
+	Value *TrailingStop
+}
+
+// ParseTrailingStop reads the trailing stop arguments, it returns nil when none is set
+func ParseTrailingStop(args map[string]string) (*TrailingStop, error) {
+	mode := strings.ToLower(strings.TrimSpace(args[ArgTrailingStopMode]))
+	distanceArg := strings.TrimSpace(args[ArgTrailingStopDistance])
+	breakEvenArg := strings.TrimSpace(args[ArgBreakEvenPercent])
+
+	if mode == "" && distanceArg == "" && breakEvenArg == "" {
+		return nil, nil
+	}
+
+	ts := &TrailingStop{Mode: mode}
+
+	switch mode {
+	case "":
+		if distanceArg != "" {
+			return nil, errors.Errorf("%s requires %s", ArgTrailingStopDistance, ArgTrailingStopMode)
+		}
+	case TrailingModeDistance, TrailingModePercent, TrailingModeATR:
+		if distanceArg == "" {
+			return nil, errors.Errorf("%s requires %s", ArgTrailingStopMode, ArgTrailingStopDistance)
+		}
+
+		distance, err := fixedpoint.NewFromString(strings.TrimSuffix(distanceArg, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", ArgTrailingStopDistance)
+		}
+		if distance.Sign() <= 0 {
+			return nil, errors.Errorf("%s must be greater than zero", ArgTrailingStopDistance)
+		}
+		if mode == TrailingModePercent && distance.Compare(fixedpoint.NewFromInt(100)) >= 0 {
+			return nil, errors.Errorf("%s must be less than 100 percent", ArgTrailingStopDistance)
+		}
+
+		ts.Distance = distance
+	default:
+		return nil, errors.Errorf("invalid %s %q, use distance, percent or atr", ArgTrailingStopMode, mode)
+	}
+
+	if breakEvenArg != "" {
+		breakEven, err := fixedpoint.NewFromString(strings.TrimSuffix(breakEvenArg, "%"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", ArgBreakEvenPercent)
+		}
+		if breakEven.Sign() <= 0 {
+			return nil, errors.Errorf("%s must be greater than zero", ArgBreakEvenPercent)
+		}
+
+		ts.BreakEvenPercent = breakEven
+	}
+
+	return ts, nil
+}
+
+// Update moves the stop with a new price range of the position and reports
+// whether it changed. atr is only used by the atr mode.
+func (ts *TrailingStop) Update(isLong bool, entry, high, low, atr fixedpoint.Value) bool {
+	best := high
+	if !isLong {
+		best = low
+	}
+	if ts.Extreme.IsZero() || (isLong && best.Compare(ts.Extreme) > 0) || (!isLong && best.Compare(ts.Extreme) < 0) {
+		ts.Extreme = best
+	}
+
+	candidate := fixedpoint.Zero
+
+	if offset := ts.offset(atr); offset.Sign() > 0 {
+		if isLong {
+			candidate = ts.Extreme.Sub(offset)
+		} else {
+			candidate = ts.Extreme.Add(offset)
+		}
+	}
+
+	if !ts.BrokeEven && ts.BreakEvenPercent.Sign() > 0 && entry.Sign() > 0 {
+		move := ts.Extreme.Sub(entry).Div(entry).Mul(fixedpoint.NewFromInt(100))
+		if !isLong {
+			move = move.Neg()
+		}
+
+		if move.Compare(ts.BreakEvenPercent) >= 0 {
+			ts.BrokeEven = true
+			if candidate.IsZero() || tighter(isLong, entry, candidate) {
+				candidate = entry
+			}
+		}
+	}
+
+	if candidate.Sign() <= 0 {
+		return false
+	}
+
+	if ts.Stop.IsZero() || tighter(isLong, candidate, ts.Stop) {
+		ts.Stop = candidate
+		return true
+	}
+
+	return false
+}
+
+// Hit reports whether price crossed the stop
+func (ts *TrailingStop) Hit(isLong bool, price fixedpoint.Value) bool {
+	if ts.Stop.IsZero() {
+		return false
+	}
+
+	if isLong {
+		return price.Compare(ts.Stop) <= 0
+	}
+
+	return price.Compare(ts.Stop) >= 0
+}
+
+// offset returns the distance of the stop from the best price
+func (ts *TrailingStop) offset(atr fixedpoint.Value) fixedpoint.Value {
+	switch ts.Mode {
+	case TrailingModeDistance:
+		return ts.Distance
+	case TrailingModePercent:
+		return ts.Extreme.Mul(ts.Distance).Div(fixedpoint.NewFromInt(100))
+	case TrailingModeATR:
+		return atr.Mul(ts.Distance)
+	default:
+		return fixedpoint.Zero
+	}
+}
+
+// String describes the trailing stop for the prompt
+func (ts *TrailingStop) String() string {
+	parts := make([]string, 0, 3)
+
+	switch ts.Mode {
+	case TrailingModeDistance:
+		parts = append(parts, fmt.Sprintf("trailing %s below/above the best price", ts.Distance.String()))
+	case TrailingModePercent:
+		parts = append(parts, fmt.Sprintf("trailing %s%% from the best price", ts.Distance.String()))
+	case TrailingModeATR:
+		parts = append(parts, fmt.Sprintf("trailing %sx ATR(%d) from the best price", ts.Distance.String(), DefaultATRWindow))
+	}
+
+	if ts.BreakEvenPercent.Sign() > 0 {
+		if ts.BrokeEven {
+			parts = append(parts, "moved to break-even")
+		} else {
+			parts = append(parts, fmt.Sprintf("break-even after +%s%%", ts.BreakEvenPercent.String()))
+		}
+	}
+
+	if !ts.Stop.IsZero() {
+		parts = append(parts, fmt.Sprintf("current stop %s", ts.Stop.String()))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// tighter reports whether stop a is closer to the price than stop b
+func tighter(isLong bool, a, b fixedpoint.Value) bool {
+	if isLong {
+		return a.Compare(b) > 0
+	}
+
+	return a.Compare(b) < 0
+}
+
+// averageTrueRange returns the simple average true range of the last window klines
+func averageTrueRange(klines types.KLineWindow, window int) fixedpoint.Value {
+	if len(klines) < 2 {
+		return fixedpoint.Zero
+	}
+
+	start := len(klines) - window
+	if start < 1 {
+		start = 1
+	}
+
+	sum := fixedpoint.Zero
+	for i := start; i < len(klines); i++ {
+		prevClose := klines[i-1].Close
+		tr := klines[i].High.Sub(klines[i].Low)
+		tr = fixedpoint.Max(tr, klines[i].High.Sub(prevClose).Abs())
+		tr = fixedpoint.Max(tr, klines[i].Low.Sub(prevClose).Abs())
+		sum = sum.Add(tr)
+	}
+
+	return sum.Div(fixedpoint.NewFromInt(int64(len(klines) - start)))
+}
+
+// setTrailingStop replaces the trailing stop of the position, initialStop is
+// the stop it starts from, nil clears the trailing stop
+func (ent *ExchangeEntity) setTrailingStop(ts *TrailingStop, initialStop *fixedpoint.Value) {
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	if ts != nil && initialStop != nil && initialStop.Sign() > 0 {
+		ts.Stop = *initialStop
+	}
+
+	ent.trailingStop = ts
+	ent.pendingAmend = false
+	ent.publishExits()
+}
+
+// currentStop returns the stop a new trailing stop continues from
+func (ent *ExchangeEntity) currentStop() *fixedpoint.Value {
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	if ent.trailingStop != nil && ent.trailingStop.Stop.Sign() > 0 {
+		stop := ent.trailingStop.Stop
+		return &stop
+	}
+
+	if ent.position != nil && ent.position.SlTriggerPx != nil {
+		stop := *ent.position.SlTriggerPx
+		return &stop
+	}
+
+	return nil
+}
+
+// clearExits drops the trailing stop and take-profit ladder of a closed
+// position. It runs from the fills of a close, which may be processed while
+// exitMu is held by the same goroutine, the exits are then dropped when
+// exitMu is released. The clear is tied to the generation of the closed
+// position, it is dropped once a new position was opened.
+func (ent *ExchangeEntity) clearExits() {
+	ent.exitsCleared.Store(ent.positionGen.Load() + 1)
+
+	if ent.exitMu.TryLock() {
+		ent.unlockExits()
+	}
+}
+
+// unlockExits releases exitMu, dropping the exits first when a clear of the
+// current position was asked while it was held
+func (ent *ExchangeEntity) unlockExits() {
+	if cleared := ent.exitsCleared.Swap(0); cleared != 0 {
+		if gen := ent.positionGen.Load(); cleared-1 == gen {
+			ent.trailingStop = nil
+			ent.takeProfitLadder = nil
+			ent.pendingAmend = false
+			ent.amendFailing = false
+			ent.publishExits()
+		} else {
+			log.WithField("generation", cleared-1).
+				WithField("current", gen).
+				Info("exits_clear_of_previous_position_dropped")
+		}
+	}
+
+	ent.exitMu.Unlock()
+
+	// A clear asked while releasing
+	if ent.exitsCleared.Load() != 0 && ent.exitMu.TryLock() {
+		ent.unlockExits()
+	}
+}
+
+// publishExits copies the trailing stop and take-profit ladder to the position for the prompt
+func (ent *ExchangeEntity) publishExits() {
+	if ent.position == nil {
+		return
+	}
+
+	ent.position.TrailingStop = nil
+	if ent.trailingStop != nil {
+		snapshot := *ent.trailingStop
+		ent.position.TrailingStop = &snapshot
+	}
+
+	ent.position.TakeProfitLadder = nil
+	if ent.takeProfitLadder != nil {
+		ent.position.TakeProfitLadder = ent.takeProfitLadder.clone()
+	}
+}
+
+// exitClose is a close decided by an exit while exitMu is held. It is placed
+// once exitMu is released, as the fills of the close clear the exits.
+type exitClose struct {
+	reason     string
+	source     string
+	percentage fixedpoint.Value
+	price      fixedpoint.Value
+	placed     func() // Updates the exits once the close is placed, called under exitMu
+}
+
+// stopAmend is an amendment of the exchange stop decided while exitMu is
+// held. It is placed once exitMu is released, like an exitClose.
+type stopAmend struct {
+	side  types.SideType
+	price fixedpoint.Value
+	stop  fixedpoint.Value
+}
+
+// updateExits runs the take-profit ladder and the trailing stop of the
+// position on a new price range
+func (ent *ExchangeEntity) updateExits(ctx context.Context, high, low, price fixedpoint.Value) {
+	ent.exitMu.Lock()
+	exit := ent.decideExit(ctx, high, low, price)
+	if exit != nil {
+		ent.exitClosing = true
+	}
+	amend := ent.decideAmend(price)
+	ent.unlockExits()
+
+	if amend != nil {
+		ent.placeStopAmend(ctx, amend)
+	}
+
+	if exit != nil {
+		ent.placeExitClose(ctx, exit)
+	}
+}
+
+// decideExit runs the exits on a new price range and returns the close they
+// trigger, nil if none. The caller holds exitMu.
+func (ent *ExchangeEntity) decideExit(ctx context.Context, high, low, price fixedpoint.Value) *exitClose {
+	// The exits wait for the close in flight
+	if ent.exitClosing {
+		return nil
+	}
+
+	if exit := ent.checkSpotExits(high, low, price); exit != nil {
+		return exit
+	}
+
+	if ent.position == nil || (ent.trailingStop == nil && ent.takeProfitLadder == nil) {
+		return nil
+	}
+	defer ent.publishExits()
+
+	if ent.position.IsClosed() || ent.position.IsDust(price) {
+		log.Info("exits_cleared_for_closed_position")
+		ent.trailingStop = nil
+		ent.takeProfitLadder = nil
+		return nil
+	}
+
+	if exit := ent.checkTakeProfitLadder(high, low, price); exit != nil {
+		return exit
+	}
+
+	return ent.updateTrailingStop(ctx, high, low, price)
+}
+
+// placeExitClose places the close of an exit, exitMu is not held
+func (ent *ExchangeEntity) placeExitClose(ctx context.Context, exit *exitClose) {
+	closeCtx := context.WithValue(ctx, "closeReason", exit.reason)
+	closeCtx = context.WithValue(closeCtx, "closeSource", exit.source)
+	err := ent.ClosePosition(closeCtx, exit.percentage, exit.price)
+
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	ent.exitClosing = false
+	if err != nil {
+		// The exit triggers again on the next price update
+		log.WithError(err).WithField("source", exit.source).Error("exit_ClosePosition_fail")
+		return
+	}
+
+	if exit.placed != nil {
+		exit.placed()
+	}
+	ent.publishExits()
+}
+
+// updateTrailingStop moves the trailing stop with a new price range. The
+// stop is amended on the exchange when it supports position updates, see
+// decideAmend, otherwise it returns the close of the position once price
+// crosses it. The caller holds exitMu.
+func (ent *ExchangeEntity) updateTrailingStop(ctx context.Context, high, low, price fixedpoint.Value) *exitClose {
+	ts := ent.trailingStop
+	if ts == nil {
+		return nil
+	}
+
+	isLong := ent.position.IsLong()
+
+	atr := fixedpoint.Zero
+	if ts.Mode == TrailingModeATR && ent.KLineWindow != nil {
+		atr = averageTrueRange(*ent.KLineWindow, DefaultATRWindow)
+	}
+
+	if ts.Update(isLong, ent.position.AverageCost, high, low, atr) {
+		log.WithField("stop", ts.Stop).
+			WithField("extreme", ts.Extreme).
+			WithField("brokeEven", ts.BrokeEven).
+			Info("trailing_stop_moved")
+
+		ent.pendingAmend = true
+	}
+
+	// The stop is enforced here until an amendment succeeds
+	local := !ent.canAmendStop() || ent.amendFailing
+	if !local || !ts.Hit(isLong, price) {
+		return nil
+	}
+
+	log.WithField("stop", ts.Stop).
+		WithField("price", price).
+		Info("trailing_stop_triggered")
+
+	return &exitClose{
+		reason:     CloseReasonStopLoss,
+		source:     CloseSourceTrailingStop,
+		percentage: fixedpoint.One,
+		price:      price,
+		placed: func() {
+			ent.trailingStop = nil
+			ent.takeProfitLadder = nil
+		},
+	}
+}
+
+// decideAmend returns the amendment of the exchange stop lagging the trailing
+// stop, nil if none is due. The caller holds exitMu.
+func (ent *ExchangeEntity) decideAmend(price fixedpoint.Value) *stopAmend {
+	ts := ent.trailingStop
+	if ts == nil || ts.Stop.Sign() <= 0 || !ent.pendingAmend || ent.amending || ent.exitClosing {
+		return nil
+	}
+
+	if !ent.canAmendStop() || time.Since(ent.lastAmend) < ent.minAmendInterval() {
+		return nil
+	}
+
+	ent.amending = true
+	return &stopAmend{
+		side:  ent.getPositionSide(ent.position),
+		price: price,
+		stop:  ts.Stop,
+	}
+}
+
+// placeStopAmend amends the exchange stop, exitMu is not held
+func (ent *ExchangeEntity) placeStopAmend(ctx context.Context, amend *stopAmend) {
+	err := ent.UpdatePositionV2(ctx, amend.side, amend.price, &StopLossPrice{Value: amend.stop})
+
+	ent.exitMu.Lock()
+	defer ent.unlockExits()
+
+	ent.amending = false
+	if err != nil {
+		log.WithError(err).Warn("trailing_stop_amend_fail")
+		ent.amendFailing = true
+		return
+	}
+
+	ent.amendFailing = false
+	ent.lastAmend = time.Now()
+
+	// The stop may have moved again while the amendment was placed
+	if ent.trailingStop == nil || ent.trailingStop.Stop.Compare(amend.stop) == 0 {
+		ent.pendingAmend = false
+	}
+}
+
+// canAmendStop reports whether the exchange can amend the stop of the position
+func (ent *ExchangeEntity) canAmendStop() bool {
+	if ent.session == nil || ent.spot() {
+		return false
+	}
+
+	_, implemented := ent.session.Exchange.(types.ExchangePositionUpdateService)
+	return implemented
+}
+
+func (ent *ExchangeEntity) minAmendInterval() time.Duration {
+	if ent.cfg == nil || ent.cfg.TrailingStop.MinAmendInterval == 0 {
+		return DefaultMinAmendInterval
+	}
+
+	return ent.cfg.TrailingStop.MinAmendInterval.Duration()
+}
@@ -0,0 +1,143 @@
+package exchange
+
+import (
+	"testing"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func num(v float64) fixedpoint.Value {
+	return fixedpoint.NewFromFloat(v)
+}
+
+func TestParseTrailingStop(t *testing.T) {
+	ts, err := ParseTrailingStop(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, ts)
+
+	ts, err = ParseTrailingStop(map[string]string{
+		ArgTrailingStopMode:     "Percent",
+		ArgTrailingStopDistance: "2%",
+		ArgBreakEvenPercent:     "1.5",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, TrailingModePercent, ts.Mode)
+	assert.Equal(t, num(2), ts.Distance)
+	assert.Equal(t, num(1.5), ts.BreakEvenPercent)
+
+	ts, err = ParseTrailingStop(map[string]string{ArgBreakEvenPercent: "1"})
+	assert.NoError(t, err)
+	assert.Empty(t, ts.Mode)
+
+	invalid := []map[string]string{
+		{ArgTrailingStopMode: "atr"},
+		{ArgTrailingStopDistance: "1"},
+		{ArgTrailingStopMode: "chandelier", ArgTrailingStopDistance: "1"},
+		{ArgTrailingStopMode: "distance", ArgTrailingStopDistance: "-1"},
+		{ArgTrailingStopMode: "percent", ArgTrailingStopDistance: "100"},
+		{ArgBreakEvenPercent: "abc"},
+	}
+	for _, args := range invalid {
+		_, err := ParseTrailingStop(args)
+		assert.Error(t, err, "args %v", args)
+	}
+}
+
+func TestTrailingStop_Distance(t *testing.T) {
+	ts := &TrailingStop{Mode: TrailingModeDistance, Distance: num(0.5)}
+
+	assert.True(t, ts.Update(true, num(10), num(10.2), num(9.9), fixedpoint.Zero))
+	assert.Equal(t, num(9.7), ts.Stop)
+
+	assert.True(t, ts.Update(true, num(10), num(11), num(10.4), fixedpoint.Zero))
+	assert.Equal(t, num(10.5), ts.Stop)
+
+	// A pullback never loosens the stop
+	assert.False(t, ts.Update(true, num(10), num(10.6), num(10.1), fixedpoint.Zero))
+	assert.Equal(t, num(10.5), ts.Stop)
+
+	assert.True(t, ts.Hit(true, num(10.5)))
+	assert.False(t, ts.Hit(true, num(10.6)))
+}
+
+func TestTrailingStop_PercentShort(t *testing.T) {
+	ts := &TrailingStop{Mode: TrailingModePercent, Distance: num(10), Stop: num(120)}
+
+	assert.True(t, ts.Update(false, num(100), num(101), num(90), fixedpoint.Zero))
+	assert.Equal(t, num(99), ts.Stop)
+
+	assert.False(t, ts.Update(false, num(100), num(95), num(92), fixedpoint.Zero))
+	assert.Equal(t, num(99), ts.Stop)
+
+	assert.True(t, ts.Hit(false, num(99.5)))
+	assert.False(t, ts.Hit(false, num(98)))
+}
+
+func TestTrailingStop_ATR(t *testing.T) {
+	klines := types.KLineWindow{
+		{High: num(10), Low: num(9), Close: num(9.5)},
+		{High: num(10.5), Low: num(9.5), Close: num(10)},
+		{High: num(11), Low: num(10), Close: num(10.5)},
+	}
+	atr := averageTrueRange(klines, DefaultATRWindow)
+	assert.Equal(t, num(1), atr)
+
+	ts := &TrailingStop{Mode: TrailingModeATR, Distance: num(2)}
+	assert.True(t, ts.Update(true, num(10), num(11), num(10), atr))
+	assert.Equal(t, num(9), ts.Stop)
+}
+
+func TestTrailingStop_BreakEven(t *testing.T) {
+	ts := &TrailingStop{BreakEvenPercent: num(2), Stop: num(95)}
+
+	assert.False(t, ts.Update(true, num(100), num(101), num(99), fixedpoint.Zero))
+	assert.False(t, ts.BrokeEven)
+
+	assert.True(t, ts.Update(true, num(100), num(102), num(100.5), fixedpoint.Zero))
+	assert.True(t, ts.BrokeEven)
+	assert.Equal(t, num(100), ts.Stop)
+
+	// A trailing stop above the entry is kept over break-even
+	ts = &TrailingStop{Mode: TrailingModeDistance, Distance: num(1), BreakEvenPercent: num(2)}
+	assert.True(t, ts.Update(true, num(100), num(105), num(104), fixedpoint.Zero))
+	assert.Equal(t, num(104), ts.Stop)
+	assert.Contains(t, ts.String(), "moved to break-even")
+}
+
+func TestClearExitsWhileHeld(t *testing.T) {
+	ent := &ExchangeEntity{position: NewPositionX(types.NewPositionFromMarket(ledgerMarket))}
+	ent.setTrailingStop(&TrailingStop{Mode: TrailingModeDistance, Distance: num(1)}, nil)
+
+	// A close fill processed while the exits are updated must not block
+	ent.exitMu.Lock()
+	ent.clearExits()
+	assert.NotNil(t, ent.trailingStop)
+	ent.unlockExits()
+
+	assert.Nil(t, ent.trailingStop)
+	assert.Nil(t, ent.position.TrailingStop)
+
+	ent.setTrailingStop(&TrailingStop{Mode: TrailingModeDistance, Distance: num(1)}, nil)
+	ent.clearExits()
+	assert.Nil(t, ent.trailingStop)
+}
+
+func TestClearExitsOfPreviousPosition(t *testing.T) {
+	ent := &ExchangeEntity{position: NewPositionX(types.NewPositionFromMarket(ledgerMarket))}
+
+	// The close fill of the previous position arrives while the exits of a new one are set
+	ent.exitMu.Lock()
+	ent.clearExits()
+	ent.positionGen.Add(1)
+	ent.trailingStop = &TrailingStop{Mode: TrailingModeDistance, Distance: num(1)}
+	ent.unlockExits()
+
+	assert.NotNil(t, ent.trailingStop)
+	assert.Zero(t, ent.exitsCleared.Load())
+
+	// A clear of the current position still applies
+	ent.clearExits()
+	assert.Nil(t, ent.trailingStop)
+}
@@ -89,7 +89,7 @@ func (entity *FearAndGreedEntity) executeRefreshIndex(ctx context.Context) error
 
 	if index != nil && len(index.Data) > 0 {
 		fng := index.Data[0].Value
-		ch <- types.NewEvent("fng_changed", &fng)
+		types.EmitEvent(ctx, ch, types.NewEvent("fng_changed", &fng))
 		log.WithField("value", fng).Info("Fear & Greed Index refreshed successfully")
 	} else {
 		return fmt.Errorf("no Fear & Greed Index data available")
@@ -135,7 +135,7 @@ func (entity *FearAndGreedEntity) executeGetHistoricalIndex(ctx context.Context,
 			historicalData += fmt.Sprintf("%d. %s: %s (%s)\n", i+1, data.Timestamp, data.Value, data.ValueClassification)
 		}
 
-		ch <- types.NewEvent("fng_historical_data", &historicalData)
+		types.EmitEvent(ctx, ch, types.NewEvent("fng_historical_data", &historicalData))
 		log.WithField("count", len(index.Data)).Info("Historical Fear & Greed Index retrieved successfully")
 	} else {
 		return fmt.Errorf("no historical Fear & Greed Index data available")
@@ -9,11 +9,18 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tmc/langchaingo/llms"
 	"github.com/yubing744/trading-gpt/pkg/apis/twitterapi"
 	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
 	"github.com/yubing744/trading-gpt/pkg/types"
 )
 
+const summarizePrompt = `Summarize the following tweets for a crypto trader in at most 5 short bullet points.
+Focus on market-moving news, sentiment and notable accounts, and skip spam and giveaways.
+
+%s`
+
 var log = logrus.WithField("entity", "twitterapi")
 
 type TwitterAPIEntity struct {
@@ -22,6 +29,7 @@ type TwitterAPIEntity struct {
 	config        *config.TwitterAPIEntityConfig
 	timers        map[string]*time.Ticker
 	eventChannel  atomic.Value // Store chan types.IEvent for thread-safe access
+	llm           llms.Model
 }
 
 // NewTwitterAPIEntity creates a new instance of TwitterAPIEntity with the given ID, Twitter client, and configuration.
@@ -36,6 +44,11 @@ func NewTwitterAPIEntity(config *config.TwitterAPIEntityConfig) *TwitterAPIEntit
 	}
 }
 
+// SetLLM sets the model used to summarize tweets, see config.TwitterAPIEntityConfig.Summarize
+func (e *TwitterAPIEntity) SetLLM(llm llms.Model) {
+	e.llm = llm
+}
+
 // GetID returns the entity's id.
 func (e *TwitterAPIEntity) GetID() string {
 	return e.id
@@ -162,9 +175,9 @@ func (e *TwitterAPIEntity) executeConfiguredSearch(ctx context.Context, item *co
 	}
 
 	// Format and send results
-	content := e.formatTweets(response.Tweets, maxResults)
+	content := e.summarize(ctx, e.formatTweets(response.Tweets, maxResults))
 	event := NewTwitterAPIEvent(item.Name, item.Description, content)
-	ch <- event
+	types.EmitEvent(ctx, ch, event)
 
 	log.WithField("tweetCount", len(response.Tweets)).Info("Twitter search command executed successfully")
 	return nil
@@ -219,10 +232,10 @@ func (e *TwitterAPIEntity) executeGenericSearch(ctx context.Context, args map[st
 	}
 
 	// Format and send results
-	content := e.formatTweets(response.Tweets, maxResults)
+	content := e.summarize(ctx, e.formatTweets(response.Tweets, maxResults))
 	description := fmt.Sprintf("Twitter search results for: %s", query)
 	event := NewTwitterAPIEvent("search_tweets", description, content)
-	ch <- event
+	types.EmitEvent(ctx, ch, event)
 
 	log.WithField("tweetCount", len(response.Tweets)).Info("Generic Twitter search command executed successfully")
 	return nil
@@ -282,12 +295,29 @@ func (e *TwitterAPIEntity) searchTweets(ctx context.Context, ch chan types.IEven
 	log.WithField("item", item).WithField("req", req).WithField("response", response).Info("searchTweets_end")
 
 	// Format tweets into a readable content
-	content := e.formatTweets(response.Tweets, item.MaxResults)
+	content := e.summarize(ctx, e.formatTweets(response.Tweets, item.MaxResults))
 
 	event := NewTwitterAPIEvent(item.Name, item.Description, content)
 	ch <- event
 }
 
+// summarize condenses the formatted tweets with the news_summarization llm
+// route, the tweets are reported as is if summarizing is off or fails
+func (e *TwitterAPIEntity) summarize(ctx context.Context, content string) string {
+	if !e.config.Summarize || e.llm == nil || content == "No tweets found." {
+		return content
+	}
+
+	ctx = task.WithTask(ctx, task.NewsSummarization)
+	summary, err := llms.GenerateFromSinglePrompt(ctx, e.llm, fmt.Sprintf(summarizePrompt, content))
+	if err != nil {
+		log.WithError(err).Warn("summarize tweets error, report raw tweets")
+		return content
+	}
+
+	return strings.TrimSpace(summary)
+}
+
 // formatTweets formats the tweets into a human-readable string
 func (e *TwitterAPIEntity) formatTweets(tweets []twitterapi.Tweet, maxResults int) string {
 	sb := strings.Builder{}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/c9s/bbgo/pkg/bbgo"
@@ -16,12 +18,17 @@ import (
 	"github.com/yubing744/trading-gpt/pkg/chat"
 	"github.com/yubing744/trading-gpt/pkg/chat/feishu"
 	"github.com/yubing744/trading-gpt/pkg/llms"
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/llms/usage"
 	"github.com/yubing744/trading-gpt/pkg/prompt"
 	"github.com/yubing744/trading-gpt/pkg/utils/xtemplate"
 
 	"github.com/yubing744/trading-gpt/pkg/agents"
 	"github.com/yubing744/trading-gpt/pkg/agents/keeper"
 	"github.com/yubing744/trading-gpt/pkg/agents/trading"
+	"github.com/yubing744/trading-gpt/pkg/apis/okx"
+	"github.com/yubing744/trading-gpt/pkg/auth"
 	"github.com/yubing744/trading-gpt/pkg/config"
 	"github.com/yubing744/trading-gpt/pkg/env"
 	"github.com/yubing744/trading-gpt/pkg/env/coze"
@@ -31,8 +38,11 @@ import (
 	"github.com/yubing744/trading-gpt/pkg/memory"
 	"github.com/yubing744/trading-gpt/pkg/utils"
 
+	"github.com/yubing744/trading-gpt/pkg/notify/discord"
 	nfeishu "github.com/yubing744/trading-gpt/pkg/notify/feishu"
 	feishu_hook "github.com/yubing744/trading-gpt/pkg/notify/feishu-hook"
+	"github.com/yubing744/trading-gpt/pkg/notify/slack"
+	"github.com/yubing744/trading-gpt/pkg/notify/webhook"
 	ttypes "github.com/yubing744/trading-gpt/pkg/types"
 )
 
@@ -63,10 +73,12 @@ type Strategy struct {
 	Market      types.Market
 
 	// persistence fields
-	Position *types.Position
+	Position      *types.Position
+	ShortPosition *types.Position // Short leg in futures hedge mode
 
-	session       *bbgo.ExchangeSession
-	orderExecutor *bbgo.GeneralOrderExecutor
+	session            *bbgo.ExchangeSession
+	orderExecutor      *bbgo.GeneralOrderExecutor
+	shortOrderExecutor *bbgo.GeneralOrderExecutor // Order executor of the short leg in futures hedge mode
 
 	// StrategyController
 	bbgo.StrategyController
@@ -84,6 +96,28 @@ type Strategy struct {
 
 	// command system
 	commandMemory *memory.CommandMemory
+	commandMu     sync.Mutex             // Serializes runs of scheduled commands
+	lastPrice     atomic.Value           // fixedpoint.Value of the latest kline update, for price triggers
+	cycleSession  *chat.BroadcastSession // Session of the trading cycles, replies go to the admin sessions
+
+	// episodic memory
+	episodeStore    *memory.EpisodeStore
+	episodeEmbedder memory.Embedder
+
+	// post-trade reflection
+	tradeJournal *memory.TradeJournal
+	reflector    memory.Reflector
+	reflections  chan reflectionJob // Closed trades waiting for their reflection
+
+	// shared knowledge
+	knowledgeBase *memory.KnowledgeBase
+
+	// structured trade event channels
+	eventPublishers []*eventPublisher
+
+	// access control
+	authorizer   *auth.Authorizer
+	chatCommands *chat.CommandRegistry
 }
 
 // ID should return the identity of this strategy
@@ -116,6 +150,11 @@ func (s *Strategy) Subscribe(session *bbgo.ExchangeSession) {
 	for _, interval := range s.SubscribeIntervals {
 		session.Subscribe(types.KLineChannel, s.Symbol, types.SubscribeOptions{Interval: interval})
 	}
+
+	if s.Env.ExchangeConfig != nil && s.Env.ExchangeConfig.TrailingStop.OnTrades {
+		log.Info("subscribe MarketTradeChannel")
+		session.Subscribe(types.MarketTradeChannel, s.Symbol, types.SubscribeOptions{})
+	}
 }
 
 // This strategy simply spent all available quote currency to buy the symbol whenever kline gets closed
@@ -154,6 +193,31 @@ func (s *Strategy) Run(ctx context.Context, orderExecutor bbgo.OrderExecutor, se
 		bbgo.Sync(ctx, s)
 	})
 
+	// The short leg of a hedge mode position has its own position and orders
+	if s.hedgeMode() {
+		if s.ShortPosition == nil {
+			s.ShortPosition = types.NewPositionFromMarket(s.Market)
+		}
+		s.ShortPosition.Strategy = ID
+		s.ShortPosition.StrategyInstanceID = instanceID + "-short"
+
+		if s.session.MakerFeeRate.Sign() > 0 || s.session.TakerFeeRate.Sign() > 0 {
+			s.ShortPosition.SetExchangeFeeRate(s.session.ExchangeName, types.ExchangeFee{
+				MakerFeeRate: s.session.MakerFeeRate,
+				TakerFeeRate: s.session.TakerFeeRate,
+			})
+		}
+
+		s.shortOrderExecutor = bbgo.NewGeneralOrderExecutor(session, s.Symbol, ID, instanceID+"-short", s.ShortPosition)
+		s.shortOrderExecutor.BindEnvironment(s.Environment)
+		s.shortOrderExecutor.Bind()
+
+		s.shortOrderExecutor.TradeCollector().OnPositionUpdate(func(position *types.Position) {
+			log.WithField("position", position).Info("Strategy_OnShortPositionUpdate")
+			bbgo.Sync(ctx, s)
+		})
+	}
+
 	// Setup LLM
 	err := s.setupLLM(ctx)
 	if err != nil {
@@ -184,6 +248,33 @@ func (s *Strategy) Run(ctx context.Context, orderExecutor bbgo.OrderExecutor, se
 		return err
 	}
 
+	// Setup Episodes
+	err = s.setupEpisodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Setup Reflection
+	err = s.setupReflection(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Setup Knowledge
+	err = s.setupKnowledge(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Setup Auth
+	err = s.setupAuth(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Setup Trading Cycle
+	s.setupCycle(ctx)
+
 	// Setup Notify
 	err = s.setupNotify(ctx)
 	if err != nil {
@@ -199,6 +290,18 @@ func (s *Strategy) Run(ctx context.Context, orderExecutor bbgo.OrderExecutor, se
 	return nil
 }
 
+// hedgeMode reports whether long and short legs of the symbol coexist on a futures session
+func (s *Strategy) hedgeMode() bool {
+	cfg := s.Env.ExchangeConfig
+	return cfg != nil && cfg.Futures.Enabled && cfg.Futures.HedgeMode && !cfg.Spot.Enabled
+}
+
+// spotMode reports whether the symbol is traded on a spot-only account, long only without leverage
+func (s *Strategy) spotMode() bool {
+	cfg := s.Env.ExchangeConfig
+	return cfg != nil && cfg.Spot.Enabled
+}
+
 func (s *Strategy) setupLLM(ctx context.Context) error {
 	llm := llms.NewLLMManager(&s.LLM)
 	err := llm.Init()
@@ -210,9 +313,28 @@ func (s *Strategy) setupLLM(ctx context.Context) error {
 	return nil
 }
 
+// okxClient creates the OKX REST client with the credentials of the session,
+// read from its environment variables as bbgo does when not configured
+func (s *Strategy) okxClient() *okx.Client {
+	key, secret, passphrase := s.session.Key, s.session.Secret, s.session.Passphrase
+	if key == "" || secret == "" {
+		prefix := s.session.EnvVarPrefix
+		if prefix == "" {
+			prefix = s.session.ExchangeName.String()
+		}
+
+		prefix = strings.ToUpper(prefix)
+		key = os.Getenv(prefix + "_API_KEY")
+		secret = os.Getenv(prefix + "_API_SECRET")
+		passphrase = os.Getenv(prefix + "_API_PASSPHRASE")
+	}
+
+	return okx.NewClient(okx.DefaultBaseURL, key, secret, passphrase)
+}
+
 func (s *Strategy) setupWorld(ctx context.Context) error {
 	world := env.NewEnvironment(&s.Env)
-	world.RegisterEntity(exchange.NewExchangeEntity(
+	exchangeEntity := exchange.NewExchangeEntity(
 		s.Symbol,
 		s.Interval,
 		s.Leverage,
@@ -220,7 +342,16 @@ func (s *Strategy) setupWorld(ctx context.Context) error {
 		s.session,
 		s.orderExecutor,
 		s.Position,
-	))
+	)
+	if s.shortOrderExecutor != nil {
+		log.Info("futures_hedge_mode_enabled")
+
+		exchangeEntity.SetShortLeg(s.shortOrderExecutor, s.ShortPosition)
+	}
+	if s.session.ExchangeName == types.ExchangeOKEx {
+		exchangeEntity.SetExchangeServices(exchange.NewOKXAdapter(s.okxClient(), s.Market))
+	}
+	world.RegisterEntity(exchangeEntity)
 
 	if s.Env.FNG != nil && s.Env.FNG.Enabled {
 		log.Info("fng_enabled")
@@ -249,7 +380,9 @@ func (s *Strategy) setupWorld(ctx context.Context) error {
 		}
 		s.Env.TwitterAPI.APIKey = twitterAPIKey
 
-		world.RegisterEntity(twitterapi.NewTwitterAPIEntity(s.Env.TwitterAPI))
+		twitterEntity := twitterapi.NewTwitterAPIEntity(s.Env.TwitterAPI)
+		twitterEntity.SetLLM(s.llm)
+		world.RegisterEntity(twitterEntity)
 	}
 
 	err := world.Start(ctx)
@@ -266,6 +399,7 @@ func (s *Strategy) setupAgent(ctx context.Context) error {
 	tradingCfg := &s.Agent.Trading
 	if tradingCfg != nil && tradingCfg.Enabled {
 		tradingAgent := trading.NewTradingAgent(tradingCfg, s.llm)
+		tradingAgent.SetTokenizer(s.llm.Tokenizer())
 		s.agent = tradingAgent
 	}
 
@@ -304,7 +438,32 @@ func (s *Strategy) setupMemory(ctx context.Context) error {
 			s.Memory.MaxWords = 1000
 		}
 
+		if s.Memory.ArchivePath == "" {
+			s.Memory.ArchivePath = "memory-bank/archive"
+		}
+		if s.Memory.MaxArchives == 0 {
+			s.Memory.MaxArchives = 20
+		}
+
 		s.memoryManager = memory.NewMemoryManager(s.Memory.MemoryPath, s.Memory.MaxWords)
+		if s.Memory.HistoryPath == "" {
+			s.Memory.HistoryPath = strings.TrimSuffix(s.Memory.MemoryPath, filepath.Ext(s.Memory.MemoryPath)) + ".history.jsonl"
+		}
+
+		s.memoryManager.SetArchive(s.Memory.ArchivePath, s.Memory.MaxArchives)
+		s.memoryManager.SetHistory(memory.NewMemoryHistory(s.Memory.HistoryPath))
+		s.memoryManager.SetDeleteGuard(s.Memory.DeleteGuardPercent)
+
+		if s.Memory.Structured {
+			sections, err := s.memorySectionSpecs()
+			if err != nil {
+				return err
+			}
+			s.memoryManager.SetSections(sections)
+		}
+		if s.Memory.Compaction == nil || *s.Memory.Compaction {
+			s.memoryManager.SetCompactor(memory.NewLLMCompactor(s.llm))
+		}
 		s.memoryEnabled = true
 
 		// Load existing memory
@@ -333,6 +492,7 @@ func (s *Strategy) setupCommands(ctx context.Context) error {
 		}
 
 		s.commandMemory = memory.NewCommandMemory(s.Commands.CommandPath)
+		s.setupScheduler(ctx)
 		log.Info("Command system enabled")
 	} else {
 		log.Info("Command system disabled")
@@ -371,6 +531,81 @@ func (s *Strategy) setupNotify(ctx context.Context) error {
 		log.Info("init feishu hook notify channel ok!")
 	}
 
+	slackNotifyCfg := s.Notify.Slack
+	if slackNotifyCfg != nil && slackNotifyCfg.Enabled {
+		if os.Getenv("NOTIFY_SLACK_URL") != "" {
+			slackNotifyCfg.URL = os.Getenv("NOTIFY_SLACK_URL")
+		}
+
+		slackNotifyChannel := slack.NewSlackNotifyChannel(slackNotifyCfg)
+		chatSession := chat.NewChatSession(slackNotifyChannel)
+		s.setupAdminSession(ctx, chatSession)
+
+		log.Info("init slack notify channel ok!")
+	}
+
+	discordNotifyCfg := s.Notify.Discord
+	if discordNotifyCfg != nil && discordNotifyCfg.Enabled {
+		if os.Getenv("NOTIFY_DISCORD_URL") != "" {
+			discordNotifyCfg.URL = os.Getenv("NOTIFY_DISCORD_URL")
+		}
+
+		discordNotifyChannel := discord.NewDiscordNotifyChannel(discordNotifyCfg)
+		chatSession := chat.NewChatSession(discordNotifyChannel)
+		s.setupAdminSession(ctx, chatSession)
+
+		log.Info("init discord notify channel ok!")
+	}
+
+	webhookNotifyCfg := s.Notify.Webhook
+	if webhookNotifyCfg != nil && webhookNotifyCfg.Enabled {
+		if os.Getenv("NOTIFY_WEBHOOK_SECRET") != "" {
+			webhookNotifyCfg.Secret = os.Getenv("NOTIFY_WEBHOOK_SECRET")
+		}
+
+		webhookNotifyChannel, err := webhook.NewWebhookNotifyChannel(webhookNotifyCfg, s.InstanceID())
+		if err != nil {
+			return errors.Wrap(err, "init webhook notify channel error")
+		}
+		webhookNotifyChannel.Start(ctx)
+		s.eventPublishers = append(s.eventPublishers, newEventPublisher(ctx, webhookNotifyChannel))
+
+		// Publish order updates of our symbol
+		s.session.UserDataStream.OnOrderUpdate(func(order types.Order) {
+			if order.Symbol != s.Symbol {
+				return
+			}
+
+			s.publishEvent(ctx, ttypes.NotifyEventOrder, order)
+		})
+
+		log.Info("init webhook notify channel ok!")
+	}
+
+	return nil
+}
+
+// publishEvent queues a structured trade event to all event notify channels,
+// each channel delivers its events in order in the background
+func (s *Strategy) publishEvent(ctx context.Context, eventType string, data interface{}) {
+	for _, p := range s.eventPublishers {
+		p.publish(eventType, data)
+	}
+}
+
+func (s *Strategy) setupAuth(ctx context.Context) error {
+	authorizer, err := auth.NewAuthorizer(&s.Auth)
+	if err != nil {
+		return errors.Wrap(err, "init authorizer error")
+	}
+
+	s.authorizer = authorizer
+	s.setupChatCommands(ctx)
+
+	log.WithField("users", len(s.Auth.Users)).
+		WithField("default_role", s.Auth.DefaultRole).
+		Info("init auth ok!")
+
 	return nil
 }
 
@@ -386,7 +621,6 @@ func (s *Strategy) setupChat(ctx context.Context) error {
 
 		chatProvider := feishu.NewFeishuChatProvider(feishuCfg)
 		sessions := chat.NewChatSessions()
-		adminInit := &sync.Once{}
 
 		go func() {
 			err := chatProvider.Listen(func(ch ttypes.IChannel) {
@@ -398,10 +632,6 @@ func (s *Strategy) setupChat(ctx context.Context) error {
 				ch.OnMessage(func(msg *ttypes.Message) {
 					s.handleChatMessage(context.Background(), chatSession, msg)
 				})
-
-				adminInit.Do(func() {
-					s.setupAdminSession(ctx, chatSession)
-				})
 			})
 			if err != nil {
 				log.WithError(err).Error("listen chat error")
@@ -413,14 +643,45 @@ func (s *Strategy) setupChat(ctx context.Context) error {
 	return nil
 }
 
-func (s *Strategy) setupAdminSession(ctx context.Context, chatSession ttypes.ISession) {
-	chatSession.SetRoles([]string{ttypes.RoleAdmin})
+// setupCycle runs a single trading cycle on the events of the environment,
+// actions generated by the cycle run with the strategy's own admin role
+func (s *Strategy) setupCycle(ctx context.Context) {
+	s.cycleSession = chat.NewBroadcastSession("trading_cycle")
+	s.cycleSession.SetRoles([]string{ttypes.RoleAdmin})
 
 	s.world.OnEvent(func(evt ttypes.IEvent) {
-		s.handleEnvEvent(context.Background(), chatSession, evt)
+		s.handleWorldEvent(context.Background(), evt)
 	})
 }
 
+// handleWorldEvent handles an event of the environment once, whatever the
+// sessions subscribed, then updates the trading cycle with it
+func (s *Strategy) handleWorldEvent(ctx context.Context, evt ttypes.IEvent) {
+	posData, closed := evt.GetData().(exchange.PositionClosedEventData)
+	closed = closed && evt.GetType() == exchange.EventPositionClosed
+
+	if closed {
+		s.publishEvent(ctx, ttypes.NotifyEventPositionClosed, posData)
+	}
+
+	s.handleEnvEvent(ctx, s.cycleSession, evt)
+
+	// Post-mortem of the trade for the journal and memory, once per close, in the background
+	if closed {
+		s.reflectOnTrade(ctx, s.cycleSession, posData)
+	}
+
+	// Commands waiting for the event run after the event updated the cycle
+	s.fireEventTriggers(ctx, evt.GetType())
+}
+
+// setupAdminSession subscribes a session to the replies of the trading cycle,
+// it returns false if the session was already subscribed
+func (s *Strategy) setupAdminSession(ctx context.Context, chatSession ttypes.ISession) bool {
+	chatSession.SetRoles([]string{ttypes.RoleAdmin})
+	return s.cycleSession.Subscribe(chatSession)
+}
+
 func (s *Strategy) replyMsg(ctx context.Context, chatSession ttypes.ISession, msg string) {
 	err := chatSession.Reply(ctx, &ttypes.Message{
 		ID:   uuid.NewString(),
@@ -438,10 +699,24 @@ func (s *Strategy) feedbackCmdExecuteResult(ctx context.Context, chatSession tty
 func (s *Strategy) emergencyClosePosition(ctx context.Context, chatSession ttypes.ISession, reason string) {
 	log.Warn("emergency close position")
 
-	err := s.world.SendCommand(ctx, "exchange.close_position", map[string]string{})
-	if err != nil {
-		log.WithError(err).Error("env send cmd error")
-		return
+	// Attribute the closing fill to the emergency close in the position_closed event
+	ctx = context.WithValue(ctx, "closeReason", exchange.CloseReasonEmergency)
+	ctx = context.WithValue(ctx, "closeSource", exchange.CloseSourceEmergency)
+
+	if s.hedgeMode() {
+		// Both legs may be open, close each of them
+		for _, leg := range []exchange.PositionSide{exchange.PositionSideLong, exchange.PositionSideShort} {
+			err := s.world.SendCommand(ctx, EmergencyCloseAction, map[string]string{exchange.ArgLeg: string(leg)})
+			if err != nil {
+				log.WithError(err).WithField("leg", leg).Warn("env send cmd error")
+			}
+		}
+	} else {
+		err := s.world.SendCommand(ctx, EmergencyCloseAction, map[string]string{})
+		if err != nil {
+			log.WithError(err).Error("env send cmd error")
+			return
+		}
 	}
 
 	log.Warn("emergency close position ok")
@@ -451,6 +726,18 @@ func (s *Strategy) emergencyClosePosition(ctx context.Context, chatSession ttype
 func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession, msgs []*ttypes.Message, retryTime int) {
 	s.replyMsg(ctx, chatSession, fmt.Sprintf("The agent start action at %s, and the msgs:", time.Now().Format(time.RFC3339)))
 	for _, msg := range msgs {
+		if msg.Image != nil && s.chartNotifyChat() {
+			err := chatSession.Reply(ctx, &ttypes.Message{
+				ID:    uuid.NewString(),
+				Text:  msg.Text,
+				Image: msg.Image,
+			})
+			if err != nil {
+				log.WithError(err).Error("reply image error")
+			}
+			continue
+		}
+
 		s.replyMsg(ctx, chatSession, msg.Text)
 	}
 
@@ -459,7 +746,12 @@ func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession,
 		log.WithError(err).Error("gen action error")
 		s.replyMsg(ctx, chatSession, fmt.Sprintf("gen action error: %s", err.Error()))
 
-		if chatSession.HasRole(ttypes.RoleAdmin) {
+		// Reaching the spend cap says nothing about the market, keep the position
+		if errors.Is(err, llms.ErrDailyCapExceeded) {
+			return
+		}
+
+		if ttypes.RoleSatisfies(s.principalOf(ctx, chatSession).Role, s.actionRole(EmergencyCloseAction)) {
 			s.emergencyClosePosition(ctx, chatSession, "agent error")
 		}
 
@@ -467,6 +759,7 @@ func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession,
 	}
 
 	actions := make([]*ttypes.Action, 0)
+	var thoughts *ttypes.Thoughts
 
 	if len(resp.Texts) > 0 {
 		resultText := strings.TrimSpace(strings.Join(resp.Texts, ""))
@@ -504,6 +797,18 @@ func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession,
 			if result.Thoughts != nil {
 				s.replyMsg(ctx, chatSession, result.Thoughts.ToHumanText())
 			}
+			thoughts = result.Thoughts
+
+			recordEpisodeDecision(ctx, result)
+
+			s.publishEvent(ctx, ttypes.NotifyEventDecision, &ttypes.DecisionNotifyData{
+				Symbol:       s.Symbol,
+				Model:        resp.Model,
+				Action:       result.Action,
+				Thoughts:     result.Thoughts,
+				NextCommands: result.NextCommands,
+				Timestamp:    time.Now(),
+			})
 
 			if result.Action != nil {
 				s.replyMsg(ctx, chatSession, fmt.Sprintf("Action: %s", result.Action.JSON()))
@@ -514,8 +819,13 @@ func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession,
 			}
 
 			// Process memory output if memory is enabled
-			if s.memoryEnabled && s.memoryManager != nil && result.Memory != nil {
-				s.processMemoryOutput(ctx, chatSession, result.Memory)
+			if s.memoryEnabled && s.memoryManager != nil && !result.Memory.Empty() {
+				s.processMemoryOutput(ctx, chatSession, result.Memory, resp.Model)
+			}
+
+			// Share lessons if the knowledge base is enabled
+			if s.knowledgeBase != nil && len(result.Knowledge) > 0 {
+				s.processKnowledgeOutput(ctx, chatSession, result.Knowledge, resp.Model)
 			}
 
 			// Process next_commands if command system is enabled
@@ -531,52 +841,80 @@ func (s *Strategy) agentAction(ctx context.Context, chatSession ttypes.ISession,
 		s.replyMsg(ctx, chatSession, fmt.Sprintf("Generated by LLM model: %s", resp.Model))
 	}
 
+	if resp.Usage != nil {
+		s.replyMsg(ctx, chatSession, fmt.Sprintf("Token usage: %s", resp.Usage.String()))
+	}
+
 	if len(actions) > 0 {
-		if chatSession.HasRole(ttypes.RoleAdmin) {
-			if len(actions) > 1 {
-				log.Info("skip handle actions for too many actions")
-				return
+		if len(actions) > 1 {
+			log.Info("skip handle actions for too many actions")
+			return
+		}
+
+		for _, action := range actions {
+			actionName := action.Name
+			if !strings.Contains(action.Name, ".") {
+				actionName = "exchange." + actionName
 			}
 
-			for _, action := range actions {
-				actionName := action.Name
-				if !strings.Contains(action.Name, ".") {
-					actionName = "exchange." + actionName
-				}
+			err := s.authorizeAction(ctx, chatSession, actionName, action.Args)
+			if err != nil {
+				s.feedbackCmdExecuteResult(ctx, chatSession, fmt.Sprintf("Command: %s refused, reason: %s", action.JSON(), err.Error()))
+				continue
+			}
 
-				err := s.world.SendCommand(ctx, actionName, action.Args)
-
-				if err != nil {
-					log.WithError(err).Error("env send cmd error")
-					errMsg := fmt.Sprintf("Command: %s failed to execute by entity, reason: %s", action.JSON(), err.Error())
-					s.feedbackCmdExecuteResult(ctx, chatSession, errMsg)
-
-					if retryTime > 0 {
-						time.Sleep(time.Second * 5)
-
-						newMsgs := append(msgs, []*ttypes.Message{
-							{
-								Text: errMsg,
-							},
-							{
-								Text: "Please try to fix the above error by responding with JSON again.",
-							},
-						}...)
-						s.agentAction(ctx, chatSession, newMsgs, retryTime-1)
-					}
-				} else {
-					s.feedbackCmdExecuteResult(ctx, chatSession, fmt.Sprintf("Command: %s executed successfully by entity.", action.JSON()))
+			err = s.world.SendCommand(ctx, actionName, action.Args)
+			if err != nil {
+				log.WithError(err).Error("env send cmd error")
+				errMsg := fmt.Sprintf("Command: %s failed to execute by entity, reason: %s", action.JSON(), err.Error())
+				s.feedbackCmdExecuteResult(ctx, chatSession, errMsg)
+
+				if retryTime > 0 {
+					time.Sleep(time.Second * 5)
+
+					newMsgs := append(msgs, []*ttypes.Message{
+						{
+							Text: errMsg,
+						},
+						{
+							Text: "Please try to fix the above error by responding with JSON again.",
+						},
+					}...)
+					s.agentAction(ctx, chatSession, newMsgs, retryTime-1)
 				}
+			} else {
+				s.feedbackCmdExecuteResult(ctx, chatSession, fmt.Sprintf("Command: %s executed successfully by entity.", action.JSON()))
+				s.recordTradeDecision(ctx, chatSession, action, thoughts, resp.Model)
 			}
-		} else {
-			log.Info("skip handle actions for not have RoleAdmin")
 		}
 	}
 }
 
 func (s *Strategy) handleChatMessage(ctx context.Context, chatSession *chat.ChatSession, msg *ttypes.Message) {
 	log.WithField("msg", msg).Info("new message")
-	s.agentAction(ctx, chatSession, []*ttypes.Message{msg}, MaxRetryTime)
+
+	principal := s.authorizer.Resolve(msg.UserID)
+	ctx = auth.WithPrincipal(ctx, principal)
+
+	// Chats an admin talks in receive the replies of the trading cycle
+	if principal.Role == ttypes.RoleAdmin && s.setupAdminSession(ctx, chatSession) {
+		log.WithField("session", chatSession.GetID()).
+			WithField("user", principal.UserID).
+			Info("subscribe chat session to trading cycles")
+	}
+
+	if name, args, ok := chat.ParseCommand(msg.Text); ok {
+		s.handleSlashCommand(ctx, chatSession, principal, name, args)
+		return
+	}
+
+	err := s.authorizer.Authorize(principal, chatSession.GetID(), ChatAction, ttypes.RoleViewer, nil)
+	if err != nil {
+		s.replyMsg(ctx, chatSession, fmt.Sprintf("Message refused: %s", err.Error()))
+		return
+	}
+
+	s.agentAction(task.WithTask(ctx, task.ChatQA), chatSession, []*ttypes.Message{msg}, MaxRetryTime)
 }
 
 func (s *Strategy) handleEnvEvent(ctx context.Context, session ttypes.ISession, evt ttypes.IEvent) {
@@ -620,6 +958,21 @@ func (s *Strategy) handleEnvEvent(ctx context.Context, session ttypes.ISession,
 		} else {
 			log.WithField("eventType", evt.GetType()).Warn("event data Type not match")
 		}
+	case exchange.EventPositionReconciled:
+		report, ok := evt.GetData().(*exchange.ReconcileReport)
+		if ok {
+			s.handlePositionReconciled(ctx, session, report)
+		} else {
+			log.WithField("eventType", evt.GetType()).Warn("event data Type not match")
+		}
+	case exchange.EventEntryPlanStopsFailed:
+		msg, ok := evt.GetData().(string)
+		if ok {
+			s.replyMsg(ctx, session, msg)
+			s.stashMsg(ctx, session, "⚠️ "+msg)
+		} else {
+			log.WithField("eventType", evt.GetType()).Warn("event data Type not match")
+		}
 	case "update_finish":
 		s.handleUpdateFinish(ctx, session)
 	default:
@@ -633,16 +986,18 @@ func (s *Strategy) handleKlineChanged(ctx context.Context, session ttypes.ISessi
 	msg := fmt.Sprintf("KLine data changed:\n%s", utils.FormatKLineWindow(*klineWindow, s.MaxNum))
 
 	session.SetAttribute("kline", klineWindow)
-	s.stashMsg(ctx, session, msg)
+	s.observeTradePrices(klineWindow)
+	s.stashSectionMsg(ctx, session, ttypes.SectionKlines, msg)
 }
 
 func (s *Strategy) handleExchangeIndicatorChanged(ctx context.Context, session ttypes.ISession, indicator *exchange.ExchangeIndicator) {
 	log.WithField("indicator", indicator).Info("handle indicator changed")
 
+	s.setIndicator(session, indicator)
 	messages := indicator.ToPrompts(s.MaxNum)
 
 	for _, msg := range messages {
-		s.stashMsg(ctx, session, msg)
+		s.stashSectionMsg(ctx, session, ttypes.SectionIndicators, msg)
 	}
 }
 
@@ -650,8 +1005,9 @@ func (s *Strategy) handleDefaultEvent(ctx context.Context, session ttypes.ISessi
 	messages := evt.ToPrompts()
 	log.WithField("event", evt.GetType()).WithField("messages", messages).Info("handle_default_event")
 
+	// Other entities (twitter, coze, fng history) provide news and sentiment
 	for _, msg := range messages {
-		s.stashMsg(ctx, session, msg)
+		s.stashSectionMsg(ctx, session, ttypes.SectionNews, msg)
 	}
 }
 
@@ -668,6 +1024,13 @@ func (s *Strategy) handleFngChanged(ctx context.Context, session ttypes.ISession
 	session.SetAttribute("fng_msg", &ttypes.Message{
 		Text: msg,
 	})
+
+	value, err := parseFng(*fng)
+	if err != nil {
+		log.WithError(err).Warn("parse fng error")
+	} else {
+		session.SetAttribute("fng", value)
+	}
 }
 
 func (s *Strategy) handlePositionChanged(_ctx context.Context, session ttypes.ISession, position *exchange.PositionX) {
@@ -678,39 +1041,52 @@ func (s *Strategy) handlePositionChanged(_ctx context.Context, session ttypes.IS
 	remainingPercent := position.RemainingFundsRatio.Float64() * 100
 	positionPercent := position.PositionFundsRatio.Float64() * 100
 
+	session.RemoveAttribute("position")
+
 	kline, ok := s.getKline(session)
 	if ok {
-		if position.IsOpened(kline.GetClose()) {
-			side := "short"
-			if position.IsLong() {
-				side = "long"
+		if position.ShortLeg == nil {
+			if position.IsOpened(kline.GetClose()) {
+				session.SetAttribute("position", position)
+				s.trackOpenPosition(position)
+				s.enterEpisodeTrade(position)
+
+				msg = s.describePosition(position, "position")
 			}
+		} else {
+			// Hedge mode, the legs are reported separately
+			legs := make([]string, 0, 2)
+			for _, leg := range []*exchange.PositionX{position, position.ShortLeg} {
+				name := leg.Leg + " leg"
+				if !leg.IsOpened(kline.GetClose()) {
+					legs = append(legs, fmt.Sprintf("The %s is flat.", name))
+					continue
+				}
 
-			msg = fmt.Sprintf("The current position is %s with %dx leverage, average cost: %.3f, and accumulated profit: %.3f%% (%.3f %s).",
-				side,
-				s.Leverage.Int(),
-				position.AverageCost.Float64(),
-				position.AccumulatedProfit.Float64(),
-				position.AccumulatedProfitValue.Float64(),
-				position.Market.QuoteCurrency)
+				if _, set := session.GetAttribute("position"); !set {
+					session.SetAttribute("position", leg)
+					s.trackOpenPosition(leg)
+					s.enterEpisodeTrade(leg)
+				}
 
-			if position.TpTriggerPx != nil {
-				msg += fmt.Sprintf("\nThe current position's take-profit trigger price is %s.", position.Market.FormatPrice(*position.TpTriggerPx))
+				legs = append(legs, s.describePosition(leg, name))
 			}
 
-			if position.SlTriggerPx != nil {
-				msg += fmt.Sprintf("\nThe current position's stop-loss trigger price is %s.", position.Market.FormatPrice(*position.SlTriggerPx))
+			msg = "The position is in hedge mode, each leg is addressed with the leg argument.\n" + strings.Join(legs, "\n")
+		}
+
+		for _, leg := range []*exchange.PositionX{position, position.ShortLeg} {
+			if leg == nil {
+				continue
 			}
 
-			profits := position.GetProfitValues()
-			if len(profits) > s.MaxNum {
-				profits = profits[len(profits)-s.MaxNum:]
+			if leg.EntryPlan != nil {
+				msg += fmt.Sprintf("\nThe pending entry plan: %s.", leg.EntryPlan.String())
 			}
 
-			msg = msg + fmt.Sprintf("\nThe profits of the recent %d periods: [%s], and the holding period: %d.",
-				s.MaxNum,
-				utils.JoinFloatSlicePercentage([]float64(profits), " "),
-				position.GetHoldingPeriod())
+			for _, execution := range leg.Executions {
+				msg += fmt.Sprintf("\nOrder execution: %s.", execution.String())
+			}
 		}
 
 		msg = msg + fmt.Sprintf("\nAvailable quote capital: %.2f%% of total equity; current position exposure: %.2f%%.",
@@ -723,6 +1099,60 @@ func (s *Strategy) handlePositionChanged(_ctx context.Context, session ttypes.IS
 	}
 }
 
+// describePosition renders an open position, or a leg of a hedge mode position, for the prompt
+func (s *Strategy) describePosition(position *exchange.PositionX, name string) string {
+	side := "short"
+	if position.IsLong() {
+		side = "long"
+	}
+
+	leverage := fmt.Sprintf(" with %dx leverage", s.Leverage.Int())
+	if s.spotMode() {
+		leverage = ""
+	}
+
+	msg := fmt.Sprintf("The current %s is %s%s, average cost: %.3f, and accumulated profit: %.3f%% (%.3f %s).",
+		name,
+		side,
+		leverage,
+		position.AverageCost.Float64(),
+		position.AccumulatedProfit.Float64(),
+		position.AccumulatedProfitValue.Float64(),
+		position.Market.QuoteCurrency)
+
+	if position.TpTriggerPx != nil {
+		msg += fmt.Sprintf("\nThe current %s's take-profit trigger price is %s.", name, position.Market.FormatPrice(*position.TpTriggerPx))
+	}
+
+	if position.SlTriggerPx != nil {
+		msg += fmt.Sprintf("\nThe current %s's stop-loss trigger price is %s.", name, position.Market.FormatPrice(*position.SlTriggerPx))
+	}
+
+	if position.TrailingStop != nil {
+		msg += fmt.Sprintf("\nThe current %s's trailing stop: %s.", name, position.TrailingStop.String())
+	}
+
+	if position.TakeProfitLadder != nil {
+		msg += fmt.Sprintf("\nThe current %s's take-profit ladder: %s.", name, position.TakeProfitLadder.String())
+	}
+
+	if position.Realized != nil {
+		msg += fmt.Sprintf("\nThe current %s's realized partial exits: %s %s.", name, position.Realized.String(), position.Market.QuoteCurrency)
+	}
+
+	profits := position.GetProfitValues()
+	if len(profits) > s.MaxNum {
+		profits = profits[len(profits)-s.MaxNum:]
+	}
+
+	msg = msg + fmt.Sprintf("\nThe profits of the recent %d periods: [%s], and the holding period: %d.",
+		s.MaxNum,
+		utils.JoinFloatSlicePercentage([]float64(profits), " "),
+		position.GetHoldingPeriod())
+
+	return msg
+}
+
 func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISession) {
 	// Execute pending commands from previous cycle before collecting new data
 	if s.commandMemory != nil {
@@ -732,6 +1162,13 @@ func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISessi
 	tempMsgs, ok := s.popMsgs(ctx, session)
 	log.WithField("tempMsgs", tempMsgs).Info("session tmp msgs")
 
+	tracker := s.llm.Usage()
+	if ok && tracker.OverCap() && tracker.OverCapAction() == usage.OverCapSkip {
+		s.replyMsg(ctx, session, fmt.Sprintf("Daily LLM spend cap reached ($%.4f of $%.2f), skip this cycle",
+			tracker.TodayCost(), tracker.DailyCap()))
+		ok = false
+	}
+
 	if ok {
 		// fng
 		fngMsg, ok := session.GetAttribute("fng_msg")
@@ -745,6 +1182,22 @@ func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISessi
 			tempMsgs = append(tempMsgs, posMsg)
 		}
 
+		// outcomes of the scheduled commands paired with their output
+		if s.commandMemory != nil {
+			tempMsgs = append(tempMsgs, s.commandResultMsgs()...)
+		}
+
+		// similar past market situations
+		episode := s.newEpisode(ctx, session)
+		if episode != nil {
+			tempMsgs = append(tempMsgs, s.similarEpisodeMsgs(episode)...)
+		}
+
+		// lessons shared by all instances
+		if knowledgeMsg, ok := s.knowledgeMsg(); ok {
+			tempMsgs = append(tempMsgs, knowledgeMsg)
+		}
+
 		actionTips := make([]string, 0)
 		for _, ac := range s.world.Actions() {
 			actionTips = append(actionTips, ac.String())
@@ -755,6 +1208,8 @@ func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISessi
 			"ActionTips":              actionTips,
 			"Strategy":                s.Strategy,
 			"StrategyAttentionPoints": s.StrategyAttentionPoints,
+			"KnowledgeEnabled":        s.knowledgeBase != nil,
+			"SpotMode":                s.spotMode(),
 		}
 
 		// Add memory data if memory is enabled
@@ -770,7 +1225,20 @@ func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISessi
 				templateData["CurrentWords"] = 0
 				templateData["MemoryUsagePercent"] = 0
 			} else {
-				templateData["Memory"] = memory
+				// Memory is part of the prompt, so its section budget is applied here
+				memoryBudget := s.Agent.Trading.ContextBudget.Memory
+				if sections := s.memoryManager.Sections(); len(sections) > 0 {
+					promptMemory, promptSections := s.memorySectionsData(memory, sections, memoryBudget)
+					templateData["Memory"] = promptMemory
+					templateData["MemorySections"] = promptSections
+				} else {
+					promptMemory := memory
+					if memoryBudget > 0 {
+						promptMemory = tokenizer.KeepHead(s.llm.Tokenizer(), memory, memoryBudget)
+					}
+					templateData["Memory"] = promptMemory
+				}
+
 				// Calculate memory usage
 				currentWords := len(strings.Fields(memory))
 				usagePercent := 0
@@ -784,27 +1252,76 @@ func (s *Strategy) handleUpdateFinish(ctx context.Context, session ttypes.ISessi
 			templateData["MemoryEnabled"] = false
 		}
 
-		prompt, err := xtemplate.Render(prompt.ThoughtTpl, templateData)
+		instructions, err := xtemplate.Render(prompt.InstructionsTpl, templateData)
+		if err != nil {
+			s.replyMsg(ctx, session, fmt.Sprintf("Render prompt error: %s", err.Error()))
+			return
+		}
+
+		thought, err := xtemplate.Render(prompt.ThoughtTpl, templateData)
 		if err != nil {
 			s.replyMsg(ctx, session, fmt.Sprintf("Render prompt error: %s", err.Error()))
 			return
 		}
 
+		tempMsgs = append([]*ttypes.Message{{
+			Text:    instructions,
+			Section: ttypes.SectionInstructions,
+		}}, tempMsgs...)
+
+		if s.Chart.Enabled {
+			chartMsg, err := s.chartMsg(session)
+			if err != nil {
+				log.WithError(err).Warn("render chart error")
+			} else {
+				tempMsgs = append(tempMsgs, chartMsg)
+			}
+		}
+
 		tempMsgs = append(tempMsgs, &ttypes.Message{
-			Text: prompt,
+			Text: thought,
 		})
 
-		s.agentAction(ctx, session, tempMsgs, MaxRetryTime)
+		cycleID := uuid.NewString()
+		cycleCtx, cycle := usage.WithCycle(task.WithTask(withCycleID(ctx, cycleID), task.Decision))
+		if episode != nil {
+			episode.ID = cycleID
+			cycleCtx = withEpisode(cycleCtx, episode)
+		}
+
+		s.agentAction(cycleCtx, session, tempMsgs, MaxRetryTime)
+		s.replyMsg(ctx, session, s.cycleUsageMsg(cycle))
+
+		if episode != nil {
+			s.saveEpisode(episode)
+		}
 	}
 
 	session.RemoveAttribute("tempMsgs")
 }
 
+func (s *Strategy) cycleUsageMsg(cycle *usage.CycleUsage) string {
+	tracker := s.llm.Usage()
+
+	msg := fmt.Sprintf("Cycle LLM usage: %s; today $%.4f", cycle.String(), tracker.TodayCost())
+	if tracker.DailyCap() > 0 {
+		msg += fmt.Sprintf(" of $%.2f cap", tracker.DailyCap())
+	}
+
+	return msg
+}
+
 func (s *Strategy) stashMsg(ctx context.Context, session ttypes.ISession, msg string) {
+	s.stashSectionMsg(ctx, session, "", msg)
+}
+
+// stashSectionMsg stashes a message of a prompt section, see types.Section*
+func (s *Strategy) stashSectionMsg(ctx context.Context, session ttypes.ISession, section string, msg string) {
 	tempMsgsRef, _ := session.GetAttribute("tempMsgs")
 	tempMsgs, _ := tempMsgsRef.([]*ttypes.Message)
 	tempMsgs = append(tempMsgs, &ttypes.Message{
-		Text: msg,
+		Text:    msg,
+		Section: section,
 	})
 
 	log.WithField("tempMsgs", tempMsgs).Info("session tmp msgs")
@@ -856,7 +1373,8 @@ func (s *Strategy) handlePositionClosed(ctx context.Context, session ttypes.ISes
 		"Exit Price: %.2f\n"+
 		"Quantity: %.6f\n"+
 		"%s: %.2f (%.2f%%)\n"+
-		"Close Reason: %s\n"+
+		"Fees: %.2f, Funding: %.2f\n"+
+		"Close Reason: %s (%s)\n"+
 		"Close Time: %s",
 		posData.Symbol,
 		posData.StrategyID,
@@ -867,7 +1385,10 @@ func (s *Strategy) handlePositionClosed(ctx context.Context, session ttypes.ISes
 		pnlStr,
 		posData.ProfitAndLoss,
 		posData.ProfitAndLossPercent,
+		posData.Fees,
+		posData.Funding,
 		posData.CloseReason,
+		posData.CloseSource,
 		posData.Timestamp.Format(time.RFC3339))
 
 	// Use Strategy's own reply mechanism for notification
@@ -876,20 +1397,64 @@ func (s *Strategy) handlePositionClosed(ctx context.Context, session ttypes.ISes
 	// Store this in session for later use
 	session.SetAttribute("last_closed_position", posData)
 
+	// The closed position is the outcome of the episodes that traded it
+	s.resolveEpisodes(posData)
+
 	// Add a message to the chat
 	s.stashMsg(ctx, session, fmt.Sprintf("📊 Position closed for %s with %s: %.2f (%.2f%%)",
 		posData.Symbol, pnlStr, posData.ProfitAndLoss, posData.ProfitAndLossPercent))
 }
 
+// handlePositionReconciled tells the users and the model about the exchange
+// state that changed outside of the strategy
+func (s *Strategy) handlePositionReconciled(ctx context.Context, session ttypes.ISession, report *exchange.ReconcileReport) {
+	log.WithField("report", report).Info("Handling position reconciled event")
+
+	for _, msg := range report.ToPrompts() {
+		s.replyMsg(ctx, session, msg)
+		s.stashMsg(ctx, session, "⚠️ "+msg)
+	}
+}
+
 // processMemoryOutput processes memory output from AI and saves it
-func (s *Strategy) processMemoryOutput(ctx context.Context, chatSession ttypes.ISession, memory *ttypes.Memory) {
-	if memory == nil || memory.Content == "" {
+func (s *Strategy) processMemoryOutput(ctx context.Context, chatSession ttypes.ISession, output *ttypes.Memory, model string) {
+	if output.Empty() {
 		return
 	}
 
-	// AI outputs complete memory content, so we replace the entire memory
-	// Save memory and get truncation information
-	savedMemory, wasTruncated, err := s.memoryManager.SaveMemory(memory.Content)
+	ctx = memory.WithWriteInfo(ctx, memory.WriteInfo{
+		CycleID: cycleIDFromContext(ctx),
+		Model:   model,
+		Source:  memory.SourceAgent,
+	})
+
+	// AI outputs either complete memory content, which replaces the entire
+	// memory, or updates of structured memory sections
+	var savedMemory string
+	var compaction *memory.Compaction
+	var err error
+	if len(output.Sections) > 0 && len(s.memoryManager.Sections()) > 0 {
+		var notes []string
+		savedMemory, compaction, notes, err = s.memoryManager.UpdateSections(ctx, output.Sections)
+		for _, note := range notes {
+			s.stashMsg(ctx, chatSession, fmt.Sprintf("Memory update note: %s", note))
+		}
+	} else {
+		savedMemory, compaction, err = s.memoryManager.SaveMemoryContext(ctx, output.Content)
+	}
+	var guardErr *memory.GuardError
+	if errors.As(err, &guardErr) {
+		if guardErr.Dropped {
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("🛡️ Memory write rejected: %s. Apply or review the waiting write with /memory_confirm and /memory_history.\nDropped memory update: %s",
+				guardErr.Error(), output.ToHumanText()))
+		} else {
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("🛡️ Memory write rejected: %s. An admin can apply it with /memory_confirm.\nRejected memory update: %s",
+				guardErr.Error(), output.ToHumanText()))
+		}
+		s.stashMsg(ctx, chatSession, fmt.Sprintf("Your last memory update was rejected because it deleted %.0f%% of the existing memory. "+
+			"Keep the existing insights and only add, merge or refine them.", guardErr.DeletedPercent))
+		return
+	}
 	if err != nil {
 		log.WithError(err).Error("Failed to save memory")
 		s.replyMsg(ctx, chatSession, fmt.Sprintf("Memory save failed: %s", err.Error()))
@@ -899,18 +1464,27 @@ func (s *Strategy) processMemoryOutput(ctx context.Context, chatSession ttypes.I
 	// Update current memory
 	s.currentMemory = savedMemory
 
-	// Provide different feedback based on whether content was truncated
-	if wasTruncated {
-		// Truncated case: provide warning and word limit information
-		wordCount := len(strings.Fields(memory.Content))
+	// Provide different feedback based on whether content was compacted
+	if compaction != nil {
+		// Compacted case: provide warning and word limit information
 		limitInfo := s.memoryManager.GetWordLimitInfo()
 
-		warningMsg := fmt.Sprintf("⚠️ Memory saved but truncated!\n"+
-			"Current memory word count: %d words\n"+
-			"%s\n"+
-			"Please keep memory content concise in future outputs.\n"+
-			"Memory content: %s",
-			wordCount, limitInfo, memory.Content)
+		how := "consolidated by LLM"
+		if compaction.Method == memory.CompactionTruncate {
+			how = "truncated section by section"
+			if compaction.Err != nil {
+				how += fmt.Sprintf(" (LLM compaction failed: %s)", compaction.Err.Error())
+			}
+		}
+
+		warningMsg := fmt.Sprintf("⚠️ Memory over the limit, %s: %d -> %d words\n"+
+			"%s\n",
+			how, compaction.OriginalWords, compaction.Words, limitInfo)
+		if compaction.ArchivePath != "" {
+			warningMsg += fmt.Sprintf("Pre-compaction memory archived to: %s\n", compaction.ArchivePath)
+		}
+		warningMsg += fmt.Sprintf("Please keep memory content concise in future outputs.\n"+
+			"Memory content: %s", savedMemory)
 
 		s.replyMsg(ctx, chatSession, warningMsg)
 
@@ -919,25 +1493,48 @@ func (s *Strategy) processMemoryOutput(ctx context.Context, chatSession ttypes.I
 
 	} else {
 		// Normal save case
-		s.replyMsg(ctx, chatSession, fmt.Sprintf("💾 Memory saved: %s", memory.Content))
+		s.replyMsg(ctx, chatSession, fmt.Sprintf("💾 Memory saved: %s", output.ToHumanText()))
 	}
 }
 
-// executeNextCycleCommands executes pending commands from previous cycle
+// executeNextCycleCommands executes pending commands from previous cycle,
+// commands with a cycles trigger count the cycle and run once it is due
 func (s *Strategy) executeNextCycleCommands(ctx context.Context, session ttypes.ISession) {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+
 	commands, err := s.commandMemory.LoadPendingCommands()
 	if err != nil {
 		log.WithError(err).Warn("Failed to load pending commands")
 		return
 	}
 
-	if len(commands) == 0 {
-		return
+	now := time.Now()
+	due := make([]*memory.PendingCommand, 0)
+	changed := make([]*memory.PendingCommand, 0)
+	for _, cmd := range commands {
+		if cmd.Trigger == nil {
+			due = append(due, cmd)
+			continue
+		}
+
+		if cmd.Trigger.Type != memory.TriggerCycles {
+			continue
+		}
+
+		changed = append(changed, cmd)
+		if cmd.Trigger.Expired(now) {
+			s.expireCommand(ctx, cmd)
+		} else if cmd.Trigger.CountCycle() {
+			due = append(due, cmd)
+		}
 	}
 
-	s.replyMsg(ctx, session, fmt.Sprintf("📋 Executing %d pending commands from previous cycle...", len(commands)))
+	if len(due) > 0 {
+		s.replyMsg(ctx, session, fmt.Sprintf("📋 Executing %d pending commands from previous cycle...", len(due)))
+	}
 
-	for _, cmd := range commands {
+	for _, cmd := range due {
 		// Check for context cancellation between iterations
 		select {
 		case <-ctx.Done():
@@ -950,29 +1547,18 @@ func (s *Strategy) executeNextCycleCommands(ctx context.Context, session ttypes.
 			continue
 		}
 
-		// Execute command with timeout
-		err := s.executeCommand(ctx, session, cmd)
-		if err != nil {
-			log.WithError(err).WithField("command", cmd).Error("Command execution failed")
-			cmd.Status = "failed"
-			cmd.Error = err.Error()
-			cmd.RetryCount++
-
-			if cmd.RetryCount >= cmd.MaxRetries {
-				s.replyMsg(ctx, session, fmt.Sprintf("❌ Command failed permanently: %s.%s - %s", cmd.EntityID, cmd.CommandName, err.Error()))
-			} else {
-				s.replyMsg(ctx, session, fmt.Sprintf("⚠️ Command failed (retry %d/%d): %s.%s", cmd.RetryCount, cmd.MaxRetries, cmd.EntityID, cmd.CommandName))
-			}
-		} else {
-			cmd.Status = "completed"
-			s.replyMsg(ctx, session, fmt.Sprintf("✅ Command executed successfully: %s.%s", cmd.EntityID, cmd.CommandName))
+		s.runPendingCommand(ctx, session, cmd)
+		if cmd.Trigger == nil {
+			changed = append(changed, cmd)
 		}
+	}
 
-		cmd.UpdatedAt = time.Now()
+	if len(changed) == 0 {
+		return
 	}
 
 	// Save updated command statuses
-	if err := s.commandMemory.SaveCommands(commands); err != nil {
+	if err := s.commandMemory.SaveCommands(changed); err != nil {
 		log.WithError(err).Error("Failed to save command statuses")
 	}
 
@@ -982,22 +1568,59 @@ func (s *Strategy) executeNextCycleCommands(ctx context.Context, session ttypes.
 	}
 }
 
-// executeCommand executes a single command with timeout
-func (s *Strategy) executeCommand(ctx context.Context, session ttypes.ISession, cmd *memory.PendingCommand) error {
+// runPendingCommand executes a pending command, keeps its output and updates
+// its status, the outcome is reported to the session
+func (s *Strategy) runPendingCommand(ctx context.Context, session ttypes.ISession, cmd *memory.PendingCommand) {
+	reply := func(ctx context.Context, msg string) {
+		s.replyMsg(ctx, session, msg)
+	}
+
+	// Execute command with timeout
+	events, err := s.executeCommand(ctx, cmd)
+	cmd.Output = s.commandOutputText(events)
+	s.applyCommandOutput(ctx, session, events)
+
+	if err != nil {
+		log.WithError(err).WithField("command", cmd).Error("Command execution failed")
+		cmd.Status = "failed"
+		cmd.Error = err.Error()
+		cmd.RetryCount++
+
+		if cmd.RetryCount >= cmd.MaxRetries {
+			reply(ctx, fmt.Sprintf("❌ Command failed permanently: %s.%s - %s", cmd.EntityID, cmd.CommandName, err.Error()))
+		} else {
+			reply(ctx, fmt.Sprintf("⚠️ Command failed (retry %d/%d): %s.%s", cmd.RetryCount, cmd.MaxRetries, cmd.EntityID, cmd.CommandName))
+		}
+	} else {
+		cmd.Status = "completed"
+		reply(ctx, fmt.Sprintf("✅ Command executed successfully: %s.%s", cmd.EntityID, cmd.CommandName))
+	}
+
+	cmd.UpdatedAt = time.Now()
+}
+
+// executeCommand executes a single command with timeout, it returns the events
+// the command emitted as its output
+func (s *Strategy) executeCommand(ctx context.Context, cmd *memory.PendingCommand) ([]ttypes.IEvent, error) {
 	// Set 30-second timeout for command execution
 	cmdCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	// Collect the output instead of emitting it, the environment is busy with this cycle
+	cmdCtx, output := ttypes.WithCommandOutput(cmdCtx, cmd.ID)
+
 	// Build full command name
 	fullCommandName := cmd.EntityID + "." + cmd.CommandName
 
 	// Execute via world.SendCommand
-	return s.world.SendCommand(cmdCtx, fullCommandName, cmd.Args)
+	err := s.world.SendCommand(cmdCtx, fullCommandName, cmd.Args)
+	return output.Events(), err
 }
 
 const MaxCommandsPerCycle = 10
 
-// processNextCommands processes next_commands from AI output and saves them for next cycle
+// processNextCommands processes next_commands from AI output and saves them for the
+// next cycle or, with a trigger, for the scheduler
 func (s *Strategy) processNextCommands(ctx context.Context, session ttypes.ISession, nextCommands []*ttypes.NextCommand) {
 	if len(nextCommands) == 0 {
 		return
@@ -1010,7 +1633,7 @@ func (s *Strategy) processNextCommands(ctx context.Context, session ttypes.ISess
 		nextCommands = nextCommands[:MaxCommandsPerCycle]
 	}
 
-	s.replyMsg(ctx, session, fmt.Sprintf("📝 Scheduling %d commands for next cycle...", len(nextCommands)))
+	s.replyMsg(ctx, session, fmt.Sprintf("📝 Scheduling %d commands...", len(nextCommands)))
 
 	pendingCommands := make([]*memory.PendingCommand, 0)
 
@@ -1030,17 +1653,21 @@ func (s *Strategy) processNextCommands(ctx context.Context, session ttypes.ISess
 			continue
 		}
 
-		// Create pending command
-		cmd := &memory.PendingCommand{
-			ID:          uuid.NewString(),
-			EntityID:    nc.EntityID,
-			CommandName: nc.CommandName,
-			Args:        nc.Args,
-			Status:      "pending",
-			RetryCount:  0,
-			MaxRetries:  1, // Default retry once
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+		// Scheduled commands run with the strategy's role, so check the requester now
+		if err := s.authorizeAction(ctx, session, nc.EntityID+"."+nc.CommandName, nc.Args); err != nil {
+			s.replyMsg(ctx, session, fmt.Sprintf("⚠️ Skipping command: %s", err.Error()))
+			continue
+		}
+
+		// Create pending command, a triggered one waits for its condition
+		cmd, err := s.newPendingCommand(nc)
+		if err != nil {
+			s.replyMsg(ctx, session, fmt.Sprintf("⚠️ Skipping command %s.%s: %s", nc.EntityID, nc.CommandName, err.Error()))
+			s.stashMsg(ctx, session, fmt.Sprintf("Scheduled command %s.%s was rejected: %s", nc.EntityID, nc.CommandName, err.Error()))
+			continue
+		}
+		if cmd.Trigger != nil {
+			s.replyMsg(ctx, session, fmt.Sprintf("⏳ %s.%s waits for trigger: %s", nc.EntityID, nc.CommandName, cmd.Trigger.String()))
 		}
 
 		pendingCommands = append(pendingCommands, cmd)
@@ -1048,12 +1675,14 @@ func (s *Strategy) processNextCommands(ctx context.Context, session ttypes.ISess
 
 	// Save commands to file
 	if len(pendingCommands) > 0 {
+		s.commandMu.Lock()
 		err := s.commandMemory.SaveCommands(pendingCommands)
+		s.commandMu.Unlock()
 		if err != nil {
 			log.WithError(err).Error("Failed to save next commands")
-			s.replyMsg(ctx, session, "⚠️ Failed to save commands for next cycle")
+			s.replyMsg(ctx, session, "⚠️ Failed to save scheduled commands")
 		} else {
-			s.replyMsg(ctx, session, fmt.Sprintf("💾 Saved %d commands for next cycle", len(pendingCommands)))
+			s.replyMsg(ctx, session, fmt.Sprintf("💾 Saved %d scheduled commands", len(pendingCommands)))
 		}
 	}
 }
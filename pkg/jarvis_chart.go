@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/yubing744/trading-gpt/pkg/chart"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/env/exchange"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+const (
+	DefaultChartPivotSpan = 3
+	DefaultChartMaxLevels = 2
+)
+
+// chartCaption introduces the chart to the model, the image comes before it
+const chartCaption = "Candlestick chart of the klines above, with the configured indicators, " +
+	"support/resistance levels (S/R) and the current position's entry, stop-loss (SL) and take-profit (TP) lines."
+
+// chartNotifyChat reports whether charts are posted to the chat channels
+func (s *Strategy) chartNotifyChat() bool {
+	return s.Chart.NotifyChat == nil || *s.Chart.NotifyChat
+}
+
+// getIndicators returns the latest indicators reported in this session by name
+func (s *Strategy) getIndicators(session ttypes.ISession) map[string]*exchange.ExchangeIndicator {
+	indicators, ok := session.GetAttribute("indicators")
+	if ok {
+		return indicators.(map[string]*exchange.ExchangeIndicator)
+	}
+
+	return map[string]*exchange.ExchangeIndicator{}
+}
+
+func (s *Strategy) setIndicator(session ttypes.ISession, indicator *exchange.ExchangeIndicator) {
+	indicators := make(map[string]*exchange.ExchangeIndicator)
+	for name, ei := range s.getIndicators(session) {
+		indicators[name] = ei
+	}
+	indicators[indicator.Name] = indicator
+
+	session.SetAttribute("indicators", indicators)
+}
+
+// chartMsg renders the klines of the session as a candlestick chart message
+func (s *Strategy) chartMsg(session ttypes.ISession) (*ttypes.Message, error) {
+	window, ok := s.getKline(session)
+	if !ok || len(*window) == 0 {
+		return nil, fmt.Errorf("no klines to chart")
+	}
+
+	candles := make([]chart.Candle, 0, len(*window))
+	for _, kline := range *window {
+		candles = append(candles, chart.Candle{
+			Open:   kline.Open.Float64(),
+			High:   kline.High.Float64(),
+			Low:    kline.Low.Float64(),
+			Close:  kline.Close.Float64(),
+			Volume: kline.Volume.Float64(),
+		})
+	}
+
+	c := chart.NewChart(fmt.Sprintf("%s %s", s.Symbol, window.GetInterval()), candles)
+	if s.Chart.Width > 0 {
+		c.Width = s.Chart.Width
+	}
+	if s.Chart.Height > 0 {
+		c.Height = s.Chart.Height
+	}
+
+	s.addChartIndicators(c, s.getIndicators(session), window.GetInterval())
+	s.addChartLevels(c, session, candles)
+
+	data, err := c.PNG()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ttypes.Message{
+		Text: chartCaption,
+		Image: &ttypes.Image{
+			Name:     fmt.Sprintf("%s-%s.png", s.Symbol, window.GetInterval()),
+			MIMEType: "image/png",
+			Data:     data,
+		},
+	}, nil
+}
+
+// addChartIndicators draws the indicators computed on the chart interval,
+// moving averages and BOLL on the candles and VR in the subpanel
+func (s *Strategy) addChartIndicators(c *chart.Chart, indicators map[string]*exchange.ExchangeIndicator, interval types.Interval) {
+	names := make([]string, 0, len(indicators))
+	for name := range indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selected := make(map[string]bool, len(s.Chart.Indicators))
+	for _, name := range s.Chart.Indicators {
+		selected[name] = true
+	}
+
+	for _, name := range names {
+		ei := indicators[name]
+		if (len(selected) > 0 && !selected[name]) || ei.Interval() != interval {
+			continue
+		}
+
+		switch ei.Type {
+		case config.IndicatorTypeBOLL:
+			up, mid, down, ok := ei.Bands()
+			if ok {
+				col := chart.Palette[len(c.Overlays)%len(chart.Palette)]
+				c.AddOverlay(name+" up", up, col)
+				c.AddOverlay(name, mid, col)
+				c.AddOverlay(name+" down", down, col)
+			}
+		case config.IndicatorTypeSMA, config.IndicatorTypeEWMA, config.IndicatorTypeVWMA:
+			values, ok := ei.Values()
+			if ok {
+				c.AddOverlay(name, values, chart.Palette[len(c.Overlays)%len(chart.Palette)])
+			}
+		case config.IndicatorTypeVR:
+			values, ok := ei.Values()
+			if ok {
+				c.AddSubpanel(name, values, chart.Palette[(len(c.Overlays)+len(c.Subpanel))%len(chart.Palette)])
+			}
+		}
+	}
+}
+
+// addChartLevels draws the nearest support/resistance levels and the lines of the open position
+func (s *Strategy) addChartLevels(c *chart.Chart, session ttypes.ISession, candles []chart.Candle) {
+	pivotSpan := s.Chart.PivotSpan
+	if pivotSpan <= 0 {
+		pivotSpan = DefaultChartPivotSpan
+	}
+
+	maxLevels := s.Chart.MaxLevels
+	if maxLevels == 0 {
+		maxLevels = DefaultChartMaxLevels
+	}
+
+	if maxLevels > 0 {
+		supports, resistances := chart.SupportResistance(candles, pivotSpan, maxLevels)
+		for _, level := range supports {
+			c.AddLevel("S", level, chart.ColorSupport, true)
+		}
+		for _, level := range resistances {
+			c.AddLevel("R", level, chart.ColorResistance, true)
+		}
+	}
+
+	positionRef, ok := session.GetAttribute("position")
+	if !ok {
+		return
+	}
+
+	position := positionRef.(*exchange.PositionX)
+	c.AddLevel("Entry", position.AverageCost.Float64(), chart.ColorEntry, false)
+
+	if position.SlTriggerPx != nil {
+		c.AddLevel("SL", position.SlTriggerPx.Float64(), chart.ColorStopLoss, false)
+	}
+
+	if position.TpTriggerPx != nil {
+		c.AddLevel("TP", position.TpTriggerPx.Float64(), chart.ColorTakeProfit, false)
+	}
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yubing744/trading-gpt/pkg/env/exchange"
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// commandOutputText formats the events a command emitted for the prompt
+func (s *Strategy) commandOutputText(events []ttypes.IEvent) string {
+	parts := make([]string, 0, len(events))
+	for _, evt := range events {
+		var prompts []string
+		switch data := evt.GetData().(type) {
+		case *exchange.ExchangeIndicator:
+			prompts = data.ToPrompts(s.MaxNum)
+		case *string:
+			prompts = evt.ToPrompts()
+			if len(prompts) == 0 {
+				prompts = []string{fmt.Sprintf("%s: %s", evt.GetType(), *data)}
+			}
+		default:
+			prompts = evt.ToPrompts()
+			if len(prompts) == 0 && data != nil {
+				prompts = []string{fmt.Sprintf("%s: %v", evt.GetType(), data)}
+			}
+		}
+
+		parts = append(parts, prompts...)
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// applyCommandOutput keeps the state the output events of a command carry,
+// their text is reported with the command
+func (s *Strategy) applyCommandOutput(ctx context.Context, session ttypes.ISession, events []ttypes.IEvent) {
+	for _, evt := range events {
+		switch data := evt.GetData().(type) {
+		case *exchange.ExchangeIndicator:
+			s.setIndicator(session, data)
+		case *string:
+			if evt.GetType() == "fng_changed" {
+				s.handleFngChanged(ctx, session, data)
+			}
+		}
+	}
+}
+
+// commandResultMsgs returns a prompt message per scheduled command finished
+// since the last cycle, pairing the request with its outcome and output
+func (s *Strategy) commandResultMsgs() []*ttypes.Message {
+	results, err := s.commandMemory.TakeResults()
+	if err != nil {
+		log.WithError(err).Warn("Failed to load command results")
+		return nil
+	}
+
+	msgs := make([]*ttypes.Message, 0, len(results))
+	for _, cmd := range results {
+		msgs = append(msgs, &ttypes.Message{
+			Text:    commandResultText(cmd),
+			Section: ttypes.SectionCommands,
+		})
+	}
+
+	return msgs
+}
+
+// commandResultText describes the outcome of a scheduled command
+func commandResultText(cmd *memory.PendingCommand) string {
+	args, _ := json.Marshal(cmd.Args)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Result of the command you scheduled: %s.%s %s", cmd.EntityID, cmd.CommandName, args))
+	if cmd.Trigger != nil {
+		text.WriteString(fmt.Sprintf(" (trigger %s)", cmd.Trigger.String()))
+	}
+
+	switch cmd.Status {
+	case "completed":
+		text.WriteString(fmt.Sprintf("\nStatus: completed at %s", cmd.UpdatedAt.UTC().Format("2006-01-02 15:04:05")))
+	default:
+		text.WriteString(fmt.Sprintf("\nStatus: %s, %s", cmd.Status, cmd.Error))
+	}
+
+	if cmd.Output != "" {
+		text.WriteString("\nOutput:\n")
+		text.WriteString(cmd.Output)
+	} else if cmd.Status == "completed" {
+		text.WriteString("\nOutput: none")
+	}
+
+	return text.String()
+}
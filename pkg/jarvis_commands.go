@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/yubing744/trading-gpt/pkg/auth"
+	"github.com/yubing744/trading-gpt/pkg/chat"
+	"github.com/yubing744/trading-gpt/pkg/env/exchange"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+const (
+	// ChatAction is the audited action of talking to the agent
+	ChatAction = "chat"
+
+	// EmergencyCloseAction closes the position when the agent fails
+	EmergencyCloseAction = "exchange.close_position"
+)
+
+// principalOf returns who the current request runs for: the chat user stored in ctx,
+// or the strategy itself with the roles of the session for trading cycles
+func (s *Strategy) principalOf(ctx context.Context, session ttypes.ISession) *auth.Principal {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p
+	}
+
+	return &auth.Principal{
+		UserID: auth.SystemUserID,
+		Role:   ttypes.HighestRole(session.GetRoles()),
+	}
+}
+
+// actionRole returns the role required by an entity action, actions without one need viewer
+func (s *Strategy) actionRole(fullCmd string) string {
+	action := s.world.GetAction(fullCmd)
+	if action != nil && action.Role != "" {
+		return action.Role
+	}
+
+	return ttypes.RoleViewer
+}
+
+func (s *Strategy) authorizeAction(ctx context.Context, session ttypes.ISession, fullCmd string, args map[string]string) error {
+	return s.authorizer.Authorize(s.principalOf(ctx, session), session.GetID(), fullCmd, s.actionRole(fullCmd), args)
+}
+
+func (s *Strategy) setupChatCommands(ctx context.Context) {
+	commands := chat.NewCommandRegistry()
+
+	commands.Register(&chat.Command{
+		Name:        "help",
+		Usage:       "/help",
+		Description: "List the commands you can run",
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			principal := s.principalOf(ctx, session)
+
+			var text strings.Builder
+			text.WriteString("Commands:")
+			for _, cmd := range s.chatCommands.Commands() {
+				if ttypes.RoleSatisfies(principal.Role, cmd.Role) {
+					text.WriteString(fmt.Sprintf("\n%s - %s", cmd.Usage, cmd.Description))
+				}
+			}
+
+			return text.String(), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "whoami",
+		Usage:       "/whoami",
+		Description: "Show your user ID and role",
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			principal := s.principalOf(ctx, session)
+
+			role := principal.Role
+			if role == "" {
+				role = "none, ask an admin to add your user ID to auth.users"
+			}
+
+			return fmt.Sprintf("User ID: %s\nName: %s\nRole: %s", principal.UserID, principal.DisplayName(), role), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "position",
+		Usage:       "/position",
+		Description: "Show the current position, both legs in hedge mode",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			if !s.hedgeMode() {
+				if s.Position == nil || s.Position.GetBase().IsZero() {
+					return "No position", nil
+				}
+
+				return s.Position.String(), nil
+			}
+
+			legs := make([]string, 0, 2)
+			for _, leg := range []struct {
+				name     string
+				position *types.Position
+			}{{"Long leg", s.Position}, {"Short leg", s.ShortPosition}} {
+				if leg.position != nil && !leg.position.GetBase().IsZero() {
+					legs = append(legs, fmt.Sprintf("%s: %s", leg.name, leg.position.String()))
+				}
+			}
+
+			if len(legs) == 0 {
+				return "No position", nil
+			}
+
+			return strings.Join(legs, "\n"), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "usage",
+		Usage:       "/usage",
+		Description: "Show today's LLM token usage and cost",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			tracker := s.llm.Usage()
+			today := tracker.Today()
+
+			keys := make([]string, 0, len(today.Models))
+			for key := range today.Models {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			var text strings.Builder
+			text.WriteString(fmt.Sprintf("LLM usage %s: %d calls, %s", today.Date, today.Calls, today.Total.String()))
+			if tracker.DailyCap() > 0 {
+				text.WriteString(fmt.Sprintf("\nDaily cap: $%.2f, over cap: %s", tracker.DailyCap(), tracker.OverCapAction()))
+			}
+			for _, key := range keys {
+				text.WriteString(fmt.Sprintf("\n%s: %s", key, today.Models[key].String()))
+			}
+
+			return text.String(), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "close",
+		Usage:       "/close [percentage]",
+		Description: "Close the position, fully or by percentage such as 50%",
+		Role:        ttypes.RoleOperator,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			cmdArgs := map[string]string{}
+			if len(args) > 0 {
+				cmdArgs["percentage"] = args[0]
+			}
+
+			// Attribute the closing fill to the operator in the position_closed event
+			ctx = context.WithValue(ctx, "closeReason", exchange.CloseReasonManual)
+			ctx = context.WithValue(ctx, "closeSource", exchange.CloseSourceChat)
+
+			err := s.world.SendCommand(ctx, "exchange.close_position", cmdArgs)
+			if err != nil {
+				return "", err
+			}
+
+			return "Close position command executed", nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "users",
+		Usage:       "/users",
+		Description: "List configured users and roles",
+		Role:        ttypes.RoleAdmin,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			users := s.authorizer.Users()
+			sort.Slice(users, func(i, j int) bool {
+				return users[i].UserID < users[j].UserID
+			})
+
+			var text strings.Builder
+			text.WriteString(fmt.Sprintf("Users (default role: %s):", s.Auth.DefaultRole))
+			for _, user := range users {
+				text.WriteString(fmt.Sprintf("\n%s (%s): %s", user.DisplayName(), user.UserID, user.Role))
+			}
+
+			return text.String(), nil
+		},
+	})
+
+	s.registerMemoryCommands(commands)
+	s.registerKnowledgeCommands(commands)
+
+	s.chatCommands = commands
+}
+
+func (s *Strategy) handleSlashCommand(ctx context.Context, session ttypes.ISession, principal *auth.Principal, name string, args []string) {
+	cmd, ok := s.chatCommands.Get(name)
+	if !ok {
+		s.replyMsg(ctx, session, fmt.Sprintf("Unknown command /%s, send /help to list commands", name))
+		return
+	}
+
+	var auditArgs map[string]string
+	if len(args) > 0 {
+		auditArgs = map[string]string{"args": strings.Join(args, " ")}
+	}
+
+	err := s.authorizer.Authorize(principal, session.GetID(), "/"+cmd.Name, cmd.Role, auditArgs)
+	if err != nil {
+		s.replyMsg(ctx, session, fmt.Sprintf("Command refused: %s", err.Error()))
+		return
+	}
+
+	reply, err := cmd.Handler(ctx, session, args)
+	if err != nil {
+		log.WithError(err).WithField("command", cmd.Name).Error("run chat command error")
+		s.replyMsg(ctx, session, fmt.Sprintf("Command /%s failed: %s", cmd.Name, err.Error()))
+		return
+	}
+
+	s.replyMsg(ctx, session, reply)
+}
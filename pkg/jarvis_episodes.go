@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/env/exchange"
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+const (
+	DefaultEpisodeTopK          = 3
+	DefaultMaxEpisodes          = 2000
+	DefaultEpisodeHorizon       = time.Hour
+	DefaultEpisodeMinSimilarity = 0.5
+
+	// Reasoning kept with an episode, in runes
+	episodeReasoningLength = 300
+	episodeEmbedTimeout    = 30 * time.Second
+)
+
+type episodeCtxKey struct{}
+
+// withEpisode attaches the episode of a decision cycle, agentAction fills in the decision
+func withEpisode(ctx context.Context, ep *memory.Episode) context.Context {
+	return context.WithValue(ctx, episodeCtxKey{}, ep)
+}
+
+func episodeFromContext(ctx context.Context) *memory.Episode {
+	ep, _ := ctx.Value(episodeCtxKey{}).(*memory.Episode)
+	return ep
+}
+
+func (s *Strategy) setupEpisodes(ctx context.Context) error {
+	if !s.Episodes.Enabled {
+		log.Info("Episodic memory disabled")
+		return nil
+	}
+
+	// Set default values if not configured
+	if s.Episodes.EpisodePath == "" {
+		s.Episodes.EpisodePath = "memory-bank/episodes.json"
+	}
+	if s.Episodes.TopK == 0 {
+		s.Episodes.TopK = DefaultEpisodeTopK
+	}
+	if s.Episodes.MaxEpisodes == 0 {
+		s.Episodes.MaxEpisodes = DefaultMaxEpisodes
+	}
+	if s.Episodes.OutcomeHorizon == 0 {
+		s.Episodes.OutcomeHorizon = types.Duration(DefaultEpisodeHorizon)
+	}
+	if s.Episodes.MinSimilarity == 0 {
+		s.Episodes.MinSimilarity = DefaultEpisodeMinSimilarity
+	}
+
+	s.episodeStore = memory.NewEpisodeStore(s.Episodes.EpisodePath, s.Episodes.MaxEpisodes)
+	if err := s.episodeStore.Load(); err != nil {
+		log.WithError(err).Warn("Failed to load episodes")
+	}
+
+	if s.Episodes.Ollama != nil && s.Episodes.Ollama.Model != "" {
+		embedder, err := memory.NewOllamaEmbedder(s.Episodes.Ollama)
+		if err != nil {
+			log.WithError(err).Warn("Failed to create episode embedder, fall back to market features")
+		} else {
+			s.episodeEmbedder = embedder
+		}
+	}
+
+	log.WithField("episodes", s.episodeStore.Len()).Info("Episodic memory enabled")
+	return nil
+}
+
+// marketSnapshot collects the klines, indicators on the kline interval and
+// the Fear & Greed Index of the session
+func (s *Strategy) marketSnapshot(session ttypes.ISession) (*memory.MarketSnapshot, bool) {
+	window, ok := s.getKline(session)
+	if !ok || len(*window) == 0 {
+		return nil, false
+	}
+
+	snapshot := &memory.MarketSnapshot{}
+	for _, kline := range *window {
+		snapshot.Closes = append(snapshot.Closes, kline.Close.Float64())
+		snapshot.Highs = append(snapshot.Highs, kline.High.Float64())
+		snapshot.Lows = append(snapshot.Lows, kline.Low.Float64())
+		snapshot.Volumes = append(snapshot.Volumes, kline.Volume.Float64())
+	}
+
+	for _, ei := range s.getIndicators(session) {
+		if ei.Interval() != window.GetInterval() {
+			continue
+		}
+
+		switch ei.Type {
+		case config.IndicatorTypeBOLL:
+			up, _, down, ok := ei.Bands()
+			if ok && len(up) > 0 && len(down) > 0 && up[len(up)-1] > down[len(down)-1] {
+				percentB := (snapshot.LastClose() - down[len(down)-1]) / (up[len(up)-1] - down[len(down)-1])
+				snapshot.BollPercentB = &percentB
+			}
+		case config.IndicatorTypeVR:
+			snapshot.VR = lastValue(ei)
+		case config.IndicatorTypeRSI:
+			snapshot.RSI = lastValue(ei)
+		}
+	}
+
+	if fng, ok := session.GetAttribute("fng"); ok {
+		value := fng.(float64)
+		snapshot.FNG = &value
+	}
+
+	return snapshot, true
+}
+
+func lastValue(ei *exchange.ExchangeIndicator) *float64 {
+	vals, ok := ei.Values()
+	if !ok || len(vals) == 0 {
+		return nil
+	}
+
+	return &vals[len(vals)-1]
+}
+
+// newEpisode resolves the outcomes due and starts the episode of this cycle,
+// it returns nil when episodic memory is disabled or there are no klines.
+// The episode ID is the cycle ID set by the caller.
+func (s *Strategy) newEpisode(ctx context.Context, session ttypes.ISession) *memory.Episode {
+	if s.episodeStore == nil {
+		return nil
+	}
+
+	snapshot, ok := s.marketSnapshot(session)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	resolved, err := s.episodeStore.ResolveForward(s.Symbol, snapshot.LastClose(), now, s.Episodes.OutcomeHorizon.Duration())
+	if err != nil {
+		log.WithError(err).Warn("Failed to resolve episode forward returns")
+	} else if resolved > 0 {
+		log.WithField("resolved", resolved).Info("Resolved episode forward returns")
+	}
+
+	ep := &memory.Episode{
+		Symbol:    s.Symbol,
+		Timestamp: now,
+		Close:     snapshot.LastClose(),
+		Summary:   snapshot.String(),
+		Features:  snapshot.Features(),
+	}
+
+	if pos, ok := session.GetAttribute("position"); ok {
+		ep.InTrade = true
+		ep.Position = "short"
+		if pos.(*exchange.PositionX).IsLong() {
+			ep.Position = "long"
+		}
+	}
+
+	if s.episodeEmbedder != nil {
+		embedCtx, cancel := context.WithTimeout(ctx, episodeEmbedTimeout)
+		embedding, err := s.episodeEmbedder.Embed(embedCtx, ep.Summary)
+		cancel()
+
+		if err != nil {
+			log.WithError(err).Warn("Failed to embed episode, fall back to market features")
+		} else {
+			ep.Embedder = s.episodeEmbedder.Name()
+			ep.Embedding = embedding
+		}
+	}
+
+	return ep
+}
+
+// similarEpisodeMsgs returns the prompt messages of the past episodes most similar to ep
+func (s *Strategy) similarEpisodeMsgs(ep *memory.Episode) []*ttypes.Message {
+	matches := s.episodeStore.Similar(ep, s.Episodes.TopK, s.Episodes.MinSimilarity)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	msgs := make([]*ttypes.Message, 0, len(matches))
+	for _, text := range memory.FormatEpisodeMatches(matches) {
+		msgs = append(msgs, &ttypes.Message{
+			Text:    text,
+			Section: ttypes.SectionEpisodes,
+		})
+	}
+
+	return msgs
+}
+
+// recordEpisodeDecision fills in the decision of the cycle episode in ctx
+func recordEpisodeDecision(ctx context.Context, result *ttypes.Result) {
+	ep := episodeFromContext(ctx)
+	if ep == nil {
+		return
+	}
+
+	// An open decision is in the trade once the position opens, see enterEpisodeTrade
+	ep.Decision = "wait"
+	if result.Action != nil && result.Action.Name != "" {
+		ep.Decision = result.Action.JSON()
+	}
+
+	if result.Thoughts != nil {
+		reasoning := []rune(strings.TrimSpace(result.Thoughts.Speak))
+		if len(reasoning) > episodeReasoningLength {
+			reasoning = append(reasoning[:episodeReasoningLength], '…')
+		}
+		ep.Reasoning = string(reasoning)
+	}
+}
+
+// saveEpisode stores the episode of the trading cycle once the agent made a decision
+func (s *Strategy) saveEpisode(ep *memory.Episode) {
+	if ep == nil || ep.Decision == "" {
+		return
+	}
+
+	if err := s.episodeStore.Add(ep); err != nil {
+		log.WithError(err).Warn("Failed to save episode")
+		return
+	}
+
+	// A market order may have opened the position during the cycle
+	if position, open := s.cycleSession.GetAttribute("position"); open {
+		if position, ok := position.(*exchange.PositionX); ok {
+			s.enterEpisodeTrade(position)
+		}
+	}
+}
+
+// enterEpisodeTrade marks the episode which opened the position as traded,
+// it is resolved by the close of the position
+func (s *Strategy) enterEpisodeTrade(position *exchange.PositionX) {
+	if s.episodeStore == nil {
+		return
+	}
+
+	// The position may be seen cycles after it opened, a later decision did not open it
+	openedAt := position.OpenedAt
+	if openedAt.IsZero() {
+		openedAt = time.Now()
+	}
+
+	entered, err := s.episodeStore.EnterTrade(s.Symbol, openedAt)
+	if err != nil {
+		log.WithError(err).Warn("Failed to mark the episode of the opened position")
+	} else if entered {
+		log.Info("Marked the episode of the opened position")
+	}
+}
+
+// resolveEpisodes sets the outcome of the episodes traded by the closed position
+func (s *Strategy) resolveEpisodes(posData exchange.PositionClosedEventData) {
+	if s.episodeStore == nil {
+		return
+	}
+
+	closedAt := posData.Timestamp
+	if closedAt.IsZero() {
+		closedAt = time.Now()
+	}
+
+	resolved, err := s.episodeStore.ResolveTrade(s.Symbol, memory.EpisodeOutcome{
+		ProfitAndLoss:        posData.ProfitAndLoss,
+		ProfitAndLossPercent: posData.ProfitAndLossPercent,
+		CloseReason:          posData.CloseReason,
+		ClosedAt:             closedAt,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to resolve episodes of the closed position")
+		return
+	}
+
+	log.WithField("resolved", resolved).Info("Resolved episodes of the closed position")
+}
+
+// parseFng parses the Fear & Greed Index value
+func parseFng(fng string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(fng), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fng value %q: %w", fng, err)
+	}
+
+	return value, nil
+}
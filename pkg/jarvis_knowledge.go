@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yubing744/trading-gpt/pkg/chat"
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+const DefaultKnowledgePerScope = 50
+
+func (s *Strategy) setupKnowledge(ctx context.Context) error {
+	if !s.Knowledge.Enabled {
+		log.Info("Shared knowledge disabled")
+		return nil
+	}
+
+	// Set default values if not configured
+	if s.Knowledge.KnowledgePath == "" {
+		s.Knowledge.KnowledgePath = "memory-bank/shared/knowledge.json"
+	}
+	if s.Knowledge.Instance == "" {
+		s.Knowledge.Instance = s.InstanceID()
+	}
+	if s.Knowledge.MaxPerScope == 0 {
+		s.Knowledge.MaxPerScope = DefaultKnowledgePerScope
+	}
+
+	s.knowledgeBase = memory.NewKnowledgeBase(s.Knowledge.KnowledgePath, s.Knowledge.MaxPerScope)
+
+	log.WithField("scopes", s.knowledgeScopes()).Info("Shared knowledge enabled")
+	return nil
+}
+
+// knowledgeScopes returns the scopes of this instance, the most specific first
+func (s *Strategy) knowledgeScopes() []string {
+	scopes := []string{memory.SymbolScope(s.Symbol)}
+	if s.Knowledge.AssetClass != "" {
+		scopes = append(scopes, memory.AssetScope(s.Knowledge.AssetClass))
+	}
+
+	return append(scopes, memory.ScopeGlobal)
+}
+
+// knowledgeScope maps a scope of the knowledge output to the scope of this instance
+func (s *Strategy) knowledgeScope(scope string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(scope)) {
+	case ttypes.KnowledgeScopeGlobal:
+		return memory.ScopeGlobal, nil
+	case ttypes.KnowledgeScopeAsset:
+		if s.Knowledge.AssetClass == "" {
+			return "", fmt.Errorf("no asset class configured for the asset scope")
+		}
+		return memory.AssetScope(s.Knowledge.AssetClass), nil
+	case ttypes.KnowledgeScopeSymbol, "":
+		return memory.SymbolScope(s.Symbol), nil
+	default:
+		return "", fmt.Errorf("unknown knowledge scope %q", scope)
+	}
+}
+
+// knowledgeMsg returns the prompt message of the lessons shared with this
+// instance, symbol lessons override asset class and global lessons of the same key
+func (s *Strategy) knowledgeMsg() (*ttypes.Message, bool) {
+	if s.knowledgeBase == nil {
+		return nil, false
+	}
+
+	entries, err := s.knowledgeBase.Merged(s.knowledgeScopes()...)
+	if err != nil {
+		log.WithError(err).Warn("Failed to load shared knowledge")
+		return nil, false
+	}
+	if len(entries) == 0 {
+		return nil, false
+	}
+
+	return &ttypes.Message{
+		Text: "Shared knowledge learned by all trading instances, the most specific scope first:\n" +
+			memory.FormatKnowledge(entries),
+		Section: ttypes.SectionKnowledge,
+	}, true
+}
+
+// processKnowledgeOutput contributes the lessons of the knowledge output
+func (s *Strategy) processKnowledgeOutput(ctx context.Context, chatSession ttypes.ISession, output []*ttypes.Knowledge, model string) {
+	for _, k := range output {
+		if k == nil {
+			continue
+		}
+
+		scope, err := s.knowledgeScope(k.Scope)
+		if err != nil {
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("Knowledge [%s] skipped: %s", k.Key, err.Error()))
+			s.stashMsg(ctx, chatSession, fmt.Sprintf("Knowledge [%s] was not shared: %s", k.Key, err.Error()))
+			continue
+		}
+
+		err = s.knowledgeBase.Upsert(&memory.Knowledge{
+			Scope: scope,
+			Key:   strings.TrimSpace(k.Key),
+			Text:  strings.TrimSpace(k.Text),
+			Provenance: memory.Provenance{
+				Instance: s.Knowledge.Instance,
+				Symbol:   s.Symbol,
+				CycleID:  cycleIDFromContext(ctx),
+				Model:    model,
+			},
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to share knowledge")
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("Failed to share knowledge [%s]: %s", k.Key, err.Error()))
+			continue
+		}
+
+		if k.Text == "" {
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("🧠 Shared knowledge removed: %s [%s]", scope, k.Key))
+		} else {
+			s.replyMsg(ctx, chatSession, fmt.Sprintf("🧠 Shared knowledge saved: %s [%s] %s", scope, k.Key, k.Text))
+		}
+	}
+}
+
+// shareReflection contributes the rule adopted by a trade reflection in the symbol scope
+func (s *Strategy) shareReflection(trade *memory.TradeRecord) {
+	if s.knowledgeBase == nil || trade.Reflection == nil || trade.Reflection.Rule == "" {
+		return
+	}
+	if s.Knowledge.ShareRules != nil && !*s.Knowledge.ShareRules {
+		return
+	}
+
+	key := trade.Reflection.RuleKey
+	if key == "" {
+		key = trade.ID
+	}
+
+	err := s.knowledgeBase.Upsert(&memory.Knowledge{
+		Scope: memory.SymbolScope(s.Symbol),
+		Key:   key,
+		Text:  trade.Reflection.Rule,
+		Provenance: memory.Provenance{
+			Instance: s.Knowledge.Instance,
+			Symbol:   s.Symbol,
+			TradeID:  trade.ID,
+		},
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to share trade reflection rule")
+	}
+}
+
+// registerKnowledgeCommands adds the chat commands of the shared knowledge
+func (s *Strategy) registerKnowledgeCommands(commands *chat.CommandRegistry) {
+	if s.knowledgeBase == nil {
+		return
+	}
+
+	commands.Register(&chat.Command{
+		Name:        "knowledge",
+		Usage:       "/knowledge [scope]",
+		Description: "List shared knowledge with its provenance, scope is global, asset:<class> or symbol:<symbol>",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			scopes := s.knowledgeScopes()
+			if len(args) > 0 {
+				scopes = args[:1]
+			}
+
+			entries, err := s.knowledgeBase.List(scopes...)
+			if err != nil {
+				return "", err
+			}
+			if len(entries) == 0 {
+				return "No shared knowledge yet", nil
+			}
+
+			var text strings.Builder
+			text.WriteString("Shared knowledge:")
+			for _, entry := range entries {
+				text.WriteString(fmt.Sprintf("\n%s [%s] %s\n  from %s, updated %s",
+					entry.Scope, entry.Key, entry.Text, entry.Provenance.String(),
+					entry.UpdatedAt.UTC().Format("2006-01-02 15:04")))
+			}
+
+			return text.String(), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "knowledge_remove",
+		Usage:       "/knowledge_remove <scope> <key>",
+		Description: "Remove a shared lesson",
+		Role:        ttypes.RoleAdmin,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			if len(args) < 2 {
+				return "", fmt.Errorf("usage: /knowledge_remove <scope> <key>")
+			}
+
+			removed, err := s.knowledgeBase.Remove(args[0], args[1])
+			if err != nil {
+				return "", err
+			}
+			if !removed {
+				return "", fmt.Errorf("no shared knowledge %s [%s]", args[0], args[1])
+			}
+
+			return fmt.Sprintf("Shared knowledge %s [%s] removed", args[0], args[1]), nil
+		},
+	})
+}
@@ -0,0 +1,276 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/yubing744/trading-gpt/pkg/auth"
+	"github.com/yubing744/trading-gpt/pkg/chat"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// DefaultMemoryHistoryLimit is the number of versions listed by /memory_history
+const DefaultMemoryHistoryLimit = 10
+
+type cycleIDKey struct{}
+
+// withCycleID attaches the ID of a decision cycle to ctx
+func withCycleID(ctx context.Context, cycleID string) context.Context {
+	return context.WithValue(ctx, cycleIDKey{}, cycleID)
+}
+
+func cycleIDFromContext(ctx context.Context) string {
+	cycleID, _ := ctx.Value(cycleIDKey{}).(string)
+	return cycleID
+}
+
+// memorySectionSpecs returns the configured sections of the structured
+// memory, or the defaults sharing max_words
+func (s *Strategy) memorySectionSpecs() ([]*memory.SectionSpec, error) {
+	if len(s.Memory.Sections) == 0 {
+		return memory.DefaultSectionSpecs(s.Memory.MaxWords), nil
+	}
+
+	specs := make([]*memory.SectionSpec, 0, len(s.Memory.Sections))
+	for _, section := range s.Memory.Sections {
+		specs = append(specs, &memory.SectionSpec{
+			Name:        section.Name,
+			Title:       section.Title,
+			Mode:        section.Mode,
+			MaxWords:    section.MaxWords,
+			Description: section.Description,
+		})
+	}
+
+	if err := memory.ValidateSectionSpecs(specs); err != nil {
+		return nil, errors.Wrap(err, "invalid memory sections")
+	}
+
+	return specs, nil
+}
+
+// memorySectionsData returns the notes outside the sections and the sections
+// of the structured memory for the prompt templates. A memory budget is
+// shared in proportion to the word budgets of the sections and the words of
+// the notes.
+func (s *Strategy) memorySectionsData(content string, specs []*memory.SectionSpec, budget int) (string, []map[string]interface{}) {
+	sm := memory.ParseStructured(content, specs)
+
+	preambleWords := len(strings.Fields(sm.Preamble))
+	totalWords := preambleWords
+	for _, spec := range specs {
+		totalWords += spec.MaxWords
+	}
+
+	tok := s.llm.Tokenizer()
+	keep := func(text string, words int) string {
+		if budget <= 0 || totalWords == 0 {
+			return text
+		}
+		return tokenizer.KeepHead(tok, text, budget*words/totalWords)
+	}
+
+	sections := make([]map[string]interface{}, 0, len(sm.Sections))
+	for _, section := range sm.Sections {
+		sections = append(sections, map[string]interface{}{
+			"Name":        section.Spec.Name,
+			"Title":       section.Spec.Title,
+			"Mode":        section.Spec.Mode,
+			"Description": section.Spec.Description,
+			"MaxWords":    section.Spec.MaxWords,
+			"Words":       section.Words(),
+			"Content":     keep(section.Content(), section.Spec.MaxWords),
+		})
+	}
+
+	return keep(sm.Preamble, preambleWords), sections
+}
+
+func parseVersion(arg string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(arg), "v"))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid memory version %q", arg)
+	}
+
+	return version, nil
+}
+
+func userIDOf(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p.UserID
+	}
+
+	return ""
+}
+
+// registerMemoryCommands adds the chat commands of the memory history
+func (s *Strategy) registerMemoryCommands(commands *chat.CommandRegistry) {
+	if s.memoryManager == nil || s.memoryManager.History() == nil {
+		return
+	}
+
+	history := s.memoryManager.History()
+
+	commands.Register(&chat.Command{
+		Name:        "memory_history",
+		Usage:       "/memory_history [count]",
+		Description: "List the latest memory versions",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			limit := DefaultMemoryHistoryLimit
+			if len(args) > 0 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return "", fmt.Errorf("invalid count %q", args[0])
+				}
+				limit = n
+			}
+
+			versions, err := history.List()
+			if err != nil {
+				return "", err
+			}
+			if len(versions) == 0 {
+				return "No memory versions yet", nil
+			}
+			if len(versions) > limit {
+				versions = versions[len(versions)-limit:]
+			}
+
+			var text strings.Builder
+			text.WriteString("Memory versions:")
+			for i := len(versions) - 1; i >= 0; i-- {
+				text.WriteString("\n" + versions[i].Summary())
+			}
+
+			if pending := s.memoryManager.Pending(); pending != nil {
+				text.WriteString(fmt.Sprintf("\nPending write from %s deleting %.0f%%, run /memory_confirm to apply it",
+					pending.CreatedAt.UTC().Format("2006-01-02 15:04:05"), pending.DeletedPercent))
+			}
+
+			return text.String(), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "memory_show",
+		Usage:       "/memory_show <version>",
+		Description: "Show a memory version",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			if len(args) < 1 {
+				return "", fmt.Errorf("usage: /memory_show <version>")
+			}
+
+			version, err := parseVersion(args[0])
+			if err != nil {
+				return "", err
+			}
+
+			v, err := history.Get(version)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s\n\n%s", v.Summary(), v.Content), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "memory_diff",
+		Usage:       "/memory_diff <from> [to]",
+		Description: "Diff two memory versions, to defaults to the current memory",
+		Role:        ttypes.RoleViewer,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			if len(args) < 1 {
+				return "", fmt.Errorf("usage: /memory_diff <from> [to]")
+			}
+
+			fromVersion, err := parseVersion(args[0])
+			if err != nil {
+				return "", err
+			}
+
+			from, err := history.Get(fromVersion)
+			if err != nil {
+				return "", err
+			}
+
+			toName := "current"
+			to, err := s.memoryManager.LoadMemory()
+			if err != nil {
+				return "", err
+			}
+
+			if len(args) > 1 {
+				toVersion, err := parseVersion(args[1])
+				if err != nil {
+					return "", err
+				}
+
+				v, err := history.Get(toVersion)
+				if err != nil {
+					return "", err
+				}
+
+				toName = fmt.Sprintf("v%d", v.Version)
+				to = v.Content
+			}
+
+			diff := memory.Diff(from.Content, to)
+			if diff == "" {
+				return fmt.Sprintf("v%d and %s are the same", from.Version, toName), nil
+			}
+
+			return fmt.Sprintf("Diff v%d -> %s (%.0f%% deleted):\n%s",
+				from.Version, toName, memory.DeletedPercent(from.Content, to), diff), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "memory_rollback",
+		Usage:       "/memory_rollback <version>",
+		Description: "Restore a memory version",
+		Role:        ttypes.RoleAdmin,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			if len(args) < 1 {
+				return "", fmt.Errorf("usage: /memory_rollback <version>")
+			}
+
+			version, err := parseVersion(args[0])
+			if err != nil {
+				return "", err
+			}
+
+			saved, err := s.memoryManager.Rollback(ctx, version, userIDOf(ctx))
+			if err != nil {
+				return "", err
+			}
+
+			s.currentMemory = saved
+			return fmt.Sprintf("Memory rolled back to v%d", version), nil
+		},
+	})
+
+	commands.Register(&chat.Command{
+		Name:        "memory_confirm",
+		Usage:       "/memory_confirm",
+		Description: "Apply the memory write rejected by the delete guard",
+		Role:        ttypes.RoleAdmin,
+		Handler: func(ctx context.Context, session ttypes.ISession, args []string) (string, error) {
+			saved, _, err := s.memoryManager.ConfirmPending(ctx, userIDOf(ctx))
+			if err != nil {
+				return "", err
+			}
+
+			s.currentMemory = saved
+			return fmt.Sprintf("💾 Memory saved: %s", saved), nil
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"context"
+
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// MaxPendingNotifyEvents is the number of events waiting for a slow event
+// notify channel above which new events are dropped
+const MaxPendingNotifyEvents = 1000
+
+type notifyEvent struct {
+	eventType string
+	data      interface{}
+}
+
+// eventPublisher delivers the events of a notify channel one at a time, in
+// the order they were published
+type eventPublisher struct {
+	ch     ttypes.IEventNotifyChannel
+	events chan notifyEvent
+}
+
+// newEventPublisher starts the worker of the channel, it stops with ctx
+func newEventPublisher(ctx context.Context, ch ttypes.IEventNotifyChannel) *eventPublisher {
+	p := &eventPublisher{
+		ch:     ch,
+		events: make(chan notifyEvent, MaxPendingNotifyEvents),
+	}
+
+	go p.run(ctx)
+	return p
+}
+
+// publish queues an event without waiting for its delivery
+func (p *eventPublisher) publish(eventType string, data interface{}) {
+	select {
+	case p.events <- notifyEvent{eventType: eventType, data: data}:
+	default:
+		log.WithField("channel", p.ch.GetID()).
+			WithField("eventType", eventType).
+			Warn("event notify queue full, event dropped")
+	}
+}
+
+func (p *eventPublisher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt := <-p.events:
+			err := p.ch.Publish(ctx, evt.eventType, evt.data)
+			if err != nil {
+				log.WithError(err).
+					WithField("channel", p.ch.GetID()).
+					WithField("eventType", evt.eventType).
+					Error("publish event error")
+			}
+		}
+	}
+}
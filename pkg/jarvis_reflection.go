@@ -0,0 +1,271 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/pkg/errors"
+
+	"github.com/yubing744/trading-gpt/pkg/env/exchange"
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Reasoning kept with a trade decision, in runes
+const tradeReasoningLength = 300
+
+// MaxPendingReflections is the number of closed trades waiting for their
+// reflection above which a closed trade is journaled without one
+const MaxPendingReflections = 10
+
+// reflectionJob is a closed trade waiting for its reflection
+type reflectionJob struct {
+	session ttypes.ISession
+	trade   *memory.TradeRecord
+}
+
+func (s *Strategy) setupReflection(ctx context.Context) error {
+	if !s.Reflection.Enabled {
+		log.Info("Trade reflection disabled")
+		return nil
+	}
+
+	// Set default values if not configured
+	if s.Reflection.JournalPath == "" {
+		s.Reflection.JournalPath = "memory-bank/trade-journal.jsonl"
+	}
+
+	s.tradeJournal = memory.NewTradeJournal(s.Reflection.JournalPath)
+	if err := s.tradeJournal.Load(); err != nil {
+		log.WithError(err).Warn("Failed to load open trade")
+	}
+
+	s.reflector = memory.NewLLMReflector(s.llm)
+	s.reflections = make(chan reflectionJob, MaxPendingReflections)
+	go s.runReflections(ctx)
+
+	log.Info("Trade reflection enabled")
+	return nil
+}
+
+// shortReasoning cuts the reasoning of a decision kept in the journal
+func shortReasoning(thoughts *ttypes.Thoughts) string {
+	if thoughts == nil {
+		return ""
+	}
+
+	reasoning := []rune(strings.TrimSpace(thoughts.Speak))
+	if len(reasoning) > tradeReasoningLength {
+		reasoning = append(reasoning[:tradeReasoningLength], '…')
+	}
+
+	return string(reasoning)
+}
+
+// recordTradeDecision journals an executed action, an open action starts the trade
+func (s *Strategy) recordTradeDecision(ctx context.Context, session ttypes.ISession, action *ttypes.Action, thoughts *ttypes.Thoughts, model string) {
+	if s.tradeJournal == nil {
+		return
+	}
+
+	if s.tradeJournal.Open() == nil && strings.Contains(action.Name, "open_") {
+		side := "long"
+		if strings.Contains(action.Name, "short") {
+			side = "short"
+		}
+
+		entryPrice := 0.0
+		if kline, ok := s.getKline(session); ok && len(*kline) > 0 {
+			entryPrice = kline.GetClose().Float64()
+		}
+
+		s.startTrade(side, entryPrice)
+	}
+
+	err := s.tradeJournal.AddDecision(&memory.TradeDecision{
+		Timestamp: time.Now(),
+		CycleID:   cycleIDFromContext(ctx),
+		Model:     model,
+		Action:    action.JSON(),
+		Reasoning: shortReasoning(thoughts),
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to journal trade decision")
+	}
+}
+
+func (s *Strategy) startTrade(side string, entryPrice float64) {
+	now := time.Now()
+	err := s.tradeJournal.Start(&memory.TradeRecord{
+		ID:         fmt.Sprintf("%s-%d", s.Symbol, now.Unix()),
+		Symbol:     s.Symbol,
+		Side:       side,
+		OpenedAt:   now,
+		EntryPrice: entryPrice,
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to journal trade start")
+	}
+}
+
+// trackOpenPosition starts a trade for a position opened outside the agent,
+// such as before the journal was enabled
+func (s *Strategy) trackOpenPosition(position *exchange.PositionX) {
+	if s.tradeJournal == nil || s.tradeJournal.Open() != nil {
+		return
+	}
+
+	side := "short"
+	if position.IsLong() {
+		side = "long"
+	}
+
+	s.startTrade(side, position.AverageCost.Float64())
+}
+
+// observeTradePrices widens the price path of the open trade with the klines
+// closed since it opened
+func (s *Strategy) observeTradePrices(klineWindow *types.KLineWindow) {
+	if s.tradeJournal == nil {
+		return
+	}
+
+	trade := s.tradeJournal.Open()
+	if trade == nil {
+		return
+	}
+
+	for _, kline := range *klineWindow {
+		if kline.EndTime.Time().Before(trade.OpenedAt) {
+			continue
+		}
+
+		if err := s.tradeJournal.ObservePrice(kline.High.Float64(), kline.Low.Float64()); err != nil {
+			log.WithError(err).Warn("Failed to journal trade prices")
+			return
+		}
+	}
+}
+
+// reflectOnTrade closes the journaled trade and queues its post-mortem
+func (s *Strategy) reflectOnTrade(ctx context.Context, session ttypes.ISession, posData exchange.PositionClosedEventData) {
+	if s.tradeJournal == nil {
+		return
+	}
+
+	closedAt := posData.Timestamp
+	if closedAt.IsZero() {
+		closedAt = time.Now()
+	}
+
+	trade, err := s.tradeJournal.Close(posData.EntryPrice, memory.TradeCloseData{
+		ExitPrice:            posData.ExitPrice,
+		Quantity:             posData.Quantity,
+		ProfitAndLoss:        posData.ProfitAndLoss,
+		ProfitAndLossPercent: posData.ProfitAndLossPercent,
+		CloseReason:          posData.CloseReason,
+		ClosedAt:             closedAt,
+	})
+	if errors.Is(err, memory.ErrNoOpenTrade) {
+		log.WithField("positionData", posData).Info("No journaled trade for the closed position, skip reflection")
+		return
+	}
+	if err != nil {
+		log.WithError(err).Warn("Failed to close journaled trade")
+	}
+
+	// The reflection is an LLM call, it runs off the world event loop
+	select {
+	case s.reflections <- reflectionJob{session: session, trade: trade}:
+	default:
+		log.WithField("trade", trade.ID).Warn("Too many trades waiting for reflection, journal the trade without one")
+		if err := s.tradeJournal.Append(trade); err != nil {
+			log.WithError(err).Warn("Failed to append trade to journal")
+		}
+	}
+}
+
+// runReflections reflects on the closed trades one at a time, in the order they closed
+func (s *Strategy) runReflections(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.reflections:
+			s.reflectClosedTrade(ctx, job.session, job.trade)
+		}
+	}
+}
+
+// reflectClosedTrade asks the reflector about a closed trade, journals it and
+// writes the reflection into memory
+func (s *Strategy) reflectClosedTrade(ctx context.Context, session ttypes.ISession, trade *memory.TradeRecord) {
+	var err error
+	current := ""
+	if s.memoryEnabled && s.memoryManager != nil {
+		current, err = s.memoryManager.LoadMemory()
+		if err != nil {
+			log.WithError(err).Warn("Failed to load memory for reflection")
+		}
+	}
+
+	reflection, err := s.reflector.Reflect(ctx, trade, current)
+	if err != nil {
+		log.WithError(err).Warn("Failed to reflect on trade")
+		s.replyMsg(ctx, session, fmt.Sprintf("Trade reflection failed: %s", err.Error()))
+	} else {
+		trade.Reflection = reflection
+	}
+
+	if err := s.tradeJournal.Append(trade); err != nil {
+		log.WithError(err).Warn("Failed to append trade to journal")
+	}
+
+	if trade.Reflection == nil {
+		return
+	}
+
+	s.shareReflection(trade)
+
+	s.replyMsg(ctx, session, fmt.Sprintf("📝 Trade reflection for %s %s (MFE %+.2f%%, MAE %+.2f%%):\n%s",
+		trade.Symbol, trade.Side, trade.MFEPercent, trade.MAEPercent, reflection.String()))
+	s.stashMsg(ctx, session, fmt.Sprintf("Post-trade reflection of the closed %s position: %s", trade.Side, reflection.String()))
+
+	if s.memoryEnabled && s.memoryManager != nil && (s.Reflection.WriteMemory == nil || *s.Reflection.WriteMemory) {
+		s.writeReflection(ctx, session, trade)
+	}
+}
+
+// writeReflection writes the rule and mistakes of a reflected trade into memory
+func (s *Strategy) writeReflection(ctx context.Context, session ttypes.ISession, trade *memory.TradeRecord) {
+	ctx = memory.WithWriteInfo(ctx, memory.WriteInfo{
+		CycleID: trade.ID,
+		Source:  memory.SourceReflection,
+	})
+
+	var saved string
+	var err error
+	if sections := s.memoryManager.Sections(); len(sections) > 0 {
+		updates := memory.ReflectionUpdates(trade, sections)
+		if len(updates) == 0 {
+			return
+		}
+		saved, _, _, err = s.memoryManager.UpdateSections(ctx, updates)
+	} else {
+		saved, _, err = s.memoryManager.UpdateMemory(ctx, func(current string) string {
+			return memory.AppendReflection(current, trade)
+		})
+	}
+
+	if err != nil {
+		log.WithError(err).Warn("Failed to write trade reflection into memory")
+		s.replyMsg(ctx, session, fmt.Sprintf("Failed to write trade reflection into memory: %s", err.Error()))
+		return
+	}
+
+	s.currentMemory = saved
+	log.WithField("trade", trade.ID).Info("Trade reflection written into memory")
+}
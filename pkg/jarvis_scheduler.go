@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c9s/bbgo/pkg/fixedpoint"
+	"github.com/c9s/bbgo/pkg/types"
+	"github.com/dop251/goja"
+	"github.com/google/uuid"
+
+	"github.com/yubing744/trading-gpt/pkg/memory"
+	ttypes "github.com/yubing744/trading-gpt/pkg/types"
+	"github.com/yubing744/trading-gpt/pkg/utils"
+)
+
+const (
+	DefaultTriggerCheck     = 5 * time.Second
+	DefaultTriggerExpiry    = 24 * time.Hour
+	DefaultMaxTriggerExpiry = 7 * 24 * time.Hour
+)
+
+// setupScheduler checks the triggers of scheduled commands between decision
+// cycles, price triggers on every kline update and time triggers on a ticker
+func (s *Strategy) setupScheduler(ctx context.Context) {
+	if s.Commands.TriggerCheck == 0 {
+		s.Commands.TriggerCheck = types.Duration(DefaultTriggerCheck)
+	}
+	if s.Commands.TriggerExpiry == 0 {
+		s.Commands.TriggerExpiry = types.Duration(DefaultTriggerExpiry)
+	}
+	if s.Commands.MaxTriggerExpiry == 0 {
+		s.Commands.MaxTriggerExpiry = types.Duration(DefaultMaxTriggerExpiry)
+	}
+
+	// Price updates are coalesced, a check in progress covers the updates it missed
+	priceUpdated := make(chan struct{}, 1)
+	if s.session != nil && s.session.MarketDataStream != nil {
+		s.session.MarketDataStream.OnKLine(types.KLineWith(s.Symbol, s.Interval, func(kline types.KLine) {
+			s.lastPrice.Store(kline.Close)
+
+			select {
+			case priceUpdated <- struct{}{}:
+			default:
+			}
+		}))
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.Commands.TriggerCheck.Duration())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-priceUpdated:
+				s.checkTriggers(ctx)
+			case <-ticker.C:
+				s.checkTriggers(ctx)
+			}
+		}
+	}()
+}
+
+// newPendingCommand builds the pending command of a next_commands entry,
+// a command with trigger waits for it instead of the next cycle
+func (s *Strategy) newPendingCommand(nc *ttypes.NextCommand) (*memory.PendingCommand, error) {
+	now := time.Now()
+	cmd := &memory.PendingCommand{
+		ID:          uuid.NewString(),
+		EntityID:    nc.EntityID,
+		CommandName: nc.CommandName,
+		Args:        nc.Args,
+		Status:      "pending",
+		RetryCount:  0,
+		MaxRetries:  1, // Default retry once
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if nc.Trigger == nil {
+		return cmd, nil
+	}
+
+	trigger, err := memory.NewCommandTrigger(nc.Trigger, now,
+		s.Commands.TriggerExpiry.Duration(), s.Commands.MaxTriggerExpiry.Duration())
+	if err != nil {
+		return nil, err
+	}
+
+	switch trigger.Type {
+	case memory.TriggerPrice:
+		if err := utils.ValidateCondition(trigger.Condition); err != nil {
+			return nil, err
+		}
+	case memory.TriggerTime:
+		if !trigger.At.After(now) {
+			return nil, fmt.Errorf("trigger time %s is in the past", nc.Trigger.At)
+		}
+	}
+
+	cmd.Trigger = trigger
+	return cmd, nil
+}
+
+// checkTriggers runs the commands whose price or time trigger fired and
+// expires the commands whose trigger can no longer fire
+func (s *Strategy) checkTriggers(ctx context.Context) {
+	price, hasPrice := s.lastPrice.Load().(fixedpoint.Value)
+
+	s.runTriggered(ctx, func(trigger *memory.CommandTrigger, now time.Time) (bool, string) {
+		switch trigger.Type {
+		case memory.TriggerTime:
+			return trigger.Due(now), fmt.Sprintf("time %s reached", trigger.At.UTC().Format(time.RFC3339))
+		case memory.TriggerPrice:
+			if !hasPrice {
+				return false, ""
+			}
+
+			fired, err := utils.EvalCondition(goja.New(), s.triggerKlines(), price, trigger.Condition)
+			if err != nil {
+				log.WithError(err).WithField("condition", trigger.Condition).Warn("Failed to evaluate price trigger")
+				return false, ""
+			}
+			return fired, fmt.Sprintf("%s at price %s", trigger.Condition, price.String())
+		}
+
+		return false, ""
+	})
+}
+
+// fireEventTriggers runs the commands waiting for an entity event
+func (s *Strategy) fireEventTriggers(ctx context.Context, eventType string) {
+	if s.commandMemory == nil {
+		return
+	}
+
+	s.runTriggered(ctx, func(trigger *memory.CommandTrigger, now time.Time) (bool, string) {
+		return trigger.Type == memory.TriggerEvent && trigger.Event == eventType, "event " + eventType
+	})
+}
+
+// runTriggered executes the triggered commands fire reports as due. The store
+// is reloaded under the command lock, so each command runs at most once.
+func (s *Strategy) runTriggered(ctx context.Context, fire func(trigger *memory.CommandTrigger, now time.Time) (bool, string)) {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+
+	commands, err := s.commandMemory.LoadPendingCommands()
+	if err != nil {
+		log.WithError(err).Warn("Failed to load pending commands")
+		return
+	}
+
+	now := time.Now()
+	changed := make([]*memory.PendingCommand, 0)
+	for _, cmd := range commands {
+		if cmd.Trigger == nil {
+			continue
+		}
+
+		if cmd.Trigger.Expired(now) {
+			s.expireCommand(ctx, cmd)
+			changed = append(changed, cmd)
+			continue
+		}
+
+		fired, reason := fire(cmd.Trigger, now)
+		if !fired {
+			continue
+		}
+
+		s.notifyAdmins(ctx, fmt.Sprintf("⏰ Trigger fired (%s): %s.%s", reason, cmd.EntityID, cmd.CommandName))
+		s.runPendingCommand(ctx, s.cycleSession, cmd)
+		changed = append(changed, cmd)
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	if err := s.commandMemory.SaveCommands(changed); err != nil {
+		log.WithError(err).Error("Failed to save command statuses")
+	}
+}
+
+// expireCommand drops a command whose trigger did not fire in time
+func (s *Strategy) expireCommand(ctx context.Context, cmd *memory.PendingCommand) {
+	cmd.Status = memory.CommandStatusExpired
+	cmd.Error = fmt.Sprintf("trigger expired: %s", cmd.Trigger.String())
+	cmd.UpdatedAt = time.Now()
+
+	s.notifyAdmins(ctx, fmt.Sprintf("⌛ Command expired: %s.%s (%s)", cmd.EntityID, cmd.CommandName, cmd.Trigger.String()))
+}
+
+// triggerKlines returns the klines of the last cycle for the price variables
+func (s *Strategy) triggerKlines() *types.KLineWindow {
+	if klines, ok := s.getKline(s.cycleSession); ok {
+		return klines
+	}
+
+	return &types.KLineWindow{}
+}
+
+// notifyAdmins replies to the admin sessions subscribed to the trading cycle
+func (s *Strategy) notifyAdmins(ctx context.Context, msg string) {
+	s.replyMsg(ctx, s.cycleSession, msg)
+}
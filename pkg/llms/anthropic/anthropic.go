@@ -2,6 +2,7 @@ package anthropic
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -11,6 +12,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/callbacks"
 	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/llms/promptcache"
+	llmusage "github.com/yubing744/trading-gpt/pkg/llms/usage"
 )
 
 const DefaultTokenSample = 4000
@@ -28,6 +32,7 @@ type LLM struct {
 	model            string
 	thinkingBudget   int64
 	enableThinking   bool
+	promptCaching    bool
 }
 
 var _ llms.Model = (*LLM)(nil)
@@ -49,6 +54,7 @@ func New(model string, opts ...Option) (*LLM, error) {
 		client:         c,
 		thinkingBudget: options.thinkingBudget,
 		enableThinking: options.enableThinking,
+		promptCaching:  options.promptCaching,
 	}, nil
 }
 
@@ -92,20 +98,34 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 		opt(opts)
 	}
 
+	// The last message of the stable prefix gets a cache breakpoint
+	cacheIndex := -1
+	if o.promptCaching {
+		cacheIndex = promptcache.StablePrefix(ctx) - 1
+	}
+
 	// Build system prompt and messages
 	systemPrompt := ""
 	var anthropicMessages []anthropic.MessageParam
 
-	for _, mc := range messages {
+	for i, mc := range messages {
 		textMsg := joinTextParts(mc.Parts)
 
+		block := anthropic.NewTextBlock(textMsg)
+		if i == cacheIndex {
+			block.OfText.CacheControl = anthropic.NewCacheControlEphemeralParam()
+		}
+
 		switch mc.Role {
 		case llms.ChatMessageTypeSystem:
 			systemPrompt = textMsg
 		case llms.ChatMessageTypeAI:
-			anthropicMessages = append(anthropicMessages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(textMsg)))
+			anthropicMessages = append(anthropicMessages, anthropic.NewAssistantMessage(block))
 		case llms.ChatMessageTypeHuman:
-			anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(anthropic.NewTextBlock(textMsg)))
+			// Images go before the text that refers to them
+			blocks := imageBlocks(mc.Parts)
+			blocks = append(blocks, block)
+			anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(blocks...))
 		default:
 			return nil, fmt.Errorf("role %v not supported", mc.Role)
 		}
@@ -129,9 +149,14 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 	}
 
 	if systemPrompt != "" {
-		req.System = []anthropic.TextBlockParam{
-			{Text: systemPrompt},
+		system := anthropic.TextBlockParam{Text: systemPrompt}
+
+		// The system prompt is the same every request
+		if o.promptCaching {
+			system.CacheControl = anthropic.NewCacheControlEphemeralParam()
 		}
+
+		req.System = []anthropic.TextBlockParam{system}
 	}
 
 	// Add extended thinking configuration
@@ -160,10 +185,24 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 		}
 	}
 
+	usage := response.Usage
+	log.WithField("input_tokens", usage.InputTokens).
+		WithField("output_tokens", usage.OutputTokens).
+		WithField("cache_creation_input_tokens", usage.CacheCreationInputTokens).
+		WithField("cache_read_input_tokens", usage.CacheReadInputTokens).
+		Info("anthropic usage")
+
 	resp := &llms.ContentResponse{
 		Choices: []*llms.ContentChoice{
 			{
 				Content: content,
+				GenerationInfo: map[string]any{
+					llmusage.InfoPromptTokens:             int(usage.InputTokens),
+					llmusage.InfoCompletionTokens:         int(usage.OutputTokens),
+					llmusage.InfoCacheCreationInputTokens: int(usage.CacheCreationInputTokens),
+					llmusage.InfoCacheReadInputTokens:     int(usage.CacheReadInputTokens),
+					"TotalTokens":                         int(usage.InputTokens + usage.OutputTokens),
+				},
 			},
 		},
 	}
@@ -171,6 +210,16 @@ func (o *LLM) GenerateContent(ctx context.Context, messages []llms.MessageConten
 	return resp, nil
 }
 
+func imageBlocks(parts []llms.ContentPart) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0)
+	for _, part := range parts {
+		if binaryPart, ok := part.(llms.BinaryContent); ok {
+			blocks = append(blocks, anthropic.NewImageBlockBase64(binaryPart.MIMEType, base64.StdEncoding.EncodeToString(binaryPart.Data)))
+		}
+	}
+	return blocks
+}
+
 func joinTextParts(parts []llms.ContentPart) string {
 	text := ""
 	for _, part := range parts {
@@ -0,0 +1,113 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/llms/promptcache"
+)
+
+func TestGenerateContentPromptCaching(t *testing.T) {
+	var request map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"id": "msg_1",
+			"type": "message",
+			"role": "assistant",
+			"model": "claude-sonnet-4-0",
+			"content": [{"type": "text", "text": "{}"}],
+			"stop_reason": "end_turn",
+			"usage": {
+				"input_tokens": 200,
+				"output_tokens": 50,
+				"cache_creation_input_tokens": 0,
+				"cache_read_input_tokens": 3000
+			}
+		}`)
+	}))
+	defer server.Close()
+
+	llm, err := New("claude-sonnet-4-0", WithToken("sk-ant-test-token"), WithBaseURL(server.URL), WithPromptCaching(true))
+	assert.NoError(t, err)
+
+	ctx := promptcache.WithStablePrefix(context.Background(), 2)
+	resp, err := llm.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "background"),
+		llms.TextParts(llms.ChatMessageTypeHuman, "instructions"),
+		llms.TextParts(llms.ChatMessageTypeHuman, "klines"),
+	})
+	assert.NoError(t, err)
+
+	system := request["system"].([]interface{})[0].(map[string]interface{})
+	assert.NotNil(t, system["cache_control"])
+
+	messages := request["messages"].([]interface{})
+	assert.Len(t, messages, 2)
+
+	instructions := messages[0].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "ephemeral", instructions["cache_control"].(map[string]interface{})["type"])
+
+	klines := messages[1].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	assert.Nil(t, klines["cache_control"])
+
+	info := resp.Choices[0].GenerationInfo
+	assert.Equal(t, 200, info["PromptTokens"])
+	assert.Equal(t, 3000, info["CacheReadInputTokens"])
+}
+
+func TestGenerateContentImages(t *testing.T) {
+	var request map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"id": "msg_1",
+			"type": "message",
+			"role": "assistant",
+			"model": "claude-sonnet-4-0",
+			"content": [{"type": "text", "text": "{}"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 1200, "output_tokens": 50}
+		}`)
+	}))
+	defer server.Close()
+
+	llm, err := New("claude-sonnet-4-0", WithToken("sk-ant-test-token"), WithBaseURL(server.URL))
+	assert.NoError(t, err)
+
+	_, err = llm.GenerateContent(context.Background(), []llms.MessageContent{
+		{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{
+				llms.BinaryContent{MIMEType: "image/png", Data: []byte("png")},
+				llms.TextContent{Text: "chart"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	content := request["messages"].([]interface{})[0].(map[string]interface{})["content"].([]interface{})
+	assert.Len(t, content, 2)
+
+	image := content[0].(map[string]interface{})
+	assert.Equal(t, "image", image["type"])
+	source := image["source"].(map[string]interface{})
+	assert.Equal(t, "image/png", source["media_type"])
+	assert.Equal(t, "cG5n", source["data"])
+	assert.Equal(t, "chart", content[1].(map[string]interface{})["text"])
+}
@@ -9,6 +9,7 @@ type options struct {
 	baseURL        string
 	thinkingBudget int64
 	enableThinking bool
+	promptCaching  bool
 }
 
 type Option func(*options)
@@ -48,3 +49,11 @@ func WithThinking(enabled bool) Option {
 		}
 	}
 }
+
+// WithPromptCaching enables cache breakpoints on the system prompt and the
+// stable message prefix, see promptcache.WithStablePrefix.
+func WithPromptCaching(enabled bool) Option {
+	return func(opts *options) {
+		opts.promptCaching = enabled
+	}
+}
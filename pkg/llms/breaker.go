@@ -0,0 +1,110 @@
+package llms
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFailureThreshold = 3
+	DefaultOpenTimeout      = 5 * time.Minute
+	DefaultCallTimeout      = 3 * time.Minute
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker skips a provider after consecutive failures. Once the open
+// timeout elapsed a single probe call is let through, its result closes or
+// reopens the breaker.
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	state       string
+	failures    int
+	openedAt    time.Time
+	now         func() time.Time
+	lock        sync.Mutex
+}
+
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+
+	if openTimeout <= 0 {
+		openTimeout = DefaultOpenTimeout
+	}
+
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       BreakerClosed,
+		now:         time.Now,
+	}
+}
+
+// Allow reports whether a call may be made now
+func (b *CircuitBreaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// The probe is still in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// Success records a successful call and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed call and opens the breaker past the threshold or
+// when the probe failed
+func (b *CircuitBreaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Cancel records a call the caller gave up on. It says nothing about the
+// provider, an abandoned probe lets the next call probe again.
+func (b *CircuitBreaker) Cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+// State returns closed, open or half_open
+func (b *CircuitBreaker) State() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.state
+}
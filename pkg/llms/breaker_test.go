@@ -0,0 +1,64 @@
+package llms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, BreakerClosed, breaker.State())
+
+	breaker.Success()
+	breaker.Failure()
+	assert.True(t, breaker.Allow())
+	breaker.Failure()
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// A single probe once the open timeout elapsed
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// A failed probe reopens the breaker
+	breaker.Failure()
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	breaker.Success()
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.True(t, breaker.Allow())
+}
+
+func TestCircuitBreakerCancelledProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+
+	// The caller gave up on the probe, the next call probes again
+	breaker.Cancel()
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+
+	// Cancelling a call of a closed breaker changes nothing
+	breaker.Success()
+	breaker.Cancel()
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/google/generative-ai-go/genai"
 	"github.com/tmc/langchaingo/llms"
 	"google.golang.org/api/iterator"
+
+	"github.com/yubing744/trading-gpt/pkg/llms/usage"
 )
 
 var (
@@ -154,6 +156,31 @@ func convertCandidates(candidates []*genai.Candidate) (*llms.ContentResponse, er
 	return &contentResponse, nil
 }
 
+// convertResponse converts the candidates of a response and adds its token usage
+func convertResponse(resp *genai.GenerateContentResponse) (*llms.ContentResponse, error) {
+	contentResponse, err := convertCandidates(resp.Candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	addUsage(contentResponse, resp.UsageMetadata)
+	return contentResponse, nil
+}
+
+// addUsage reports token usage in the generation info, cached prompt tokens
+// are reported separately from the uncached ones
+func addUsage(contentResponse *llms.ContentResponse, metadata *genai.UsageMetadata) {
+	if metadata == nil {
+		return
+	}
+
+	for _, choice := range contentResponse.Choices {
+		choice.GenerationInfo[usage.InfoPromptTokens] = int(metadata.PromptTokenCount - metadata.CachedContentTokenCount)
+		choice.GenerationInfo[usage.InfoCompletionTokens] = int(metadata.CandidatesTokenCount)
+		choice.GenerationInfo[usage.InfoCacheReadInputTokens] = int(metadata.CachedContentTokenCount)
+	}
+}
+
 // convertParts converts between a sequence of langchain parts and genai parts.
 func convertParts(parts []llms.ContentPart) ([]genai.Part, error) {
 	convertedParts := make([]genai.Part, 0, len(parts))
@@ -241,7 +268,7 @@ func generateFromSingleMessage(ctx context.Context, model *genai.GenerativeModel
 		if len(resp.Candidates) == 0 {
 			return nil, ErrNoContentInResponse
 		}
-		return convertCandidates(resp.Candidates)
+		return convertResponse(resp)
 	}
 	iter := model.GenerateContentStream(ctx, convertedParts...)
 	return convertAndStreamFromIterator(ctx, iter, opts)
@@ -279,7 +306,7 @@ func generateFromMessages(ctx context.Context, model *genai.GenerativeModel, mes
 		if len(resp.Candidates) == 0 {
 			return nil, ErrNoContentInResponse
 		}
-		return convertCandidates(resp.Candidates)
+		return convertResponse(resp)
 	}
 	iter := session.SendMessageStream(ctx, reqContent.Parts...)
 	return convertAndStreamFromIterator(ctx, iter, opts)
@@ -294,6 +321,7 @@ func convertAndStreamFromIterator(ctx context.Context, iter *genai.GenerateConte
 	candidate := &genai.Candidate{
 		Content: &genai.Content{},
 	}
+	var usageMetadata *genai.UsageMetadata
 DoStream:
 	for {
 		resp, err := iter.Next()
@@ -304,6 +332,10 @@ DoStream:
 			return nil, fmt.Errorf("error in stream mode: %w", err)
 		}
 
+		if resp.UsageMetadata != nil {
+			usageMetadata = resp.UsageMetadata
+		}
+
 		if len(resp.Candidates) != 1 {
 			return nil, fmt.Errorf("expect single candidate in stream mode; got %v", len(resp.Candidates))
 		}
@@ -328,7 +360,13 @@ DoStream:
 		}
 	}
 
-	return convertCandidates([]*genai.Candidate{candidate})
+	contentResponse, err := convertCandidates([]*genai.Candidate{candidate})
+	if err != nil {
+		return nil, err
+	}
+
+	addUsage(contentResponse, usageMetadata)
+	return contentResponse, nil
 }
 
 // convertTools converts from a list of langchaingo tools to a list of genai
@@ -2,181 +2,366 @@ package llms
 
 import (
 	"context"
-	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
 
 	"github.com/yubing744/trading-gpt/pkg/config"
-	"github.com/yubing744/trading-gpt/pkg/llms/anthropic"
-	"github.com/yubing744/trading-gpt/pkg/llms/googleai"
-
-	openaix "github.com/yubing744/trading-gpt/pkg/llms/openai"
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+	"github.com/yubing744/trading-gpt/pkg/llms/tokenizer"
+	"github.com/yubing744/trading-gpt/pkg/llms/usage"
 )
 
 var log = logrus.WithField("module", "llm_manager")
 
+// ErrDailyCapExceeded is returned when the daily spend cap is reached and cycles are skipped
+var ErrDailyCapExceeded = errors.New("daily llm spend cap exceeded")
+
+// llmInstance is a named instance of a provider type
+type llmInstance struct {
+	name    string
+	typ     string
+	model   string
+	llm     llms.Model
+	vision  bool
+	breaker *CircuitBreaker
+}
+
 type LLMManager struct {
-	cfg      *config.LLMConfig
-	llms     map[string]llms.Model
-	primary  string
-	secondly string
+	cfg         *config.LLMConfig
+	llms        map[string]*llmInstance
+	chain       []string
+	routes      map[string][]string
+	callTimeout time.Duration
+	usage       *usage.Tracker
 }
 
 func NewLLMManager(cfg *config.LLMConfig) *LLMManager {
+	chain := cfg.Chain
+	if len(chain) == 0 {
+		chain = make([]string, 0, 2)
+		for _, name := range []string{cfg.Primary, cfg.Secondly} {
+			if name != "" && (len(chain) == 0 || chain[0] != name) {
+				chain = append(chain, name)
+			}
+		}
+	}
+
+	callTimeout := DefaultCallTimeout
+	if cfg.CircuitBreaker != nil && cfg.CircuitBreaker.CallTimeout > 0 {
+		callTimeout = cfg.CircuitBreaker.CallTimeout.Duration()
+	}
+
 	return &LLMManager{
-		cfg:      cfg,
-		llms:     make(map[string]llms.Model, 0),
-		primary:  cfg.Primary,
-		secondly: cfg.Secondly,
+		cfg:         cfg,
+		llms:        make(map[string]*llmInstance, 0),
+		chain:       chain,
+		routes:      make(map[string][]string, 0),
+		callTimeout: callTimeout,
+		usage:       usage.NewTracker(cfg.Usage),
 	}
 }
 
 func (mgr *LLMManager) Init() error {
+	err := mgr.usage.Load()
+	if err != nil {
+		log.WithError(err).Warn("load llm usage error")
+	}
 
-	// init openai model
+	// The legacy provider sections are instances named after their type
+	legacyTypes := make([]string, 0)
+	legacy := make(map[string]config.LLMProviderConfig, 0)
 	if mgr.cfg.OpenAI != nil {
-		openAICfg := mgr.cfg.OpenAI
+		legacyTypes = append(legacyTypes, ProviderOpenAI)
+		legacy[ProviderOpenAI] = mgr.cfg.OpenAI
+	}
+	if mgr.cfg.Anthropic != nil {
+		legacyTypes = append(legacyTypes, ProviderAnthropic)
+		legacy[ProviderAnthropic] = mgr.cfg.Anthropic
+	}
+	if mgr.cfg.GoogleAI != nil {
+		legacyTypes = append(legacyTypes, ProviderGoogleAI)
+		legacy[ProviderGoogleAI] = mgr.cfg.GoogleAI
+	}
+	if mgr.cfg.Ollama != nil {
+		legacyTypes = append(legacyTypes, ProviderOllama)
+		legacy[ProviderOllama] = mgr.cfg.Ollama
+	}
 
-		token := os.Getenv("LLM_OPENAI_TOKEN")
-		if token == "" {
-			return errors.New("AGENT_OPENAI_TOKEN not set in .env.local")
+	for _, typ := range legacyTypes {
+		err := mgr.addInstance(typ, typ, legacy[typ])
+		if err != nil {
+			return err
 		}
-		openAICfg.Token = token
-
-		opts := make([]openai.Option, 0)
-		opts = append(opts, openai.WithToken(openAICfg.Token))
-		opts = append(opts, openai.WithModel(openAICfg.Model))
+	}
 
-		if openAICfg.BaseURL != "" {
-			opts = append(opts, openai.WithBaseURL(openAICfg.BaseURL))
+	for _, instanceCfg := range mgr.cfg.Providers {
+		factory, ok := GetProvider(instanceCfg.Type)
+		if !ok {
+			return errors.Errorf("llm %s: unknown provider type %s, registered: %v", instanceCfg.Name, instanceCfg.Type, ProviderTypes())
 		}
 
-		noSystemRole := false
-		if openAICfg.NoSystemRole != nil {
-			noSystemRole = *openAICfg.NoSystemRole
+		providerCfg, err := decodeProviderConfig(factory, instanceCfg.Config)
+		if err != nil {
+			return errors.Wrapf(err, "llm %s: invalid config", instanceCfg.Name)
 		}
 
-		llm, err := openaix.New(noSystemRole, opts...)
+		err = mgr.addInstance(instanceCfg.Name, instanceCfg.Type, providerCfg)
 		if err != nil {
-			return errors.Wrap(err, "New openai fail")
+			return err
 		}
-
-		mgr.llms["openai"] = llm
 	}
 
-	// init anthropic model
-	if mgr.cfg.Anthropic != nil {
-		anthropicCfg := mgr.cfg.Anthropic
+	mgr.chain = mgr.configured(mgr.chain)
+	log.WithField("chain", mgr.chain).Info("llm chain")
 
-		token := os.Getenv("LLM_ANTHROPIC_TOKEN")
-		if token == "" {
-			return errors.New("LLM_ANTHROPIC_TOKEN not set in .env.local")
+	for taskType, chain := range mgr.cfg.Routes {
+		if !task.IsValid(taskType) {
+			return errors.Errorf("llm route for unknown task %s, known: %v", taskType, task.Tasks)
 		}
-		anthropicCfg.Token = token
 
-		opts := make([]anthropic.Option, 0)
-		opts = append(opts, anthropic.WithToken(anthropicCfg.Token))
+		mgr.routes[taskType] = mgr.configured(chain)
+		log.WithField("task", taskType).WithField("chain", mgr.routes[taskType]).Info("llm route")
+	}
 
-		if anthropicCfg.ExtendedThinking {
-			opts = append(opts, anthropic.WithThinkingBudget(anthropicCfg.ThinkingBudget))
-		}
+	return nil
+}
 
-		llm, err := anthropic.New(anthropicCfg.Model, opts...)
-		if err != nil {
-			return errors.Wrap(err, "New anthropic AI fail")
+// configured drops the names of a chain that are not configured
+func (mgr *LLMManager) configured(names []string) []string {
+	chain := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := mgr.llms[name]; !ok {
+			log.WithField("llm", name).Warn("llm in chain not configured, skipped")
+			continue
 		}
 
-		mgr.llms["anthropic"] = llm
+		chain = append(chain, name)
 	}
 
-	// init google AI model
-	if mgr.cfg.GoogleAI != nil {
-		googleAICfg := mgr.cfg.GoogleAI
+	return chain
+}
 
-		apiKey := os.Getenv("LLM_GOOGLEAI_APIKEY")
-		if apiKey == "" {
-			return errors.New("LLM_GOOGLEAI_APIKEY not set in .env.local")
-		}
-		googleAICfg.APIKey = apiKey
+// ChainFor returns the fallback chain of a task type
+func (mgr *LLMManager) ChainFor(taskType string) []string {
+	chain, ok := mgr.routes[taskType]
+	if !ok || len(chain) == 0 {
+		chain = mgr.chain
+	}
 
-		opts := make([]googleai.Option, 0)
-		opts = append(opts, googleai.WithAPIKey(googleAICfg.APIKey))
-		opts = append(opts, googleai.WithDefaultModel(googleAICfg.Model))
+	return append([]string{}, chain...)
+}
 
-		llm, err := googleai.New(context.Background(), opts...)
-		if err != nil {
-			return errors.Wrap(err, "New anthropic AI fail")
-		}
+func (mgr *LLMManager) addInstance(name string, typ string, providerCfg config.LLMProviderConfig) error {
+	if name == "" {
+		return errors.Errorf("llm of type %s has no name", typ)
+	}
 
-		mgr.llms["googleai"] = llm
+	if _, ok := mgr.llms[name]; ok {
+		return errors.Errorf("llm %s defined twice", name)
 	}
 
-	// init ollama model
-	if mgr.cfg.Ollama != nil {
-		ollamaCfg := mgr.cfg.Ollama
+	factory, ok := GetProvider(typ)
+	if !ok {
+		return errors.Errorf("llm %s: unknown provider type %s", name, typ)
+	}
 
-		opts := make([]ollama.Option, 0)
-		opts = append(opts, ollama.WithServerURL(ollamaCfg.ServerURL))
-		opts = append(opts, ollama.WithModel(ollamaCfg.Model))
+	llm, err := factory.New(name, providerCfg)
+	if err != nil {
+		return errors.Wrapf(err, "llm %s: create fail", name)
+	}
 
-		llm, err := ollama.New(opts...)
-		if err != nil {
-			return errors.Wrap(err, "New ollama AI fail")
-		}
+	threshold, openTimeout := 0, time.Duration(0)
+	if mgr.cfg.CircuitBreaker != nil {
+		threshold = mgr.cfg.CircuitBreaker.FailureThreshold
+		openTimeout = mgr.cfg.CircuitBreaker.OpenTimeout.Duration()
+	}
 
-		mgr.llms["ollama"] = llm
+	vision := factory.Vision
+	if override, ok := mgr.cfg.Vision[name]; ok {
+		vision = override
+	}
+
+	mgr.llms[name] = &llmInstance{
+		name:    name,
+		typ:     typ,
+		model:   providerCfg.ModelName(),
+		llm:     llm,
+		vision:  vision,
+		breaker: NewCircuitBreaker(threshold, openTimeout),
 	}
 
 	return nil
 }
 
+// GetLLM returns the first llm of the chain
 func (mgr *LLMManager) GetLLM() (llms.Model, error) {
-	llm, ok := mgr.llms[mgr.primary]
-	if !ok {
+	if len(mgr.chain) == 0 {
 		return nil, errors.New("no primary llm")
 	}
 
-	return llm, nil
+	return mgr.llms[mgr.chain[0]].llm, nil
 }
 
-func (mgr *LLMManager) GetSecondlyLLM() (llms.Model, error) {
-	llm, ok := mgr.llms[mgr.secondly]
+// Chain returns the names of the fallback chain in order
+func (mgr *LLMManager) Chain() []string {
+	return append([]string{}, mgr.chain...)
+}
+
+// BreakerState returns the circuit breaker state of the named llm
+func (mgr *LLMManager) BreakerState(name string) string {
+	inst, ok := mgr.llms[name]
 	if !ok {
-		return nil, errors.New("no secondly llm")
+		return ""
 	}
 
-	return llm, nil
+	return inst.breaker.State()
+}
+
+// Tokenizer returns the tokenizer matching the decision LLM
+func (mgr *LLMManager) Tokenizer() tokenizer.Tokenizer {
+	return mgr.TokenizerFor(task.Decision)
+}
+
+// TokenizerFor returns the tokenizer matching the first LLM of a task type
+func (mgr *LLMManager) TokenizerFor(taskType string) tokenizer.Tokenizer {
+	chain := mgr.ChainFor(taskType)
+	if len(chain) == 0 {
+		return tokenizer.ForProvider("", "")
+	}
+
+	inst := mgr.llms[chain[0]]
+	return tokenizer.ForProvider(inst.typ, inst.model)
+}
+
+func (mgr *LLMManager) modelOf(name string) string {
+	inst, ok := mgr.llms[name]
+	if !ok {
+		return ""
+	}
+
+	return inst.model
+}
+
+// Usage returns the usage tracker of all LLM calls
+func (mgr *LLMManager) Usage() *usage.Tracker {
+	return mgr.usage
 }
 
 // GenerateContent asks the model to generate content from a sequence of
 // messages. It's the most general interface for multi-modal LLMs that support
-// chat-like interactions.
+// chat-like interactions. The llms of the chain routed for the task of ctx
+// are tried in order, skipping those whose circuit breaker is open.
 func (mgr *LLMManager) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
-	llm, err := mgr.GetLLM()
-	if err != nil {
-		return nil, errors.Wrap(err, "get llm fail")
+	chain := mgr.ChainFor(task.FromContext(ctx))
+	if len(chain) == 0 {
+		return nil, errors.New("no primary llm")
 	}
 
-	resp, err := llm.GenerateContent(ctx, messages, options...)
-	if err != nil {
-		log.WithError(err).WithField("model", mgr.primary).Error("GenerateContent_fail_by_primary_model")
+	if mgr.usage.OverCap() {
+		if mgr.usage.OverCapAction() == usage.OverCapSkip || len(chain) < 2 {
+			return nil, ErrDailyCapExceeded
+		}
+
+		log.WithField("cost", mgr.usage.TodayCost()).
+			WithField("chain", chain[1:]).
+			Warn("daily spend cap reached, downgrade to fallback models")
+
+		chain = chain[1:]
+	}
+
+	var lastErr error
+	for _, name := range chain {
+		inst := mgr.llms[name]
+
+		if !inst.breaker.Allow() {
+			log.WithField("model", name).Warn("circuit breaker open, skip model")
+			lastErr = errors.Errorf("llm %s circuit breaker open", name)
+			continue
+		}
+
+		resp, err := mgr.generate(ctx, inst, messages, options...)
+		if err != nil {
+			// The caller gave up, which says nothing about the provider
+			if ctx.Err() != nil {
+				inst.breaker.Cancel()
+				return nil, errors.Wrapf(err, "llm %s fail", name)
+			}
+
+			inst.breaker.Failure()
+			log.WithError(err).
+				WithField("model", name).
+				WithField("breaker", inst.breaker.State()).
+				Error("GenerateContent_fail")
+
+			lastErr = errors.Wrapf(err, "llm %s fail", name)
+			continue
+		}
+
+		inst.breaker.Success()
+		mgr.recordUsage(ctx, name, resp)
+		setModel(resp, name)
+		return resp, nil
+	}
+
+	return nil, errors.Wrap(lastErr, "all llms in chain failed")
+}
+
+func (mgr *LLMManager) generate(ctx context.Context, inst *llmInstance, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	callCtx, cancel := context.WithTimeout(ctx, mgr.callTimeout)
+	defer cancel()
+
+	if !inst.vision {
+		messages = withoutImages(messages)
+	}
+
+	return inst.llm.GenerateContent(callCtx, messages, options...)
+}
+
+// withoutImages drops the image parts for models without vision, messages
+// left without parts are dropped
+func withoutImages(messages []llms.MessageContent) []llms.MessageContent {
+	filtered := make([]llms.MessageContent, 0, len(messages))
+	for _, msg := range messages {
+		parts := make([]llms.ContentPart, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch part.(type) {
+			case llms.BinaryContent, llms.ImageURLContent:
+				continue
+			}
 
-		llm2, err2 := mgr.GetSecondlyLLM()
-		if err2 != nil {
-			return nil, errors.Wrap(err2, "get secondly fail")
+			parts = append(parts, part)
 		}
 
-		resp2, err := llm2.GenerateContent(ctx, messages, options...)
-		setModel(resp2, mgr.secondly)
-		return resp2, err
+		if len(parts) > 0 {
+			filtered = append(filtered, llms.MessageContent{Role: msg.Role, Parts: parts})
+		}
 	}
 
-	setModel(resp, mgr.primary)
-	return resp, nil
+	return filtered
+}
+
+// recordUsage prices the usage reported by the provider and adds the cost to
+// the generation info of the response
+func (mgr *LLMManager) recordUsage(ctx context.Context, name string, resp *llms.ContentResponse) {
+	if resp == nil || len(resp.Choices) == 0 {
+		return
+	}
+
+	u := usage.NewTokenUsage(resp.Choices[0].GenerationInfo)
+	if u == nil {
+		return
+	}
+
+	mgr.usage.Record(ctx, name, mgr.modelOf(name), u)
+
+	for _, choice := range resp.Choices {
+		if choice.GenerationInfo != nil {
+			choice.GenerationInfo[usage.InfoCost] = u.Cost
+		}
+	}
 }
 
 func setModel(resp *llms.ContentResponse, model string) {
@@ -199,22 +384,5 @@ func setModel(resp *llms.ContentResponse, model string) {
 // the [GenerateFromSinglePrompt] function which provides a similar capability
 // to Call and is built on top of the new interface.
 func (mgr *LLMManager) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
-	llm, err := mgr.GetLLM()
-	if err != nil {
-		return "", errors.Wrap(err, "get llm fail")
-	}
-
-	result, err := llm.Call(ctx, prompt, options...)
-	if err != nil {
-		log.WithError(err).WithField("model", mgr.primary).Error("Call_fail_by_primary_model")
-
-		llm2, err2 := mgr.GetSecondlyLLM()
-		if err2 != nil {
-			return "", errors.Wrap(err2, "get secondly fail")
-		}
-
-		return llm2.Call(ctx, prompt, options...)
-	}
-
-	return result, nil
+	return llms.GenerateFromSinglePrompt(ctx, mgr, prompt, options...)
 }
@@ -0,0 +1,230 @@
+package llms
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+)
+
+type fakeConfig struct {
+	Model string `json:"model"`
+	Fail  bool   `json:"fail"`
+}
+
+func (cfg *fakeConfig) ModelName() string {
+	return cfg.Model
+}
+
+type fakeLLM struct {
+	name  string
+	fail  bool
+	calls int
+}
+
+func (llm *fakeLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	llm.calls++
+	if llm.fail {
+		return nil, errors.New("provider down")
+	}
+
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{Content: "from " + llm.name}},
+	}, nil
+}
+
+func (llm *fakeLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, llm, prompt, options...)
+}
+
+func newFakeManager(t *testing.T, chain []string, providers ...*config.LLMInstanceConfig) (*LLMManager, map[string]*fakeLLM) {
+	fakes := make(map[string]*fakeLLM, 0)
+
+	RegisterProvider("fake", &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &fakeConfig{} },
+		New: func(name string, cfg config.LLMProviderConfig) (llms.Model, error) {
+			llm := &fakeLLM{name: name, fail: cfg.(*fakeConfig).Fail}
+			fakes[name] = llm
+			return llm, nil
+		},
+	})
+
+	mgr := NewLLMManager(&config.LLMConfig{
+		Chain:     chain,
+		Providers: providers,
+		CircuitBreaker: &config.LLMCircuitBreakerConfig{
+			FailureThreshold: 2,
+		},
+		Usage: &config.LLMUsageConfig{
+			StatePath: filepath.Join(t.TempDir(), "llm_usage.json"),
+		},
+	})
+	assert.NoError(t, mgr.Init())
+
+	return mgr, fakes
+}
+
+func fakeInstance(name string, fail bool) *config.LLMInstanceConfig {
+	return &config.LLMInstanceConfig{
+		Name:   name,
+		Type:   "fake",
+		Config: map[string]interface{}{"model": name + "-model", "fail": fail},
+	}
+}
+
+func TestLLMManagerChain(t *testing.T) {
+	mgr, fakes := newFakeManager(t,
+		[]string{"deepseek", "missing", "vllm", "local"},
+		fakeInstance("deepseek", true),
+		fakeInstance("vllm", true),
+		fakeInstance("local", false),
+	)
+
+	assert.Equal(t, []string{"deepseek", "vllm", "local"}, mgr.Chain())
+	assert.Equal(t, "deepseek-model", mgr.modelOf("deepseek"))
+
+	resp, err := mgr.GenerateContent(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "from local", resp.Choices[0].Content)
+	assert.Equal(t, "local", resp.Choices[0].GenerationInfo["model"])
+
+	// Failing providers are skipped once their breaker opens
+	_, err = mgr.GenerateContent(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, BreakerOpen, mgr.BreakerState("deepseek"))
+
+	_, err = mgr.GenerateContent(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fakes["deepseek"].calls)
+	assert.Equal(t, 2, fakes["vllm"].calls)
+	assert.Equal(t, 3, fakes["local"].calls)
+}
+
+func TestLLMManagerAllFailed(t *testing.T) {
+	mgr, _ := newFakeManager(t, []string{"a", "b"}, fakeInstance("a", true), fakeInstance("b", true))
+
+	_, err := mgr.GenerateContent(context.Background(), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "llm b fail")
+}
+
+func TestLLMManagerCancelledProbe(t *testing.T) {
+	mgr, fakes := newFakeManager(t, []string{"a"}, fakeInstance("a", true))
+
+	for i := 0; i < 2; i++ {
+		_, err := mgr.GenerateContent(context.Background(), nil)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, BreakerOpen, mgr.BreakerState("a"))
+
+	later := time.Now().Add(DefaultOpenTimeout)
+	mgr.llms["a"].breaker.now = func() time.Time { return later }
+
+	// The probe of a cancelled call does not stay in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := mgr.GenerateContent(ctx, nil)
+	assert.Error(t, err)
+	assert.Equal(t, BreakerOpen, mgr.BreakerState("a"))
+
+	_, err = mgr.GenerateContent(context.Background(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, 4, fakes["a"].calls)
+}
+
+func TestLLMManagerInitErrors(t *testing.T) {
+	RegisterProvider("fake", &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &fakeConfig{} },
+		New: func(name string, cfg config.LLMProviderConfig) (llms.Model, error) {
+			return &fakeLLM{name: name}, nil
+		},
+	})
+
+	cases := map[string][]*config.LLMInstanceConfig{
+		"unknown type":  {{Name: "a", Type: "nope"}},
+		"unknown field": {{Name: "a", Type: "fake", Config: map[string]interface{}{"modle": "x"}}},
+		"duplicate":     {fakeInstance("a", false), fakeInstance("a", false)},
+		"no name":       {{Type: "fake"}},
+	}
+
+	for name, providers := range cases {
+		mgr := NewLLMManager(&config.LLMConfig{Providers: providers})
+		assert.Error(t, mgr.Init(), name)
+	}
+}
+
+func TestNewLLMManagerLegacyChain(t *testing.T) {
+	mgr := NewLLMManager(&config.LLMConfig{Primary: "openai", Secondly: "ollama"})
+	assert.Equal(t, []string{"openai", "ollama"}, mgr.chain)
+
+	mgr = NewLLMManager(&config.LLMConfig{Primary: "openai", Secondly: "openai"})
+	assert.Equal(t, []string{"openai"}, mgr.chain)
+}
+
+func TestLLMManagerRoutes(t *testing.T) {
+	RegisterProvider("fake", &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &fakeConfig{} },
+		New: func(name string, cfg config.LLMProviderConfig) (llms.Model, error) {
+			return &fakeLLM{name: name}, nil
+		},
+	})
+
+	mgr := NewLLMManager(&config.LLMConfig{
+		Chain: []string{"claude", "deepseek"},
+		Routes: map[string][]string{
+			task.NewsSummarization: {"ollama"},
+			task.Decision:          {"deepseek", "claude"},
+		},
+		Providers: []*config.LLMInstanceConfig{
+			fakeInstance("claude", false),
+			fakeInstance("deepseek", false),
+			fakeInstance("ollama", false),
+		},
+	})
+	assert.NoError(t, mgr.Init())
+
+	generate := func(ctx context.Context) string {
+		resp, err := mgr.GenerateContent(ctx, nil)
+		assert.NoError(t, err)
+		return resp.Choices[0].Content
+	}
+
+	assert.Equal(t, "from claude", generate(context.Background()))
+	assert.Equal(t, "from ollama", generate(task.WithTask(context.Background(), task.NewsSummarization)))
+	assert.Equal(t, "from deepseek", generate(task.WithTask(context.Background(), task.Decision)))
+	assert.Equal(t, "from claude", generate(task.WithTask(context.Background(), task.ChatQA)))
+
+	mgr = NewLLMManager(&config.LLMConfig{
+		Routes: map[string][]string{"trading": {"claude"}},
+	})
+	assert.Error(t, mgr.Init())
+}
+
+func TestWithoutImages(t *testing.T) {
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "system"),
+		{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{
+				llms.BinaryContent{MIMEType: "image/png", Data: []byte{1}},
+				llms.TextContent{Text: "chart"},
+			},
+		},
+		{
+			Role:  llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{llms.ImageURLContent{URL: "https://example.com/chart.png"}},
+		},
+	}
+
+	filtered := withoutImages(messages)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, []llms.ContentPart{llms.TextContent{Text: "chart"}}, filtered[1].Parts)
+	assert.Len(t, messages[1].Parts, 2)
+}
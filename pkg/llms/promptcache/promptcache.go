@@ -0,0 +1,18 @@
+package promptcache
+
+import "context"
+
+type stablePrefixKey struct{}
+
+// WithStablePrefix marks the first n messages of the next request, counting the
+// system message, as identical across requests. Providers supporting prompt
+// caching place a cache breakpoint at the end of that prefix.
+func WithStablePrefix(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, stablePrefixKey{}, n)
+}
+
+// StablePrefix returns the number of leading stable messages, 0 if unknown
+func StablePrefix(ctx context.Context) int {
+	n, _ := ctx.Value(stablePrefixKey{}).(int)
+	return n
+}
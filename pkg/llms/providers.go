@@ -0,0 +1,161 @@
+package llms
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/llms/anthropic"
+	"github.com/yubing744/trading-gpt/pkg/llms/googleai"
+
+	openaix "github.com/yubing744/trading-gpt/pkg/llms/openai"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderGoogleAI  = "googleai"
+	ProviderOllama    = "ollama"
+)
+
+func init() {
+	RegisterProvider(ProviderOpenAI, &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &config.OpenAIConfig{} },
+		New:       newOpenAI,
+	})
+
+	RegisterProvider(ProviderAnthropic, &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &config.AnthropicConfig{} },
+		New:       newAnthropic,
+		Vision:    true,
+	})
+
+	RegisterProvider(ProviderGoogleAI, &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &config.GoogleAIConfig{} },
+		New:       newGoogleAI,
+		Vision:    true,
+	})
+
+	RegisterProvider(ProviderOllama, &ProviderFactory{
+		NewConfig: func() config.LLMProviderConfig { return &config.OllamaConfig{} },
+		New:       newOllama,
+	})
+}
+
+var envNamePattern = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// providerSecret returns the LLM_<NAME>_<KEY> env var of an instance, or the
+// configured value if the env var is not set
+func providerSecret(name string, key string, configured string) (string, string) {
+	envName := "LLM_" + envNamePattern.ReplaceAllString(strings.ToUpper(name), "_") + "_" + key
+
+	value := os.Getenv(envName)
+	if value == "" {
+		value = configured
+	}
+
+	return value, envName
+}
+
+func newOpenAI(name string, providerCfg config.LLMProviderConfig) (llms.Model, error) {
+	openAICfg := providerCfg.(*config.OpenAIConfig)
+
+	token, envName := providerSecret(name, "TOKEN", openAICfg.Token)
+	if token == "" {
+		return nil, errors.Errorf("%s not set in .env.local", envName)
+	}
+	openAICfg.Token = token
+
+	opts := make([]openai.Option, 0)
+	opts = append(opts, openai.WithToken(openAICfg.Token))
+	opts = append(opts, openai.WithModel(openAICfg.Model))
+
+	if openAICfg.BaseURL != "" {
+		opts = append(opts, openai.WithBaseURL(openAICfg.BaseURL))
+	}
+
+	noSystemRole := false
+	if openAICfg.NoSystemRole != nil {
+		noSystemRole = *openAICfg.NoSystemRole
+	}
+
+	llm, err := openaix.New(noSystemRole, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "New openai fail")
+	}
+
+	return llm, nil
+}
+
+func newAnthropic(name string, providerCfg config.LLMProviderConfig) (llms.Model, error) {
+	anthropicCfg := providerCfg.(*config.AnthropicConfig)
+
+	token, envName := providerSecret(name, "TOKEN", anthropicCfg.Token)
+	if token == "" {
+		return nil, errors.Errorf("%s not set in .env.local", envName)
+	}
+	anthropicCfg.Token = token
+
+	opts := make([]anthropic.Option, 0)
+	opts = append(opts, anthropic.WithToken(anthropicCfg.Token))
+
+	if anthropicCfg.ExtendedThinking {
+		opts = append(opts, anthropic.WithThinkingBudget(anthropicCfg.ThinkingBudget))
+	}
+
+	promptCaching := true
+	if anthropicCfg.PromptCaching != nil {
+		promptCaching = *anthropicCfg.PromptCaching
+	}
+	opts = append(opts, anthropic.WithPromptCaching(promptCaching))
+
+	llm, err := anthropic.New(anthropicCfg.Model, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "New anthropic AI fail")
+	}
+
+	return llm, nil
+}
+
+func newGoogleAI(name string, providerCfg config.LLMProviderConfig) (llms.Model, error) {
+	googleAICfg := providerCfg.(*config.GoogleAIConfig)
+
+	apiKey, envName := providerSecret(name, "APIKEY", googleAICfg.APIKey)
+	if apiKey == "" {
+		return nil, errors.Errorf("%s not set in .env.local", envName)
+	}
+	googleAICfg.APIKey = apiKey
+
+	opts := make([]googleai.Option, 0)
+	opts = append(opts, googleai.WithAPIKey(googleAICfg.APIKey))
+	opts = append(opts, googleai.WithDefaultModel(googleAICfg.Model))
+
+	llm, err := googleai.New(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "New google AI fail")
+	}
+
+	return llm, nil
+}
+
+func newOllama(name string, providerCfg config.LLMProviderConfig) (llms.Model, error) {
+	ollamaCfg := providerCfg.(*config.OllamaConfig)
+
+	opts := make([]ollama.Option, 0)
+	opts = append(opts, ollama.WithServerURL(ollamaCfg.ServerURL))
+	opts = append(opts, ollama.WithModel(ollamaCfg.Model))
+
+	llm, err := ollama.New(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "New ollama AI fail")
+	}
+
+	return llm, nil
+}
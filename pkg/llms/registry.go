@@ -0,0 +1,83 @@
+package llms
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+// ProviderFactory creates the LLM instances of one provider type
+type ProviderFactory struct {
+	// NewConfig returns an empty config schema, the instance config is decoded into it
+	NewConfig func() config.LLMProviderConfig
+	// New creates the model of the named instance from its decoded config
+	New func(name string, cfg config.LLMProviderConfig) (llms.Model, error)
+	// Vision tells whether the models accept image parts, overridable per instance
+	Vision bool
+}
+
+var (
+	providers     = make(map[string]*ProviderFactory, 0)
+	providersLock sync.RWMutex
+)
+
+// RegisterProvider registers a provider type, a later registration replaces an earlier one
+func RegisterProvider(typ string, factory *ProviderFactory) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+
+	providers[typ] = factory
+}
+
+// GetProvider returns the factory of a provider type
+func GetProvider(typ string) (*ProviderFactory, bool) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	factory, ok := providers[typ]
+	return factory, ok
+}
+
+// ProviderTypes returns the registered provider types
+func ProviderTypes() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	types := make([]string, 0, len(providers))
+	for typ := range providers {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// decodeProviderConfig decodes an instance config into the schema of its
+// provider, unknown fields are rejected to catch typos early
+func decodeProviderConfig(factory *ProviderFactory, raw map[string]interface{}) (config.LLMProviderConfig, error) {
+	cfg := factory.NewConfig()
+	if len(raw) == 0 {
+		return cfg, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal provider config fail")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode provider config fail")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,39 @@
+package task
+
+import "context"
+
+// Task types of LLM calls, each can be routed to its own models
+const (
+	Decision          = "decision"
+	MemoryCompaction  = "memory_compaction"
+	NewsSummarization = "news_summarization"
+	Reflection        = "reflection"
+	ChatQA            = "chat_qa"
+)
+
+// Tasks lists the known task types
+var Tasks = []string{Decision, MemoryCompaction, NewsSummarization, Reflection, ChatQA}
+
+type taskKey struct{}
+
+// WithTask tags the LLM calls made with ctx with a task type
+func WithTask(ctx context.Context, task string) context.Context {
+	return context.WithValue(ctx, taskKey{}, task)
+}
+
+// FromContext returns the task type of ctx, empty if untagged
+func FromContext(ctx context.Context) string {
+	task, _ := ctx.Value(taskKey{}).(string)
+	return task
+}
+
+// IsValid reports whether task is a known task type
+func IsValid(task string) bool {
+	for _, t := range Tasks {
+		if t == task {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package tokenizer
+
+import (
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+const DefaultEncoding = "cl100k_base"
+
+// TiktokenTokenizer counts tokens with the BPE encoding of an OpenAI model.
+// The encoding is loaded on first use, if it can not be loaded (e.g. offline
+// without TIKTOKEN_CACHE_DIR) the tokenizer falls back to an approximation.
+type TiktokenTokenizer struct {
+	model    string
+	once     sync.Once
+	encoding *tiktoken.Tiktoken
+	fallback Tokenizer
+}
+
+func NewTiktokenTokenizer(model string) *TiktokenTokenizer {
+	return &TiktokenTokenizer{
+		model:    model,
+		fallback: NewApproxTokenizer("openai-approx", 4.0, 2.5, 1.0),
+	}
+}
+
+func (t *TiktokenTokenizer) Name() string {
+	return "tiktoken"
+}
+
+func (t *TiktokenTokenizer) load() {
+	encoding, err := tiktoken.EncodingForModel(t.model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(DefaultEncoding)
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("model", t.model).Warn("load tiktoken encoding fail, use approximation")
+		return
+	}
+
+	t.encoding = encoding
+}
+
+func (t *TiktokenTokenizer) Count(text string) int {
+	t.once.Do(t.load)
+
+	if t.encoding == nil {
+		return t.fallback.Count(text)
+	}
+
+	return len(t.encoding.EncodeOrdinary(text))
+}
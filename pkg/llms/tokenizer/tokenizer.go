@@ -0,0 +1,176 @@
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.WithField("llms", "tokenizer")
+
+// Tokenizer counts the tokens a provider charges for a text
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// ForProvider returns the tokenizer of an LLM provider as named in the llm
+// config (openai, anthropic, googleai, ollama). OpenAI models use the real BPE
+// encoding, the others an approximation calibrated for their tokenizers.
+func ForProvider(provider string, model string) Tokenizer {
+	switch provider {
+	case "openai":
+		return NewTiktokenTokenizer(model)
+	case "anthropic":
+		return NewApproxTokenizer("anthropic", 3.5, 2.0, 1.2)
+	case "googleai":
+		return NewApproxTokenizer("googleai", 4.0, 2.5, 1.0)
+	case "ollama":
+		return NewApproxTokenizer("ollama", 3.8, 2.0, 1.3)
+	default:
+		return NewApproxTokenizer("default", 3.5, 2.0, 1.2)
+	}
+}
+
+// ApproxTokenizer estimates tokens from character classes. Trading prompts are
+// dominated by numbers which tokenize much denser than prose, so letters,
+// digits/punctuation and non-ASCII runes are weighted separately.
+type ApproxTokenizer struct {
+	name           string
+	charsPerToken  float64 // letters and whitespace per token
+	digitsPerToken float64 // digits and punctuation per token
+	tokensPerRune  float64 // tokens per non-ASCII rune, e.g. CJK
+}
+
+func NewApproxTokenizer(name string, charsPerToken float64, digitsPerToken float64, tokensPerRune float64) *ApproxTokenizer {
+	return &ApproxTokenizer{
+		name:           name,
+		charsPerToken:  charsPerToken,
+		digitsPerToken: digitsPerToken,
+		tokensPerRune:  tokensPerRune,
+	}
+}
+
+func (t *ApproxTokenizer) Name() string {
+	return t.name
+}
+
+func (t *ApproxTokenizer) Count(text string) int {
+	chars, digits, others := 0, 0, 0
+
+	for _, r := range text {
+		switch {
+		case r > unicode.MaxASCII:
+			others++
+		case unicode.IsLetter(r) || unicode.IsSpace(r):
+			chars++
+		default:
+			digits++
+		}
+	}
+
+	tokens := float64(chars)/t.charsPerToken + float64(digits)/t.digitsPerToken + float64(others)*t.tokensPerRune
+	return int(math.Ceil(tokens))
+}
+
+// CountAll sums the tokens of texts
+func CountAll(t Tokenizer, texts ...string) int {
+	total := 0
+	for _, text := range texts {
+		total += t.Count(text)
+	}
+
+	return total
+}
+
+// KeepTail shortens text to at most maxTokens keeping its first line as a header
+// and as many of the latest lines as fit, since series data puts the newest
+// values last. A single long line keeps its tail.
+func KeepTail(t Tokenizer, text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	if t.Count(text) <= maxTokens {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > 1 {
+		header := lines[0] + "\n..."
+		budget := maxTokens - t.Count(header) - 1
+
+		kept := make([]string, 0)
+		for i := len(lines) - 1; i > 0 && budget > 0; i-- {
+			cost := t.Count(lines[i]) + 1
+			if cost > budget {
+				if len(kept) == 0 {
+					kept = append(kept, keepRunesTail(t, lines[i], budget))
+				}
+				break
+			}
+
+			kept = append(kept, lines[i])
+			budget -= cost
+		}
+
+		if len(kept) > 0 {
+			for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+				kept[i], kept[j] = kept[j], kept[i]
+			}
+
+			return header + "\n" + strings.Join(kept, "\n")
+		}
+	}
+
+	return keepRunesTail(t, text, maxTokens)
+}
+
+// KeepHead shortens text to at most maxTokens keeping its beginning
+func KeepHead(t Tokenizer, text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	if t.Count(text) <= maxTokens {
+		return text
+	}
+
+	runes := []rune(text)
+	n := searchLength(len(runes), func(n int) bool {
+		return t.Count(string(runes[:n])+"...") <= maxTokens
+	})
+
+	return string(runes[:n]) + "..."
+}
+
+func keepRunesTail(t Tokenizer, text string, maxTokens int) string {
+	runes := []rune(text)
+	n := searchLength(len(runes), func(n int) bool {
+		return t.Count("..."+string(runes[len(runes)-n:])) <= maxTokens
+	})
+
+	if n == 0 {
+		return ""
+	}
+
+	return "..." + string(runes[len(runes)-n:])
+}
+
+// searchLength returns the largest n in [0, max] for which fits(n) holds,
+// assuming fits is monotonic
+func searchLength(max int, fits func(n int) bool) int {
+	lo, hi := 0, max
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo
+}
@@ -0,0 +1,53 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproxTokenizer(t *testing.T) {
+	tok := NewApproxTokenizer("test", 4, 2, 1)
+
+	assert.Equal(t, 0, tok.Count(""))
+	assert.Equal(t, 2, tok.Count("abcdefgh"))
+	assert.Equal(t, 3, tok.Count("2.6543"))
+	assert.Equal(t, 2, tok.Count("交易"))
+
+	// Numbers cost more tokens than prose of the same length
+	assert.Greater(t, tok.Count("2.66 2.65 2.65 2.64"), tok.Count("the market is calm"))
+}
+
+func TestForProvider(t *testing.T) {
+	assert.Equal(t, "anthropic", ForProvider("anthropic", "").Name())
+	assert.Equal(t, "tiktoken", ForProvider("openai", "gpt-4o").Name())
+	assert.Equal(t, "default", ForProvider("unknown", "").Name())
+}
+
+func TestKeepTail(t *testing.T) {
+	tok := NewApproxTokenizer("test", 1, 1, 1)
+
+	text := "KLine data changed:\nline-1\nline-2\nline-3"
+	assert.Equal(t, text, KeepTail(tok, text, 100))
+
+	trimmed := KeepTail(tok, text, 35)
+	assert.True(t, strings.HasPrefix(trimmed, "KLine data changed:\n..."))
+	assert.True(t, strings.HasSuffix(trimmed, "line-3"))
+	assert.NotContains(t, trimmed, "line-1")
+	assert.LessOrEqual(t, tok.Count(trimmed), 35)
+
+	series := "RSI: [1 2 3 4 5 6 7 8 9]"
+	trimmed = KeepTail(tok, series, 10)
+	assert.True(t, strings.HasSuffix(trimmed, "8 9]"))
+	assert.LessOrEqual(t, tok.Count(trimmed), 10)
+
+	assert.Equal(t, "", KeepTail(tok, series, 0))
+}
+
+func TestKeepHead(t *testing.T) {
+	tok := NewApproxTokenizer("test", 1, 1, 1)
+
+	trimmed := KeepHead(tok, "remember: trend following works", 12)
+	assert.Equal(t, "remember:...", trimmed)
+}
@@ -0,0 +1,331 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+var log = logrus.WithField("llms", "usage")
+
+const (
+	DefaultStatePath     = "data/llm_usage.json"
+	DefaultRetentionDays = 90
+
+	OverCapDowngrade = "downgrade"
+	OverCapSkip      = "skip"
+
+	dayLayout = "2006-01-02"
+)
+
+// DayUsage accumulates the usage of one UTC day
+type DayUsage struct {
+	Date   string                 `json:"date"`
+	Calls  int                    `json:"calls"`
+	Total  TokenUsage             `json:"total"`
+	Models map[string]*TokenUsage `json:"models"`
+}
+
+// CycleUsage accumulates the usage of one decision cycle
+type CycleUsage struct {
+	Calls int
+	Total TokenUsage
+	lock  sync.Mutex
+}
+
+func (c *CycleUsage) add(u *TokenUsage) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.Calls++
+	c.Total.Add(u)
+}
+
+func (c *CycleUsage) String() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return fmt.Sprintf("%d calls, %s", c.Calls, c.Total.String())
+}
+
+type cycleKey struct{}
+
+// WithCycle starts accumulating the usage of the LLM calls made with the returned ctx
+func WithCycle(ctx context.Context) (context.Context, *CycleUsage) {
+	cycle := &CycleUsage{}
+	return context.WithValue(ctx, cycleKey{}, cycle), cycle
+}
+
+// Tracker prices token usage and accumulates it per cycle, model and day.
+// Daily totals are persisted so the spend cap survives restarts.
+type Tracker struct {
+	prices        map[string]*config.LLMPriceConfig
+	dailyCap      float64
+	overCapAction string
+	statePath     string
+	retentionDays int
+	days          map[string]*DayUsage
+	now           func() time.Time
+	lock          sync.Mutex
+}
+
+func NewTracker(cfg *config.LLMUsageConfig) *Tracker {
+	if cfg == nil {
+		cfg = &config.LLMUsageConfig{}
+	}
+
+	overCapAction := cfg.OverCapAction
+	if overCapAction == "" {
+		overCapAction = OverCapDowngrade
+	}
+
+	statePath := cfg.StatePath
+	if statePath == "" {
+		statePath = DefaultStatePath
+	}
+
+	retentionDays := cfg.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = DefaultRetentionDays
+	}
+
+	prices := cfg.Prices
+	if prices == nil {
+		prices = make(map[string]*config.LLMPriceConfig, 0)
+	}
+
+	return &Tracker{
+		prices:        prices,
+		dailyCap:      cfg.DailyCap,
+		overCapAction: overCapAction,
+		statePath:     statePath,
+		retentionDays: retentionDays,
+		days:          make(map[string]*DayUsage, 0),
+		now:           time.Now,
+	}
+}
+
+// Load restores the persisted usage, a missing file is not an error
+func (t *Tracker) Load() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	data, err := os.ReadFile(t.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	days := make([]*DayUsage, 0)
+	if err := json.Unmarshal(data, &days); err != nil {
+		return fmt.Errorf("failed to parse usage file: %w", err)
+	}
+
+	for _, day := range days {
+		if day.Models == nil {
+			day.Models = make(map[string]*TokenUsage, 0)
+		}
+
+		t.days[day.Date] = day
+	}
+
+	return nil
+}
+
+// Price returns the cost in USD of usage by model, priced by model name or,
+// if not listed, by provider name. Unpriced models cost nothing.
+func (t *Tracker) Price(provider string, model string, u *TokenUsage) float64 {
+	price, ok := t.prices[model]
+	if !ok {
+		price, ok = t.prices[provider]
+	}
+
+	if !ok || price == nil {
+		return 0
+	}
+
+	return (float64(u.InputTokens)*price.Input +
+		float64(u.OutputTokens)*price.Output +
+		float64(u.CacheCreationInputTokens)*price.CacheWrite +
+		float64(u.CacheReadInputTokens)*price.CacheRead) / 1_000_000
+}
+
+// Record prices u, sets its cost and adds it to the day, the model and the
+// cycle of ctx, if any
+func (t *Tracker) Record(ctx context.Context, provider string, model string, u *TokenUsage) {
+	u.Cost = t.Price(provider, model, u)
+
+	if cycle, ok := ctx.Value(cycleKey{}).(*CycleUsage); ok {
+		cycle.add(u)
+	}
+
+	key := provider
+	if model != "" {
+		key = provider + "/" + model
+	}
+
+	t.lock.Lock()
+	day := t.today()
+	day.Calls++
+	day.Total.Add(u)
+
+	modelUsage, ok := day.Models[key]
+	if !ok {
+		modelUsage = &TokenUsage{}
+		day.Models[key] = modelUsage
+	}
+	modelUsage.Add(u)
+
+	err := t.save()
+	t.lock.Unlock()
+
+	if err != nil {
+		log.WithError(err).Warn("save llm usage error")
+	}
+
+	if t.dailyCap > 0 && t.TodayCost() >= t.dailyCap {
+		log.WithField("cost", t.TodayCost()).
+			WithField("cap", t.dailyCap).
+			Warn("daily llm spend cap reached")
+	}
+}
+
+// Today returns a copy of today's usage
+func (t *Tracker) Today() DayUsage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	day := t.today()
+
+	models := make(map[string]*TokenUsage, len(day.Models))
+	for key, u := range day.Models {
+		copied := *u
+		models[key] = &copied
+	}
+
+	return DayUsage{
+		Date:   day.Date,
+		Calls:  day.Calls,
+		Total:  day.Total,
+		Models: models,
+	}
+}
+
+// TodayCost returns today's spend in USD
+func (t *Tracker) TodayCost() float64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.today().Total.Cost
+}
+
+// DailyCap returns the daily spend cap in USD, 0 means none
+func (t *Tracker) DailyCap() float64 {
+	return t.dailyCap
+}
+
+// OverCap reports whether today's spend reached the daily cap. It is checked
+// before a call and the cost is only known after it, so the calls started
+// under the cap can overshoot it by their cost.
+func (t *Tracker) OverCap() bool {
+	return t.dailyCap > 0 && t.TodayCost() >= t.dailyCap
+}
+
+// OverCapAction returns what to do past the cap: downgrade or skip
+func (t *Tracker) OverCapAction() string {
+	return t.overCapAction
+}
+
+func (t *Tracker) today() *DayUsage {
+	date := t.now().UTC().Format(dayLayout)
+
+	day, ok := t.days[date]
+	if !ok {
+		day = &DayUsage{
+			Date:   date,
+			Models: make(map[string]*TokenUsage, 0),
+		}
+		t.days[date] = day
+	}
+
+	return day
+}
+
+// save writes the usage of the retained days, the caller holds the lock
+func (t *Tracker) save() error {
+	cutoff := t.now().UTC().AddDate(0, 0, -t.retentionDays).Format(dayLayout)
+
+	days := make([]*DayUsage, 0, len(t.days))
+	for date, day := range t.days {
+		if date < cutoff {
+			delete(t.days, date)
+			continue
+		}
+
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	tempPath := t.statePath + ".tmp"
+	if err := writeFileSync(tempPath, data, 0644); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, t.statePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename usage file: %w", err)
+	}
+
+	// Persist the rename itself
+	if d, err := os.Open(filepath.Dir(t.statePath)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// writeFileSync writes data to path and flushes it to disk, so a crash after
+// the rename can't leave an empty usage file which would reset the spend
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,106 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+func newTestTracker(t *testing.T, dailyCap float64) *Tracker {
+	return NewTracker(&config.LLMUsageConfig{
+		Prices: map[string]*config.LLMPriceConfig{
+			"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+			"ollama":            {Input: 0, Output: 0},
+		},
+		DailyCap:  dailyCap,
+		StatePath: filepath.Join(t.TempDir(), "llm_usage.json"),
+	})
+}
+
+func TestTrackerPrice(t *testing.T) {
+	tracker := newTestTracker(t, 0)
+
+	u := &TokenUsage{
+		InputTokens:              1_000_000,
+		OutputTokens:             100_000,
+		CacheCreationInputTokens: 200_000,
+		CacheReadInputTokens:     1_000_000,
+	}
+
+	assert.InDelta(t, 3+1.5+0.75+0.3, tracker.Price("anthropic", "claude-3-5-sonnet", u), 1e-9)
+	assert.Equal(t, 0.0, tracker.Price("ollama", "mistral-nemo", u))
+	assert.Equal(t, 0.0, tracker.Price("openai", "unknown", u))
+}
+
+func TestTrackerRecord(t *testing.T) {
+	tracker := newTestTracker(t, 0)
+	ctx, cycle := WithCycle(context.Background())
+
+	u1 := &TokenUsage{InputTokens: 1000, OutputTokens: 100}
+	tracker.Record(ctx, "anthropic", "claude-3-5-sonnet", u1)
+	assert.InDelta(t, 0.0045, u1.Cost, 1e-9)
+
+	tracker.Record(ctx, "ollama", "mistral-nemo", &TokenUsage{InputTokens: 500, OutputTokens: 50})
+	tracker.Record(context.Background(), "anthropic", "claude-3-5-sonnet", &TokenUsage{InputTokens: 1000, OutputTokens: 100})
+
+	assert.Equal(t, 2, cycle.Calls)
+	assert.Equal(t, 1500, cycle.Total.InputTokens)
+	assert.InDelta(t, 0.0045, cycle.Total.Cost, 1e-9)
+
+	today := tracker.Today()
+	assert.Equal(t, 3, today.Calls)
+	assert.Equal(t, 2500, today.Total.InputTokens)
+	assert.InDelta(t, 0.009, tracker.TodayCost(), 1e-9)
+	assert.Equal(t, 2000, today.Models["anthropic/claude-3-5-sonnet"].InputTokens)
+	assert.Equal(t, 500, today.Models["ollama/mistral-nemo"].InputTokens)
+}
+
+func TestTrackerPersistence(t *testing.T) {
+	tracker := newTestTracker(t, 0)
+	tracker.Record(context.Background(), "anthropic", "claude-3-5-sonnet", &TokenUsage{InputTokens: 1000, OutputTokens: 100})
+
+	reloaded := NewTracker(&config.LLMUsageConfig{StatePath: tracker.statePath})
+	assert.NoError(t, reloaded.Load())
+	assert.Equal(t, 1, reloaded.Today().Calls)
+	assert.InDelta(t, 0.0045, reloaded.TodayCost(), 1e-9)
+
+	missing := NewTracker(&config.LLMUsageConfig{StatePath: filepath.Join(t.TempDir(), "missing.json")})
+	assert.NoError(t, missing.Load())
+}
+
+func TestTrackerRetention(t *testing.T) {
+	tracker := newTestTracker(t, 0)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.now = func() time.Time { return now.AddDate(0, 0, -100) }
+	tracker.Record(context.Background(), "ollama", "", &TokenUsage{InputTokens: 1})
+
+	tracker.now = func() time.Time { return now }
+	tracker.Record(context.Background(), "ollama", "", &TokenUsage{InputTokens: 1})
+
+	assert.Len(t, tracker.days, 1)
+	assert.Contains(t, tracker.Today().Models, "ollama")
+}
+
+func TestTrackerOverCap(t *testing.T) {
+	tracker := newTestTracker(t, 0.01)
+	assert.Equal(t, OverCapDowngrade, tracker.OverCapAction())
+	assert.False(t, tracker.OverCap())
+
+	tracker.Record(context.Background(), "anthropic", "claude-3-5-sonnet", &TokenUsage{InputTokens: 1000, OutputTokens: 100})
+	assert.False(t, tracker.OverCap())
+
+	tracker.Record(context.Background(), "anthropic", "claude-3-5-sonnet", &TokenUsage{InputTokens: 2000, OutputTokens: 200})
+	assert.True(t, tracker.OverCap())
+
+	tracker.now = func() time.Time { return time.Now().AddDate(0, 0, 1) }
+	assert.False(t, tracker.OverCap())
+
+	uncapped := newTestTracker(t, 0)
+	uncapped.Record(context.Background(), "anthropic", "claude-3-5-sonnet", &TokenUsage{InputTokens: 10_000_000})
+	assert.False(t, uncapped.OverCap())
+}
@@ -0,0 +1,93 @@
+package usage
+
+import "fmt"
+
+// GenerationInfo keys providers use to report token usage
+const (
+	InfoPromptTokens             = "PromptTokens" // Input tokens billed at the input price, cached tokens excluded where reported
+	InfoCompletionTokens         = "CompletionTokens"
+	InfoReasoningTokens          = "ReasoningTokens"
+	InfoCacheCreationInputTokens = "CacheCreationInputTokens"
+	InfoCacheReadInputTokens     = "CacheReadInputTokens"
+	InfoCost                     = "Cost"
+)
+
+// TokenUsage reports the tokens and cost of a generation
+type TokenUsage struct {
+	InputTokens              int     `json:"input_tokens"`
+	OutputTokens             int     `json:"output_tokens"`               // Includes thinking tokens
+	ThinkingTokens           int     `json:"thinking_tokens"`             // Reasoning tokens, where reported
+	CacheCreationInputTokens int     `json:"cache_creation_input_tokens"` // Cache miss, prefix written to the cache
+	CacheReadInputTokens     int     `json:"cache_read_input_tokens"`     // Cache hit, prefix read from the cache
+	Cost                     float64 `json:"cost"`                        // USD
+}
+
+// NewTokenUsage reads the token counts from the GenerationInfo of a langchaingo
+// content choice, it returns nil if the provider reported none
+func NewTokenUsage(info map[string]any) *TokenUsage {
+	if info == nil {
+		return nil
+	}
+
+	usage := &TokenUsage{}
+	found := false
+
+	fields := map[string]*int{
+		InfoPromptTokens:             &usage.InputTokens,
+		InfoCompletionTokens:         &usage.OutputTokens,
+		InfoReasoningTokens:          &usage.ThinkingTokens,
+		InfoCacheCreationInputTokens: &usage.CacheCreationInputTokens,
+		InfoCacheReadInputTokens:     &usage.CacheReadInputTokens,
+	}
+
+	for key, field := range fields {
+		switch val := info[key].(type) {
+		case int:
+			*field = val
+			found = true
+		case int32:
+			*field = int(val)
+			found = true
+		case int64:
+			*field = int(val)
+			found = true
+		case float64:
+			*field = int(val)
+			found = true
+		}
+	}
+
+	if cost, ok := info[InfoCost].(float64); ok {
+		usage.Cost = cost
+	}
+
+	if !found {
+		return nil
+	}
+
+	return usage
+}
+
+// Add accumulates other into u
+func (u *TokenUsage) Add(other *TokenUsage) {
+	if other == nil {
+		return
+	}
+
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.ThinkingTokens += other.ThinkingTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+	u.Cost += other.Cost
+}
+
+func (u *TokenUsage) String() string {
+	return fmt.Sprintf("input %d, output %d (thinking %d), cache read %d, cache write %d, cost $%.4f",
+		u.InputTokens,
+		u.OutputTokens,
+		u.ThinkingTokens,
+		u.CacheReadInputTokens,
+		u.CacheCreationInputTokens,
+		u.Cost)
+}
@@ -0,0 +1,28 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTokenUsage(t *testing.T) {
+	assert.Nil(t, NewTokenUsage(nil))
+	assert.Nil(t, NewTokenUsage(map[string]any{"model": "anthropic"}))
+
+	usage := NewTokenUsage(map[string]any{
+		"PromptTokens":             120,
+		"CompletionTokens":         int64(80),
+		"ReasoningTokens":          30,
+		"CacheCreationInputTokens": 0,
+		"CacheReadInputTokens":     float64(3000),
+		"Cost":                     0.25,
+	})
+
+	assert.Equal(t, 120, usage.InputTokens)
+	assert.Equal(t, 80, usage.OutputTokens)
+	assert.Equal(t, 30, usage.ThinkingTokens)
+	assert.Equal(t, 0, usage.CacheCreationInputTokens)
+	assert.Equal(t, 3000, usage.CacheReadInputTokens)
+	assert.Equal(t, 0.25, usage.Cost)
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/gofrs/flock"
 )
 
 // PendingCommand represents a command waiting to be executed
@@ -14,12 +18,15 @@ type PendingCommand struct {
 	EntityID    string            `json:"entity_id"`    // Target entity
 	CommandName string            `json:"command_name"` // Command/workflow name
 	Args        map[string]string `json:"args"`         // Parameters
-	Status      string            `json:"status"`       // pending/completed/failed
+	Status      string            `json:"status"`       // pending/completed/failed/expired
 	RetryCount  int               `json:"retry_count"`  // Current retry attempt
 	MaxRetries  int               `json:"max_retries"`  // Max retry limit
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
-	Error       string            `json:"error,omitempty"` // Error message if failed
+	Error       string            `json:"error,omitempty"`    // Error message if failed
+	Trigger     *CommandTrigger   `json:"trigger,omitempty"`  // Condition to wait for, nil runs next cycle
+	Output      string            `json:"output,omitempty"`   // Events the command emitted, as prompt text
+	Reported    bool              `json:"reported,omitempty"` // Whether the outcome was given to the agent
 }
 
 // CommandStore represents the structure of the commands JSON file
@@ -29,20 +36,32 @@ type CommandStore struct {
 	Failed    []*PendingCommand `json:"failed"`
 }
 
-// CommandMemory handles file-based command persistence
+// CommandMemory handles file-based command persistence. Every access holds a
+// file lock next to the store and writes are fsynced before the atomic rename,
+// so a crash leaves either the old or the new store.
 type CommandMemory struct {
 	commandPath string
+
+	mu   sync.Mutex
+	lock *flock.Flock
 }
 
 // NewCommandMemory creates a new command memory manager
 func NewCommandMemory(commandPath string) *CommandMemory {
 	return &CommandMemory{
 		commandPath: commandPath,
+		lock:        flock.New(commandPath + ".lock"),
 	}
 }
 
 // LoadPendingCommands loads pending commands from file
 func (cm *CommandMemory) LoadPendingCommands() ([]*PendingCommand, error) {
+	unlock, err := cm.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	store, err := cm.loadStore()
 	if err != nil {
 		return nil, err
@@ -61,6 +80,12 @@ func (cm *CommandMemory) LoadPendingCommands() ([]*PendingCommand, error) {
 
 // SaveCommands saves commands to file, organizing by status
 func (cm *CommandMemory) SaveCommands(commands []*PendingCommand) error {
+	unlock, err := cm.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Load existing store
 	store, err := cm.loadStore()
 	if err != nil {
@@ -106,6 +131,10 @@ func (cm *CommandMemory) SaveCommands(commands []*PendingCommand) error {
 					}
 				}
 			}
+		case CommandStatusExpired:
+			// The trigger never fired, keep it with the failed commands
+			cm.removeFromPending(store, cmd.ID)
+			store.Failed = append(store.Failed, cmd)
 		}
 	}
 
@@ -114,6 +143,12 @@ func (cm *CommandMemory) SaveCommands(commands []*PendingCommand) error {
 
 // ArchiveCompletedCommands removes old completed commands to keep file size manageable
 func (cm *CommandMemory) ArchiveCompletedCommands() error {
+	unlock, err := cm.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	store, err := cm.loadStore()
 	if err != nil {
 		return err
@@ -134,6 +169,60 @@ func (cm *CommandMemory) ArchiveCompletedCommands() error {
 	return cm.saveStore(store)
 }
 
+// TakeResults returns the commands finished since the last call, completed,
+// permanently failed or expired, and marks them reported
+func (cm *CommandMemory) TakeResults() ([]*PendingCommand, error) {
+	unlock, err := cm.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	store, err := cm.loadStore()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*PendingCommand, 0)
+	for _, list := range [][]*PendingCommand{store.Completed, store.Failed} {
+		for _, cmd := range list {
+			if !cmd.Reported {
+				cmd.Reported = true
+				results = append(results, cmd)
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].UpdatedAt.Before(results[j].UpdatedAt)
+	})
+
+	return results, cm.saveStore(store)
+}
+
+// acquire takes the in-process and the file lock of the store
+func (cm *CommandMemory) acquire() (func(), error) {
+	cm.mu.Lock()
+
+	if err := os.MkdirAll(filepath.Dir(cm.commandPath), 0700); err != nil {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("failed to create command directory: %w", err)
+	}
+	if err := cm.lock.Lock(); err != nil {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("failed to lock command file: %w", err)
+	}
+
+	return func() {
+		cm.lock.Unlock()
+		cm.mu.Unlock()
+	}, nil
+}
+
 // loadStore loads the command store from file
 func (cm *CommandMemory) loadStore() (*CommandStore, error) {
 	if _, err := os.Stat(cm.commandPath); os.IsNotExist(err) {
@@ -172,15 +261,9 @@ func (cm *CommandMemory) saveStore(store *CommandStore) error {
 		return fmt.Errorf("failed to marshal command store: %w", err)
 	}
 
-	// Atomic write: write to temp file with restrictive permissions, then rename
-	tempPath := cm.commandPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to write temp command file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, cm.commandPath); err != nil {
-		os.Remove(tempPath) // Clean up temp file on failure
-		return fmt.Errorf("failed to rename temp command file: %w", err)
+	// Atomic write with restrictive permissions
+	if err := writeFileAtomic(cm.commandPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write command file: %w", err)
 	}
 
 	return nil
@@ -1,8 +1,10 @@
 package memory
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -291,3 +293,66 @@ func TestCommandMemory_AtomicWrite(t *testing.T) {
 		t.Error("Command file should exist after atomic write")
 	}
 }
+
+func TestCommandMemory_TakeResults(t *testing.T) {
+	cm := NewCommandMemory(filepath.Join(t.TempDir(), "commands.json"))
+
+	now := time.Now()
+	done := &PendingCommand{ID: "done", EntityID: "fng", CommandName: "get_historical_index", Status: "completed",
+		MaxRetries: 1, CreatedAt: now, UpdatedAt: now, Output: "Historical Fear & Greed Index"}
+	retry := &PendingCommand{ID: "retry", EntityID: "coze", CommandName: "sentiment", Status: "failed",
+		RetryCount: 0, MaxRetries: 2, CreatedAt: now, UpdatedAt: now, Error: "timeout"}
+	if err := cm.SaveCommands([]*PendingCommand{{ID: "retry", Status: "pending"}}); err != nil {
+		t.Fatalf("Failed to save commands: %v", err)
+	}
+	if err := cm.SaveCommands([]*PendingCommand{done, retry}); err != nil {
+		t.Fatalf("Failed to save commands: %v", err)
+	}
+
+	results, err := cm.TakeResults()
+	if err != nil {
+		t.Fatalf("Failed to take results: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "done" || results[0].Output != "Historical Fear & Greed Index" {
+		t.Fatalf("Expected only the finished command with its output, got %+v", results)
+	}
+
+	results, _ = cm.TakeResults()
+	if len(results) != 0 {
+		t.Errorf("Expected results reported once, got %+v", results)
+	}
+}
+
+func TestCommandMemory_ConcurrentWriters(t *testing.T) {
+	commandPath := filepath.Join(t.TempDir(), "commands.json")
+
+	// Each writer has its own handle on the store, like separate processes
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		cm := NewCommandMemory(commandPath)
+		writer := i
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				err := cm.SaveCommands([]*PendingCommand{{
+					ID:     fmt.Sprintf("cmd-%d-%d", writer, j),
+					Status: "pending",
+				}})
+				if err != nil {
+					t.Errorf("Failed to save command: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	commands, err := NewCommandMemory(commandPath).LoadPendingCommands()
+	if err != nil {
+		t.Fatalf("Failed to load commands: %v", err)
+	}
+	if len(commands) != 40 {
+		t.Errorf("Expected no lost writes, got %d commands", len(commands))
+	}
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Trigger types of a scheduled command
+const (
+	TriggerPrice  = "price"  // Price expression checked on every price update
+	TriggerTime   = "time"   // Absolute time
+	TriggerCycles = "cycles" // After a number of decision cycles
+	TriggerEvent  = "event"  // Entity event, such as position_closed
+)
+
+// CommandStatusExpired is the status of a command whose trigger expired
+const CommandStatusExpired = "expired"
+
+// CommandTrigger is the condition a pending command waits for. A command
+// without trigger runs before the next decision cycle.
+type CommandTrigger struct {
+	Type       string     `json:"type"`
+	Condition  string     `json:"condition,omitempty"` // TriggerPrice expression
+	At         *time.Time `json:"at,omitempty"`        // TriggerTime
+	Cycles     int        `json:"cycles,omitempty"`    // TriggerCycles
+	CyclesSeen int        `json:"cycles_seen,omitempty"`
+	Event      string     `json:"event,omitempty"` // TriggerEvent
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// NewCommandTrigger converts the trigger of the model output, the expiry
+// defaults to defaultExpiry and is capped at maxExpiry. Price expressions
+// are validated by the caller.
+func NewCommandTrigger(t *types.CommandTrigger, now time.Time, defaultExpiry, maxExpiry time.Duration) (*CommandTrigger, error) {
+	trigger := &CommandTrigger{}
+	set := 0
+
+	if condition := strings.TrimSpace(t.Price); condition != "" {
+		trigger.Type = TriggerPrice
+		trigger.Condition = condition
+		set++
+	}
+	if at := strings.TrimSpace(t.At); at != "" {
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger time %q, use RFC3339: %w", at, err)
+		}
+		trigger.Type = TriggerTime
+		trigger.At = &parsed
+		set++
+	}
+	if t.Cycles != 0 {
+		if t.Cycles < 0 {
+			return nil, fmt.Errorf("invalid trigger cycles %d", t.Cycles)
+		}
+		trigger.Type = TriggerCycles
+		trigger.Cycles = t.Cycles
+		set++
+	}
+	if event := strings.TrimSpace(t.Event); event != "" {
+		trigger.Type = TriggerEvent
+		trigger.Event = event
+		set++
+	}
+
+	if set != 1 {
+		return nil, fmt.Errorf("a trigger needs exactly one of price, at, cycles and event")
+	}
+
+	expiry := defaultExpiry
+	if t.ExpiresIn != "" {
+		d, err := time.ParseDuration(t.ExpiresIn)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid trigger expires_in %q", t.ExpiresIn)
+		}
+		expiry = d
+	}
+	if maxExpiry > 0 && expiry > maxExpiry {
+		expiry = maxExpiry
+	}
+	trigger.ExpiresAt = now.Add(expiry)
+
+	if trigger.At != nil && trigger.At.After(trigger.ExpiresAt) {
+		trigger.ExpiresAt = *trigger.At
+		if maxExpiry > 0 && trigger.At.After(now.Add(maxExpiry)) {
+			return nil, fmt.Errorf("trigger time %s is beyond the maximum expiry of %s", t.At, maxExpiry)
+		}
+	}
+
+	return trigger, nil
+}
+
+// Expired reports whether the trigger can no longer fire
+func (t *CommandTrigger) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
+
+// Due reports whether a time trigger is due
+func (t *CommandTrigger) Due(now time.Time) bool {
+	return t.Type == TriggerTime && t.At != nil && !now.Before(*t.At)
+}
+
+// CountCycle counts a decision cycle and reports whether a cycles trigger is due
+func (t *CommandTrigger) CountCycle() bool {
+	if t.Type != TriggerCycles {
+		return false
+	}
+
+	t.CyclesSeen++
+	return t.CyclesSeen >= t.Cycles
+}
+
+// String describes the trigger
+func (t *CommandTrigger) String() string {
+	var text string
+	switch t.Type {
+	case TriggerPrice:
+		text = fmt.Sprintf("when %s", t.Condition)
+	case TriggerTime:
+		text = fmt.Sprintf("at %s", t.At.UTC().Format(time.RFC3339))
+	case TriggerCycles:
+		text = fmt.Sprintf("after %d cycles (%d seen)", t.Cycles, t.CyclesSeen)
+	case TriggerEvent:
+		text = fmt.Sprintf("on %s", t.Event)
+	default:
+		text = t.Type
+	}
+
+	return fmt.Sprintf("%s, expires %s", text, t.ExpiresAt.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func TestNewCommandTrigger(t *testing.T) {
+	now := time.Date(2025, 1, 23, 10, 0, 0, 0, time.UTC)
+
+	trigger, err := NewCommandTrigger(&types.CommandTrigger{Price: " close > 1.85 "}, now, 24*time.Hour, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create price trigger: %v", err)
+	}
+	if trigger.Type != TriggerPrice || trigger.Condition != "close > 1.85" {
+		t.Errorf("Unexpected price trigger: %+v", trigger)
+	}
+	if !trigger.ExpiresAt.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("Expected the default expiry, got %s", trigger.ExpiresAt)
+	}
+
+	trigger, err = NewCommandTrigger(&types.CommandTrigger{Cycles: 3, ExpiresIn: "100h"}, now, 24*time.Hour, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create cycles trigger: %v", err)
+	}
+	if !trigger.ExpiresAt.Equal(now.Add(48 * time.Hour)) {
+		t.Errorf("Expected the expiry capped, got %s", trigger.ExpiresAt)
+	}
+
+	trigger, err = NewCommandTrigger(&types.CommandTrigger{At: "2025-01-24T16:00:00Z"}, now, time.Hour, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create time trigger: %v", err)
+	}
+	if !trigger.ExpiresAt.Equal(*trigger.At) {
+		t.Errorf("Expected a time trigger to live until its time, got %s", trigger.ExpiresAt)
+	}
+	if trigger.Due(now) || !trigger.Due(trigger.At.Add(time.Second)) {
+		t.Error("Unexpected time trigger due state")
+	}
+
+	invalid := []*types.CommandTrigger{
+		{},
+		{Price: "close > 1", Event: "position_closed"},
+		{At: "tomorrow"},
+		{Cycles: -1},
+		{Event: "position_closed", ExpiresIn: "soon"},
+		{At: "2025-02-23T10:00:00Z"},
+	}
+	for _, tt := range invalid {
+		if _, err := NewCommandTrigger(tt, now, time.Hour, 48*time.Hour); err == nil {
+			t.Errorf("Expected trigger %+v to be rejected", tt)
+		}
+	}
+}
+
+func TestCommandTrigger_CountCycle(t *testing.T) {
+	trigger := &CommandTrigger{Type: TriggerCycles, Cycles: 2}
+	if trigger.CountCycle() {
+		t.Error("Expected the trigger to wait for the second cycle")
+	}
+	if !trigger.CountCycle() {
+		t.Error("Expected the trigger due on the second cycle")
+	}
+
+	event := &CommandTrigger{Type: TriggerEvent, Event: "position_closed"}
+	if event.CountCycle() {
+		t.Error("Expected cycles not to fire an event trigger")
+	}
+}
+
+func TestCommandMemory_ExpiredTrigger(t *testing.T) {
+	cm := NewCommandMemory(filepath.Join(t.TempDir(), "commands.json"))
+
+	now := time.Now()
+	cmd := &PendingCommand{
+		ID:          "cmd1",
+		EntityID:    "exchange",
+		CommandName: "open_long_position",
+		Status:      "pending",
+		MaxRetries:  1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Trigger:     &CommandTrigger{Type: TriggerPrice, Condition: "close > 1.85", ExpiresAt: now.Add(-time.Minute)},
+	}
+	if err := cm.SaveCommands([]*PendingCommand{cmd}); err != nil {
+		t.Fatalf("Failed to save commands: %v", err)
+	}
+
+	loaded, err := cm.LoadPendingCommands()
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("Expected 1 pending command, got %d (%v)", len(loaded), err)
+	}
+	if loaded[0].Trigger == nil || !loaded[0].Trigger.Expired(now) {
+		t.Fatalf("Expected the trigger persisted and expired, got %+v", loaded[0].Trigger)
+	}
+
+	loaded[0].Status = CommandStatusExpired
+	if err := cm.SaveCommands(loaded); err != nil {
+		t.Fatalf("Failed to save commands: %v", err)
+	}
+
+	store, err := cm.loadStore()
+	if err != nil {
+		t.Fatalf("Failed to load store: %v", err)
+	}
+	if len(store.Pending) != 0 || len(store.Failed) != 1 || store.Failed[0].Status != CommandStatusExpired {
+		t.Errorf("Expected the expired command moved to failed, got %+v", store)
+	}
+}
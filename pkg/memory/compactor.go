@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+)
+
+// Compactor consolidates memory content into at most maxWords words
+type Compactor interface {
+	Compact(ctx context.Context, content string, maxWords int) (string, error)
+}
+
+const compactPrompt = `You maintain the long-term memory of a crypto trading assistant. The memory below is over its limit of %d words.
+
+Rewrite it into at most %d words of markdown. Keep the existing headings and their order, and keep "- [key]" prefixes of keyed bullets. A memory without headings is organized into these sections:
+## Market Insights
+## Strategy Lessons
+## Mistakes To Avoid
+## Open Questions
+
+Rules:
+- Consolidate duplicated or overlapping points into one bullet.
+- Keep durable lessons even when they are old, drop stale details such as prices of past cycles.
+- Keep concrete numbers that still matter (levels, thresholds, win rates).
+- Write short bullets, no preamble, output only the markdown.
+
+Memory:
+%s`
+
+// LLMCompactor compacts memory with the memory_compaction llm route
+type LLMCompactor struct {
+	llm llms.Model
+}
+
+// NewLLMCompactor creates a compactor on llm
+func NewLLMCompactor(llm llms.Model) *LLMCompactor {
+	return &LLMCompactor{
+		llm: llm,
+	}
+}
+
+func (c *LLMCompactor) Compact(ctx context.Context, content string, maxWords int) (string, error) {
+	ctx = task.WithTask(ctx, task.MemoryCompaction)
+	result, err := llms.GenerateFromSinglePrompt(ctx, c.llm, fmt.Sprintf(compactPrompt, maxWords, maxWords, content))
+	if err != nil {
+		return "", fmt.Errorf("failed to compact memory: %w", err)
+	}
+
+	result = strings.TrimSpace(stripCodeFence(result))
+	if result == "" {
+		return "", fmt.Errorf("failed to compact memory: empty result")
+	}
+
+	return result + "\n", nil
+}
+
+// stripCodeFence removes a markdown code fence wrapping the whole text
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") {
+		return text
+	}
+
+	text = strings.TrimSuffix(text, "```")
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return text[i+1:]
+	}
+
+	return ""
+}
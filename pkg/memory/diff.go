@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 1
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script from a to b using the longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+func splitLines(content string) []string {
+	content = strings.TrimRight(content, "\n")
+	if content == "" {
+		return []string{}
+	}
+
+	return strings.Split(content, "\n")
+}
+
+// Diff returns a line diff from one memory content to another, removed
+// lines start with "-", added lines with "+" and skipped unchanged lines
+// are marked with "...". It returns an empty string when they are equal.
+func Diff(from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	// Keep changes and the unchanged lines near them
+	keep := make([]bool, len(ops))
+	changed := false
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+
+		changed = true
+		for k := i - diffContext; k <= i+diffContext; k++ {
+			if k >= 0 && k < len(ops) {
+				keep[k] = true
+			}
+		}
+	}
+
+	if !changed {
+		return ""
+	}
+
+	var text strings.Builder
+	skipped := false
+	for i, op := range ops {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+
+		if skipped {
+			text.WriteString("...\n")
+			skipped = false
+		}
+		text.WriteString(fmt.Sprintf("%c %s\n", op.kind, op.line))
+	}
+	if skipped {
+		text.WriteString("...\n")
+	}
+
+	return strings.TrimRight(text.String(), "\n")
+}
+
+// DeletedPercent returns the share of the words of from, in percent, which
+// no longer appear in to. Moved or reworded lines keep their common words.
+func DeletedPercent(from, to string) float64 {
+	counts := make(map[string]int)
+	total := 0
+	for _, word := range strings.Fields(strings.ToLower(from)) {
+		counts[word]++
+		total++
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	for _, word := range strings.Fields(strings.ToLower(to)) {
+		if counts[word] > 0 {
+			counts[word]--
+		}
+	}
+
+	deleted := 0
+	for _, count := range counts {
+		deleted += count
+	}
+
+	return float64(deleted) * 100 / float64(total)
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms/ollama"
+
+	"github.com/yubing744/trading-gpt/pkg/config"
+)
+
+// Embedder turns the text of a market snapshot into a vector, episodes are
+// only compared by embeddings of the same embedder
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+type embeddingClient interface {
+	CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// OllamaEmbedder embeds text with a local Ollama embedding model
+type OllamaEmbedder struct {
+	model  string
+	client embeddingClient
+}
+
+// NewOllamaEmbedder creates an embedder for the model served by Ollama
+func NewOllamaEmbedder(cfg *config.OllamaConfig) (*OllamaEmbedder, error) {
+	opts := make([]ollama.Option, 0)
+	if cfg.ServerURL != "" {
+		opts = append(opts, ollama.WithServerURL(cfg.ServerURL))
+	}
+	opts = append(opts, ollama.WithModel(cfg.Model))
+
+	client, err := ollama.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama embedder: %w", err)
+	}
+
+	return &OllamaEmbedder{
+		model:  cfg.Model,
+		client: client,
+	}, nil
+}
+
+func (e *OllamaEmbedder) Name() string {
+	return "ollama:" + e.model
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vectors, err := e.client.CreateEmbedding(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding: %w", err)
+	}
+
+	if len(vectors) == 0 || len(vectors[0]) == 0 {
+		return nil, fmt.Errorf("empty embedding from %s", e.Name())
+	}
+
+	embedding := make([]float64, len(vectors[0]))
+	for i, v := range vectors[0] {
+		embedding[i] = float64(v)
+	}
+
+	return embedding, nil
+}
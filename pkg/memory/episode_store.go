@@ -0,0 +1,315 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Episode is a decision cycle with the market it saw and what came of it
+type Episode struct {
+	ID        string          `json:"id"`
+	Symbol    string          `json:"symbol"`
+	Timestamp time.Time       `json:"timestamp"`
+	Close     float64         `json:"close"`               // Last close when the decision was made
+	Summary   string          `json:"summary"`             // Human readable market snapshot
+	Features  []float64       `json:"features"`            // MarketSnapshot.Features
+	Embedder  string          `json:"embedder,omitempty"`  // Name of the embedder of Embedding
+	Embedding []float64       `json:"embedding,omitempty"` // Text embedding of Summary
+	Position  string          `json:"position,omitempty"`  // long/short when a position was open
+	Decision  string          `json:"decision"`            // Action JSON, or wait
+	Reasoning string          `json:"reasoning,omitempty"` // Short reasoning given by the model
+	InTrade   bool            `json:"in_trade"`            // Resolved by the close of the position instead of the forward return
+	Outcome   *EpisodeOutcome `json:"outcome,omitempty"`
+
+	ForwardReturn *float64   `json:"forward_return,omitempty"` // Price change in percent after the outcome horizon
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+// EpisodeOutcome is the result of the position an episode traded
+type EpisodeOutcome struct {
+	ProfitAndLoss        float64   `json:"profit_and_loss"`
+	ProfitAndLossPercent float64   `json:"profit_and_loss_percent"`
+	CloseReason          string    `json:"close_reason"`
+	ClosedAt             time.Time `json:"closed_at"`
+}
+
+// Resolved reports whether the outcome of the episode is known
+func (ep *Episode) Resolved() bool {
+	return ep.Outcome != nil || ep.ForwardReturn != nil
+}
+
+// OutcomeText describes the outcome of the episode
+func (ep *Episode) OutcomeText() string {
+	switch {
+	case ep.Outcome != nil:
+		return fmt.Sprintf("position closed by %s with %+.2f%% (%.2f)",
+			ep.Outcome.CloseReason, ep.Outcome.ProfitAndLossPercent, ep.Outcome.ProfitAndLoss)
+	case ep.ForwardReturn != nil && ep.ResolvedAt != nil:
+		return fmt.Sprintf("price moved %+.2f%% in the following %s",
+			*ep.ForwardReturn, ep.ResolvedAt.Sub(ep.Timestamp).Round(time.Minute))
+	case ep.ForwardReturn != nil:
+		return fmt.Sprintf("price moved %+.2f%% afterwards", *ep.ForwardReturn)
+	default:
+		return "unknown"
+	}
+}
+
+// EpisodeMatch is a past episode similar to the current one
+type EpisodeMatch struct {
+	Episode    *Episode
+	Similarity float64
+}
+
+// String formats the match for the prompt
+func (m *EpisodeMatch) String() string {
+	ep := m.Episode
+
+	text := fmt.Sprintf("%s (similarity %.2f): %s", ep.Timestamp.UTC().Format("2006-01-02 15:04"), m.Similarity, ep.Summary)
+	if ep.Position != "" {
+		text += fmt.Sprintf("\nPosition: %s", ep.Position)
+	}
+	text += fmt.Sprintf("\nDecision: %s", ep.Decision)
+	if ep.Reasoning != "" {
+		text += fmt.Sprintf("\nReasoning: %s", ep.Reasoning)
+	}
+	text += fmt.Sprintf("\nOutcome: %s", ep.OutcomeText())
+
+	return text
+}
+
+// episodeFile represents the structure of the episodes JSON file
+type episodeFile struct {
+	Episodes []*Episode `json:"episodes"`
+}
+
+// EpisodeStore keeps the episodes of past decision cycles in a JSON file
+type EpisodeStore struct {
+	episodePath string
+	maxEpisodes int
+
+	mu       sync.Mutex
+	episodes []*Episode
+}
+
+// NewEpisodeStore creates a new episode store, maxEpisodes <= 0 keeps all episodes
+func NewEpisodeStore(episodePath string, maxEpisodes int) *EpisodeStore {
+	return &EpisodeStore{
+		episodePath: episodePath,
+		maxEpisodes: maxEpisodes,
+		episodes:    make([]*Episode, 0),
+	}
+}
+
+// Load reads the episodes from file, a missing file is an empty store
+func (es *EpisodeStore) Load() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	data, err := os.ReadFile(es.episodePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			es.episodes = make([]*Episode, 0)
+			return nil
+		}
+		return fmt.Errorf("failed to read episode file: %w", err)
+	}
+
+	var file episodeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse episode file: %w", err)
+	}
+
+	es.episodes = file.Episodes
+	if es.episodes == nil {
+		es.episodes = make([]*Episode, 0)
+	}
+
+	return nil
+}
+
+// Len returns the number of stored episodes
+func (es *EpisodeStore) Len() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	return len(es.episodes)
+}
+
+// Add stores an episode, dropping the oldest ones over the limit
+func (es *EpisodeStore) Add(ep *Episode) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.episodes = append(es.episodes, ep)
+	if es.maxEpisodes > 0 && len(es.episodes) > es.maxEpisodes {
+		es.episodes = es.episodes[len(es.episodes)-es.maxEpisodes:]
+	}
+
+	return es.save()
+}
+
+// ResolveTrade sets the outcome of the unresolved episodes of the closed
+// position, it returns the number of resolved episodes
+func (es *EpisodeStore) ResolveTrade(symbol string, outcome EpisodeOutcome) (int, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	resolved := 0
+	for _, ep := range es.episodes {
+		if ep.Symbol != symbol || !ep.InTrade || ep.Resolved() || ep.Timestamp.After(outcome.ClosedAt) {
+			continue
+		}
+
+		o := outcome
+		ep.Outcome = &o
+		ep.ResolvedAt = &o.ClosedAt
+		resolved++
+	}
+
+	if resolved == 0 {
+		return 0, nil
+	}
+
+	return resolved, es.save()
+}
+
+// EnterTrade marks the latest unresolved episode of the symbol which decided
+// to open a position before openedAt as traded, once the position opened. The
+// decision of an order which never fills stays resolved by the forward return.
+// It returns whether an episode was marked.
+func (es *EpisodeStore) EnterTrade(symbol string, openedAt time.Time) (bool, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	for i := len(es.episodes) - 1; i >= 0; i-- {
+		ep := es.episodes[i]
+		if ep.Symbol != symbol || ep.Resolved() || ep.Timestamp.After(openedAt) || !strings.Contains(ep.Decision, "open_") {
+			continue
+		}
+
+		if ep.InTrade {
+			return false, nil
+		}
+
+		ep.InTrade = true
+		return true, es.save()
+	}
+
+	return false, nil
+}
+
+// ResolveForward sets the forward return of the episodes without a trade
+// which are older than the horizon, measured against the current close. It
+// returns the number of resolved episodes.
+func (es *EpisodeStore) ResolveForward(symbol string, close float64, now time.Time, horizon time.Duration) (int, error) {
+	if close <= 0 {
+		return 0, nil
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	resolved := 0
+	for _, ep := range es.episodes {
+		if ep.Symbol != symbol || ep.InTrade || ep.Resolved() || ep.Close <= 0 || now.Sub(ep.Timestamp) < horizon {
+			continue
+		}
+
+		ret := (close/ep.Close - 1) * 100
+		at := now
+		ep.ForwardReturn = &ret
+		ep.ResolvedAt = &at
+		resolved++
+	}
+
+	if resolved == 0 {
+		return 0, nil
+	}
+
+	return resolved, es.save()
+}
+
+// Similar returns up to k resolved episodes of the symbol most similar to
+// query, most similar first. Episodes embedded by the same embedder as the
+// query are compared by embedding, the others by market features.
+func (es *EpisodeStore) Similar(query *Episode, k int, minSimilarity float64) []*EpisodeMatch {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	matches := make([]*EpisodeMatch, 0)
+	for _, ep := range es.episodes {
+		if ep.Symbol != query.Symbol || !ep.Resolved() || ep.ID == query.ID {
+			continue
+		}
+
+		similarity := CosineSimilarity(ep.Features, query.Features)
+		if query.Embedder != "" && ep.Embedder == query.Embedder && len(ep.Embedding) == len(query.Embedding) {
+			similarity = CosineSimilarity(ep.Embedding, query.Embedding)
+		}
+
+		if math.IsNaN(similarity) || similarity < minSimilarity {
+			continue
+		}
+
+		matches = append(matches, &EpisodeMatch{
+			Episode:    ep,
+			Similarity: similarity,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Similarity == matches[j].Similarity {
+			return matches[i].Episode.Timestamp.After(matches[j].Episode.Timestamp)
+		}
+		return matches[i].Similarity > matches[j].Similarity
+	})
+
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+
+	return matches
+}
+
+// FormatEpisodeMatches formats the matches as one prompt message each, least
+// similar first so a shrinking context budget drops them first
+func FormatEpisodeMatches(matches []*EpisodeMatch) []string {
+	msgs := make([]string, 0, len(matches))
+	for i := len(matches) - 1; i >= 0; i-- {
+		msgs = append(msgs, fmt.Sprintf("Similar past market situation #%d, %s", i+1, strings.TrimSpace(matches[i].String())))
+	}
+
+	return msgs
+}
+
+// save writes the episodes to file using atomic write
+func (es *EpisodeStore) save() error {
+	dir := filepath.Dir(es.episodePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create episode directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(&episodeFile{Episodes: es.episodes}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal episodes: %w", err)
+	}
+
+	tempPath := es.episodePath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write temp episode file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, es.episodePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp episode file: %w", err)
+	}
+
+	return nil
+}
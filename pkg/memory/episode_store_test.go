@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func trendSnapshot(step float64, n int) *MarketSnapshot {
+	snapshot := &MarketSnapshot{}
+	price := 100.0
+	for i := 0; i < n; i++ {
+		// Small alternating noise keeps the volatility non-zero
+		noise := 0.001
+		if i%2 == 0 {
+			noise = -0.001
+		}
+		price *= 1 + step + noise
+		snapshot.Closes = append(snapshot.Closes, price)
+		snapshot.Highs = append(snapshot.Highs, price*1.002)
+		snapshot.Lows = append(snapshot.Lows, price*0.998)
+		snapshot.Volumes = append(snapshot.Volumes, 10)
+	}
+
+	return snapshot
+}
+
+func TestMarketSnapshot_Features(t *testing.T) {
+	up := trendSnapshot(0.01, 30).Features()
+	down := trendSnapshot(-0.01, 30).Features()
+
+	if len(up) != len(FeatureNames) {
+		t.Fatalf("Expected %d features, got %d", len(FeatureNames), len(up))
+	}
+
+	for i, v := range up {
+		if v < -1 || v > 1 || math.IsNaN(v) {
+			t.Errorf("Feature %s out of range: %f", FeatureNames[i], v)
+		}
+	}
+
+	if up[0] <= 0 || down[0] >= 0 {
+		t.Errorf("Expected momentum signs to follow the trend, got %f and %f", up[0], down[0])
+	}
+
+	if CosineSimilarity(up, down) >= CosineSimilarity(up, trendSnapshot(0.008, 30).Features()) {
+		t.Error("Expected an uptrend to be closer to another uptrend than to a downtrend")
+	}
+
+	// Unknown indicators are neutral
+	empty := (&MarketSnapshot{}).Features()
+	for i, v := range empty {
+		if v != 0 {
+			t.Errorf("Expected neutral feature %s, got %f", FeatureNames[i], v)
+		}
+	}
+}
+
+func TestMarketSnapshot_String(t *testing.T) {
+	rsi := 72.0
+	snapshot := trendSnapshot(0.01, 30)
+	snapshot.RSI = &rsi
+
+	text := snapshot.String()
+	if !strings.Contains(text, "1-bar return +") || !strings.Contains(text, "RSI 72") {
+		t.Errorf("Unexpected snapshot text: %s", text)
+	}
+}
+
+func TestEpisodeStore_SimilarOnlyResolved(t *testing.T) {
+	store := NewEpisodeStore(filepath.Join(t.TempDir(), "episodes.json"), 0)
+	now := time.Now()
+
+	up := trendSnapshot(0.01, 30)
+	down := trendSnapshot(-0.01, 30)
+
+	episodes := []*Episode{
+		{ID: "up-trade", Symbol: "BTCUSDT", Timestamp: now.Add(-3 * time.Hour), Close: up.LastClose(), Features: up.Features(), Decision: "open_long", InTrade: true},
+		{ID: "up-wait", Symbol: "BTCUSDT", Timestamp: now.Add(-2 * time.Hour), Close: 100, Features: up.Features(), Decision: "wait"},
+		{ID: "down-wait", Symbol: "BTCUSDT", Timestamp: now.Add(-2 * time.Hour), Close: 100, Features: down.Features(), Decision: "wait"},
+		{ID: "other-symbol", Symbol: "ETHUSDT", Timestamp: now.Add(-2 * time.Hour), Close: 100, Features: up.Features(), Decision: "wait"},
+		{ID: "recent", Symbol: "BTCUSDT", Timestamp: now, Close: 100, Features: up.Features(), Decision: "wait"},
+	}
+	for _, ep := range episodes {
+		if err := store.Add(ep); err != nil {
+			t.Fatalf("Failed to add episode: %v", err)
+		}
+	}
+
+	query := &Episode{ID: "query", Symbol: "BTCUSDT", Features: up.Features()}
+	if matches := store.Similar(query, 3, 0); len(matches) != 0 {
+		t.Fatalf("Expected no resolved episodes, got %d", len(matches))
+	}
+
+	resolved, err := store.ResolveForward("BTCUSDT", 110, now, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to resolve forward returns: %v", err)
+	}
+	if resolved != 2 {
+		t.Errorf("Expected 2 forward resolved episodes, got %d", resolved)
+	}
+
+	resolved, err = store.ResolveTrade("BTCUSDT", EpisodeOutcome{ProfitAndLoss: 12, ProfitAndLossPercent: 3.2, CloseReason: "TakeProfit", ClosedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to resolve trade: %v", err)
+	}
+	if resolved != 1 {
+		t.Errorf("Expected 1 trade resolved episode, got %d", resolved)
+	}
+
+	matches := store.Similar(query, 2, 0.5)
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d", len(matches))
+	}
+	for _, m := range matches {
+		if m.Episode.ID == "down-wait" || m.Episode.Symbol != "BTCUSDT" {
+			t.Errorf("Unexpected match %s", m.Episode.ID)
+		}
+	}
+
+	if !strings.Contains(matches[0].String(), "Outcome: ") {
+		t.Errorf("Expected the outcome in the match text: %s", matches[0].String())
+	}
+
+	msgs := FormatEpisodeMatches(matches)
+	if !strings.HasPrefix(msgs[len(msgs)-1], "Similar past market situation #1") {
+		t.Errorf("Expected the most similar match last: %s", msgs[len(msgs)-1])
+	}
+}
+
+func TestEpisodeStore_PersistAndLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "episodes.json")
+	store := NewEpisodeStore(path, 2)
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := store.Add(&Episode{ID: id, Symbol: "BTCUSDT", Timestamp: time.Now(), Decision: "wait"}); err != nil {
+			t.Fatalf("Failed to add episode: %v", err)
+		}
+	}
+
+	loaded := NewEpisodeStore(path, 2)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load episodes: %v", err)
+	}
+
+	if loaded.Len() != 2 {
+		t.Fatalf("Expected 2 episodes, got %d", loaded.Len())
+	}
+	if loaded.episodes[0].ID != "2" {
+		t.Errorf("Expected the oldest episode dropped, got %s first", loaded.episodes[0].ID)
+	}
+
+	if err := NewEpisodeStore(filepath.Join(t.TempDir(), "missing.json"), 2).Load(); err != nil {
+		t.Errorf("Expected a missing file to load empty, got %v", err)
+	}
+}
+
+func TestEpisodeStore_EmbeddingSimilarity(t *testing.T) {
+	store := NewEpisodeStore(filepath.Join(t.TempDir(), "episodes.json"), 0)
+	ret := 1.0
+
+	// Same features but opposite embeddings, the embedding wins when the embedder matches
+	store.Add(&Episode{ID: "a", Symbol: "BTCUSDT", Features: []float64{1, 0}, Embedder: "ollama:test", Embedding: []float64{-1, 0, 0}, ForwardReturn: &ret})
+	store.Add(&Episode{ID: "b", Symbol: "BTCUSDT", Features: []float64{1, 0}, ForwardReturn: &ret})
+
+	matches := store.Similar(&Episode{Symbol: "BTCUSDT", Features: []float64{1, 0}, Embedder: "ollama:test", Embedding: []float64{1, 0, 0}}, 5, 0)
+	if len(matches) != 1 || matches[0].Episode.ID != "b" {
+		t.Fatalf("Expected only the feature matched episode, got %d matches", len(matches))
+	}
+}
+
+func TestEpisodeStore_EnterTrade(t *testing.T) {
+	store := NewEpisodeStore(filepath.Join(t.TempDir(), "episodes.json"), 0)
+	now := time.Now()
+
+	episodes := []*Episode{
+		{ID: "unfilled", Symbol: "BTCUSDT", Timestamp: now.Add(-3 * time.Hour), Close: 100, Decision: `{"name":"open_long"}`},
+		{ID: "filled", Symbol: "BTCUSDT", Timestamp: now.Add(-30 * time.Minute), Close: 100, Decision: `{"name":"open_long"}`},
+		{ID: "wait", Symbol: "BTCUSDT", Timestamp: now.Add(-10 * time.Minute), Close: 100, Decision: "wait"},
+	}
+	for _, ep := range episodes {
+		if err := store.Add(ep); err != nil {
+			t.Fatalf("Failed to add episode: %v", err)
+		}
+	}
+
+	// The open decision of an order never filled is not in a trade
+	resolved, err := store.ResolveForward("BTCUSDT", 110, now, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to resolve forward returns: %v", err)
+	}
+	if resolved != 1 || episodes[0].ForwardReturn == nil {
+		t.Fatalf("Expected the unfilled open decision forward resolved, got %d", resolved)
+	}
+
+	entered, err := store.EnterTrade("BTCUSDT", now)
+	if err != nil {
+		t.Fatalf("Failed to enter trade: %v", err)
+	}
+	if !entered || !episodes[1].InTrade || episodes[2].InTrade {
+		t.Fatalf("Expected only the latest open decision in the trade")
+	}
+
+	// Position updates of the same trade mark nothing more
+	if entered, _ := store.EnterTrade("BTCUSDT", now); entered {
+		t.Errorf("Expected the trade entered once")
+	}
+
+	resolved, err = store.ResolveTrade("BTCUSDT", EpisodeOutcome{ProfitAndLoss: 5, CloseReason: "TakeProfit", ClosedAt: now})
+	if err != nil {
+		t.Fatalf("Failed to resolve trade: %v", err)
+	}
+	if resolved != 1 || episodes[1].Outcome == nil {
+		t.Errorf("Expected the filled open decision resolved by the trade, got %d", resolved)
+	}
+}
@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// returnLags are the bar counts of the momentum features
+var returnLags = []int{1, 3, 6, 12, 24}
+
+// FeatureNames names each element of MarketSnapshot.Features in order
+var FeatureNames = []string{
+	"return_1", "return_3", "return_6", "return_12", "return_24",
+	"volatility", "range_position", "volume_ratio",
+	"boll_percent_b", "vr", "rsi", "fng",
+}
+
+// MarketSnapshot is the market state seen by a decision cycle. Series are
+// ordered oldest first, optional indicators are nil when not configured.
+type MarketSnapshot struct {
+	Closes  []float64
+	Highs   []float64
+	Lows    []float64
+	Volumes []float64
+
+	BollPercentB *float64 // Position of the close in the BOLL bands, 0 at the lower and 1 at the upper band
+	VR           *float64 // Volume ratio indicator, 100 is neutral
+	RSI          *float64 // 0-100
+	FNG          *float64 // Fear & Greed Index, 0-100
+}
+
+// LastClose returns the latest close or 0 without klines
+func (m *MarketSnapshot) LastClose() float64 {
+	if len(m.Closes) == 0 {
+		return 0
+	}
+
+	return m.Closes[len(m.Closes)-1]
+}
+
+// Features returns a fixed length vector describing the snapshot, every
+// element is scaled into [-1, 1] and 0 means neutral or unknown, so the
+// cosine similarity of two vectors compares market regimes across prices
+// and symbols.
+func (m *MarketSnapshot) Features() []float64 {
+	features := make([]float64, 0, len(FeatureNames))
+
+	vol := m.volatility()
+	for _, lag := range returnLags {
+		ret, ok := m.logReturn(lag)
+		if !ok || vol == 0 {
+			features = append(features, 0)
+			continue
+		}
+
+		// Returns in units of the expected move over the lag
+		features = append(features, math.Tanh(ret/(vol*math.Sqrt(float64(lag)))/2))
+	}
+
+	// Volatility relative to 0.5% per bar
+	if vol > 0 {
+		features = append(features, math.Tanh(math.Log(vol/0.005)))
+	} else {
+		features = append(features, 0)
+	}
+
+	features = append(features, m.rangePosition())
+
+	if ratio := m.volumeRatio(); ratio > 0 {
+		features = append(features, math.Tanh(math.Log(ratio)))
+	} else {
+		features = append(features, 0)
+	}
+
+	features = append(features, optional(m.BollPercentB, func(v float64) float64 { return math.Tanh(2*v - 1) }))
+	features = append(features, optional(m.VR, func(v float64) float64 {
+		if v <= 0 {
+			return -1
+		}
+		return math.Tanh(math.Log(v / 100))
+	}))
+	features = append(features, optional(m.RSI, func(v float64) float64 { return clamp((v-50)/50, -1, 1) }))
+	features = append(features, optional(m.FNG, func(v float64) float64 { return clamp((v-50)/50, -1, 1) }))
+
+	return features
+}
+
+// String describes the snapshot for prompts and text embeddings
+func (m *MarketSnapshot) String() string {
+	parts := make([]string, 0)
+
+	for _, lag := range []int{1, 6, 24} {
+		if ret, ok := m.logReturn(lag); ok {
+			parts = append(parts, fmt.Sprintf("%d-bar return %+.2f%%", lag, (math.Exp(ret)-1)*100))
+		}
+	}
+
+	if vol := m.volatility(); vol > 0 {
+		parts = append(parts, fmt.Sprintf("volatility %.2f%%/bar", vol*100))
+	}
+
+	if len(m.Highs) > 0 {
+		parts = append(parts, fmt.Sprintf("close at %.0f%% of the range", (m.rangePosition()+1)*50))
+	}
+
+	if ratio := m.volumeRatio(); ratio > 0 {
+		parts = append(parts, fmt.Sprintf("volume %.1fx average", ratio))
+	}
+
+	if m.BollPercentB != nil {
+		parts = append(parts, fmt.Sprintf("BOLL %%b %.2f", *m.BollPercentB))
+	}
+
+	if m.VR != nil {
+		parts = append(parts, fmt.Sprintf("VR %.0f", *m.VR))
+	}
+
+	if m.RSI != nil {
+		parts = append(parts, fmt.Sprintf("RSI %.0f", *m.RSI))
+	}
+
+	if m.FNG != nil {
+		parts = append(parts, fmt.Sprintf("Fear & Greed %.0f", *m.FNG))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (m *MarketSnapshot) logReturn(lag int) (float64, bool) {
+	n := len(m.Closes)
+	if n <= lag || m.Closes[n-1-lag] <= 0 || m.Closes[n-1] <= 0 {
+		return 0, false
+	}
+
+	return math.Log(m.Closes[n-1] / m.Closes[n-1-lag]), true
+}
+
+// volatility is the standard deviation of the log returns per bar
+func (m *MarketSnapshot) volatility() float64 {
+	rets := make([]float64, 0, len(m.Closes))
+	for i := 1; i < len(m.Closes); i++ {
+		if m.Closes[i-1] > 0 && m.Closes[i] > 0 {
+			rets = append(rets, math.Log(m.Closes[i]/m.Closes[i-1]))
+		}
+	}
+
+	if len(rets) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, r := range rets {
+		mean += r
+	}
+	mean /= float64(len(rets))
+
+	variance := 0.0
+	for _, r := range rets {
+		variance += (r - mean) * (r - mean)
+	}
+
+	return math.Sqrt(variance / float64(len(rets)-1))
+}
+
+// rangePosition is the last close within the high-low range of the window,
+// -1 at the low and 1 at the high
+func (m *MarketSnapshot) rangePosition() float64 {
+	if len(m.Highs) == 0 || len(m.Lows) == 0 {
+		return 0
+	}
+
+	high, low := m.Highs[0], m.Lows[0]
+	for _, h := range m.Highs {
+		high = math.Max(high, h)
+	}
+	for _, l := range m.Lows {
+		low = math.Min(low, l)
+	}
+
+	if high <= low {
+		return 0
+	}
+
+	return clamp(2*(m.LastClose()-low)/(high-low)-1, -1, 1)
+}
+
+// volumeRatio is the last volume over the average volume, 0 when unknown
+func (m *MarketSnapshot) volumeRatio() float64 {
+	if len(m.Volumes) < 2 {
+		return 0
+	}
+
+	total := 0.0
+	for _, v := range m.Volumes {
+		total += v
+	}
+
+	last := m.Volumes[len(m.Volumes)-1]
+	if total <= 0 || last <= 0 {
+		return 0
+	}
+
+	return last / (total / float64(len(m.Volumes)))
+}
+
+func optional(v *float64, scale func(float64) float64) float64 {
+	if v == nil || math.IsNaN(*v) || math.IsInf(*v, 0) {
+		return 0
+	}
+
+	return scale(*v)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, 0 when
+// their lengths differ or either is a zero vector
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	dot, na, nb := 0.0, 0.0, 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+
+	if na == 0 || nb == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,342 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// Knowledge scopes, from the broadest
+const (
+	ScopeGlobal       = "global"
+	scopeAssetPrefix  = "asset:"
+	scopeSymbolPrefix = "symbol:"
+)
+
+// AssetScope returns the scope of an asset class, such as majors or memecoins
+func AssetScope(assetClass string) string {
+	return scopeAssetPrefix + strings.ToLower(strings.TrimSpace(assetClass))
+}
+
+// SymbolScope returns the scope of a symbol
+func SymbolScope(symbol string) string {
+	return scopeSymbolPrefix + strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// ValidScope reports whether scope is global, an asset class or a symbol scope
+func ValidScope(scope string) bool {
+	switch {
+	case scope == ScopeGlobal:
+		return true
+	case strings.HasPrefix(scope, scopeAssetPrefix):
+		return len(scope) > len(scopeAssetPrefix)
+	case strings.HasPrefix(scope, scopeSymbolPrefix):
+		return len(scope) > len(scopeSymbolPrefix)
+	default:
+		return false
+	}
+}
+
+// Provenance tells where a lesson comes from
+type Provenance struct {
+	Instance string `json:"instance"`
+	Symbol   string `json:"symbol,omitempty"`
+	TradeID  string `json:"trade_id,omitempty"`
+	CycleID  string `json:"cycle_id,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// String formats the provenance for chat
+func (p Provenance) String() string {
+	parts := []string{p.Instance}
+	if p.Symbol != "" {
+		parts = append(parts, p.Symbol)
+	}
+	if p.TradeID != "" {
+		parts = append(parts, "trade "+p.TradeID)
+	}
+	if p.CycleID != "" {
+		parts = append(parts, "cycle "+p.CycleID)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Knowledge is a lesson of the shared knowledge base
+type Knowledge struct {
+	Scope      string     `json:"scope"`
+	Key        string     `json:"key"`
+	Text       string     `json:"text"`
+	Provenance Provenance `json:"provenance"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type knowledgeFile struct {
+	Entries []*Knowledge `json:"entries"`
+}
+
+// KnowledgeBase is a knowledge store shared by the instances of a host.
+// Every access holds a file lock next to the store, so instances read a
+// consistent store and writes are read-modify-write under an exclusive lock.
+type KnowledgeBase struct {
+	knowledgePath string
+	maxPerScope   int
+
+	mu   sync.Mutex
+	lock *flock.Flock
+}
+
+// NewKnowledgeBase creates a knowledge base stored at knowledgePath,
+// maxPerScope <= 0 keeps all lessons
+func NewKnowledgeBase(knowledgePath string, maxPerScope int) *KnowledgeBase {
+	return &KnowledgeBase{
+		knowledgePath: knowledgePath,
+		maxPerScope:   maxPerScope,
+		lock:          flock.New(knowledgePath + ".lock"),
+	}
+}
+
+// Upsert sets a lesson by scope and key, an empty text removes it. The
+// least recently updated lessons of the scope are dropped over the limit.
+func (kb *KnowledgeBase) Upsert(k *Knowledge) error {
+	if !ValidScope(k.Scope) {
+		return fmt.Errorf("invalid knowledge scope %q", k.Scope)
+	}
+	if strings.TrimSpace(k.Key) == "" {
+		return fmt.Errorf("knowledge needs a key")
+	}
+
+	return kb.update(func(entries []*Knowledge) []*Knowledge {
+		now := time.Now()
+		createdAt := now
+
+		kept := make([]*Knowledge, 0, len(entries)+1)
+		for _, entry := range entries {
+			if entry.Scope == k.Scope && entry.Key == k.Key {
+				createdAt = entry.CreatedAt
+				continue
+			}
+			kept = append(kept, entry)
+		}
+
+		if strings.TrimSpace(k.Text) == "" {
+			return kept
+		}
+
+		k.CreatedAt = createdAt
+		k.UpdatedAt = now
+		kept = append(kept, k)
+
+		return kb.prune(kept, k.Scope)
+	})
+}
+
+// Remove deletes a lesson, it reports whether the lesson existed
+func (kb *KnowledgeBase) Remove(scope, key string) (bool, error) {
+	removed := false
+	err := kb.update(func(entries []*Knowledge) []*Knowledge {
+		kept := make([]*Knowledge, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Scope == scope && entry.Key == key {
+				removed = true
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		return kept
+	})
+
+	return removed, err
+}
+
+// List returns the lessons of scopes, all lessons without scopes, oldest first
+func (kb *KnowledgeBase) List(scopes ...string) ([]*Knowledge, error) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+
+	if err := kb.ensureDir(); err != nil {
+		return nil, err
+	}
+	if err := kb.lock.RLock(); err != nil {
+		return nil, fmt.Errorf("failed to lock knowledge base: %w", err)
+	}
+	defer kb.lock.Unlock()
+
+	entries, err := kb.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) == 0 {
+		return entries, nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, scope := range scopes {
+		wanted[scope] = true
+	}
+
+	filtered := make([]*Knowledge, 0, len(entries))
+	for _, entry := range entries {
+		if wanted[entry.Scope] {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered, nil
+}
+
+// Merged returns the lessons of scopes, given from the most specific. A key
+// set in a more specific scope overrides the same key of broader scopes.
+func (kb *KnowledgeBase) Merged(scopes ...string) ([]*Knowledge, error) {
+	entries, err := kb.List(scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	rank := make(map[string]int)
+	for i, scope := range scopes {
+		rank[scope] = i
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if rank[entries[i].Scope] != rank[entries[j].Scope] {
+			return rank[entries[i].Scope] < rank[entries[j].Scope]
+		}
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+
+	seen := make(map[string]bool)
+	merged := make([]*Knowledge, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry.Key] {
+			continue
+		}
+		seen[entry.Key] = true
+		merged = append(merged, entry)
+	}
+
+	return merged, nil
+}
+
+// FormatKnowledge formats merged lessons for the prompt, grouped by scope
+func FormatKnowledge(entries []*Knowledge) string {
+	var text strings.Builder
+	scope := ""
+	for _, entry := range entries {
+		if entry.Scope != scope {
+			scope = entry.Scope
+			if text.Len() > 0 {
+				text.WriteString("\n")
+			}
+			text.WriteString(fmt.Sprintf("[%s]\n", scope))
+		}
+		text.WriteString(fmt.Sprintf("- [%s] %s (from %s)\n", entry.Key, entry.Text, entry.Provenance.Instance))
+	}
+
+	return strings.TrimRight(text.String(), "\n")
+}
+
+// prune drops the least recently updated lessons of scope over the limit
+func (kb *KnowledgeBase) prune(entries []*Knowledge, scope string) []*Knowledge {
+	if kb.maxPerScope <= 0 {
+		return entries
+	}
+
+	scoped := make([]*Knowledge, 0)
+	for _, entry := range entries {
+		if entry.Scope == scope {
+			scoped = append(scoped, entry)
+		}
+	}
+	sort.SliceStable(scoped, func(i, j int) bool {
+		return scoped[i].UpdatedAt.Before(scoped[j].UpdatedAt)
+	})
+
+	drop := make(map[*Knowledge]bool)
+	for i := 0; i < len(scoped)-kb.maxPerScope; i++ {
+		drop[scoped[i]] = true
+	}
+
+	kept := make([]*Knowledge, 0, len(entries))
+	for _, entry := range entries {
+		if !drop[entry] {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
+
+// update applies fn to the lessons under the exclusive file lock
+func (kb *KnowledgeBase) update(fn func([]*Knowledge) []*Knowledge) error {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+
+	if err := kb.ensureDir(); err != nil {
+		return err
+	}
+	if err := kb.lock.Lock(); err != nil {
+		return fmt.Errorf("failed to lock knowledge base: %w", err)
+	}
+	defer kb.lock.Unlock()
+
+	entries, err := kb.load()
+	if err != nil {
+		return err
+	}
+
+	return kb.save(fn(entries))
+}
+
+func (kb *KnowledgeBase) ensureDir() error {
+	if err := os.MkdirAll(filepath.Dir(kb.knowledgePath), 0755); err != nil {
+		return fmt.Errorf("failed to create knowledge directory: %w", err)
+	}
+
+	return nil
+}
+
+func (kb *KnowledgeBase) load() ([]*Knowledge, error) {
+	data, err := os.ReadFile(kb.knowledgePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Knowledge{}, nil
+		}
+		return nil, fmt.Errorf("failed to read knowledge file: %w", err)
+	}
+
+	var file knowledgeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse knowledge file: %w", err)
+	}
+
+	if file.Entries == nil {
+		return []*Knowledge{}, nil
+	}
+
+	return file.Entries, nil
+}
+
+// save writes the lessons to file using atomic write
+func (kb *KnowledgeBase) save(entries []*Knowledge) error {
+	data, err := json.MarshalIndent(&knowledgeFile{Entries: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal knowledge: %w", err)
+	}
+
+	// Shared by the instances, a crash must not leave a truncated file
+	if err := writeFileAtomic(kb.knowledgePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write knowledge file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestKnowledgeBase_MergedScopes(t *testing.T) {
+	kb := NewKnowledgeBase(filepath.Join(t.TempDir(), "knowledge.json"), 0)
+
+	lessons := []*Knowledge{
+		{Scope: ScopeGlobal, Key: "funding", Text: "Avoid longs when funding is extreme", Provenance: Provenance{Instance: "btc"}},
+		{Scope: ScopeGlobal, Key: "weekend", Text: "Weekend breakouts fail often", Provenance: Provenance{Instance: "eth"}},
+		{Scope: AssetScope("Memecoins"), Key: "volume", Text: "Pumps without volume fade", Provenance: Provenance{Instance: "doge"}},
+		{Scope: SymbolScope("suiusdt"), Key: "funding", Text: "SUI funding spikes are short lived", Provenance: Provenance{Instance: "sui", TradeID: "t1"}},
+		{Scope: SymbolScope("BTCUSDT"), Key: "halving", Text: "not for SUI", Provenance: Provenance{Instance: "btc"}},
+	}
+	for _, k := range lessons {
+		if err := kb.Upsert(k); err != nil {
+			t.Fatalf("Failed to upsert knowledge: %v", err)
+		}
+	}
+
+	merged, err := kb.Merged(SymbolScope("SUIUSDT"), AssetScope("memecoins"), ScopeGlobal)
+	if err != nil {
+		t.Fatalf("Failed to merge knowledge: %v", err)
+	}
+
+	got := make([]string, 0, len(merged))
+	for _, k := range merged {
+		got = append(got, k.Scope+"/"+k.Key)
+	}
+	want := "symbol:SUIUSDT/funding asset:memecoins/volume global/weekend"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(got, " "))
+	}
+
+	text := FormatKnowledge(merged)
+	if !strings.Contains(text, "[symbol:SUIUSDT]\n- [funding] SUI funding spikes are short lived (from sui)") {
+		t.Errorf("Unexpected knowledge text:\n%s", text)
+	}
+
+	// An empty text removes the lesson, the global one shows again
+	if err := kb.Upsert(&Knowledge{Scope: SymbolScope("SUIUSDT"), Key: "funding"}); err != nil {
+		t.Fatalf("Failed to remove knowledge: %v", err)
+	}
+	merged, _ = kb.Merged(SymbolScope("SUIUSDT"), ScopeGlobal)
+	if len(merged) != 2 || merged[1].Key != "funding" || merged[1].Scope != ScopeGlobal {
+		t.Errorf("Unexpected knowledge after removal: %+v", merged)
+	}
+
+	if err := kb.Upsert(&Knowledge{Scope: "desk", Key: "x", Text: "y"}); err == nil {
+		t.Error("Expected an invalid scope to be rejected")
+	}
+}
+
+func TestKnowledgeBase_PruneAndRemove(t *testing.T) {
+	kb := NewKnowledgeBase(filepath.Join(t.TempDir(), "knowledge.json"), 2)
+
+	for i := 1; i <= 3; i++ {
+		if err := kb.Upsert(&Knowledge{Scope: ScopeGlobal, Key: fmt.Sprintf("k%d", i), Text: "lesson"}); err != nil {
+			t.Fatalf("Failed to upsert knowledge: %v", err)
+		}
+	}
+
+	entries, _ := kb.List(ScopeGlobal)
+	if len(entries) != 2 || entries[0].Key != "k2" {
+		t.Fatalf("Expected the oldest lesson dropped, got %+v", entries)
+	}
+
+	removed, err := kb.Remove(ScopeGlobal, "k2")
+	if err != nil || !removed {
+		t.Fatalf("Expected k2 removed, got %v %v", removed, err)
+	}
+	if removed, _ := kb.Remove(ScopeGlobal, "k2"); removed {
+		t.Error("Expected no second removal")
+	}
+}
+
+func TestKnowledgeBase_ConcurrentInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "knowledge.json")
+
+	// Each instance has its own handle on the shared store
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		kb := NewKnowledgeBase(path, 0)
+		instance := fmt.Sprintf("instance-%d", i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				err := kb.Upsert(&Knowledge{Scope: ScopeGlobal, Key: fmt.Sprintf("%s-%d", instance, j), Text: "lesson",
+					Provenance: Provenance{Instance: instance}})
+				if err != nil {
+					t.Errorf("Failed to upsert knowledge: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := NewKnowledgeBase(path, 0).List()
+	if err != nil {
+		t.Fatalf("Failed to list knowledge: %v", err)
+	}
+	if len(entries) != 40 {
+		t.Errorf("Expected no lost writes, got %d lessons", len(entries))
+	}
+}
@@ -0,0 +1,209 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sources of a memory write
+const (
+	SourceInitial    = "initial"    // Memory found on disk before the history started
+	SourceAgent      = "agent"      // Memory output of a decision cycle
+	SourceRollback   = "rollback"   // Rollback to an earlier version
+	SourceConfirm    = "confirm"    // Guarded write confirmed by a user
+	SourceReflection = "reflection" // Post-mortem of a closed trade
+)
+
+// WriteInfo tags a memory write
+type WriteInfo struct {
+	CycleID string
+	Model   string
+	Source  string
+	UserID  string
+}
+
+type writeInfoKey struct{}
+
+// WithWriteInfo attaches the tags of the memory writes made with ctx
+func WithWriteInfo(ctx context.Context, info WriteInfo) context.Context {
+	return context.WithValue(ctx, writeInfoKey{}, info)
+}
+
+// WriteInfoFromContext returns the tags attached by WithWriteInfo
+func WriteInfoFromContext(ctx context.Context) WriteInfo {
+	info, _ := ctx.Value(writeInfoKey{}).(WriteInfo)
+	return info
+}
+
+// MemoryVersion is one write of the memory
+type MemoryVersion struct {
+	Version      int       `json:"version"`
+	Timestamp    time.Time `json:"timestamp"`
+	CycleID      string    `json:"cycle_id,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Source       string    `json:"source"`
+	UserID       string    `json:"user_id,omitempty"`
+	Words        int       `json:"words"`
+	Compaction   string    `json:"compaction,omitempty"`    // CompactionLLM or CompactionTruncate when the write was over the limit
+	RollbackFrom int       `json:"rollback_from,omitempty"` // Version restored by a rollback
+	Content      string    `json:"content"`
+}
+
+// Summary describes the version without its content
+func (v *MemoryVersion) Summary() string {
+	text := fmt.Sprintf("v%d %s %s, %d words", v.Version, v.Timestamp.UTC().Format("2006-01-02 15:04:05"), v.Source, v.Words)
+	if v.Model != "" {
+		text += ", model " + v.Model
+	}
+	if v.CycleID != "" {
+		text += ", cycle " + v.CycleID
+	}
+	if v.Compaction != "" {
+		text += ", compacted by " + v.Compaction
+	}
+	if v.RollbackFrom > 0 {
+		text += fmt.Sprintf(", restored v%d", v.RollbackFrom)
+	}
+	if v.UserID != "" {
+		text += ", by " + v.UserID
+	}
+
+	return text
+}
+
+// MemoryHistory is the append-only version history of the memory, one JSON
+// version per line
+type MemoryHistory struct {
+	historyPath string
+
+	mu   sync.Mutex
+	last int // Latest version, -1 until loaded
+}
+
+// NewMemoryHistory creates a history stored at historyPath
+func NewMemoryHistory(historyPath string) *MemoryHistory {
+	return &MemoryHistory{
+		historyPath: historyPath,
+		last:        -1,
+	}
+}
+
+// Append numbers and appends a version
+func (h *MemoryHistory) Append(v *MemoryVersion) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.last < 0 {
+		versions, err := h.load()
+		if err != nil {
+			return err
+		}
+
+		h.last = 0
+		if len(versions) > 0 {
+			h.last = versions[len(versions)-1].Version
+		}
+	}
+
+	v.Version = h.last + 1
+	if v.Timestamp.IsZero() {
+		v.Timestamp = time.Now()
+	}
+	v.Words = countWords(v.Content)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal memory version: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.historyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create memory history directory: %w", err)
+	}
+
+	f, err := os.OpenFile(h.historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open memory history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append memory version: %w", err)
+	}
+
+	h.last = v.Version
+	return nil
+}
+
+// List returns all versions, oldest first
+func (h *MemoryHistory) List() ([]*MemoryVersion, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.load()
+}
+
+// Get returns a version by number
+func (h *MemoryHistory) Get(version int) (*MemoryVersion, error) {
+	versions, err := h.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("memory version %d not found", version)
+}
+
+// Latest returns the latest version, nil when the history is empty
+func (h *MemoryHistory) Latest() (*MemoryVersion, error) {
+	versions, err := h.List()
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+func (h *MemoryHistory) load() ([]*MemoryVersion, error) {
+	f, err := os.Open(h.historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*MemoryVersion{}, nil
+		}
+		return nil, fmt.Errorf("failed to open memory history: %w", err)
+	}
+	defer f.Close()
+
+	versions := make([]*MemoryVersion, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var v MemoryVersion
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			return nil, fmt.Errorf("failed to parse memory version: %w", err)
+		}
+		versions = append(versions, &v)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read memory history: %w", err)
+	}
+
+	return versions, nil
+}
@@ -1,16 +1,81 @@
 package memory
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+var log = logrus.WithField("memory", "manager")
+
+// Compaction methods
+const (
+	CompactionLLM      = "llm"
+	CompactionTruncate = "truncate"
 )
 
+// CompactionTargetPercent is the share of the word limit a compacted memory
+// is asked to fit in, leaving room for the next insights
+const CompactionTargetPercent = 80
+
+// Compaction describes how an over limit memory was reduced
+type Compaction struct {
+	Method        string // CompactionLLM or CompactionTruncate
+	OriginalWords int
+	Words         int
+	ArchivePath   string // Pre-compaction memory, empty when archiving failed or is disabled
+	Err           error  // Why the compactor was not used, nil for CompactionLLM
+}
+
+// GuardError rejects a write deleting more of the memory than the guard allows
+type GuardError struct {
+	DeletedPercent float64
+	MaxPercent     float64
+	Dropped        bool // Another rejected write already waits for confirmation, this one is not kept
+}
+
+func (e *GuardError) Error() string {
+	if e.Dropped {
+		return fmt.Sprintf("memory write deletes %.0f%% of the existing memory, over the %.0f%% guard, and is dropped while another rejected write waits for confirmation",
+			e.DeletedPercent, e.MaxPercent)
+	}
+
+	return fmt.Sprintf("memory write deletes %.0f%% of the existing memory, over the %.0f%% guard, it must be confirmed",
+		e.DeletedPercent, e.MaxPercent)
+}
+
+// PendingWrite is a write rejected by the guard, waiting for confirmation
+type PendingWrite struct {
+	Content        string
+	Info           WriteInfo
+	DeletedPercent float64
+	CreatedAt      time.Time
+}
+
 // MemoryManager handles file-based memory operations
 type MemoryManager struct {
 	memoryPath string
 	maxWords   int
+
+	compactor   Compactor
+	archiveDir  string
+	maxArchives int
+
+	history      *MemoryHistory
+	guardPercent float64
+	sections     []*SectionSpec
+
+	mu      sync.Mutex
+	pending *PendingWrite
 }
 
 // NewMemoryManager creates a new memory manager
@@ -35,36 +100,316 @@ func (m *MemoryManager) LoadMemory() (string, error) {
 	return string(content), nil
 }
 
+// SetCompactor sets the compactor used when the memory goes over the word
+// limit, without one the memory is truncated section by section
+func (m *MemoryManager) SetCompactor(compactor Compactor) {
+	m.compactor = compactor
+}
+
+// SetArchive keeps up to maxArchives pre-compaction memories in dir, an
+// empty dir disables archiving
+func (m *MemoryManager) SetArchive(dir string, maxArchives int) {
+	m.archiveDir = dir
+	m.maxArchives = maxArchives
+}
+
+// SetHistory records every write in history
+func (m *MemoryManager) SetHistory(history *MemoryHistory) {
+	m.history = history
+}
+
+// History returns the version history, nil when disabled
+func (m *MemoryManager) History() *MemoryHistory {
+	return m.history
+}
+
+// SetDeleteGuard rejects writes deleting more than percent of the existing
+// memory until they are confirmed, 0 disables the guard
+func (m *MemoryManager) SetDeleteGuard(percent float64) {
+	m.guardPercent = percent
+}
+
+// SetSections switches to the structured memory made of sections
+func (m *MemoryManager) SetSections(sections []*SectionSpec) {
+	m.sections = sections
+}
+
+// Sections returns the sections of the structured memory, nil for a free-form memory
+func (m *MemoryManager) Sections() []*SectionSpec {
+	return m.sections
+}
+
+// LoadStructured loads the memory split into its sections
+func (m *MemoryManager) LoadStructured() (*StructuredMemory, error) {
+	if len(m.sections) == 0 {
+		return nil, fmt.Errorf("memory sections are not configured")
+	}
+
+	content, err := m.LoadMemory()
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseStructured(content, m.sections), nil
+}
+
+// UpdateSections applies section updates to the structured memory and saves
+// it like SaveMemoryContext, with no other write in between. It also returns
+// notes on skipped updates and trimmed sections.
+func (m *MemoryManager) UpdateSections(ctx context.Context, updates map[string]*types.MemorySectionUpdate) (string, *Compaction, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sm, err := m.LoadStructured()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	notes := sm.Apply(updates)
+	saved, compaction, err := m.save(ctx, sm.String())
+	return saved, compaction, notes, err
+}
+
+// UpdateMemory applies update to the current memory and saves the result
+// like SaveMemoryContext, with no other write in between
+func (m *MemoryManager) UpdateMemory(ctx context.Context, update func(current string) string) (string, *Compaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, err := m.LoadMemory()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return m.save(ctx, update(current))
+}
+
+// Pending returns the write waiting for confirmation, nil if none
+func (m *MemoryManager) Pending() *PendingWrite {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending
+}
+
 // SaveMemory saves memory content to file with word limit enforcement
 func (m *MemoryManager) SaveMemory(content string) (string, bool, error) {
-	originalWordCount := len(strings.Fields(content))
-	truncated := m.truncateToMaxWords(content)
+	saved, compaction, err := m.SaveMemoryContext(context.Background(), content)
+	return saved, compaction != nil, err
+}
+
+// SaveMemoryContext saves memory content to file, tagged with the
+// WriteInfo of ctx. Content over the word limit is archived and compacted,
+// the returned compaction is nil when the content was within the limit. A
+// write deleting too much of the memory returns a *GuardError and waits for
+// ConfirmPending.
+func (m *MemoryManager) SaveMemoryContext(ctx context.Context, content string) (string, *Compaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.save(ctx, content)
+}
+
+// save checks the delete guard and writes content, the caller holds m.mu
+func (m *MemoryManager) save(ctx context.Context, content string) (string, *Compaction, error) {
+	info := WriteInfoFromContext(ctx)
+	if info.Source == "" {
+		info.Source = SourceAgent
+	}
+
+	if m.guardPercent > 0 {
+		current, err := m.LoadMemory()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if deleted := DeletedPercent(current, content); deleted > m.guardPercent {
+			// The first rejected write keeps waiting, a later one never replaces it unseen
+			if m.pending != nil {
+				log.WithField("source", info.Source).
+					WithField("deleted_percent", deleted).
+					WithField("pending_since", m.pending.CreatedAt).
+					Warn("memory write dropped, a rejected write already waits for confirmation")
+
+				return "", nil, &GuardError{DeletedPercent: deleted, MaxPercent: m.guardPercent, Dropped: true}
+			}
+
+			m.pending = &PendingWrite{
+				Content:        content,
+				Info:           info,
+				DeletedPercent: deleted,
+				CreatedAt:      time.Now(),
+			}
+
+			return "", nil, &GuardError{DeletedPercent: deleted, MaxPercent: m.guardPercent}
+		}
+	}
+
+	return m.write(ctx, content, info, 0)
+}
+
+// ConfirmPending saves the write rejected by the guard
+func (m *MemoryManager) ConfirmPending(ctx context.Context, userID string) (string, *Compaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := m.pending
+	m.pending = nil
+	if pending == nil {
+		return "", nil, fmt.Errorf("no memory write waiting for confirmation")
+	}
+
+	info := pending.Info
+	info.Source = SourceConfirm
+	info.UserID = userID
+
+	return m.write(ctx, pending.Content, info, 0)
+}
+
+// Rollback restores a version of the history as a new version
+func (m *MemoryManager) Rollback(ctx context.Context, version int, userID string) (string, error) {
+	if m.history == nil {
+		return "", fmt.Errorf("memory history is disabled")
+	}
+
+	v, err := m.history.Get(version)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved, _, err := m.write(ctx, v.Content, WriteInfo{Source: SourceRollback, UserID: userID}, version)
+	return saved, err
+}
+
+// write saves content over the memory file and records its version. The
+// caller holds m.mu from the load of the memory it changed, so that no other
+// write is lost in between.
+func (m *MemoryManager) write(ctx context.Context, content string, info WriteInfo, rollbackFrom int) (string, *Compaction, error) {
+	previous, err := m.LoadMemory()
+	if err != nil {
+		return "", nil, err
+	}
 
-	wasTruncated := originalWordCount > m.maxWords
+	var compaction *Compaction
+	if countWords(content) > m.maxWords {
+		content, compaction = m.compact(ctx, content)
+	}
 
 	// Ensure the directory exists before writing the file
 	dir := filepath.Dir(m.memoryPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", false, fmt.Errorf("failed to create memory directory: %w", err)
+		return "", nil, fmt.Errorf("failed to create memory directory: %w", err)
+	}
+
+	if err := writeFileAtomic(m.memoryPath, []byte(content), 0644); err != nil {
+		return "", nil, fmt.Errorf("failed to write memory file: %w", err)
+	}
+
+	if m.history != nil && content != previous {
+		if err := m.record(previous, content, info, compaction, rollbackFrom); err != nil {
+			log.WithError(err).Warn("Failed to record memory version")
+		}
 	}
 
-	err := os.WriteFile(m.memoryPath, []byte(truncated), 0644)
+	return content, compaction, nil
+}
+
+// record appends a version, the memory found before the history started is
+// kept as the first version
+func (m *MemoryManager) record(previous, content string, info WriteInfo, compaction *Compaction, rollbackFrom int) error {
+	latest, err := m.history.Latest()
 	if err != nil {
-		return "", false, fmt.Errorf("failed to write memory file: %w", err)
+		return err
 	}
 
-	return truncated, wasTruncated, nil
+	if latest == nil && previous != "" {
+		if err := m.history.Append(&MemoryVersion{Source: SourceInitial, Content: previous}); err != nil {
+			return err
+		}
+	}
+
+	v := &MemoryVersion{
+		CycleID:      info.CycleID,
+		Model:        info.Model,
+		Source:       info.Source,
+		UserID:       info.UserID,
+		RollbackFrom: rollbackFrom,
+		Content:      content,
+	}
+	if compaction != nil {
+		v.Compaction = compaction.Method
+	}
+
+	return m.history.Append(v)
 }
 
-// truncateToMaxWords truncates content to maximum word limit
-func (m *MemoryManager) truncateToMaxWords(content string) string {
-	words := strings.Fields(content)
-	if len(words) <= m.maxWords {
-		return content
+// compact archives content and reduces it to the word limit, with the
+// compactor if any and section-aware truncation otherwise
+func (m *MemoryManager) compact(ctx context.Context, content string) (string, *Compaction) {
+	compaction := &Compaction{
+		Method:        CompactionTruncate,
+		OriginalWords: countWords(content),
+	}
+
+	archivePath, err := m.archive(content)
+	if err != nil {
+		log.WithError(err).Warn("Failed to archive memory before compaction")
+	}
+	compaction.ArchivePath = archivePath
+
+	compacted := ""
+	if m.compactor != nil {
+		compacted, err = m.compactor.Compact(ctx, content, m.maxWords*CompactionTargetPercent/100)
+		if err != nil {
+			log.WithError(err).Warn("Failed to compact memory, fall back to truncation")
+			compaction.Err = err
+		} else {
+			compaction.Method = CompactionLLM
+			content = compacted
+		}
+	}
+
+	// Compacted content can still be a little over the limit
+	content = TruncateSections(content, m.maxWords)
+	compaction.Words = countWords(content)
+
+	return content, compaction
+}
+
+// archive writes content to the archive directory and prunes the oldest archives
+func (m *MemoryManager) archive(content string) (string, error) {
+	if m.archiveDir == "" {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(m.archiveDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create memory archive directory: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(m.memoryPath), filepath.Ext(m.memoryPath))
+	archivePath := filepath.Join(m.archiveDir, fmt.Sprintf("%s.%s%s", base, time.Now().UTC().Format("20060102-150405.000"), filepath.Ext(m.memoryPath)))
+	if err := os.WriteFile(archivePath, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write memory archive: %w", err)
+	}
+
+	if m.maxArchives > 0 {
+		archives, err := filepath.Glob(filepath.Join(m.archiveDir, base+".*"))
+		if err != nil {
+			return archivePath, fmt.Errorf("failed to list memory archives: %w", err)
+		}
+
+		// Timestamps sort in time order
+		sort.Strings(archives)
+		for len(archives) > m.maxArchives {
+			os.Remove(archives[0])
+			archives = archives[1:]
+		}
 	}
 
-	// Keep the latest memory content
-	return strings.Join(words[len(words)-m.maxWords:], " ")
+	return archivePath, nil
 }
 
 // GetWordLimitInfo returns word limit information for AI feedback
@@ -1,8 +1,15 @@
 package memory
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMemoryManager(t *testing.T) {
@@ -89,3 +96,241 @@ func TestMemoryManagerWithNonExistentDirectory(t *testing.T) {
 		t.Errorf("Expected loaded content to match saved content. Expected: %s, Got: %s", testContent, loadedContent)
 	}
 }
+
+type fakeCompactor struct {
+	result string
+	err    error
+	calls  int
+}
+
+func (c *fakeCompactor) Compact(ctx context.Context, content string, maxWords int) (string, error) {
+	c.calls++
+	return c.result, c.err
+}
+
+const sectionedMemory = `# Trading Memory
+
+## Market Insights
+- BTC respects the 4h BOLL lower band in ranges.
+- Funding spikes precede long squeezes.
+- Weekend volume is thin.
+
+## Mistakes To Avoid
+- Do not chase breakouts without volume.
+- Move the stop to break-even after 1R.
+`
+
+func TestMemoryManagerCompaction(t *testing.T) {
+	dir := t.TempDir()
+	mm := NewMemoryManager(filepath.Join(dir, "memory.md"), 30)
+	mm.SetArchive(filepath.Join(dir, "archive"), 1)
+
+	compactor := &fakeCompactor{result: "## Market Insights\n- Buy the 4h BOLL lower band in ranges.\n"}
+	mm.SetCompactor(compactor)
+
+	saved, compaction, err := mm.SaveMemoryContext(context.Background(), sectionedMemory)
+	if err != nil {
+		t.Fatalf("Failed to save memory: %v", err)
+	}
+	if compaction == nil || compaction.Method != CompactionLLM {
+		t.Fatalf("Expected LLM compaction, got %+v", compaction)
+	}
+	if saved != compactor.result {
+		t.Errorf("Expected the compacted memory, got: %s", saved)
+	}
+
+	archived, err := os.ReadFile(compaction.ArchivePath)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if string(archived) != sectionedMemory {
+		t.Error("Expected the pre-compaction memory in the archive")
+	}
+
+	// A failing compactor falls back to truncation, and old archives are pruned
+	time.Sleep(2 * time.Millisecond)
+	compactor.err = errors.New("llm down")
+	saved, compaction, err = mm.SaveMemoryContext(context.Background(), sectionedMemory)
+	if err != nil {
+		t.Fatalf("Failed to save memory: %v", err)
+	}
+	if compaction.Method != CompactionTruncate || compaction.Err == nil {
+		t.Errorf("Expected truncation fallback, got %+v", compaction)
+	}
+	if compaction.Words > 30 || !strings.Contains(saved, "## Mistakes To Avoid") {
+		t.Errorf("Unexpected truncated memory (%d words): %s", compaction.Words, saved)
+	}
+
+	archives, _ := filepath.Glob(filepath.Join(dir, "archive", "memory.*"))
+	if len(archives) != 1 {
+		t.Errorf("Expected 1 archive, got %d", len(archives))
+	}
+
+	// Within the limit nothing is compacted
+	compactor.calls = 0
+	_, compaction, _ = mm.SaveMemoryContext(context.Background(), "short memory")
+	if compaction != nil || compactor.calls != 0 {
+		t.Error("Expected no compaction within the limit")
+	}
+}
+
+func TestTruncateSections(t *testing.T) {
+	truncated := TruncateSections(sectionedMemory, 30)
+
+	if len(strings.Fields(truncated)) > 30 {
+		t.Errorf("Expected at most 30 words, got %d", len(strings.Fields(truncated)))
+	}
+
+	// Leading bullets of each section survive, whole bullets are dropped
+	for _, keep := range []string{"## Market Insights", "- BTC respects the 4h BOLL lower band in ranges.", "## Mistakes To Avoid", "- Do not chase breakouts without volume."} {
+		if !strings.Contains(truncated, keep) {
+			t.Errorf("Expected %q in truncated memory:\n%s", keep, truncated)
+		}
+	}
+	if strings.Contains(truncated, "Weekend") {
+		t.Errorf("Expected the last bullet of the longest section dropped:\n%s", truncated)
+	}
+
+	// A single paragraph is cut at a sentence end
+	paragraph := "First sentence is kept. Second sentence is far too long to fit in the limit"
+	if got := TruncateSections(paragraph, 8); got != "First sentence is kept." {
+		t.Errorf("Unexpected paragraph truncation: %q", got)
+	}
+}
+
+func TestMemoryManagerHistoryAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	memoryPath := filepath.Join(dir, "memory.md")
+	if err := os.WriteFile(memoryPath, []byte("- existing rule\n"), 0644); err != nil {
+		t.Fatalf("Failed to write memory: %v", err)
+	}
+
+	mm := NewMemoryManager(memoryPath, 100)
+	history := NewMemoryHistory(filepath.Join(dir, "memory.history.jsonl"))
+	mm.SetHistory(history)
+
+	ctx := WithWriteInfo(context.Background(), WriteInfo{CycleID: "cycle-1", Model: "gpt-4o", Source: SourceAgent})
+	if _, _, err := mm.SaveMemoryContext(ctx, "- existing rule\n- new rule\n"); err != nil {
+		t.Fatalf("Failed to save memory: %v", err)
+	}
+
+	// Unchanged writes add no version
+	if _, _, err := mm.SaveMemoryContext(ctx, "- existing rule\n- new rule\n"); err != nil {
+		t.Fatalf("Failed to save memory: %v", err)
+	}
+
+	versions, err := history.List()
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Expected the initial and one agent version, got %d", len(versions))
+	}
+	if versions[0].Source != SourceInitial || versions[1].CycleID != "cycle-1" || versions[1].Model != "gpt-4o" {
+		t.Errorf("Unexpected versions: %s / %s", versions[0].Summary(), versions[1].Summary())
+	}
+
+	if diff := Diff(versions[0].Content, versions[1].Content); !strings.Contains(diff, "+ - new rule") {
+		t.Errorf("Unexpected diff: %s", diff)
+	}
+
+	saved, err := mm.Rollback(context.Background(), 1, "admin")
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if saved != "- existing rule\n" {
+		t.Errorf("Expected version 1 restored, got %q", saved)
+	}
+
+	latest, _ := history.Latest()
+	if latest.Version != 3 || latest.Source != SourceRollback || latest.RollbackFrom != 1 || latest.UserID != "admin" {
+		t.Errorf("Unexpected rollback version: %s", latest.Summary())
+	}
+}
+
+func TestMemoryManagerDeleteGuard(t *testing.T) {
+	dir := t.TempDir()
+	mm := NewMemoryManager(filepath.Join(dir, "memory.md"), 100)
+	mm.SetDeleteGuard(50)
+
+	if _, _, err := mm.SaveMemoryContext(context.Background(), sectionedMemory); err != nil {
+		t.Fatalf("Failed to save memory: %v", err)
+	}
+
+	_, _, err := mm.SaveMemoryContext(context.Background(), "## Market Insights\n- Only one rule left.\n")
+	var guardErr *GuardError
+	if !errors.As(err, &guardErr) || guardErr.DeletedPercent <= 50 {
+		t.Fatalf("Expected the write to be guarded, got %v", err)
+	}
+
+	current, _ := mm.LoadMemory()
+	if current != sectionedMemory {
+		t.Error("Expected the guarded write not to change the memory")
+	}
+
+	// Small edits pass the guard
+	if _, _, err := mm.SaveMemoryContext(context.Background(), sectionedMemory+"- One more rule.\n"); err != nil {
+		t.Errorf("Expected a small edit to pass the guard, got %v", err)
+	}
+
+	if mm.Pending() == nil {
+		t.Fatal("Expected a pending write")
+	}
+
+	// A second rejected write does not replace the pending one
+	_, _, err = mm.SaveMemoryContext(context.Background(), "## Market Insights\n- Another single rule.\n")
+	if !errors.As(err, &guardErr) || !guardErr.Dropped {
+		t.Fatalf("Expected the second write to be dropped, got %v", err)
+	}
+	if !strings.Contains(mm.Pending().Content, "Only one rule left") {
+		t.Error("Expected the first rejected write to keep waiting")
+	}
+
+	saved, _, err := mm.ConfirmPending(context.Background(), "admin")
+	if err != nil || !strings.Contains(saved, "Only one rule left") {
+		t.Errorf("Expected the pending write confirmed, got %q, %v", saved, err)
+	}
+	if mm.Pending() != nil {
+		t.Error("Expected no pending write after confirmation")
+	}
+}
+
+func TestMemoryManagerUpdateMemory(t *testing.T) {
+	mm := NewMemoryManager(filepath.Join(t.TempDir(), "memory.md"), 1000)
+
+	// Concurrent load-modify-save writes do not lose each other
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := mm.UpdateMemory(context.Background(), func(current string) string {
+				return current + fmt.Sprintf("- reflection %d\n", i)
+			})
+			if err != nil {
+				t.Errorf("Failed to update memory: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	content, err := mm.LoadMemory()
+	if err != nil {
+		t.Fatalf("Failed to load memory: %v", err)
+	}
+	if n := strings.Count(content, "- reflection "); n != 20 {
+		t.Errorf("Expected 20 reflections, got %d", n)
+	}
+}
+
+func TestDeletedPercent(t *testing.T) {
+	if p := DeletedPercent("a b c d", "d c b a e"); p != 0 {
+		t.Errorf("Expected reordering to delete nothing, got %f", p)
+	}
+	if p := DeletedPercent("a b c d", "a b"); p != 50 {
+		t.Errorf("Expected 50%% deleted, got %f", p)
+	}
+	if p := DeletedPercent("", "a"); p != 0 {
+		t.Errorf("Expected nothing deleted from empty memory, got %f", p)
+	}
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"github.com/yubing744/trading-gpt/pkg/llms/task"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Names of the structured memory sections reflections are written to
+const (
+	ReflectionRulesSection    = "trading_rules"
+	ReflectionMistakesSection = "mistakes"
+)
+
+// reflectionsTitle is the heading of reflections in a free-form memory
+const reflectionsTitle = "## Trade Reflections"
+
+// Reflector writes the post-mortem of a closed trade
+type Reflector interface {
+	Reflect(ctx context.Context, trade *TradeRecord, memory string) (*TradeReflection, error)
+}
+
+const reflectPrompt = `You review the closed trades of a crypto trading assistant. Write a post-mortem of the trade below.
+
+Judge the decisions with what was known when they were made, not with hindsight alone. Compare the exit with the maximum favorable and adverse excursions: was the stop too tight or too loose, was profit left on the table, was the entry late.
+
+Respond with only a JSON object:
+{
+  "summary": "one sentence on the trade and its result",
+  "went_right": ["what went right"],
+  "went_wrong": ["what went wrong"],
+  "rule_key": "short ID of the rule, reuse the ID of an existing rule to refine it",
+  "rule": "one concrete rule to adopt, empty when the trade teaches nothing new"
+}
+
+Trade:
+%s
+
+Current memory:
+%s`
+
+// LLMReflector reflects on trades with the reflection llm route
+type LLMReflector struct {
+	llm llms.Model
+}
+
+// NewLLMReflector creates a reflector on llm
+func NewLLMReflector(llm llms.Model) *LLMReflector {
+	return &LLMReflector{
+		llm: llm,
+	}
+}
+
+func (r *LLMReflector) Reflect(ctx context.Context, trade *TradeRecord, memory string) (*TradeReflection, error) {
+	if strings.TrimSpace(memory) == "" {
+		memory = "(empty)"
+	}
+
+	ctx = task.WithTask(ctx, task.Reflection)
+	result, err := llms.GenerateFromSinglePrompt(ctx, r.llm, fmt.Sprintf(reflectPrompt, trade.String(), memory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reflect on trade: %w", err)
+	}
+
+	return ParseReflection(result)
+}
+
+// ParseReflection parses the JSON post-mortem of a trade, text around the
+// JSON object is ignored
+func ParseReflection(text string) (*TradeReflection, error) {
+	text = stripCodeFence(text)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("failed to parse reflection: no JSON object in %q", text)
+	}
+
+	var reflection TradeReflection
+	if err := json.Unmarshal([]byte(text[start:end+1]), &reflection); err != nil {
+		return nil, fmt.Errorf("failed to parse reflection: %w", err)
+	}
+
+	reflection.Summary = strings.TrimSpace(reflection.Summary)
+	reflection.RuleKey = strings.TrimSpace(reflection.RuleKey)
+	reflection.Rule = strings.TrimSpace(reflection.Rule)
+	if reflection.Summary == "" && reflection.Rule == "" && len(reflection.WentRight) == 0 && len(reflection.WentWrong) == 0 {
+		return nil, fmt.Errorf("failed to parse reflection: empty result")
+	}
+
+	return &reflection, nil
+}
+
+// String formats the reflection for chat
+func (r *TradeReflection) String() string {
+	var text strings.Builder
+	text.WriteString(r.Summary)
+
+	write := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		text.WriteString("\n" + title + ":")
+		for _, item := range items {
+			text.WriteString("\n- " + item)
+		}
+	}
+	write("Went right", r.WentRight)
+	write("Went wrong", r.WentWrong)
+
+	if r.Rule != "" {
+		text.WriteString(fmt.Sprintf("\nRule to adopt [%s]: %s", r.ruleKey(), r.Rule))
+	}
+
+	return strings.TrimSpace(text.String())
+}
+
+func (r *TradeReflection) ruleKey() string {
+	if r.RuleKey != "" {
+		return r.RuleKey
+	}
+
+	return "reflection"
+}
+
+// reflectionNote is a one line summary of a reflected trade
+func reflectionNote(trade *TradeRecord) string {
+	r := trade.Reflection
+	note := fmt.Sprintf("%s %s %s %+.2f%% (%s, MFE %+.2f%%, MAE %+.2f%%)",
+		trade.OpenedAt.UTC().Format("2006-01-02"), trade.Symbol, trade.Side,
+		trade.ProfitAndLossPercent, trade.CloseReason, trade.MFEPercent, trade.MAEPercent)
+
+	if r.Summary != "" {
+		note += ": " + r.Summary
+	}
+	if len(r.WentWrong) > 0 {
+		note += " Went wrong: " + strings.Join(r.WentWrong, "; ")
+	}
+
+	return note
+}
+
+// ReflectionUpdates returns the structured memory updates of a reflected
+// trade: the rule is merged into the trading rules and the trade is noted in
+// the mistakes. Sections missing from specs, or with another mode, are
+// left out.
+func ReflectionUpdates(trade *TradeRecord, specs []*SectionSpec) map[string]*types.MemorySectionUpdate {
+	updates := make(map[string]*types.MemorySectionUpdate)
+	if trade.Reflection == nil {
+		return updates
+	}
+
+	for _, spec := range specs {
+		switch {
+		case spec.Name == ReflectionRulesSection && spec.Mode == SectionModeMerge && trade.Reflection.Rule != "":
+			updates[spec.Name] = &types.MemorySectionUpdate{
+				Merge: map[string]string{trade.Reflection.ruleKey(): trade.Reflection.Rule},
+			}
+		case spec.Name == ReflectionMistakesSection && spec.Mode == SectionModeAppend && len(trade.Reflection.WentWrong) > 0:
+			updates[spec.Name] = &types.MemorySectionUpdate{
+				Append: []string{reflectionNote(trade)},
+			}
+		}
+	}
+
+	return updates
+}
+
+// AppendReflection adds a reflected trade to a free-form memory, under the
+// trade reflections heading
+func AppendReflection(content string, trade *TradeRecord) string {
+	if trade.Reflection == nil {
+		return content
+	}
+
+	block := []string{"- " + reflectionNote(trade)}
+	if trade.Reflection.Rule != "" {
+		block = append(block, "  Rule: "+trade.Reflection.Rule)
+	}
+
+	sections := parseMarkdown(content)
+	for _, section := range sections {
+		if len(section.heading) > 0 && strings.TrimSpace(section.heading[0]) == reflectionsTitle {
+			// The blank lines before the next heading move below the new bullet
+			if n := len(section.blocks); n > 0 {
+				last := section.blocks[n-1]
+				for len(last) > 0 && strings.TrimSpace(last[len(last)-1]) == "" {
+					last = last[:len(last)-1]
+					block = append(block, "")
+				}
+				section.blocks[n-1] = last
+			}
+			section.blocks = append(section.blocks, block)
+			return renderMarkdown(sections)
+		}
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return reflectionsTitle + "\n" + strings.Join(block, "\n") + "\n"
+	}
+
+	return strings.TrimRight(content, "\n ") + "\n\n" + reflectionsTitle + "\n" + strings.Join(block, "\n") + "\n"
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func reflectedTrade() *TradeRecord {
+	return &TradeRecord{
+		Symbol:               "BTCUSDT",
+		Side:                 "long",
+		OpenedAt:             time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+		ProfitAndLossPercent: -1.5,
+		CloseReason:          "StopLoss",
+		MFEPercent:           2,
+		MAEPercent:           -1.5,
+		Reflection: &TradeReflection{
+			Summary:   "Long stopped out after a fakeout.",
+			WentWrong: []string{"Stop inside the range noise"},
+			RuleKey:   "R7",
+			Rule:      "Place stops beyond the 4h swing low",
+		},
+	}
+}
+
+func TestParseReflection(t *testing.T) {
+	reflection, err := ParseReflection("Here it is:\n```json\n{\"summary\":\" ok \",\"went_right\":[\"entry\"],\"rule_key\":\"R1\",\"rule\":\"x\"}\n```")
+	if err != nil {
+		t.Fatalf("Failed to parse reflection: %v", err)
+	}
+	if reflection.Summary != "ok" || reflection.RuleKey != "R1" || len(reflection.WentRight) != 1 {
+		t.Errorf("Unexpected reflection: %+v", reflection)
+	}
+
+	if _, err := ParseReflection("no json"); err == nil {
+		t.Error("Expected an error without JSON")
+	}
+	if _, err := ParseReflection("{}"); err == nil {
+		t.Error("Expected an error for an empty reflection")
+	}
+}
+
+func TestReflectionUpdates(t *testing.T) {
+	updates := ReflectionUpdates(reflectedTrade(), DefaultSectionSpecs(1000))
+
+	rules := updates[ReflectionRulesSection]
+	if rules == nil || rules.Merge["R7"] != "Place stops beyond the 4h swing low" {
+		t.Errorf("Unexpected rules update: %+v", rules)
+	}
+
+	mistakes := updates[ReflectionMistakesSection]
+	if mistakes == nil || len(mistakes.Append) != 1 || !strings.Contains(mistakes.Append[0], "Stop inside the range noise") {
+		t.Errorf("Unexpected mistakes update: %+v", mistakes)
+	}
+
+	if len(ReflectionUpdates(reflectedTrade(), []*SectionSpec{{Name: ReflectionRulesSection, Mode: SectionModeReplace}})) != 0 {
+		t.Error("Expected no update of a rules section in replace mode")
+	}
+}
+
+func TestAppendReflection(t *testing.T) {
+	content := AppendReflection("## Market Insights\n- Range bound\n", reflectedTrade())
+	content = AppendReflection(content, reflectedTrade())
+
+	if strings.Count(content, reflectionsTitle) != 1 {
+		t.Fatalf("Expected one reflections heading:\n%s", content)
+	}
+	if strings.Count(content, "  Rule: Place stops beyond the 4h swing low") != 2 {
+		t.Errorf("Expected both reflections with their rule:\n%s", content)
+	}
+
+	// Reflections above another section keep the blank line before it
+	content = AppendReflection(reflectionsTitle+"\n- first\n\n## Other\n- x\n", reflectedTrade())
+	if !strings.Contains(content, "swing low\n\n## Other") {
+		t.Errorf("Unexpected layout:\n%s", content)
+	}
+}
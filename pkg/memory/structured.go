@@ -0,0 +1,331 @@
+package memory
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+// Update modes of a memory section
+const (
+	SectionModeReplace = "replace" // The section is rewritten as a whole
+	SectionModeAppend  = "append"  // Entries are added, the oldest are dropped over budget
+	SectionModeMerge   = "merge"   // Entries are set or removed by key, the least recently updated are dropped over budget
+)
+
+// structuredTitle is the top heading of a structured memory file
+const structuredTitle = "# Trading Memory"
+
+var entryKeyPattern = regexp.MustCompile(`^\[([^\]]+)\]\s*(.*)$`)
+
+// SectionSpec defines a section of the structured memory
+type SectionSpec struct {
+	Name        string // Key used by the memory output, such as trading_rules
+	Title       string // Markdown heading
+	Mode        string // SectionModeReplace, SectionModeAppend or SectionModeMerge
+	MaxWords    int
+	Description string // What belongs in the section, shown to the model
+}
+
+// DefaultSectionSpecs returns the default sections, sharing maxWords
+func DefaultSectionSpecs(maxWords int) []*SectionSpec {
+	return []*SectionSpec{
+		{Name: "trading_rules", Title: "Trading Rules Learned", Mode: SectionModeMerge, MaxWords: maxWords * 30 / 100,
+			Description: "durable rules learned from trades, keyed by a short rule ID"},
+		{Name: "market_regime", Title: "Market Regime Notes", Mode: SectionModeReplace, MaxWords: maxWords * 15 / 100,
+			Description: "the current trend, volatility and sentiment regime and what works in it"},
+		{Name: "setup_stats", Title: "Per-Setup Statistics", Mode: SectionModeMerge, MaxWords: maxWords * 20 / 100,
+			Description: "trades, win rate and average R per setup, keyed by setup name"},
+		{Name: "hypotheses", Title: "Open Hypotheses", Mode: SectionModeMerge, MaxWords: maxWords * 15 / 100,
+			Description: "ideas to test, keyed by hypothesis ID, remove them once confirmed or rejected"},
+		{Name: "mistakes", Title: "Mistakes To Avoid", Mode: SectionModeAppend, MaxWords: maxWords * 20 / 100,
+			Description: "one entry per mistake with the lesson"},
+	}
+}
+
+// ValidateSectionSpecs checks names, modes and budgets of the sections
+func ValidateSectionSpecs(specs []*SectionSpec) error {
+	names := make(map[string]bool)
+	for _, spec := range specs {
+		if spec.Name == "" || spec.Title == "" {
+			return fmt.Errorf("memory section needs a name and a title")
+		}
+		if names[spec.Name] {
+			return fmt.Errorf("duplicate memory section %s", spec.Name)
+		}
+		names[spec.Name] = true
+
+		switch spec.Mode {
+		case SectionModeReplace, SectionModeAppend, SectionModeMerge:
+		default:
+			return fmt.Errorf("memory section %s has unknown mode %q", spec.Name, spec.Mode)
+		}
+
+		if spec.MaxWords <= 0 {
+			return fmt.Errorf("memory section %s needs max_words", spec.Name)
+		}
+	}
+
+	return nil
+}
+
+type sectionEntry struct {
+	Key  string
+	Text string
+}
+
+// MemorySection is a section of the structured memory with its content
+type MemorySection struct {
+	Spec    *SectionSpec
+	Text    string          // Content of a replace section
+	Entries []*sectionEntry // Entries of append and merge sections, oldest first
+}
+
+// Content renders the section body
+func (s *MemorySection) Content() string {
+	if s.Spec.Mode == SectionModeReplace {
+		return strings.TrimSpace(s.Text)
+	}
+
+	lines := make([]string, 0, len(s.Entries))
+	for _, entry := range s.Entries {
+		if s.Spec.Mode == SectionModeMerge {
+			lines = append(lines, fmt.Sprintf("- [%s] %s", entry.Key, entry.Text))
+		} else {
+			lines = append(lines, "- "+entry.Text)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Words returns the words of the section body
+func (s *MemorySection) Words() int {
+	return countWords(s.Content())
+}
+
+func (s *MemorySection) setContent(content string) {
+	if s.Spec.Mode == SectionModeReplace {
+		s.Text = strings.TrimSpace(content)
+		return
+	}
+
+	s.Entries = parseEntries(content, s.Spec.Mode == SectionModeMerge)
+}
+
+func (s *MemorySection) merge(key, text string) {
+	for i, entry := range s.Entries {
+		if entry.Key == key {
+			s.Entries = append(s.Entries[:i], s.Entries[i+1:]...)
+			break
+		}
+	}
+
+	// Updated entries move to the end, so the least recently updated are dropped first
+	if text != "" {
+		s.Entries = append(s.Entries, &sectionEntry{Key: key, Text: text})
+	}
+}
+
+// fit drops the oldest entries, or truncates the text, to the section budget
+func (s *MemorySection) fit() bool {
+	if s.Words() <= s.Spec.MaxWords {
+		return false
+	}
+
+	if s.Spec.Mode == SectionModeReplace {
+		s.Text = strings.TrimSpace(TruncateSections(s.Text, s.Spec.MaxWords))
+		return true
+	}
+
+	for len(s.Entries) > 1 && s.Words() > s.Spec.MaxWords {
+		s.Entries = s.Entries[1:]
+	}
+
+	if len(s.Entries) == 1 && s.Words() > s.Spec.MaxWords {
+		s.Entries[0].Text = truncateSentences(s.Entries[0].Text, s.Spec.MaxWords-countWords(s.Entries[0].Key))
+	}
+
+	return true
+}
+
+// parseEntries splits bullets into entries, continuation lines join the
+// entry above. Merge entries take their key from a leading [key].
+func parseEntries(content string, keyed bool) []*sectionEntry {
+	entries := make([]*sectionEntry, 0)
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if bulletPattern.MatchString(trimmed) || len(entries) == 0 {
+			text := strings.TrimSpace(bulletPattern.ReplaceAllString(trimmed, ""))
+			entry := &sectionEntry{Text: text}
+			if keyed {
+				if m := entryKeyPattern.FindStringSubmatch(text); m != nil {
+					entry.Key = strings.TrimSpace(m[1])
+					entry.Text = strings.TrimSpace(m[2])
+				} else {
+					entry.Key = fmt.Sprintf("note-%d", len(entries)+1)
+				}
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		last := entries[len(entries)-1]
+		last.Text = strings.TrimSpace(last.Text + " " + trimmed)
+	}
+
+	return entries
+}
+
+// StructuredMemory is the memory split into typed sections. Content outside
+// the known sections, such as a memory written before sections were enabled,
+// is kept as is in the preamble.
+type StructuredMemory struct {
+	Preamble string
+	Sections []*MemorySection
+}
+
+// ParseStructured splits memory markdown into the sections of specs by their headings
+func ParseStructured(content string, specs []*SectionSpec) *StructuredMemory {
+	sm := &StructuredMemory{}
+	byTitle := make(map[string]*MemorySection)
+	for _, spec := range specs {
+		section := &MemorySection{Spec: spec}
+		sm.Sections = append(sm.Sections, section)
+		byTitle[strings.ToLower(spec.Title)] = section
+		byTitle[strings.ToLower(spec.Name)] = section
+	}
+
+	preamble := make([]string, 0)
+	bodies := make(map[*MemorySection][]string)
+	var current *MemorySection
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == structuredTitle {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "## ") {
+			if section, ok := byTitle[strings.ToLower(strings.TrimSpace(trimmed[3:]))]; ok {
+				current = section
+				continue
+			}
+			current = nil
+		}
+
+		if current != nil {
+			bodies[current] = append(bodies[current], line)
+		} else {
+			preamble = append(preamble, line)
+		}
+	}
+
+	for section, lines := range bodies {
+		section.setContent(strings.Join(lines, "\n"))
+	}
+	sm.Preamble = strings.TrimSpace(strings.Join(preamble, "\n"))
+
+	return sm
+}
+
+// Section returns a section by name
+func (sm *StructuredMemory) Section(name string) (*MemorySection, bool) {
+	for _, section := range sm.Sections {
+		if section.Spec.Name == name {
+			return section, true
+		}
+	}
+
+	return nil, false
+}
+
+// Apply applies section updates, then fits every section into its budget.
+// Updates of unknown sections or not matching the section's mode are
+// skipped and reported in the returned notes.
+func (sm *StructuredMemory) Apply(updates map[string]*types.MemorySectionUpdate) []string {
+	names := make([]string, 0, len(updates))
+	for name := range updates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	notes := make([]string, 0)
+	for _, name := range names {
+		update := updates[name]
+		if update == nil {
+			continue
+		}
+
+		section, ok := sm.Section(name)
+		if !ok {
+			notes = append(notes, fmt.Sprintf("unknown memory section %s skipped", name))
+			continue
+		}
+
+		if update.Content != "" {
+			section.setContent(update.Content)
+		}
+
+		if len(update.Append) > 0 {
+			if section.Spec.Mode != SectionModeAppend {
+				notes = append(notes, fmt.Sprintf("append skipped, memory section %s is %s", name, section.Spec.Mode))
+			} else {
+				for _, text := range update.Append {
+					if text = strings.TrimSpace(bulletPattern.ReplaceAllString(strings.TrimSpace(text), "")); text != "" {
+						section.Entries = append(section.Entries, &sectionEntry{Text: text})
+					}
+				}
+			}
+		}
+
+		if len(update.Merge) > 0 {
+			if section.Spec.Mode != SectionModeMerge {
+				notes = append(notes, fmt.Sprintf("merge skipped, memory section %s is %s", name, section.Spec.Mode))
+			} else {
+				keys := make([]string, 0, len(update.Merge))
+				for key := range update.Merge {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+
+				for _, key := range keys {
+					section.merge(strings.TrimSpace(key), strings.TrimSpace(update.Merge[key]))
+				}
+			}
+		}
+	}
+
+	for _, section := range sm.Sections {
+		if section.fit() {
+			notes = append(notes, fmt.Sprintf("memory section %s trimmed to %d words", section.Spec.Name, section.Spec.MaxWords))
+		}
+	}
+
+	return notes
+}
+
+// String renders the structured memory as markdown
+func (sm *StructuredMemory) String() string {
+	var text strings.Builder
+	text.WriteString(structuredTitle + "\n")
+
+	if sm.Preamble != "" {
+		text.WriteString("\n" + sm.Preamble + "\n")
+	}
+
+	for _, section := range sm.Sections {
+		text.WriteString(fmt.Sprintf("\n## %s\n", section.Spec.Title))
+		if content := section.Content(); content != "" {
+			text.WriteString(content + "\n")
+		}
+	}
+
+	return text.String()
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func TestStructuredMemory_ParseAndRender(t *testing.T) {
+	specs := DefaultSectionSpecs(1000)
+	content := `# Trading Memory
+
+Legacy note kept as is.
+
+## Trading Rules Learned
+- [R1] Wait for the 4h close above resistance.
+- A rule without key
+  continued on the next line.
+
+## Market Regime Notes
+Range bound, low volatility.
+
+## Mistakes To Avoid
+- Chased a breakout without volume.
+`
+
+	sm := ParseStructured(content, specs)
+	if sm.Preamble != "Legacy note kept as is." {
+		t.Errorf("Unexpected preamble: %q", sm.Preamble)
+	}
+
+	rules, _ := sm.Section("trading_rules")
+	if len(rules.Entries) != 2 || rules.Entries[0].Key != "R1" || rules.Entries[1].Key != "note-2" {
+		t.Fatalf("Unexpected rules: %+v", rules.Entries)
+	}
+	if rules.Entries[1].Text != "A rule without key continued on the next line." {
+		t.Errorf("Expected continuation lines joined, got %q", rules.Entries[1].Text)
+	}
+
+	regime, _ := sm.Section("market_regime")
+	if regime.Content() != "Range bound, low volatility." {
+		t.Errorf("Unexpected regime: %q", regime.Content())
+	}
+
+	// Rendering and parsing again is stable
+	if again := ParseStructured(sm.String(), specs).String(); again != sm.String() {
+		t.Errorf("Expected a stable render, got:\n%s\nthen:\n%s", sm.String(), again)
+	}
+}
+
+func TestStructuredMemory_Apply(t *testing.T) {
+	specs := []*SectionSpec{
+		{Name: "rules", Title: "Rules", Mode: SectionModeMerge, MaxWords: 12},
+		{Name: "regime", Title: "Regime", Mode: SectionModeReplace, MaxWords: 20},
+		{Name: "mistakes", Title: "Mistakes", Mode: SectionModeAppend, MaxWords: 8},
+	}
+	if err := ValidateSectionSpecs(specs); err != nil {
+		t.Fatalf("Unexpected invalid specs: %v", err)
+	}
+
+	sm := ParseStructured("## Rules\n- [R1] old rule\n- [R2] second rule\n\n## Mistakes\n- first mistake\n", specs)
+
+	notes := sm.Apply(map[string]*types.MemorySectionUpdate{
+		"rules":    {Merge: map[string]string{"R1": "updated rule", "R2": "", "R3": "third rule"}},
+		"regime":   {Content: "Trending up.", Append: []string{"ignored"}},
+		"mistakes": {Append: []string{"- second mistake", "third mistake"}},
+		"unknown":  {Content: "x"},
+	})
+
+	rules, _ := sm.Section("rules")
+	if rules.Content() != "- [R1] updated rule\n- [R3] third rule" {
+		t.Errorf("Unexpected merged rules:\n%s", rules.Content())
+	}
+
+	regime, _ := sm.Section("regime")
+	if regime.Content() != "Trending up." {
+		t.Errorf("Unexpected regime: %q", regime.Content())
+	}
+
+	// 3 entries of 3 words are over 8 words, the oldest is dropped
+	mistakes, _ := sm.Section("mistakes")
+	if mistakes.Content() != "- second mistake\n- third mistake" {
+		t.Errorf("Unexpected mistakes:\n%s", mistakes.Content())
+	}
+
+	joined := strings.Join(notes, "\n")
+	for _, want := range []string{"unknown memory section unknown", "append skipped, memory section regime", "memory section mistakes trimmed"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected note %q in:\n%s", want, joined)
+		}
+	}
+
+	// Merge updates move the entry to the end, the least recently updated is dropped over budget
+	sm.Apply(map[string]*types.MemorySectionUpdate{
+		"rules": {Merge: map[string]string{"R4": "a much longer fourth rule"}},
+	})
+	if rules.Content() != "- [R3] third rule\n- [R4] a much longer fourth rule" {
+		t.Errorf("Unexpected rules over budget:\n%s", rules.Content())
+	}
+
+	if err := ValidateSectionSpecs([]*SectionSpec{{Name: "a", Title: "A", Mode: "upsert", MaxWords: 1}}); err == nil {
+		t.Error("Expected an unknown mode to be invalid")
+	}
+}
+
+func TestMemoryManagerUpdateSections(t *testing.T) {
+	mm := NewMemoryManager(filepath.Join(t.TempDir(), "memory.md"), 1000)
+	mm.SetSections(DefaultSectionSpecs(1000))
+
+	saved, _, notes, err := mm.UpdateSections(context.Background(), map[string]*types.MemorySectionUpdate{
+		"hypotheses": {Merge: map[string]string{"H1": "Funding above 0.05% marks local tops"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update sections: %v", err)
+	}
+	if len(notes) != 0 {
+		t.Errorf("Unexpected notes: %v", notes)
+	}
+
+	if !strings.Contains(saved, "## Open Hypotheses\n- [H1] Funding above 0.05% marks local tops") {
+		t.Errorf("Unexpected memory:\n%s", saved)
+	}
+
+	sm, err := mm.LoadStructured()
+	if err != nil {
+		t.Fatalf("Failed to load structured memory: %v", err)
+	}
+	hypotheses, _ := sm.Section("hypotheses")
+	if len(hypotheses.Entries) != 1 {
+		t.Errorf("Expected the hypothesis to be saved, got %d entries", len(hypotheses.Entries))
+	}
+}
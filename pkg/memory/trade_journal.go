@@ -0,0 +1,364 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TradeDecision is a decision of the agent on an open trade
+type TradeDecision struct {
+	Timestamp time.Time `json:"timestamp"`
+	CycleID   string    `json:"cycle_id,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Action    string    `json:"action"`              // Action JSON
+	Reasoning string    `json:"reasoning,omitempty"` // Short reasoning given by the model
+}
+
+// TradeReflection is the post-mortem of a closed trade
+type TradeReflection struct {
+	Summary   string   `json:"summary"`
+	WentRight []string `json:"went_right"`
+	WentWrong []string `json:"went_wrong"`
+	RuleKey   string   `json:"rule_key,omitempty"` // Short ID of the rule, reused to refine an existing rule
+	Rule      string   `json:"rule,omitempty"`     // Rule to adopt, empty when there is nothing new to learn
+}
+
+// TradeRecord is a trade from its first decision to its close
+type TradeRecord struct {
+	ID         string    `json:"id"`
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"` // long or short
+	OpenedAt   time.Time `json:"opened_at"`
+	EntryPrice float64   `json:"entry_price"`
+
+	// Price path while the trade was open
+	HighPrice float64 `json:"high_price"`
+	LowPrice  float64 `json:"low_price"`
+
+	Decisions []*TradeDecision `json:"decisions"`
+
+	ClosedAt             *time.Time       `json:"closed_at,omitempty"`
+	ExitPrice            float64          `json:"exit_price,omitempty"`
+	Quantity             float64          `json:"quantity,omitempty"`
+	ProfitAndLoss        float64          `json:"profit_and_loss,omitempty"`
+	ProfitAndLossPercent float64          `json:"profit_and_loss_percent,omitempty"`
+	CloseReason          string           `json:"close_reason,omitempty"`
+	MFEPercent           float64          `json:"mfe_percent"` // Maximum favorable excursion from the entry price
+	MAEPercent           float64          `json:"mae_percent"` // Maximum adverse excursion from the entry price, zero or negative
+	Reflection           *TradeReflection `json:"reflection,omitempty"`
+}
+
+// ObservePrice widens the price path of the trade
+func (t *TradeRecord) ObservePrice(high, low float64) {
+	if high > 0 && high > t.HighPrice {
+		t.HighPrice = high
+	}
+	if low > 0 && (t.LowPrice == 0 || low < t.LowPrice) {
+		t.LowPrice = low
+	}
+}
+
+// excursions returns the maximum favorable and adverse excursions in percent
+func (t *TradeRecord) excursions() (float64, float64) {
+	if t.EntryPrice <= 0 || t.HighPrice <= 0 || t.LowPrice <= 0 {
+		return 0, 0
+	}
+
+	up := (t.HighPrice - t.EntryPrice) / t.EntryPrice * 100
+	down := (t.LowPrice - t.EntryPrice) / t.EntryPrice * 100
+	if t.Side == "short" {
+		up, down = -down, -up
+	}
+
+	if up < 0 {
+		up = 0
+	}
+	if down > 0 {
+		down = 0
+	}
+
+	return up, down
+}
+
+// String formats the trade for the reflection prompt
+func (t *TradeRecord) String() string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Symbol: %s\nSide: %s\nOpened: %s\nEntry price: %g\n",
+		t.Symbol, t.Side, t.OpenedAt.UTC().Format(time.RFC3339), t.EntryPrice))
+
+	if t.ClosedAt != nil {
+		text.WriteString(fmt.Sprintf("Closed: %s after %s\nExit price: %g\nClose reason: %s\nPnL: %.2f (%+.2f%%)\n",
+			t.ClosedAt.UTC().Format(time.RFC3339), t.ClosedAt.Sub(t.OpenedAt).Round(time.Minute),
+			t.ExitPrice, t.CloseReason, t.ProfitAndLoss, t.ProfitAndLossPercent))
+	}
+
+	text.WriteString(fmt.Sprintf("Price range while open: %g - %g\nMax favorable excursion: %+.2f%%\nMax adverse excursion: %+.2f%%\n",
+		t.LowPrice, t.HighPrice, t.MFEPercent, t.MAEPercent))
+
+	text.WriteString("Decisions:")
+	if len(t.Decisions) == 0 {
+		text.WriteString(" none recorded")
+	}
+	for _, d := range t.Decisions {
+		text.WriteString(fmt.Sprintf("\n- %s %s", d.Timestamp.UTC().Format("2006-01-02 15:04"), d.Action))
+		if d.Reasoning != "" {
+			text.WriteString(": " + d.Reasoning)
+		}
+	}
+
+	return text.String()
+}
+
+// TradeCloseData is the close of a trade reported by the exchange
+type TradeCloseData struct {
+	ExitPrice            float64
+	Quantity             float64
+	ProfitAndLoss        float64
+	ProfitAndLossPercent float64
+	CloseReason          string
+	ClosedAt             time.Time
+}
+
+// ErrNoOpenTrade is returned when closing a trade while none is open
+var ErrNoOpenTrade = errors.New("no open trade")
+
+// TradeJournal keeps the open trade and appends closed trades to a journal,
+// one JSON trade per line. The open trade is saved next to the journal so
+// its decisions survive a restart.
+type TradeJournal struct {
+	journalPath string
+	openPath    string
+
+	mu   sync.Mutex
+	open *TradeRecord
+}
+
+// NewTradeJournal creates a journal stored at journalPath
+func NewTradeJournal(journalPath string) *TradeJournal {
+	return &TradeJournal{
+		journalPath: journalPath,
+		openPath:    strings.TrimSuffix(journalPath, filepath.Ext(journalPath)) + ".open.json",
+	}
+}
+
+// Load reads the open trade, a missing file means no open trade
+func (j *TradeJournal) Load() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.openPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			j.open = nil
+			return nil
+		}
+		return fmt.Errorf("failed to read open trade: %w", err)
+	}
+
+	var trade TradeRecord
+	if err := json.Unmarshal(data, &trade); err != nil {
+		return fmt.Errorf("failed to parse open trade: %w", err)
+	}
+
+	j.open = &trade
+	return nil
+}
+
+// Open returns a copy of the open trade, nil if none
+func (j *TradeJournal) Open() *TradeRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.open == nil {
+		return nil
+	}
+
+	trade := *j.open
+	trade.Decisions = append([]*TradeDecision{}, j.open.Decisions...)
+	return &trade
+}
+
+// Start opens a trade unless one is open already
+func (j *TradeJournal) Start(trade *TradeRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.open != nil {
+		return nil
+	}
+
+	if trade.Decisions == nil {
+		trade.Decisions = make([]*TradeDecision, 0)
+	}
+	trade.ObservePrice(trade.EntryPrice, trade.EntryPrice)
+
+	j.open = trade
+	return j.saveOpen()
+}
+
+// AddDecision records a decision on the open trade, it is a no-op without one
+func (j *TradeJournal) AddDecision(decision *TradeDecision) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.open == nil {
+		return nil
+	}
+
+	j.open.Decisions = append(j.open.Decisions, decision)
+	return j.saveOpen()
+}
+
+// ObservePrice widens the price path of the open trade
+func (j *TradeJournal) ObservePrice(high, low float64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.open == nil {
+		return nil
+	}
+
+	previousHigh, previousLow := j.open.HighPrice, j.open.LowPrice
+	j.open.ObservePrice(high, low)
+	if j.open.HighPrice == previousHigh && j.open.LowPrice == previousLow {
+		return nil
+	}
+
+	return j.saveOpen()
+}
+
+// Close finishes the open trade with the close data and returns it, the
+// returned trade is not in the journal until it is appended. Without an open
+// trade it returns ErrNoOpenTrade, a close is never journaled twice.
+func (j *TradeJournal) Close(entryPrice float64, data TradeCloseData) (*TradeRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	trade := j.open
+	if trade == nil {
+		return nil, ErrNoOpenTrade
+	}
+
+	if entryPrice > 0 {
+		trade.EntryPrice = entryPrice
+	}
+	if trade.Side == "" {
+		trade.Side = "long"
+		if (data.ExitPrice-trade.EntryPrice)*data.ProfitAndLoss < 0 {
+			trade.Side = "short"
+		}
+	}
+
+	closedAt := data.ClosedAt
+	trade.ClosedAt = &closedAt
+	trade.ExitPrice = data.ExitPrice
+	trade.Quantity = data.Quantity
+	trade.ProfitAndLoss = data.ProfitAndLoss
+	trade.ProfitAndLossPercent = data.ProfitAndLossPercent
+	trade.CloseReason = data.CloseReason
+	trade.ObservePrice(trade.EntryPrice, trade.EntryPrice)
+	trade.ObservePrice(data.ExitPrice, data.ExitPrice)
+	trade.MFEPercent, trade.MAEPercent = trade.excursions()
+
+	j.open = nil
+	if err := os.Remove(j.openPath); err != nil && !os.IsNotExist(err) {
+		return trade, fmt.Errorf("failed to remove open trade: %w", err)
+	}
+
+	return trade, nil
+}
+
+// Append appends a closed trade to the journal
+func (j *TradeJournal) Append(trade *TradeRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.Marshal(trade)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trade: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.journalPath), 0755); err != nil {
+		return fmt.Errorf("failed to create trade journal directory: %w", err)
+	}
+
+	f, err := os.OpenFile(j.journalPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open trade journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append trade: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the closed trades of the journal, oldest first
+func (j *TradeJournal) List() ([]*TradeRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Open(j.journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*TradeRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to open trade journal: %w", err)
+	}
+	defer f.Close()
+
+	trades := make([]*TradeRecord, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var trade TradeRecord
+		if err := json.Unmarshal([]byte(line), &trade); err != nil {
+			return nil, fmt.Errorf("failed to parse trade: %w", err)
+		}
+		trades = append(trades, &trade)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trade journal: %w", err)
+	}
+
+	return trades, nil
+}
+
+// saveOpen writes the open trade to file using atomic write
+func (j *TradeJournal) saveOpen() error {
+	if err := os.MkdirAll(filepath.Dir(j.openPath), 0755); err != nil {
+		return fmt.Errorf("failed to create trade journal directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(j.open, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal open trade: %w", err)
+	}
+
+	tempPath := j.openPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp open trade file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, j.openPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp open trade file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTradeJournal_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trade-journal.jsonl")
+	journal := NewTradeJournal(path)
+
+	openedAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	if err := journal.Start(&TradeRecord{ID: "t1", Symbol: "BTCUSDT", Side: "short", OpenedAt: openedAt, EntryPrice: 100}); err != nil {
+		t.Fatalf("Failed to start trade: %v", err)
+	}
+	if err := journal.AddDecision(&TradeDecision{Timestamp: openedAt, Action: `{"name":"open_short_position"}`}); err != nil {
+		t.Fatalf("Failed to add decision: %v", err)
+	}
+	if err := journal.ObservePrice(103, 95); err != nil {
+		t.Fatalf("Failed to observe price: %v", err)
+	}
+
+	// The open trade survives a restart
+	journal = NewTradeJournal(path)
+	if err := journal.Load(); err != nil {
+		t.Fatalf("Failed to load open trade: %v", err)
+	}
+	open := journal.Open()
+	if open == nil || len(open.Decisions) != 1 || open.HighPrice != 103 || open.LowPrice != 95 {
+		t.Fatalf("Unexpected open trade: %+v", open)
+	}
+
+	trade, err := journal.Close(100, TradeCloseData{
+		ExitPrice:            98,
+		ProfitAndLoss:        2,
+		ProfitAndLossPercent: 2,
+		CloseReason:          "TakeProfit",
+		ClosedAt:             openedAt.Add(2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to close trade: %v", err)
+	}
+
+	// A short gains when the price falls
+	if math.Abs(trade.MFEPercent-5) > 1e-9 || math.Abs(trade.MAEPercent+3) > 1e-9 {
+		t.Errorf("Unexpected excursions MFE %v MAE %v", trade.MFEPercent, trade.MAEPercent)
+	}
+	if journal.Open() != nil {
+		t.Error("Expected no open trade after close")
+	}
+
+	// Decisions are only kept on an open trade
+	if err := journal.AddDecision(&TradeDecision{Action: "wait"}); err != nil {
+		t.Fatalf("Failed to add decision: %v", err)
+	}
+
+	trade.Reflection = &TradeReflection{Summary: "Clean short", Rule: "Short rejections of the range high"}
+	if err := journal.Append(trade); err != nil {
+		t.Fatalf("Failed to append trade: %v", err)
+	}
+
+	trades, err := journal.List()
+	if err != nil {
+		t.Fatalf("Failed to list trades: %v", err)
+	}
+	if len(trades) != 1 || trades[0].Reflection == nil || len(trades[0].Decisions) != 1 {
+		t.Fatalf("Unexpected journal: %+v", trades)
+	}
+	if !strings.Contains(trades[0].String(), "Close reason: TakeProfit") {
+		t.Errorf("Unexpected trade text:\n%s", trades[0].String())
+	}
+}
+
+func TestTradeJournal_CloseWithoutOpenTrade(t *testing.T) {
+	journal := NewTradeJournal(filepath.Join(t.TempDir(), "trade-journal.jsonl"))
+
+	trade, err := journal.Close(100, TradeCloseData{
+		ExitPrice:     90,
+		ProfitAndLoss: 10,
+		CloseReason:   "Manual",
+		ClosedAt:      time.Now(),
+	})
+	if !errors.Is(err, ErrNoOpenTrade) || trade != nil {
+		t.Fatalf("Expected ErrNoOpenTrade, got trade %+v and error %v", trade, err)
+	}
+
+	// A second close of the same trade is not journaled
+	if err := journal.Start(&TradeRecord{ID: "t1", Symbol: "BTCUSDT", Side: "long", EntryPrice: 100}); err != nil {
+		t.Fatalf("Failed to start trade: %v", err)
+	}
+	if _, err := journal.Close(100, TradeCloseData{ExitPrice: 110, ClosedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to close trade: %v", err)
+	}
+	if _, err := journal.Close(100, TradeCloseData{ExitPrice: 110, ClosedAt: time.Now()}); !errors.Is(err, ErrNoOpenTrade) {
+		t.Errorf("Expected ErrNoOpenTrade on the second close, got %v", err)
+	}
+}
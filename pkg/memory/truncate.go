@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"regexp"
+	"strings"
+)
+
+var bulletPattern = regexp.MustCompile(`^([-*+]|\d+[.)])\s`)
+
+// mdSection is a markdown heading with its blocks, a block is a top level
+// bullet with its nested lines or a paragraph, including trailing blank lines
+type mdSection struct {
+	heading []string
+	blocks  [][]string
+}
+
+func (s *mdSection) lines() []string {
+	lines := append([]string{}, s.heading...)
+	for _, block := range s.blocks {
+		lines = append(lines, block...)
+	}
+	return lines
+}
+
+func (s *mdSection) words() int {
+	return countWords(strings.Join(s.lines(), "\n"))
+}
+
+func countWords(content string) int {
+	return len(strings.Fields(content))
+}
+
+// parseMarkdown splits content into sections at headings and into blocks at
+// top level bullets and blank lines
+func parseMarkdown(content string) []*mdSection {
+	sections := []*mdSection{{}}
+	current := sections[0]
+	var block []string
+	blank := false
+
+	flush := func() {
+		if len(block) > 0 {
+			current.blocks = append(current.blocks, block)
+			block = nil
+		}
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#") && line == strings.TrimLeft(line, " \t"):
+			flush()
+			current = &mdSection{heading: []string{line}}
+			sections = append(sections, current)
+		case trimmed == "":
+			// Blank lines stay with the block before them
+			if len(block) > 0 {
+				block = append(block, line)
+			} else if len(current.blocks) > 0 {
+				last := len(current.blocks) - 1
+				current.blocks[last] = append(current.blocks[last], line)
+			} else {
+				current.heading = append(current.heading, line)
+			}
+			blank = true
+			continue
+		case bulletPattern.MatchString(line) || (blank && line == strings.TrimLeft(line, " \t")):
+			flush()
+			block = []string{line}
+		default:
+			block = append(block, line)
+		}
+		blank = false
+	}
+	flush()
+
+	if len(sections[0].heading) == 0 && len(sections[0].blocks) == 0 {
+		sections = sections[1:]
+	}
+
+	return sections
+}
+
+func renderMarkdown(sections []*mdSection) string {
+	lines := make([]string, 0)
+	for _, section := range sections {
+		lines = append(lines, section.lines()...)
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n ") + "\n"
+}
+
+// TruncateSections reduces markdown content to at most maxWords without
+// cutting it mid-structure: the last bullet or paragraph of the longest
+// section is dropped first, so every section keeps its leading items, then
+// trailing sections, and a single remaining block is cut at a sentence end.
+func TruncateSections(content string, maxWords int) string {
+	if countWords(content) <= maxWords {
+		return content
+	}
+
+	sections := parseMarkdown(content)
+	total := 0
+	for _, section := range sections {
+		total += section.words()
+	}
+
+	for total > maxWords {
+		var longest *mdSection
+		for _, section := range sections {
+			if len(section.blocks) > 1 && (longest == nil || section.words() > longest.words()) {
+				longest = section
+			}
+		}
+
+		if longest != nil {
+			last := longest.blocks[len(longest.blocks)-1]
+			total -= countWords(strings.Join(last, "\n"))
+			longest.blocks = longest.blocks[:len(longest.blocks)-1]
+			continue
+		}
+
+		if len(sections) > 1 {
+			total -= sections[len(sections)-1].words()
+			sections = sections[:len(sections)-1]
+			continue
+		}
+
+		break
+	}
+
+	result := renderMarkdown(sections)
+	if countWords(result) <= maxWords {
+		return result
+	}
+
+	return truncateSentences(result, maxWords)
+}
+
+// truncateSentences keeps the first maxWords words, ending at the last
+// complete sentence when there is one
+func truncateSentences(content string, maxWords int) string {
+	if maxWords <= 0 {
+		return ""
+	}
+
+	words := strings.Fields(content)
+	if len(words) <= maxWords {
+		return content
+	}
+
+	head := strings.Join(words[:maxWords], " ")
+	if end := strings.LastIndexAny(head, ".!?"); end > 0 {
+		return head[:end+1]
+	}
+
+	return head
+}
@@ -0,0 +1,168 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+var log = logrus.WithField("notify", "discord")
+
+// MaxContentLength is the maximum message length accepted by discord webhooks
+const MaxContentLength = 2000
+
+type DiscordMessage struct {
+	Content  string `json:"content"`
+	Username string `json:"username,omitempty"`
+}
+
+type DiscordNotifyChannel struct {
+	url      string
+	username string
+	client   *http.Client
+}
+
+func NewDiscordNotifyChannel(cfg *config.NotifyDiscordConfig) *DiscordNotifyChannel {
+	if cfg.URL == "" {
+		log.Fatal("URL required!")
+	}
+
+	log.WithField("username", cfg.Username).
+		Info("create discord notify channel")
+
+	return &DiscordNotifyChannel{
+		url:      cfg.URL,
+		username: cfg.Username,
+		client: &http.Client{
+			Timeout: time.Second * 20,
+		},
+	}
+}
+
+func (ch *DiscordNotifyChannel) GetID() string {
+	return "discord"
+}
+
+// Reply posts the message, splitting it into several posts when it exceeds the
+// discord content limit. An image is attached to the first post.
+func (ch *DiscordNotifyChannel) Reply(ctx context.Context, msg *types.Message) error {
+	image := msg.Image
+	for _, chunk := range splitContent(msg.Text, MaxContentLength) {
+		err := ch.post(ctx, chunk, image)
+		if err != nil {
+			return err
+		}
+
+		image = nil
+	}
+
+	return nil
+}
+
+func (ch *DiscordNotifyChannel) post(ctx context.Context, content string, image *types.Image) error {
+	body, _ := json.Marshal(&DiscordMessage{
+		Content:  content,
+		Username: ch.username,
+	})
+
+	contentType := "application/json"
+	if image != nil {
+		var err error
+		body, contentType, err = multipartBody(body, image)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ch.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	log.WithField("content", content).Debug("reply")
+
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("response error, status code: %d, detail: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// multipartBody builds a webhook request with the JSON payload and an attached file
+func multipartBody(payload []byte, image *types.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	err := writer.WriteField("payload_json", string(payload))
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := image.Name
+	if name == "" {
+		name = "image.png"
+	}
+
+	part, err := writer.CreateFormFile("files[0]", name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = part.Write(image.Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// splitContent splits text into chunks of at most maxLen runes, preferring line breaks
+func splitContent(text string, maxLen int) []string {
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return []string{text}
+	}
+
+	chunks := make([]string, 0)
+	for len(runes) > maxLen {
+		cut := maxLen
+		for i := maxLen - 1; i > maxLen/2; i-- {
+			if runes[i] == '\n' {
+				cut = i + 1
+				break
+			}
+		}
+
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+
+	return chunks
+}
@@ -0,0 +1,54 @@
+package discord
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+func TestSplitContent(t *testing.T) {
+	assert.Equal(t, []string{"short"}, splitContent("short", 10))
+
+	chunks := splitContent(strings.Repeat("a", 25), 10)
+	assert.Equal(t, []string{strings.Repeat("a", 10), strings.Repeat("a", 10), strings.Repeat("a", 5)}, chunks)
+
+	chunks = splitContent("line one\nline two\nline three", 12)
+	assert.Equal(t, "line one\n", chunks[0])
+	assert.Equal(t, "line one\nline two\nline three", strings.Join(chunks, ""))
+}
+
+func TestReplyWithImage(t *testing.T) {
+	var payload, fileName string
+	var file []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		payload = r.FormValue("payload_json")
+
+		f, header, err := r.FormFile("files[0]")
+		assert.NoError(t, err)
+		fileName = header.Filename
+		file, _ = io.ReadAll(f)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ch := NewDiscordNotifyChannel(&config.NotifyDiscordConfig{URL: server.URL})
+	err := ch.Reply(context.Background(), &types.Message{
+		Text:  "chart",
+		Image: &types.Image{Name: "chart.png", MIMEType: "image/png", Data: []byte("png")},
+	})
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"content": "chart"}`, payload)
+	assert.Equal(t, "chart.png", fileName)
+	assert.Equal(t, []byte("png"), file)
+}
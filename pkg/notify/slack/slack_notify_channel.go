@@ -0,0 +1,73 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+)
+
+var log = logrus.WithField("notify", "slack")
+
+type SlackMessage struct {
+	Text string `json:"text"`
+}
+
+type SlackNotifyChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifyChannel(cfg *config.NotifySlackConfig) *SlackNotifyChannel {
+	if cfg.URL == "" {
+		log.Fatal("URL required!")
+	}
+
+	log.Info("create slack notify channel")
+
+	return &SlackNotifyChannel{
+		url: cfg.URL,
+		client: &http.Client{
+			Timeout: time.Second * 20,
+		},
+	}
+}
+
+func (ch *SlackNotifyChannel) GetID() string {
+	return "slack"
+}
+
+func (ch *SlackNotifyChannel) Reply(ctx context.Context, msg *types.Message) error {
+	body, _ := json.Marshal(&SlackMessage{
+		Text: msg.Text,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ch.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	log.WithField("body", string(body)).Debug("reply")
+
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("response error, status code: %d, detail: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+	"github.com/yubing744/trading-gpt/pkg/utils"
+)
+
+var log = logrus.WithField("notify", "webhook")
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	DefaultTimeout       = time.Second * 10
+	DefaultMaxRetries    = 3
+	DefaultRetryBackoff  = time.Second
+	DefaultQueuePath     = "data/webhook-queue"
+	DefaultMaxQueueSize  = 1000
+	DefaultFlushInterval = time.Second * 30
+)
+
+// Payload is the JSON envelope posted for every event
+type Payload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Source    string      `json:"source"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// permanentError marks a delivery failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+type WebhookNotifyChannel struct {
+	url           string
+	secret        string
+	source        string
+	events        []string
+	maxRetries    int
+	retryBackoff  time.Duration
+	flushInterval time.Duration
+	client        *http.Client
+	queue         *DiskQueue
+	sendLock      sync.Mutex
+}
+
+func NewWebhookNotifyChannel(cfg *config.NotifyWebhookConfig, source string) (*WebhookNotifyChannel, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook url required")
+	}
+
+	timeout := cfg.Timeout.Duration()
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	retryBackoff := cfg.RetryBackoff.Duration()
+	if retryBackoff <= 0 {
+		retryBackoff = DefaultRetryBackoff
+	}
+
+	queuePath := cfg.QueuePath
+	if queuePath == "" {
+		queuePath = DefaultQueuePath
+	}
+
+	maxQueueSize := cfg.MaxQueueSize
+	if maxQueueSize <= 0 {
+		maxQueueSize = DefaultMaxQueueSize
+	}
+
+	flushInterval := cfg.FlushInterval.Duration()
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	log.WithField("url", cfg.URL).
+		WithField("events", cfg.Events).
+		WithField("queue_path", queuePath).
+		WithField("signed", cfg.Secret != "").
+		Info("create webhook notify channel")
+
+	return &WebhookNotifyChannel{
+		url:           cfg.URL,
+		secret:        cfg.Secret,
+		source:        source,
+		events:        cfg.Events,
+		maxRetries:    maxRetries,
+		retryBackoff:  retryBackoff,
+		flushInterval: flushInterval,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		queue: NewDiskQueue(queuePath, maxQueueSize),
+	}, nil
+}
+
+func (ch *WebhookNotifyChannel) GetID() string {
+	return "webhook"
+}
+
+// Start redelivers queued events periodically until ctx is done
+func (ch *WebhookNotifyChannel) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(ch.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ch.Flush(ctx)
+			}
+		}
+	}()
+}
+
+// Reply publishes a plain chat message
+func (ch *WebhookNotifyChannel) Reply(ctx context.Context, msg *types.Message) error {
+	return ch.Publish(ctx, types.NotifyEventMessage, msg)
+}
+
+// Publish delivers a structured event. Events that can not be delivered after
+// all retries are kept in the disk queue and redelivered later.
+func (ch *WebhookNotifyChannel) Publish(ctx context.Context, eventType string, data interface{}) error {
+	if len(ch.events) > 0 && !utils.Contains(ch.events, eventType) {
+		return nil
+	}
+
+	payload := &Payload{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		Source:    ch.source,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	ch.sendLock.Lock()
+	defer ch.sendLock.Unlock()
+
+	// Keep delivery order: new events wait behind the ones already queued
+	if ch.queue.Len() > 0 {
+		if err := ch.queue.Push(payload); err != nil {
+			return errors.Wrap(err, "queue event fail")
+		}
+
+		ch.drain(ctx)
+		return nil
+	}
+
+	err := ch.sendWithRetry(ctx, payload)
+	if err != nil {
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			return err
+		}
+
+		log.WithError(err).
+			WithField("type", payload.Type).
+			WithField("id", payload.ID).
+			Warn("webhook delivery failed, queue event on disk")
+
+		if qerr := ch.queue.Push(payload); qerr != nil {
+			return errors.Wrap(qerr, "queue event fail")
+		}
+	}
+
+	return nil
+}
+
+// Flush tries to deliver all queued events
+func (ch *WebhookNotifyChannel) Flush(ctx context.Context) {
+	ch.sendLock.Lock()
+	defer ch.sendLock.Unlock()
+
+	ch.drain(ctx)
+}
+
+func (ch *WebhookNotifyChannel) drain(ctx context.Context) {
+	sent, err := ch.queue.Drain(func(payload *Payload) error {
+		err := ch.send(ctx, payload)
+
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			log.WithError(err).WithField("id", payload.ID).Error("drop undeliverable webhook event")
+			return nil
+		}
+
+		return err
+	})
+
+	if sent > 0 {
+		log.WithField("sent", sent).Info("redelivered queued webhook events")
+	}
+
+	if err != nil {
+		log.WithError(err).Debug("webhook queue drain stopped")
+	}
+}
+
+func (ch *WebhookNotifyChannel) sendWithRetry(ctx context.Context, payload *Payload) error {
+	backoff := ch.retryBackoff
+
+	var err error
+	for attempt := 0; attempt <= ch.maxRetries; attempt++ {
+		err = ch.send(ctx, payload)
+		if err == nil {
+			return nil
+		}
+
+		var perr *permanentError
+		if errors.As(err, &perr) || attempt == ch.maxRetries {
+			break
+		}
+
+		log.WithError(err).
+			WithField("attempt", attempt+1).
+			WithField("backoff", backoff).
+			Warn("webhook delivery failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	return err
+}
+
+func (ch *WebhookNotifyChannel) send(ctx context.Context, payload *Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return &permanentError{err: errors.Wrap(err, "marshal payload fail")}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ch.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if ch.secret != "" {
+		req.Header.Set(HeaderSignature, Sign(ch.secret, timestamp, body))
+	}
+
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail, _ := io.ReadAll(resp.Body)
+	err = errors.Errorf("response error, status code: %d, detail: %s", resp.StatusCode, detail)
+
+	// Client errors other than rate limiting will not succeed on retry
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+
+	return err
+}
+
+// Sign returns the signature header value for a request body:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header produced by Sign
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yubing744/trading-gpt/pkg/config"
+	"github.com/yubing744/trading-gpt/pkg/types"
+
+	bbgotypes "github.com/c9s/bbgo/pkg/types"
+)
+
+func newTestChannel(t *testing.T, url string, events []string) *WebhookNotifyChannel {
+	ch, err := NewWebhookNotifyChannel(&config.NotifyWebhookConfig{
+		Enabled:      true,
+		URL:          url,
+		Secret:       "test-secret",
+		Events:       events,
+		MaxRetries:   2,
+		RetryBackoff: bbgotypes.Duration(time.Millisecond),
+		QueuePath:    t.TempDir(),
+	}, "jarvis:SUIUSDT")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return ch
+}
+
+func TestNewWebhookNotifyChannelRequiresURL(t *testing.T) {
+	_, err := NewWebhookNotifyChannel(&config.NotifyWebhookConfig{Enabled: true}, "jarvis:SUIUSDT")
+	assert.Error(t, err)
+}
+
+func TestPublishSignsPayload(t *testing.T) {
+	var received Payload
+	var verified bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified = Verify("test-secret", r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature))
+		assert.Equal(t, types.NotifyEventDecision, r.Header.Get(HeaderEvent))
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ch := newTestChannel(t, server.URL, nil)
+	err := ch.Publish(context.Background(), types.NotifyEventDecision, &types.DecisionNotifyData{
+		Symbol: "SUIUSDT",
+		Action: &types.Action{Name: "exchange.no_action"},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, verified)
+	assert.Equal(t, types.NotifyEventDecision, received.Type)
+	assert.Equal(t, "jarvis:SUIUSDT", received.Source)
+	assert.NotEmpty(t, received.ID)
+}
+
+func TestPublishFiltersEvents(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	ch := newTestChannel(t, server.URL, []string{types.NotifyEventPositionClosed})
+
+	assert.NoError(t, ch.Publish(context.Background(), types.NotifyEventOrder, map[string]string{}))
+	assert.NoError(t, ch.Publish(context.Background(), types.NotifyEventPositionClosed, map[string]string{}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestPublishRetriesThenSucceeds(t *testing.T) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}))
+	defer server.Close()
+
+	ch := newTestChannel(t, server.URL, nil)
+
+	assert.NoError(t, ch.Publish(context.Background(), types.NotifyEventOrder, map[string]string{"id": "1"}))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0, ch.queue.Len())
+}
+
+func TestPublishQueuesWhenEndpointDown(t *testing.T) {
+	var lock sync.Mutex
+	down := true
+	delivered := make([]string, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload Payload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		delivered = append(delivered, payload.Data.(map[string]interface{})["id"].(string))
+	}))
+	defer server.Close()
+
+	ch := newTestChannel(t, server.URL, nil)
+
+	assert.NoError(t, ch.Publish(context.Background(), types.NotifyEventOrder, map[string]string{"id": "1"}))
+	assert.NoError(t, ch.Publish(context.Background(), types.NotifyEventOrder, map[string]string{"id": "2"}))
+	assert.Equal(t, 2, ch.queue.Len())
+
+	lock.Lock()
+	down = false
+	lock.Unlock()
+
+	ch.Flush(context.Background())
+
+	assert.Equal(t, 0, ch.queue.Len())
+	assert.Equal(t, []string{"1", "2"}, delivered)
+}
+
+func TestPublishDropsOnClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	ch := newTestChannel(t, server.URL, nil)
+
+	err := ch.Publish(context.Background(), types.NotifyEventOrder, map[string]string{"id": "1"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, ch.queue.Len())
+}
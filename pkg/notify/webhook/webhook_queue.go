@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskQueue is a directory backed FIFO of payloads waiting for redelivery.
+// Every payload is stored in its own file so a crash can lose at most the
+// payload being written.
+type DiskQueue struct {
+	dir     string
+	maxSize int
+	lock    sync.Mutex
+}
+
+// NewDiskQueue creates a disk queue rooted at dir
+func NewDiskQueue(dir string, maxSize int) *DiskQueue {
+	return &DiskQueue{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+}
+
+// Push appends a payload to the queue, dropping the oldest entries when full
+func (q *DiskQueue) Push(payload *Payload) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), payload.ID)
+	tempPath := filepath.Join(q.dir, name+".tmp")
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename queue file: %w", err)
+	}
+
+	files, err := q.files()
+	if err != nil {
+		return err
+	}
+
+	if q.maxSize > 0 && len(files) > q.maxSize {
+		for _, file := range files[:len(files)-q.maxSize] {
+			log.WithField("file", file).Warn("webhook queue full, dropping oldest event")
+			os.Remove(filepath.Join(q.dir, file))
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of queued payloads
+func (q *DiskQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	files, err := q.files()
+	if err != nil {
+		return 0
+	}
+
+	return len(files)
+}
+
+// Drain delivers queued payloads in order until send fails. Delivered payloads
+// are removed, the first failing one and everything after it stay queued.
+func (q *DiskQueue) Drain(send func(payload *Payload) error) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	files, err := q.files()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, file := range files {
+		path := filepath.Join(q.dir, file)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return sent, fmt.Errorf("failed to read queue file: %w", err)
+		}
+
+		var payload Payload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			log.WithError(err).WithField("file", file).Warn("drop corrupted webhook queue file")
+			os.Remove(path)
+			continue
+		}
+
+		if err := send(&payload); err != nil {
+			return sent, err
+		}
+
+		os.Remove(path)
+		sent++
+	}
+
+	return sent, nil
+}
+
+// files lists queued payload files ordered from oldest to newest
+func (q *DiskQueue) files() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		files = append(files, entry.Name())
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
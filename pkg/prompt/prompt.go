@@ -1,26 +1,9 @@
 package prompt
 
-var ThoughtTpl = `{{if .MemoryEnabled}}
-=== Trading Memory ===
-{{if .Memory}}{{.Memory}}{{else}}No previous memory available.{{end}}
-
-=== Memory Management ===
-Memory word limit: {{.MaxWords}} words
-Current memory usage: {{.CurrentWords}} words ({{.MemoryUsagePercent}}% of limit)
-{{if .MemoryUsagePercent | lt 50}}
-💡 Memory has plenty of space - you can add new insights and experiences to expand your knowledge base.
-{{else if .MemoryUsagePercent | lt 80}}
-⚠️ Memory is getting full - focus on adding only the most important new insights while keeping content concise.
-{{else if .MemoryUsagePercent | lt 95}}
-🚨 Memory is nearly full - prioritize consolidating and summarizing existing knowledge rather than adding new content.
-{{else}}
-🔥 Memory is at critical capacity - you MUST consolidate, summarize, and remove less critical information to make room for essential new insights.
-{{end}}
-
-IMPORTANT: The strategy runs in cycles, and your memory resets at the beginning of each cycle. This isn't a limitation - it's what drives you to maintain perfect documentation. After each reset, you rely ENTIRELY on your Memory Part to understand the project and continue work effectively. Each cycle, you must output complete memory within the word limit to maintain continuity.
-
-{{end}}
-Analyze the data provided above, and step-by-step consider the only executable trade command based on the trading strategy provided below to maximize user profit.
+// InstructionsTpl renders the part of the prompt that stays the same across
+// cycles: commands, strategy, constraints and response format. It is sent
+// before the market data so providers can cache it as a prompt prefix.
+var InstructionsTpl = `Every cycle you receive the latest market data and must decide the only executable trade command based on the trading strategy below to maximize user profit.
 
 Commands:
 {{- range $index, $item := .ActionTips}}
@@ -41,7 +24,7 @@ The commands listed above follow the format "entity_id.command_name". To schedul
 3. Add any required arguments from the command's Args list
 
 **Available Entities:**
-- exchange: Trading operations (open_long_position, open_short_position, close_position, etc.)
+- exchange: Trading operations ({{if .SpotMode}}open_long_position, close_position{{else}}open_long_position, open_short_position, close_position{{end}}, etc.)
 - coze: Workflow execution (workflow names from configuration)
 - fng: Fear & Greed Index (refresh_index, get_historical_index)
 - twitterapi: Twitter search (search_tweets, or configured search items)
@@ -74,7 +57,17 @@ The commands listed above follow the format "entity_id.command_name". To schedul
 - From "coze.market_sentiment" → entity_id="coze", command_name="market_sentiment"
 - From "fng.refresh_index" → entity_id="fng", command_name="refresh_index"
 
-Commands in next_commands will execute before the next decision cycle starts, and results will be available as events/indicators in your next analysis.
+Commands in next_commands will execute before the next decision cycle starts. Your next analysis gets a "Result of the command you scheduled" message per command, pairing the request with its status and output.
+
+**Triggered commands:**
+Add a "trigger" to run a command when a condition is met instead of before the next cycle, set exactly one of:
+- "price": a boolean expression checked on every price update, with the live price close and last_open, last_high, last_low, last_volume, prev_close of the last closed klines, e.g. "close > 1.85"
+- "at": an RFC3339 time, e.g. "2025-01-23T16:00:00Z"
+- "cycles": the number of decision cycles to wait, e.g. 3
+- "event": an entity event, e.g. "position_closed"
+and optionally "expires_in", such as "4h", after which the command is dropped (default 24h).
+For example, open a long only if the breakout is confirmed:
+{"entity_id": "exchange", "command_name": "open_long_position", "args": {"stop_loss_trigger_price": "1.80"}, "trigger": {"price": "close > 1.85", "expires_in": "4h"}}
 
 Trading strategy:
 {{.Strategy}}
@@ -94,6 +87,9 @@ Constraints:
 5、The analyze statement can be very long to ensure that the reasoning process of the analysis is rigorous.
 6、When comparing two numbers, if a digit in the decimal part is already greater, there's no need to compare the subsequent digits.
 7、The returned JSON format does not support comments
+{{- if .SpotMode}}
+8、The account is spot-only: positions are long only and not leveraged. Buy with the quote balance and sell the base you hold, there is no short selling.
+{{- end}}
 
 {{if .MemoryEnabled}}
 You should only respond in JSON format as described below, no other explanation is required
@@ -107,8 +103,15 @@ Response Format:
         "speak": "thoughts summary to say to user"
     },
     "action": {"name": "command name", "args": {"arg name": "value"}},
+{{- if .MemorySections}}
+    "memory": {"sections": {"section name": {"content": "new content of the whole section", "append": ["new entry of an append section"], "merge": {"entry key": "entry of a merge section, empty string removes the key"}}}},  // optional: only the sections to change
+{{- else}}
     "memory": {"content": "memory content to save, keep concise and within reasonable word limit"},
-    "next_commands": [{"entity_id": "entity_id", "command_name": "command_name", "args": {"arg_name": "value"}}]  // optional: commands to execute in next cycle
+{{- end}}
+    "next_commands": [{"entity_id": "entity_id", "command_name": "command_name", "args": {"arg_name": "value"}}]{{if .KnowledgeEnabled}},{{end}}  // optional: commands to execute in next cycle or on a trigger
+{{- if .KnowledgeEnabled}}
+    "knowledge": [{"scope": "global, asset or symbol", "key": "short lesson ID", "text": "lesson, empty string removes the key"}]  // optional: lessons shared with the other trading instances
+{{- end}}
 }
 {{else}}
 You should only respond in JSON format as described below, no other explanation is required
@@ -122,9 +125,60 @@ Response Format:
         "speak": "thoughts summary to say to user"
     },
     "action": {"name": "command name", "args": {"arg name": "value"}},
-    "next_commands": [{"entity_id": "entity_id", "command_name": "command_name", "args": {"arg_name": "value"}}]  // optional: commands to execute in next cycle
+    "next_commands": [{"entity_id": "entity_id", "command_name": "command_name", "args": {"arg_name": "value"}}]{{if .KnowledgeEnabled}},{{end}}  // optional: commands to execute in next cycle or on a trigger
+{{- if .KnowledgeEnabled}}
+    "knowledge": [{"scope": "global, asset or symbol", "key": "short lesson ID", "text": "lesson, empty string removes the key"}]  // optional: lessons shared with the other trading instances
+{{- end}}
 }
 {{end}}
 
+{{if .KnowledgeEnabled}}
+Shared knowledge:
+Lessons in "knowledge" are shared with the other trading instances on this host, the shared knowledge is part of the market data. Share only durable lessons that hold beyond this cycle: "symbol" for this symbol, "asset" for its asset class and "global" for every market. Reuse the key of an existing lesson to refine it.
+{{end}}
 Ensure the response can be parsed by golang json.Unmarshal
 `
+
+// ThoughtTpl renders the part of the prompt that changes every cycle, it is
+// sent after the market data
+var ThoughtTpl = `{{if .MemoryEnabled}}
+=== Trading Memory ===
+{{- if .MemorySections}}
+{{range .MemorySections}}
+--- {{.Title}} (section "{{.Name}}", {{.Mode}}, {{.Words}}/{{.MaxWords}} words) ---
+{{if .Content}}{{.Content}}{{else}}Empty.{{end}}
+{{end}}
+{{- if .Memory}}
+--- Other Notes ---
+{{.Memory}}
+{{end}}
+{{- else}}
+{{if .Memory}}{{.Memory}}{{else}}No previous memory available.{{end}}
+{{end}}
+
+=== Memory Management ===
+Memory word limit: {{.MaxWords}} words
+Current memory usage: {{.CurrentWords}} words ({{.MemoryUsagePercent}}% of limit)
+{{if .MemoryUsagePercent | lt 50}}
+💡 Memory has plenty of space - you can add new insights and experiences to expand your knowledge base.
+{{else if .MemoryUsagePercent | lt 80}}
+⚠️ Memory is getting full - focus on adding only the most important new insights while keeping content concise.
+{{else if .MemoryUsagePercent | lt 95}}
+🚨 Memory is nearly full - prioritize consolidating and summarizing existing knowledge rather than adding new content.
+{{else}}
+🔥 Memory is at critical capacity - you MUST consolidate, summarize, and remove less critical information to make room for essential new insights.
+{{end}}
+
+IMPORTANT: The strategy runs in cycles, and your memory resets at the beginning of each cycle. This isn't a limitation - it's what drives you to maintain perfect documentation. After each reset, you rely ENTIRELY on your Memory Part to understand the project and continue work effectively.
+{{- if .MemorySections}} Update only the sections that changed, each within its own word limit:
+{{- range .MemorySections}}
+- "{{.Name}}": {{.Description}}. {{if eq .Mode "merge"}}Set or remove entries by key with "merge".{{else if eq .Mode "append"}}Add entries with "append", the oldest are dropped when full.{{else}}Rewrite it with "content".{{end}}
+{{- end}}
+"content" rewrites any section as a whole, use it to consolidate a full section.
+{{- else}} Each cycle, you must output complete memory within the word limit to maintain continuity.
+{{- end}}
+
+{{end}}
+Analyze the data provided above, and step-by-step consider the only executable trade command based on the trading strategy given in the instructions to maximize user profit.
+Respond only in the JSON Response Format described in the instructions.
+`
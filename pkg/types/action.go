@@ -21,6 +21,7 @@ type ActionDesc struct {
 	Description string
 	Args        []ArgmentDesc
 	Samples     []Sample
+	Role        string // Minimum role required to execute the action, empty means viewer
 }
 
 type Action struct {
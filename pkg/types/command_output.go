@@ -0,0 +1,65 @@
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+type commandOutputKey struct{}
+
+// CommandOutput collects the events a scheduled command emits, so they are
+// reported with the command instead of as unrelated events
+type CommandOutput struct {
+	commandID string
+
+	mu     sync.Mutex
+	events []IEvent
+}
+
+// WithCommandOutput returns a copy of ctx collecting the output of the command commandID
+func WithCommandOutput(ctx context.Context, commandID string) (context.Context, *CommandOutput) {
+	output := &CommandOutput{commandID: commandID}
+	return context.WithValue(ctx, commandOutputKey{}, output), output
+}
+
+// CommandOutputFromContext returns the output collector stored in ctx, if any
+func CommandOutputFromContext(ctx context.Context) (*CommandOutput, bool) {
+	output, ok := ctx.Value(commandOutputKey{}).(*CommandOutput)
+	return output, ok && output != nil
+}
+
+// CommandID returns the ID of the command the output belongs to
+func (o *CommandOutput) CommandID() string {
+	return o.commandID
+}
+
+// Add collects an event of the command
+func (o *CommandOutput) Add(evt IEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events = append(o.events, evt)
+}
+
+// Events returns the collected events in emit order
+func (o *CommandOutput) Events() []IEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]IEvent{}, o.events...)
+}
+
+// EmitEvent sends the event of a command handler. The events of a scheduled
+// command go to its output collector, tagged with the command ID, other
+// events go to ch.
+func EmitEvent(ctx context.Context, ch chan IEvent, evt IEvent) {
+	if output, ok := CommandOutputFromContext(ctx); ok {
+		if tagged, ok := evt.(interface{ SetCommandID(id string) }); ok {
+			tagged.SetCommandID(output.CommandID())
+		}
+		output.Add(evt)
+		return
+	}
+
+	ch <- evt
+}
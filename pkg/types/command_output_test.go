@@ -0,0 +1,26 @@
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmitEvent(t *testing.T) {
+	ch := make(chan IEvent, 1)
+
+	// Without a collector the event goes to the channel
+	EmitEvent(context.Background(), ch, NewEvent("fng_changed", nil))
+	evt := <-ch
+	assert.Equal(t, "", evt.(*Event).GetCommandID())
+
+	// A scheduled command collects its events, tagged with its ID
+	ctx, output := WithCommandOutput(context.Background(), "cmd-1")
+	EmitEvent(ctx, ch, NewEvent("fng_historical_data", nil))
+
+	assert.Len(t, ch, 0)
+	events := output.Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "cmd-1", events[0].(*Event).GetCommandID())
+}
@@ -12,9 +12,10 @@ type IEvent interface {
 }
 
 type Event struct {
-	id    string
-	ttype string
-	data  interface{}
+	id        string
+	ttype     string
+	data      interface{}
+	commandID string
 }
 
 func NewEvent(ty string, data interface{}) *Event {
@@ -37,6 +38,15 @@ func (e *Event) GetData() interface{} {
 	return e.data
 }
 
+// GetCommandID returns the ID of the scheduled command the event is the output of
+func (e *Event) GetCommandID() string {
+	return e.commandID
+}
+
+func (e *Event) SetCommandID(id string) {
+	e.commandID = id
+}
+
 func (e *Event) ToPrompts() []string {
 	return []string{}
 }
@@ -1,6 +1,29 @@
 package types
 
+// Prompt sections a message belongs to, used to budget the context window
+const (
+	SectionInstructions = "instructions" // Same every cycle, sent first so providers can cache it
+	SectionKlines       = "klines"
+	SectionIndicators   = "indicators"
+	SectionNews         = "news"
+	SectionCommands     = "commands" // Outcomes and output of the scheduled commands
+	SectionMemory       = "memory"
+	SectionEpisodes     = "episodes"
+	SectionKnowledge    = "knowledge"
+	SectionHistory      = "history"
+)
+
 type Message struct {
-	ID   string `json:"id"`
-	Text string `json:"text"`
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	UserID  string `json:"user_id,omitempty"` // Sender of a chat message, empty for system messages
+	Section string `json:"section,omitempty"` // Prompt section, empty messages are never shrunk
+	Image   *Image `json:"image,omitempty"`   // Sent to vision models and posted by channels supporting images
+}
+
+// Image is an image attached to a message, such as a rendered chart
+type Image struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Data     []byte `json:"-"`
 }
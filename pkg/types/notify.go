@@ -1,8 +1,37 @@
 package types
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// Trade event types published to event notify channels
+const (
+	NotifyEventMessage        = "message"
+	NotifyEventDecision       = "decision"
+	NotifyEventOrder          = "order"
+	NotifyEventPositionClosed = "position_closed"
+)
 
 type INotifyChannel interface {
 	GetID() string
 	Reply(ctx context.Context, msg *Message) error
 }
+
+// IEventNotifyChannel is a notify channel that accepts structured trade events
+// in addition to plain text replies.
+type IEventNotifyChannel interface {
+	INotifyChannel
+
+	Publish(ctx context.Context, eventType string, data interface{}) error
+}
+
+// DecisionNotifyData is the payload published for every parsed agent decision
+type DecisionNotifyData struct {
+	Symbol       string         `json:"symbol"`
+	Model        string         `json:"model,omitempty"`
+	Action       *Action        `json:"action,omitempty"`
+	Thoughts     *Thoughts      `json:"thoughts,omitempty"`
+	NextCommands []*NextCommand `json:"next_commands,omitempty"`
+	Timestamp    time.Time      `json:"timestamp"`
+}
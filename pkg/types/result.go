@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -52,11 +53,35 @@ type Result struct {
 	Action       *Action        `json:"action"`
 	Memory       *Memory        `json:"memory,omitempty"`        // Memory field
 	NextCommands []*NextCommand `json:"next_commands,omitempty"` // Commands to execute in next cycle
+	Knowledge    []*Knowledge   `json:"knowledge,omitempty"`     // Lessons shared with the other instances
+}
+
+// Knowledge scopes of the knowledge output, relative to the instance
+const (
+	KnowledgeScopeGlobal = "global" // All instances
+	KnowledgeScopeAsset  = "asset"  // Instances trading the same asset class
+	KnowledgeScopeSymbol = "symbol" // Instances trading the same symbol
+)
+
+// Knowledge is a lesson for the shared knowledge base, an empty text removes it
+type Knowledge struct {
+	Scope string `json:"scope"` // KnowledgeScopeGlobal, KnowledgeScopeAsset or KnowledgeScopeSymbol
+	Key   string `json:"key"`   // Short ID, reusing a key updates the lesson
+	Text  string `json:"text"`
 }
 
 // Memory represents memory content for AI learning
 type Memory struct {
-	Content string `json:"content"` // Memory content
+	Content  string                          `json:"content,omitempty"`  // Memory content, replaces the whole memory
+	Sections map[string]*MemorySectionUpdate `json:"sections,omitempty"` // Updates of structured memory sections by name
+}
+
+// MemorySectionUpdate changes one section of the structured memory, content
+// rewrites the section, append and merge follow the section's update mode
+type MemorySectionUpdate struct {
+	Content string            `json:"content,omitempty"` // New content of the whole section
+	Append  []string          `json:"append,omitempty"`  // Entries added to an append section
+	Merge   map[string]string `json:"merge,omitempty"`   // Entries of a merge section by key, an empty value removes the key
 }
 
 // ToHumanText converts Memory to human-readable string
@@ -64,12 +89,69 @@ func (m *Memory) ToHumanText() string {
 	if m == nil {
 		return ""
 	}
-	return m.Content
+
+	if len(m.Sections) == 0 {
+		return m.Content
+	}
+
+	names := make([]string, 0, len(m.Sections))
+	for name := range m.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0)
+	if m.Content != "" {
+		lines = append(lines, m.Content)
+	}
+	for _, name := range names {
+		update := m.Sections[name]
+		if update == nil {
+			continue
+		}
+		if update.Content != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, update.Content))
+		}
+		for _, entry := range update.Append {
+			lines = append(lines, fmt.Sprintf("%s += %s", name, entry))
+		}
+
+		keys := make([]string, 0, len(update.Merge))
+		for key := range update.Merge {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if update.Merge[key] == "" {
+				lines = append(lines, fmt.Sprintf("%s[%s] removed", name, key))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s[%s] = %s", name, key, update.Merge[key]))
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Empty reports whether the memory output changes nothing
+func (m *Memory) Empty() bool {
+	return m == nil || (m.Content == "" && len(m.Sections) == 0)
 }
 
 // NextCommand represents a command to be executed in the next decision cycle
 type NextCommand struct {
-	EntityID    string            `json:"entity_id"`    // Target entity ID (e.g., "exchange", "coze")
-	CommandName string            `json:"command_name"` // Command name (matches ActionDesc.Name)
-	Args        map[string]string `json:"args"`         // Command parameters
+	EntityID    string            `json:"entity_id"`         // Target entity ID (e.g., "exchange", "coze")
+	CommandName string            `json:"command_name"`      // Command name (matches ActionDesc.Name)
+	Args        map[string]string `json:"args"`              // Command parameters
+	Trigger     *CommandTrigger   `json:"trigger,omitempty"` // Condition to run on instead of the next cycle
+}
+
+// CommandTrigger is the condition a scheduled command waits for, exactly one
+// of price, at, cycles and event is set
+type CommandTrigger struct {
+	Price     string `json:"price,omitempty"`      // Boolean price expression checked on every price update, e.g. "close > 1.85"
+	At        string `json:"at,omitempty"`         // RFC3339 time to run at
+	Cycles    int    `json:"cycles,omitempty"`     // Decision cycles to wait, 1 is the next cycle
+	Event     string `json:"event,omitempty"`      // Entity event to run on, e.g. position_closed
+	ExpiresIn string `json:"expires_in,omitempty"` // Duration after which the command is dropped, e.g. 4h
 }
@@ -1,5 +1,43 @@
 package types
 
 const (
-	RoleAdmin = "admim"
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
 )
+
+// roleLevels orders roles from least to most privileged, a higher role
+// implies all permissions of the lower ones
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleSatisfies reports whether role grants the permissions of required.
+// An empty required role is satisfied by anyone.
+func RoleSatisfies(role string, required string) bool {
+	if required == "" {
+		return true
+	}
+
+	return roleLevels[role] >= roleLevels[required] && IsValidRole(required)
+}
+
+// HighestRole returns the most privileged role of roles, or empty if none is valid
+func HighestRole(roles []string) string {
+	highest := ""
+	for _, role := range roles {
+		if roleLevels[role] > roleLevels[highest] {
+			highest = role
+		}
+	}
+
+	return highest
+}
@@ -12,5 +12,6 @@ type ISession interface {
 	SetAttribute(name string, value interface{})
 	RemoveAttribute(name string)
 	SetRoles(role []string)
+	GetRoles() []string
 	HasRole(role string) bool
 }
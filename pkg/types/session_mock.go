@@ -68,12 +68,11 @@ func (s *MockSession) SetRoles(roles []string) {
 	s.roles = roles
 }
 
-func (s *MockSession) HasRole(role string) bool {
-	for _, r := range s.roles {
-		if r == role {
-			return true
-		}
-	}
+func (s *MockSession) GetRoles() []string {
+	return s.roles
+}
 
-	return false
+// HasRole reports whether the session holds role or a more privileged one
+func (s *MockSession) HasRole(role string) bool {
+	return RoleSatisfies(HighestRole(s.roles), role)
 }
@@ -36,10 +36,14 @@ func ArgToFixedpoint(vm *goja.Runtime, arg string) (*fixedpoint.Value, error) {
 		return nil, err
 	}
 
-	num, ok := v.Export().(float64)
-	if ok {
+	switch num := v.Export().(type) {
+	case float64:
 		val := fixedpoint.NewFromFloat(num)
 		return &val, nil
+	case int64:
+		// Whole numbers such as "2950" export as integers
+		val := fixedpoint.NewFromInt(num)
+		return &val, nil
 	}
 
 	return nil, nil
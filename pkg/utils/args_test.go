@@ -63,3 +63,10 @@ func TestArgToFixedpointWithExpress(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 2.44, val.Float64())
 }
+
+func TestArgToFixedpointWithInteger(t *testing.T) {
+	vm := goja.New()
+	val, err := ArgToFixedpoint(vm, "2950")
+	assert.NoError(t, err)
+	assert.Equal(t, 2950.0, val.Float64())
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/c9s/bbgo/pkg/fixedpoint"
@@ -15,7 +16,53 @@ func ParsePrice(vm *goja.Runtime, klines *types.KLineWindow, closePrice fixedpoi
 		return nil, nil
 	}
 
-	// Set up JavaScript context with available variables
+	setPriceVars(vm, klines, closePrice)
+	return ArgToFixedpoint(vm, expr)
+}
+
+// EvalCondition evaluates a boolean price expression such as "close > 1.85"
+// with the same variables as ParsePrice
+func EvalCondition(vm *goja.Runtime, klines *types.KLineWindow, closePrice fixedpoint.Value, expr string) (bool, error) {
+	setPriceVars(vm, klines, closePrice)
+
+	v, err := vm.RunString(expr)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := v.Export().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q is not a boolean expression", expr)
+	}
+
+	return result, nil
+}
+
+// ValidateCondition checks that expr is a boolean price expression, it is
+// evaluated on a flat sample market
+func ValidateCondition(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty condition")
+	}
+
+	if _, err := goja.Compile("condition", expr, true); err != nil {
+		return fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+
+	price := fixedpoint.NewFromFloat(1)
+	sample := types.KLineWindow{
+		{Open: price, High: price, Low: price, Close: price},
+		{Open: price, High: price, Low: price, Close: price},
+	}
+	if _, err := EvalCondition(goja.New(), &sample, price, expr); err != nil {
+		return fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+
+	return nil
+}
+
+// setPriceVars sets up the JavaScript context with the available variables
+func setPriceVars(vm *goja.Runtime, klines *types.KLineWindow, closePrice fixedpoint.Value) {
 	vm.Set("last_close", closePrice.Float64())
 	vm.Set("close", closePrice.Float64())
 
@@ -34,6 +81,4 @@ func ParsePrice(vm *goja.Runtime, klines *types.KLineWindow, closePrice fixedpoi
 			vm.Set("prev_close", prevKline.Close.Float64())
 		}
 	}
-
-	return ArgToFixedpoint(vm, expr)
 }
@@ -131,3 +131,30 @@ func TestParsePrice_InvalidExpression(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, price)
 }
+
+func TestEvalCondition(t *testing.T) {
+	vm := goja.New()
+	klines := types.KLineWindow{
+		{Close: fixedpoint.NewFromFloat(1.80), High: fixedpoint.NewFromFloat(1.82)},
+		{Close: fixedpoint.NewFromFloat(1.86), High: fixedpoint.NewFromFloat(1.90)},
+	}
+
+	ok, err := EvalCondition(vm, &klines, fixedpoint.NewFromFloat(1.86), "close > 1.85 && prev_close < 1.85")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = EvalCondition(vm, &klines, fixedpoint.NewFromFloat(1.86), "last_high >= 2")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = EvalCondition(vm, &klines, fixedpoint.NewFromFloat(1.86), "close * 2")
+	assert.Error(t, err)
+}
+
+func TestValidateCondition(t *testing.T) {
+	assert.NoError(t, ValidateCondition("close > 1.85"))
+	assert.Error(t, ValidateCondition(""))
+	assert.Error(t, ValidateCondition("close >"))
+	assert.Error(t, ValidateCondition("close + 1"))
+	assert.Error(t, ValidateCondition("unknown_var > 1"))
+}